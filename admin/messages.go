@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// The messages of admin.proto. Like the messages of _lifecycle in the blockchain package, they are written
+// by hand: protoc isn't part of the build.
+
+type InstallRequest struct{}
+
+func (m *InstallRequest) Reset()			{ *m = InstallRequest{} }
+func (m *InstallRequest) String() string	{ return proto.CompactTextString(m) }
+func (*InstallRequest) ProtoMessage()		{}
+
+type InstallResponse struct{}
+
+func (m *InstallResponse) Reset()			{ *m = InstallResponse{} }
+func (m *InstallResponse) String() string	{ return proto.CompactTextString(m) }
+func (*InstallResponse) ProtoMessage()		{}
+
+type InstantiateRequest struct {
+	Args	[]string	`protobuf:"bytes,1,rep,name=args"`
+}
+
+func (m *InstantiateRequest) Reset()			{ *m = InstantiateRequest{} }
+func (m *InstantiateRequest) String() string	{ return proto.CompactTextString(m) }
+func (*InstantiateRequest) ProtoMessage()		{}
+
+type InstantiateResponse struct{}
+
+func (m *InstantiateResponse) Reset()			{ *m = InstantiateResponse{} }
+func (m *InstantiateResponse) String() string	{ return proto.CompactTextString(m) }
+func (*InstantiateResponse) ProtoMessage()		{}
+
+type UpgradeRequest struct {
+	Version	string		`protobuf:"bytes,1,opt,name=version"`
+	Args	[][]byte	`protobuf:"bytes,2,rep,name=args"`
+}
+
+func (m *UpgradeRequest) Reset()			{ *m = UpgradeRequest{} }
+func (m *UpgradeRequest) String() string	{ return proto.CompactTextString(m) }
+func (*UpgradeRequest) ProtoMessage()		{}
+
+type UpgradeResponse struct{}
+
+func (m *UpgradeResponse) Reset()			{ *m = UpgradeResponse{} }
+func (m *UpgradeResponse) String() string	{ return proto.CompactTextString(m) }
+func (*UpgradeResponse) ProtoMessage()		{}
+
+type ChaincodeRequest struct {
+	Function		string				`protobuf:"bytes,1,opt,name=function"`
+	Args			[]string			`protobuf:"bytes,2,rep,name=args"`
+	TransientMap	map[string][]byte	`protobuf:"bytes,3,rep,name=transient_map,json=transientMap" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Identity		string				`protobuf:"bytes,4,opt,name=identity"`
+}
+
+func (m *ChaincodeRequest) Reset()			{ *m = ChaincodeRequest{} }
+func (m *ChaincodeRequest) String() string	{ return proto.CompactTextString(m) }
+func (*ChaincodeRequest) ProtoMessage()		{}
+
+type InvokeResponse struct {
+	TxID	string	`protobuf:"bytes,1,opt,name=tx_id,json=txId"`
+}
+
+func (m *InvokeResponse) Reset()			{ *m = InvokeResponse{} }
+func (m *InvokeResponse) String() string	{ return proto.CompactTextString(m) }
+func (*InvokeResponse) ProtoMessage()		{}
+
+type QueryResponse struct {
+	Payload	[]byte	`protobuf:"bytes,1,opt,name=payload,proto3"`
+}
+
+func (m *QueryResponse) Reset()			{ *m = QueryResponse{} }
+func (m *QueryResponse) String() string	{ return proto.CompactTextString(m) }
+func (*QueryResponse) ProtoMessage()		{}
+
+type ChaincodeEventsRequest struct {
+	EventName	string	`protobuf:"bytes,1,opt,name=event_name,json=eventName"`
+}
+
+func (m *ChaincodeEventsRequest) Reset()			{ *m = ChaincodeEventsRequest{} }
+func (m *ChaincodeEventsRequest) String() string	{ return proto.CompactTextString(m) }
+func (*ChaincodeEventsRequest) ProtoMessage()		{}
+
+type ChaincodeEvent struct {
+	ChaincodeID	string	`protobuf:"bytes,1,opt,name=chaincode_id,json=chaincodeId"`
+	TxID		string	`protobuf:"bytes,2,opt,name=tx_id,json=txId"`
+	Payload		[]byte	`protobuf:"bytes,3,opt,name=payload,proto3"`
+}
+
+func (m *ChaincodeEvent) Reset()			{ *m = ChaincodeEvent{} }
+func (m *ChaincodeEvent) String() string	{ return proto.CompactTextString(m) }
+func (*ChaincodeEvent) ProtoMessage()		{}
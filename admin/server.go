@@ -0,0 +1,246 @@
+// Package admin serves the administrative gRPC API of heroes-service, defined in admin.proto: the deployment
+// of the chaincode, its invokes and queries and the streaming of its events, so other languages and the tooling
+// of the operators drive the setup without linking the Go SDK.
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"github.com/chainhero/heroes-service/blockchain"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const defaultEventBuffer = 64
+
+// Server implements the service Admin over the setup
+type Server struct {
+	Setup		*blockchain.FabricSetup
+	Token		string				// Bearer token of the calls, required
+	EventBuffer	int					// Events kept for a slow ChaincodeEvents stream before it ends, 64 when not set
+	Logger		blockchain.Logger	// A StdLogger when not set
+}
+
+// NewGRPCServer returns a gRPC server serving the service Admin, which refuses the calls without the token
+func (server *Server) NewGRPCServer(options ...grpc.ServerOption) (*grpc.Server, error) {
+	if server.Token == "" {
+		return nil, errors.New("The token of the administrative API is missing")
+	}
+	options = append(options, grpc.UnaryInterceptor(server.authorizeUnary), grpc.StreamInterceptor(server.authorizeStream))
+	grpcServer := grpc.NewServer(options...)
+	RegisterAdminServer(grpcServer, server)
+	return grpcServer, nil
+}
+
+// Install installs the chaincode of the setup on the peers of the organisation
+func (server *Server) Install(ctx context.Context, in *InstallRequest) (*InstallResponse, error) {
+	if err := server.checkInitialized(); err != nil {
+		return nil, err
+	}
+	if err := server.Setup.InstallCC(); err != nil {
+		return nil, server.statusError("Install", err)
+	}
+	return &InstallResponse{}, nil
+}
+
+// Instantiate instantiates the installed chaincode, with the default arguments of the setup when none is given
+func (server *Server) Instantiate(ctx context.Context, in *InstantiateRequest) (*InstantiateResponse, error) {
+	if err := server.checkInitialized(); err != nil {
+		return nil, err
+	}
+	var args []string
+	if len(in.Args) > 0 {
+		args = in.Args
+	}
+	if err := server.Setup.InstantiateCC(args); err != nil {
+		return nil, server.statusError("Instantiate", err)
+	}
+	return &InstantiateResponse{}, nil
+}
+
+// Upgrade upgrades the chaincode to the version
+func (server *Server) Upgrade(ctx context.Context, in *UpgradeRequest) (*UpgradeResponse, error) {
+	if err := server.checkInitialized(); err != nil {
+		return nil, err
+	}
+	if in.Version == "" {
+		return nil, status.Error(codes.InvalidArgument, "The version is missing")
+	}
+	var args [][]byte
+	if len(in.Args) > 0 {
+		args = in.Args
+	}
+	if err := server.Setup.UpgradeCCWithContext(ctx, in.Version, args); err != nil {
+		return nil, server.statusError("Upgrade", err)
+	}
+	return &UpgradeResponse{}, nil
+}
+
+// Invoke invokes the chaincode and answers once the transaction is committed
+func (server *Server) Invoke(ctx context.Context, in *ChaincodeRequest) (*InvokeResponse, error) {
+	if err := server.checkChaincodeRequest(in); err != nil {
+		return nil, err
+	}
+	txID, err := server.Setup.InvokeWith(ctx, in.Function, in.Args, callOptions(in)...)
+	if err != nil {
+		return nil, server.statusError("Invoke", err)
+	}
+	return &InvokeResponse{TxID: txID}, nil
+}
+
+// Query queries the chaincode
+func (server *Server) Query(ctx context.Context, in *ChaincodeRequest) (*QueryResponse, error) {
+	if err := server.checkChaincodeRequest(in); err != nil {
+		return nil, err
+	}
+	payload, err := server.Setup.QueryWith(ctx, in.Function, in.Args, callOptions(in)...)
+	if err != nil {
+		return nil, server.statusError("Query", err)
+	}
+	return &QueryResponse{Payload: payload}, nil
+}
+
+// ChaincodeEvents streams the events of the chaincode until the call is cancelled. The stream ends with
+// ResourceExhausted when the client doesn't read the events fast enough: the handlers of the event hub can't wait.
+func (server *Server) ChaincodeEvents(in *ChaincodeEventsRequest, stream Admin_ChaincodeEventsServer) error {
+	if err := server.checkInitialized(); err != nil {
+		return err
+	}
+	eventName := in.EventName
+	if eventName == "" {
+		eventName = ".*"
+	}
+	size := server.EventBuffer
+	if size == 0 {
+		size = defaultEventBuffer
+	}
+	events := make(chan *ChaincodeEvent, size)
+	overflow := make(chan struct{})
+	var overflowed bool
+	registration, err := server.Setup.RegisterChaincodeEvent(eventName, func(ccID string, txID string, payload []byte) {
+		if overflowed {
+			return
+		}
+		select {
+		case events <- &ChaincodeEvent{ChaincodeID: ccID, TxID: txID, Payload: payload}:
+		default:
+			overflowed = true
+			close(overflow)
+		}
+	})
+	if err != nil {
+		return server.statusError("ChaincodeEvents", err)
+	}
+	defer registration.Unregister()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-overflow:
+			return status.Errorf(codes.ResourceExhausted, "More than %d events are waiting to be sent", size)
+		case event := <-events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// authorizeUnary refuses the unary calls without the token
+func (server *Server) authorizeUnary(ctx context.Context, in interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := server.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, in)
+}
+
+// authorizeStream refuses the streaming calls without the token
+func (server *Server) authorizeStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := server.authorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// authorize checks the "authorization" metadata of the call, "Bearer <token>"
+func (server *Server) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md["authorization"] {
+		token := strings.TrimPrefix(value, "Bearer ")
+		if token != value && subtle.ConstantTimeCompare([]byte(token), []byte(server.Token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "The bearer token is missing or invalid")
+}
+
+func (server *Server) checkInitialized() error {
+	if !server.Setup.Initialized {
+		return status.Error(codes.Unavailable, "The setup is not initialized")
+	}
+	return nil
+}
+
+func (server *Server) checkChaincodeRequest(in *ChaincodeRequest) error {
+	if err := server.checkInitialized(); err != nil {
+		return err
+	}
+	if in.Function == "" {
+		return status.Error(codes.InvalidArgument, "The function is missing")
+	}
+	return nil
+}
+
+// callOptions returns the options of the call for the identity and the transient map of the request
+func callOptions(in *ChaincodeRequest) []blockchain.CallOption {
+	var options []blockchain.CallOption
+	if in.Identity != "" {
+		options = append(options, blockchain.WithIdentity(in.Identity))
+	}
+	if len(in.TransientMap) > 0 {
+		options = append(options, blockchain.WithTransientMap(in.TransientMap))
+	}
+	return options
+}
+
+// statusError logs the error of the method and returns it with its gRPC code
+func (server *Server) statusError(method string, err error) error {
+	server.logger().Errorf("Admin API %s failed: %v", method, err)
+	return status.Error(errorCode(err), err.Error())
+}
+
+// errorCode returns the gRPC code of the error of the setup, see blockchain.KindOf
+func errorCode(err error) codes.Code {
+	switch blockchain.KindOf(err) {
+	case blockchain.KindConflict:
+		return codes.Aborted
+	case blockchain.KindTimeout:
+		return codes.DeadlineExceeded
+	case blockchain.KindCanceled:
+		return codes.Canceled
+	case blockchain.KindNotFound:
+		return codes.NotFound
+	case blockchain.KindAlreadyExists:
+		return codes.AlreadyExists
+	case blockchain.KindUnavailable:
+		return codes.Unavailable
+	case blockchain.KindEndorsementFailed:
+		return codes.FailedPrecondition
+	case blockchain.KindInvalidArgument:
+		return codes.InvalidArgument
+	}
+	return codes.Unknown
+}
+
+// logger returns the logger of the server, a StdLogger when not set
+func (server *Server) logger() blockchain.Logger {
+	if server.Logger == nil {
+		return blockchain.StdLogger{}
+	}
+	return server.Logger
+}
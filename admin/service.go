@@ -0,0 +1,171 @@
+package admin
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// The service Admin of admin.proto, written by hand like the messages
+
+// AdminServer is the server of the service Admin, see Server
+type AdminServer interface {
+	Install(context.Context, *InstallRequest) (*InstallResponse, error)
+	Instantiate(context.Context, *InstantiateRequest) (*InstantiateResponse, error)
+	Upgrade(context.Context, *UpgradeRequest) (*UpgradeResponse, error)
+	Invoke(context.Context, *ChaincodeRequest) (*InvokeResponse, error)
+	Query(context.Context, *ChaincodeRequest) (*QueryResponse, error)
+	ChaincodeEvents(*ChaincodeEventsRequest, Admin_ChaincodeEventsServer) error
+}
+
+// Admin_ChaincodeEventsServer sends the events streamed by ChaincodeEvents
+type Admin_ChaincodeEventsServer interface {
+	Send(*ChaincodeEvent) error
+	grpc.ServerStream
+}
+
+// RegisterAdminServer registers the server of the service Admin on the gRPC server
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&adminServiceDesc, srv)
+}
+
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName:	"heroes.admin.Admin",
+	HandlerType:	(*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Install", Handler: unaryHandler("Install", func() interface{} { return new(InstallRequest) }, func(srv AdminServer, ctx context.Context, in interface{}) (interface{}, error) {
+			return srv.Install(ctx, in.(*InstallRequest))
+		})},
+		{MethodName: "Instantiate", Handler: unaryHandler("Instantiate", func() interface{} { return new(InstantiateRequest) }, func(srv AdminServer, ctx context.Context, in interface{}) (interface{}, error) {
+			return srv.Instantiate(ctx, in.(*InstantiateRequest))
+		})},
+		{MethodName: "Upgrade", Handler: unaryHandler("Upgrade", func() interface{} { return new(UpgradeRequest) }, func(srv AdminServer, ctx context.Context, in interface{}) (interface{}, error) {
+			return srv.Upgrade(ctx, in.(*UpgradeRequest))
+		})},
+		{MethodName: "Invoke", Handler: unaryHandler("Invoke", func() interface{} { return new(ChaincodeRequest) }, func(srv AdminServer, ctx context.Context, in interface{}) (interface{}, error) {
+			return srv.Invoke(ctx, in.(*ChaincodeRequest))
+		})},
+		{MethodName: "Query", Handler: unaryHandler("Query", func() interface{} { return new(ChaincodeRequest) }, func(srv AdminServer, ctx context.Context, in interface{}) (interface{}, error) {
+			return srv.Query(ctx, in.(*ChaincodeRequest))
+		})},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "ChaincodeEvents", Handler: chaincodeEventsHandler, ServerStreams: true},
+	},
+	Metadata:	"admin/admin.proto",
+}
+
+// unaryHandler returns the handler of the unary method, decoding its request allocated by newRequest
+// and calling it through the interceptor of the server, if any
+func unaryHandler(method string, newRequest func() interface{}, call func(srv AdminServer, ctx context.Context, in interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := newRequest()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(AdminServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/heroes.admin.Admin/" + method}
+		return interceptor(ctx, in, info, func(ctx context.Context, in interface{}) (interface{}, error) {
+			return call(srv.(AdminServer), ctx, in)
+		})
+	}
+}
+
+func chaincodeEventsHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(ChaincodeEventsRequest)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(AdminServer).ChaincodeEvents(in, &chaincodeEventsServer{stream})
+}
+
+type chaincodeEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *chaincodeEventsServer) Send(m *ChaincodeEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// AdminClient is the client of the service Admin, for the Go tooling
+type AdminClient interface {
+	Install(ctx context.Context, in *InstallRequest, opts ...grpc.CallOption) (*InstallResponse, error)
+	Instantiate(ctx context.Context, in *InstantiateRequest, opts ...grpc.CallOption) (*InstantiateResponse, error)
+	Upgrade(ctx context.Context, in *UpgradeRequest, opts ...grpc.CallOption) (*UpgradeResponse, error)
+	Invoke(ctx context.Context, in *ChaincodeRequest, opts ...grpc.CallOption) (*InvokeResponse, error)
+	Query(ctx context.Context, in *ChaincodeRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	ChaincodeEvents(ctx context.Context, in *ChaincodeEventsRequest, opts ...grpc.CallOption) (Admin_ChaincodeEventsClient, error)
+}
+
+// Admin_ChaincodeEventsClient receives the events streamed by ChaincodeEvents
+type Admin_ChaincodeEventsClient interface {
+	Recv() (*ChaincodeEvent, error)
+	grpc.ClientStream
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewAdminClient returns the client of the service Admin on the connection
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) Install(ctx context.Context, in *InstallRequest, opts ...grpc.CallOption) (*InstallResponse, error) {
+	out := new(InstallResponse)
+	err := grpc.Invoke(ctx, "/heroes.admin.Admin/Install", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *adminClient) Instantiate(ctx context.Context, in *InstantiateRequest, opts ...grpc.CallOption) (*InstantiateResponse, error) {
+	out := new(InstantiateResponse)
+	err := grpc.Invoke(ctx, "/heroes.admin.Admin/Instantiate", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *adminClient) Upgrade(ctx context.Context, in *UpgradeRequest, opts ...grpc.CallOption) (*UpgradeResponse, error) {
+	out := new(UpgradeResponse)
+	err := grpc.Invoke(ctx, "/heroes.admin.Admin/Upgrade", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *adminClient) Invoke(ctx context.Context, in *ChaincodeRequest, opts ...grpc.CallOption) (*InvokeResponse, error) {
+	out := new(InvokeResponse)
+	err := grpc.Invoke(ctx, "/heroes.admin.Admin/Invoke", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *adminClient) Query(ctx context.Context, in *ChaincodeRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	out := new(QueryResponse)
+	err := grpc.Invoke(ctx, "/heroes.admin.Admin/Query", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *adminClient) ChaincodeEvents(ctx context.Context, in *ChaincodeEventsRequest, opts ...grpc.CallOption) (Admin_ChaincodeEventsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &adminServiceDesc.Streams[0], c.cc, "/heroes.admin.Admin/ChaincodeEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chaincodeEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type chaincodeEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *chaincodeEventsClient) Recv() (*ChaincodeEvent, error) {
+	m := new(ChaincodeEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
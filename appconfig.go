@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// appConfig is the configuration of the service around the setup, read from the environment
+type appConfig struct {
+	DevMode				bool	// HEROES_DEV_MODE, "true" runs the chaincode served by "go run -tags devmode ./chaincode", without Fabric network
+	DevModeAddress		string	// HEROES_DEV_MODE_ADDRESS, address of this development server, localhost:9999 by default
+	AdminGRPCAddress	string	// HEROES_ADMIN_GRPC_ADDRESS, listening address of the administrative gRPC API, not served by default
+	AdminGRPCToken		string	// HEROES_ADMIN_GRPC_TOKEN, bearer token of its calls, required
+	AdminGRPCTLSCert	string	// HEROES_ADMIN_GRPC_TLS_CERT, PEM certificate of the API, plaintext only on the loopback
+	AdminGRPCTLSKey		string	// HEROES_ADMIN_GRPC_TLS_KEY, its PEM private key
+}
+
+// loadAppConfig reads the configuration of the service from the environment
+func loadAppConfig() appConfig {
+	return appConfigFrom(os.LookupEnv)
+}
+
+// appConfigFrom reads the configuration of the service from the variables found by lookup
+func appConfigFrom(lookup func(name string) (string, bool)) appConfig {
+	get := func(name string) string {
+		value, _ := lookup(name)
+		return value
+	}
+	devMode, _ := strconv.ParseBool(get("HEROES_DEV_MODE"))
+	return appConfig{
+		DevMode:			devMode,
+		DevModeAddress:		get("HEROES_DEV_MODE_ADDRESS"),
+		AdminGRPCAddress:	get("HEROES_ADMIN_GRPC_ADDRESS"),
+		AdminGRPCToken:		get("HEROES_ADMIN_GRPC_TOKEN"),
+		AdminGRPCTLSCert:	get("HEROES_ADMIN_GRPC_TLS_CERT"),
+		AdminGRPCTLSKey:	get("HEROES_ADMIN_GRPC_TLS_KEY"),
+	}
+}
+
+// checkAdminGRPC refuses to serve the administrative API in plaintext, its token could be read on the network,
+// unless it only listens on the loopback
+func (config appConfig) checkAdminGRPC() error {
+	if config.AdminGRPCTLSCert != "" || isLoopback(config.AdminGRPCAddress) {
+		return nil
+	}
+	return fmt.Errorf("The administrative API listens on %s without TLS, set HEROES_ADMIN_GRPC_TLS_CERT or listen on the loopback", config.AdminGRPCAddress)
+}
+
+// isLoopback tells if the listening address only accepts local connections, e.g. "localhost:9090" or "127.0.0.1:9090"
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAppConfigDevMode(t *testing.T) {
+	tests := []struct {
+		value	string
+		devMode	bool
+	}{
+		{"", false},
+		{"true", true},
+		{"1", true},
+		{"false", false},
+		{"yes", false},
+	}
+	for _, test := range tests {
+		config := appConfigFrom(func(name string) (string, bool) {
+			if name == "HEROES_DEV_MODE" {
+				return test.value, true
+			}
+			return "", false
+		})
+		if config.DevMode != test.devMode {
+			t.Errorf("HEROES_DEV_MODE=%q: dev mode %t", test.value, config.DevMode)
+		}
+	}
+}
+
+func TestAppConfigAdminGRPC(t *testing.T) {
+	variables := map[string]string{
+		"HEROES_ADMIN_GRPC_ADDRESS":	"127.0.0.1:9090",
+		"HEROES_ADMIN_GRPC_TOKEN":		"secret",
+		"HEROES_ADMIN_GRPC_TLS_CERT":	"admin.pem",
+		"HEROES_ADMIN_GRPC_TLS_KEY":	"admin.key",
+	}
+	config := appConfigFrom(func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	})
+	want := appConfig{AdminGRPCAddress: "127.0.0.1:9090", AdminGRPCToken: "secret", AdminGRPCTLSCert: "admin.pem", AdminGRPCTLSKey: "admin.key"}
+	if config != want {
+		t.Errorf("Got %+v, want %+v", config, want)
+	}
+}
+
+func TestCheckAdminGRPC(t *testing.T) {
+	tests := []struct {
+		address	string
+		tlsCert	string
+		valid	bool
+	}{
+		{"localhost:9090", "", true},
+		{"127.0.0.1:9090", "", true},
+		{"[::1]:9090", "", true},
+		{":9090", "", false},
+		{"0.0.0.0:9090", "", false},
+		{"10.0.0.5:9090", "", false},
+		{"admin.example.com:9090", "", false},
+		{"localhost", "", false},
+		{":9090", "admin.pem", true},
+		{"10.0.0.5:9090", "admin.pem", true},
+	}
+	for _, test := range tests {
+		config := appConfig{AdminGRPCAddress: test.address, AdminGRPCTLSCert: test.tlsCert}
+		if err := config.checkAdminGRPC(); (err == nil) != test.valid {
+			t.Errorf("%s with certificate %q: got %v", test.address, test.tlsCert, err)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// CallOption adjusts a single call of InvokeWith or QueryWith
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	identityName	string
+	identity		api.User
+	transientMap	map[string][]byte
+	commitStatus	*CommitStatus
+	once			bool
+}
+
+// WithIdentity signs the call with the user enrolled under this name (see EnrollUser), read from the credential store
+func WithIdentity(name string) CallOption {
+	return func(options *callOptions) {
+		options.identityName = name
+	}
+}
+
+// WithUser signs the call with the given user, which must know its MSP, see NewMSPUser
+func WithUser(user api.User) CallOption {
+	return func(options *callOptions) {
+		options.identity = user
+	}
+}
+
+// WithTransientMap gives the data to the chaincode in the transient map of the proposal. Unlike the arguments,
+// it is neither kept in the transaction nor in the audit log, so it can carry secrets or the values of private
+// data collections. A query with transient data isn't cached.
+func WithTransientMap(transientMap map[string][]byte) CallOption {
+	return func(options *callOptions) {
+		options.transientMap = transientMap
+	}
+}
+
+// WithCommitStatus fills the status with the commit status of the invoke, e.g. the peers whose endorsements
+// were used. The status of an invalidated transaction is filled too.
+func WithCommitStatus(status *CommitStatus) CallOption {
+	return func(options *callOptions) {
+		options.commitStatus = status
+	}
+}
+
+// WithoutConflictRetries doesn't execute the invoke again when its transaction is in conflict with another one
+// (see ConflictRetries), e.g. when its transaction ID was computed by ComputeTxID
+func WithoutConflictRetries() CallOption {
+	return func(options *callOptions) {
+		options.once = true
+	}
+}
+
+// InvokeWith calls the function of the chaincode: the proposal is endorsed by the peers of the channel, then
+// the transaction is sent to the orderer. It returns the ID of the transaction once committed, adjusted by the options.
+// It gives up when the context is done, a transaction already sent to the orderer can still be committed then.
+// With a ContextTracer, the invoke is traced under the span of the context.
+// With an identity, the proposal and the transaction are signed by it without switching the user context
+// of the client: the calls of different users run concurrently, e.g. one per request of the end users of the web application.
+func (setup *FabricSetup) InvokeWith(ctx context.Context, function string, args []string, options ...CallOption) (string, error) {
+	target, err := setup.callTarget(setup.primaryTarget(), options)
+	if err != nil {
+		return "", err
+	}
+	target.ctx = ctx
+	retryConflicts := !newCallOptions(options).once
+	// Given through a channel, the invoke still running when the context is done
+	statuses := make(chan *CommitStatus, 1)
+	err = setup.withContext(ctx, "Invoke", func() error {
+		setup.userMutex.RLock()
+		defer setup.userMutex.RUnlock()
+		status, err := setup.invokeStatusOn(target, function, args, target.transientMap, retryConflicts)
+		statuses <- status
+		return err
+	})
+	var status *CommitStatus
+	select {
+	case status = <-statuses:
+	default:
+	}
+	if status == nil {
+		return "", err
+	}
+	if commitStatus := newCallOptions(options).commitStatus; commitStatus != nil {
+		*commitStatus = *status
+	}
+	if err != nil {
+		return "", err
+	}
+	return status.TxID, nil
+}
+
+// QueryWith calls the function of the chaincode on every peer of the channel and returns the payload, adjusted
+// by the options, see InvokeWith. Nothing is written in the ledger. The peers must agree on the payload, otherwise
+// an error is returned (use QueryAllPeers to get the answer of each peer). It gives up when the context is done.
+func (setup *FabricSetup) QueryWith(ctx context.Context, function string, args []string, options ...CallOption) ([]byte, error) {
+	target, err := setup.callTarget(setup.primaryTarget(), options)
+	if err != nil {
+		return nil, err
+	}
+	target.ctx = ctx
+	var payload []byte
+	err = setup.withContext(ctx, "Query", func() (err error) {
+		setup.userMutex.RLock()
+		defer setup.userMutex.RUnlock()
+		payload, err = setup.queryOn(target, function, args)
+		return err
+	})
+	return payload, err
+}
+
+// newCallOptions gathers the options of a call
+func newCallOptions(options []CallOption) *callOptions {
+	callOptions := &callOptions{}
+	for _, option := range options {
+		option(callOptions)
+	}
+	return callOptions
+}
+
+// callTarget returns the target with the identity of the options
+func (setup *FabricSetup) callTarget(target channelTarget, options []CallOption) (channelTarget, error) {
+	callOptions := newCallOptions(options)
+	target.identity = callOptions.identity
+	target.transientMap = callOptions.transientMap
+	if callOptions.identityName != "" {
+		if !setup.Initialized {
+			return target, fmt.Errorf("Unable to load the user %s: the setup is not initialized", callOptions.identityName)
+		}
+		user, err := setup.loadEnrolledUser(callOptions.identityName)
+		if err != nil {
+			return target, fmt.Errorf("Unable to load the user %s from the state store: %v", callOptions.identityName, err)
+		}
+		if user == nil {
+			return target, fmt.Errorf("The user %s is not enrolled", callOptions.identityName)
+		}
+		target.identity = user
+	}
+	return target, nil
+}
+
+// creatorOf returns the serialized identity creating the proposals of the target, like the client does for its user context
+func (setup *FabricSetup) creatorOf(target channelTarget) ([]byte, error) {
+	if target.identity == nil {
+		return setup.Client.GetIdentity()
+	}
+	mspID, err := mspOf(target.identity)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&msp.SerializedIdentity{
+		Mspid:		mspID,
+		IdBytes:	target.identity.GetEnrollmentCertificate(),
+	})
+}
+
+// MSPUser is a user knowing the MSP of its organisation, the MSP of the proposals it creates
+type MSPUser interface {
+	api.User
+	GetMspID() string
+}
+
+// NewMSPUser gives the MSP ID of its organisation to the user, e.g. a user of another organisation given to WithUser.
+// The users enrolled or loaded by the setup already have the MSP of the organisation of the client.
+func NewMSPUser(user api.User, mspID string) MSPUser {
+	return &mspUser{User: user, mspID: mspID}
+}
+
+type mspUser struct {
+	api.User
+	mspID	string
+}
+
+func (user *mspUser) GetMspID() string {
+	return user.mspID
+}
+
+// mspOf returns the MSP ID of the user, which the SDK users don't have
+func mspOf(user api.User) (string, error) {
+	if user, ok := user.(MSPUser); ok && user.GetMspID() != "" {
+		return user.GetMspID(), nil
+	}
+	return "", fmt.Errorf("The MSP of the user %s is unknown, see NewMSPUser", user.GetName())
+}
+
+// queryAs sends the query proposal signed by the identity of the target (the user context when not set)
+// to its endorsing peers and returns their responses. Unlike the QueryByChaincode of the SDK, the rejection
+// of the chaincode is an error (a ChaincodeError), not an empty payload. The endorsements are traced under the span.
+// A chaincode still launching (cold peer after a deploy) is queried again after a short delay, up to LaunchRetries times.
+func (setup *FabricSetup) queryAs(target channelTarget, args []string, span Span) ([]*api.TransactionProposalResponse, error) {
+	retries, delay := setup.launchRetries()
+	for attempt := 0; ; attempt++ {
+		responses, err := setup.queryOnce(target, args, span)
+		if err == nil || !isChaincodeLaunching(err) || attempt >= retries {
+			return responses, err
+		}
+		if target.ctx != nil {
+			select {
+			case <-target.ctx.Done():
+				return nil, err
+			case <-time.After(delay):
+			}
+		} else {
+			time.Sleep(delay)
+		}
+	}
+}
+
+// queryOnce sends the query proposal once, see queryAs
+func (setup *FabricSetup) queryOnce(target channelTarget, args []string, span Span) ([]*api.TransactionProposalResponse, error) {
+	proposal, err := setup.createProposalOn(target, args, target.transientMap)
+	if err != nil {
+		return nil, fmt.Errorf("Create transaction proposal return error: %w", err)
+	}
+	responses, err := setup.sendProposal(proposal, setup.endorsementTargets(target.channel), span)
+	if err != nil {
+		return nil, err
+	}
+	for _, response := range responses {
+		if status := response.ProposalResponse.GetResponse().GetStatus(); status != 200 {
+			return nil, &ChaincodeError{Peer: response.Endorser, Status: status, Message: response.ProposalResponse.GetResponse().GetMessage()}
+		}
+	}
+	return responses, nil
+}
+
+// createAndSendTransaction creates the transaction from the endorsements and broadcasts it to an orderer,
+// signed by the identity of the target (the SDK only signs with the user context), the user context when not set
+func (setup *FabricSetup) createAndSendTransaction(target channelTarget, responses []*api.TransactionProposalResponse) error {
+	payload, err := transactionPayload(target.channel, responses)
+	if err != nil {
+		return err
+	}
+	identity := target.identity
+	if identity == nil {
+		identity = setup.Client.GetUserContext()
+	}
+	signature, err := setup.sign(identity, payload)
+	if err != nil {
+		return fmt.Errorf("Unable to sign the transaction: %v", err)
+	}
+	return setup.broadcast(target.channel, &api.SignedEnvelope{Payload: payload, Signature: signature})
+}
+
+// transactionPayload returns the payload of the transaction envelope made of the endorsements, to be signed by the creator
+func transactionPayload(channel api.Channel, responses []*api.TransactionProposalResponse) ([]byte, error) {
+	transaction, err := channel.CreateTransaction(responses)
+	if err != nil {
+		return nil, fmt.Errorf("CreateTransaction return error: %v", err)
+	}
+	header, err := protosUtils.GetHeader(transaction.Proposal.Proposal.Header)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the proposal header: %v", err)
+	}
+	transactionBytes, err := protosUtils.GetBytesTransaction(transaction.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	return protosUtils.GetBytesPayload(&common.Payload{Header: header, Data: transactionBytes})
+}
+
+// broadcast sends the signed transaction envelope to an orderer of the channel, failing over to the others
+// (see failoverOrderer). The SDK sends it to every orderer and fails when one of them does.
+func (setup *FabricSetup) broadcast(channel api.Channel, envelope *api.SignedEnvelope) error {
+	_, err := setup.orderingService(channel).SendBroadcast(envelope)
+	return err
+}
@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fabricClient "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client"
+	sdkUser "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/user"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/protos/msp"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// testUser returns a user with a self-signed certificate, its key imported in the crypto suite of the client
+func testUser(t testing.TB, client api.FabricClient, name string) api.User {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:	big.NewInt(1),
+		Subject:		pkix.Name{CommonName: name},
+		NotBefore:		time.Now(),
+		NotAfter:		time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := importUser(client, name, certificate, keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// creatorOfProposal returns the creator in the header of the proposal
+func creatorOfProposal(t testing.TB, proposal *api.TransactionProposal) *msp.SerializedIdentity {
+	header, err := protosUtils.GetHeader(proposal.Proposal.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureHeader, err := protosUtils.GetSignatureHeader(header.SignatureHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(signatureHeader.Creator, creator); err != nil {
+		t.Fatal(err)
+	}
+	return creator
+}
+
+func TestProposalsOfConcurrentUsers(t *testing.T) {
+	client := fabricClient.NewClient(nil)
+	client.SetCryptoSuite(bccspFactory.GetDefault())
+	admin := NewMSPUser(testUser(t, client, "admin"), "Org1MSP")
+	client.SetUserContext(admin)
+	setup := &FabricSetup{Client: client}
+
+	var users []MSPUser
+	for i := 0; i < 8; i++ {
+		users = append(users, NewMSPUser(testUser(t, client, fmt.Sprintf("user%d", i)), "Org2MSP"))
+	}
+	var wait sync.WaitGroup
+	for _, user := range users {
+		wait.Add(1)
+		go func(user MSPUser) {
+			defer wait.Done()
+			for i := 0; i < 10; i++ {
+				target := channelTarget{channelID: "mychannel", chaincodeID: "heroes-service", identity: user}
+				proposal, err := setup.createProposalOn(target, []string{"invoke", "hello", user.GetName()}, nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				creator := creatorOfProposal(t, proposal)
+				if creator.Mspid != "Org2MSP" || string(creator.IdBytes) != string(user.GetEnrollmentCertificate()) {
+					t.Errorf("The proposal of %s was created by %s of %s", user.GetName(), creator.IdBytes, creator.Mspid)
+					return
+				}
+				suite := client.GetCryptoSuite()
+				digest, _ := suite.Hash(proposal.SignedProposal.ProposalBytes, &bccsp.SHAOpts{})
+				publicKey, _ := user.GetPrivateKey().PublicKey()
+				if valid, err := suite.Verify(publicKey, proposal.SignedProposal.Signature, digest, nil); !valid {
+					t.Errorf("The proposal of %s isn't signed by its key: %v", user.GetName(), err)
+					return
+				}
+			}
+		}(user)
+	}
+	wait.Wait()
+
+	if client.GetUserContext() != admin {
+		t.Error("The user context of the client was changed")
+	}
+}
+
+func TestProposalOfUserWithoutMSP(t *testing.T) {
+	client := fabricClient.NewClient(nil)
+	client.SetCryptoSuite(bccspFactory.GetDefault())
+	setup := &FabricSetup{Client: client}
+	target := channelTarget{channelID: "mychannel", chaincodeID: "heroes-service", identity: sdkUser.NewUser("alice")}
+	if _, err := setup.createProposalOn(target, []string{"invoke", "hello", "alice"}, nil); err == nil {
+		t.Error("A proposal was created without the MSP of the user")
+	}
+}
@@ -0,0 +1,187 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/syslog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+)
+
+// AuditRecord is an Invoke or a Query, recorded by the AuditSink of the setup
+type AuditRecord struct {
+	Time			time.Time	`json:"time"`		// Start of the call
+	Operation		string		`json:"operation"`	// "Invoke" or "Query"
+	Identity		string		`json:"identity"`	// MSP ID and subject of the certificate signing the call
+	Channel			string		`json:"channel"`
+	Chaincode		string		`json:"chaincode"`
+	Function		string		`json:"function"`
+	ArgsHash		string		`json:"argsHash"`	// Hex SHA-256 of the arguments, see hashArgs
+	TxID			string		`json:"txId,omitempty"`
+	EndorsingPeers	[]string	`json:"endorsingPeers,omitempty"`
+	ValidationCode	string		`json:"validationCode,omitempty"`	// Of an invoke committed, "VALID" for a valid one
+	Error			string		`json:"error,omitempty"`
+}
+
+// AuditSink keeps the audit records, e.g. FileAuditSink, SyslogAuditSink or SQLAuditSink
+type AuditSink interface {
+	Record(record *AuditRecord) error
+}
+
+// AuditSinks gives each record to every sink, the first error is returned
+type AuditSinks []AuditSink
+
+// Record gives the record to every sink
+func (sinks AuditSinks) Record(record *AuditRecord) error {
+	var firstErr error
+	for _, sink := range sinks {
+		if err := sink.Record(record); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// FileAuditSink appends the records to a file, one JSON object per line. The file is opened for each record,
+// so it can be rotated.
+type FileAuditSink struct {
+	Path	string
+	mutex	sync.Mutex
+}
+
+// Record appends the record to the file
+func (sink *FileAuditSink) Record(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	file, err := os.OpenFile(sink.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to open the audit log: %v", err)
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// SyslogAuditSink sends the records in JSON to the system log, with the tag "heroes-service-audit"
+type SyslogAuditSink struct {
+	mutex	sync.Mutex
+	writer	*syslog.Writer
+}
+
+// Record sends the record to the system log, connected on the first record
+func (sink *SyslogAuditSink) Record(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.writer == nil {
+		if sink.writer, err = syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "heroes-service-audit"); err != nil {
+			return fmt.Errorf("Unable to connect to the system log: %v", err)
+		}
+	}
+	return sink.writer.Info(string(line))
+}
+
+// SQLAuditSink inserts the records in a table of a database, created beforehand with the columns
+// time, operation, identity, channel, chaincode, function, args_hash, tx_id, endorsing_peers (comma separated),
+// validation_code and error. The driver of the database is chosen by the caller.
+type SQLAuditSink struct {
+	DB					*sql.DB
+	Table				string
+	NumberedParameters	bool	// $1, $2... parameters (PostgreSQL), ? when false
+}
+
+// Record inserts the record
+func (sink *SQLAuditSink) Record(record *AuditRecord) error {
+	values := []interface{}{
+		record.Time, record.Operation, record.Identity, record.Channel, record.Chaincode, record.Function,
+		record.ArgsHash, record.TxID, strings.Join(record.EndorsingPeers, ","), record.ValidationCode, record.Error,
+	}
+	parameters := make([]string, len(values))
+	for i := range parameters {
+		parameters[i] = "?"
+		if sink.NumberedParameters {
+			parameters[i] = fmt.Sprintf("$%d", i+1)
+		}
+	}
+	query := fmt.Sprintf("INSERT INTO %s (time, operation, identity, channel, chaincode, function, args_hash, tx_id, endorsing_peers, validation_code, error) VALUES (%s)",
+		sink.Table, strings.Join(parameters, ", "))
+	if _, err := sink.DB.Exec(query, values...); err != nil {
+		return fmt.Errorf("Unable to insert the audit record: %v", err)
+	}
+	return nil
+}
+
+// audit gives the record of the call started at start to the AuditSink, if any. A failure is logged,
+// the call has already reached the ledger.
+func (setup *FabricSetup) audit(operation string, target channelTarget, args []string, start time.Time, fill func(record *AuditRecord), err error) {
+	if setup.AuditSink == nil || len(args) == 0 {
+		return
+	}
+	record := &AuditRecord{
+		Time:		start,
+		Operation:	operation,
+		Identity:	setup.auditIdentity(target.identity),
+		Channel:	target.channelID,
+		Chaincode:	target.chaincodeID,
+		Function:	args[0],
+		ArgsHash:	hashArgs(args),
+	}
+	fill(record)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if recordErr := setup.AuditSink.Record(record); recordErr != nil {
+		WithFields(setup.logger(), Fields{FieldTxID: record.TxID}).Errorf("Unable to record the %s in the audit log: %v", operation, recordErr)
+	}
+}
+
+// auditIdentity returns the MSP ID and the subject of the certificate of the user, the user context when nil
+func (setup *FabricSetup) auditIdentity(user api.User) string {
+	mspID := setup.Client.GetConfig().GetFabricCAID()
+	if user == nil {
+		user = setup.Client.GetUserContext()
+	}
+	if user == nil {
+		return mspID
+	}
+	if userMSP, err := mspOf(user); err == nil {
+		mspID = userMSP
+	}
+	if block, _ := pem.Decode(user.GetEnrollmentCertificate()); block != nil {
+		if certificate, err := x509.ParseCertificate(block.Bytes); err == nil {
+			return mspID + "/" + certificate.Subject.String()
+		}
+	}
+	return mspID + "/" + user.GetName()
+}
+
+// hashArgs returns the hex SHA-256 of the arguments (the function name first), each one preceded by its length
+// on 8 bytes, so the arguments can be proven without being kept in the log
+func hashArgs(args []string) string {
+	hash := sha256.New()
+	for _, arg := range args {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(arg)))
+		hash.Write(length[:])
+		hash.Write([]byte(arg))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TxRequest is an invoke of the chaincode in a batch
+type TxRequest struct {
+	Function		string
+	Args			[]string
+	TransientData	map[string][]byte	// Transient map of the proposal, see WithTransientMap
+}
+
+// TxResult is the outcome of a transaction of a batch
+type TxResult struct {
+	TxID	string
+	Status	*CommitStatus	// Nil when the transaction was not committed
+	Err		error
+}
+
+// InvokeBatch invokes the chaincode for each request and returns their results in the same order.
+// The proposals are endorsed and sent to the orderer concurrently on the workers of the submission queue
+// (see SubmitParallelism), so the orderer cuts them into the same blocks, and the commits are awaited together.
+// A transaction in conflict with another one is not executed again: the requests of a batch should write
+// different keys. The error tells how many transactions failed, the result of each one has its error.
+func (setup *FabricSetup) InvokeBatch(requests []TxRequest) ([]TxResult, error) {
+	setup.userMutex.RLock()
+	defer setup.userMutex.RUnlock()
+	if !setup.Initialized {
+		return nil, fmt.Errorf("Unable to invoke the chaincode: the setup is not initialized")
+	}
+	defer func(start time.Time) { setup.logger().Debugf("Batch of %d transactions done in %v", len(requests), time.Since(start)) }(time.Now())
+
+	target := setup.primaryTarget()
+	results := make([]TxResult, len(requests))
+	var wait sync.WaitGroup
+	for i := range requests {
+		wait.Add(1)
+		go func(request TxRequest, result *TxResult) {
+			defer wait.Done()
+			result.Status, result.Err = setup.invokeBatched(target, request)
+			if result.Status != nil {
+				result.TxID = result.Status.TxID
+			}
+		}(requests[i], &results[i])
+	}
+	wait.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of the %d transactions of the batch failed", failed, len(requests))
+	}
+	return results, nil
+}
+
+// invokeBatched sends the transaction of the request on a worker of the submission queue, then waits for its commit
+// outside of it, so the worker can send the next transaction of the batch
+func (setup *FabricSetup) invokeBatched(target channelTarget, request TxRequest) (status *CommitStatus, err error) {
+	span := setup.startSpan("Invoke")
+	span.SetAttribute(AttributeChannel, target.channelID)
+	span.SetAttribute(AttributeChaincode, target.chaincodeID)
+	defer func() { endSpan(span, err) }()
+	defer func(start time.Time) { setup.observeOperation("Invoke", start, err) }(time.Now())
+
+	var pending *pendingTx
+	submitErr := setup.submit(func() {
+		pending, err = setup.sendTransactionOn(target, append([]string{request.Function}, request.Args...), request.TransientData, span)
+	})
+	if submitErr != nil {
+		return nil, submitErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invoke of %s return error: %w", request.Function, err)
+	}
+	status, err = setup.awaitCommit(pending)
+	if err != nil {
+		return status, fmt.Errorf("Invoke of %s return error: %w", request.Function, err)
+	}
+	return status, nil
+}
@@ -0,0 +1,107 @@
+package blockchain
+
+import (
+	"sync"
+	"github.com/hyperledger/fabric/protos/common"
+)
+
+// BlockSummary is what a block listener receives for each block committed
+type BlockSummary struct {
+	ChannelID		string
+	Number			uint64
+	Height			uint64		// Height of the ledger once the block is committed, Number + 1
+	TxCount			int
+	TxIDs			[]string
+	ValidationCodes	[]string	// Validation code of each transaction, in the order of TxIDs
+}
+
+// blockListeners delivers the block summaries to the listeners, through a single block callback of the event hub:
+// the SDK identifies a block callback by its code, so several closures can't be unregistered one by one
+type blockListeners struct {
+	mutex		sync.Mutex
+	listeners	map[*blockListener]bool
+}
+
+// blockListener is a listener of the block summaries
+type blockListener struct {
+	callback	func(BlockSummary)
+}
+
+// RegisterBlockListener calls the listener with the summary of each block committed in the channels of the peer
+// of the event hub, so an off-chain index can be kept in sync with the ledger.
+// The listener runs on the goroutine of the event hub, through the dispatcher (see Pause): it must not block.
+// The returned registration stops the listening, Close stops it too.
+func (setup *FabricSetup) RegisterBlockListener(listener func(BlockSummary)) (Registration, error) {
+	return setup.addBlockListener(&blockListener{callback: listener})
+}
+
+// addBlockListener adds the listener, and the block callback of the event hub with the first one
+func (setup *FabricSetup) addBlockListener(handle *blockListener) (Registration, error) {
+	if err := setup.ensureEventHubConnected(); err != nil {
+		return nil, err
+	}
+
+	setup.blockListeners.mutex.Lock()
+	if len(setup.blockListeners.listeners) == 0 {
+		setup.blockListeners.listeners = make(map[*blockListener]bool)
+		setup.EventHub.RegisterBlockEvent(setup.deliverBlock)
+	}
+	setup.blockListeners.listeners[handle] = true
+	setup.blockListeners.mutex.Unlock()
+
+	setup.trackListener(handle, func() { setup.removeBlockListener(handle) })
+	return &listenerRegistration{setup: setup, handle: handle}, nil
+}
+
+// removeBlockListener removes the listener, and the block callback of the event hub with the last one
+func (setup *FabricSetup) removeBlockListener(handle *blockListener) {
+	setup.blockListeners.mutex.Lock()
+	defer setup.blockListeners.mutex.Unlock()
+	if !setup.blockListeners.listeners[handle] {
+		return
+	}
+	delete(setup.blockListeners.listeners, handle)
+	if len(setup.blockListeners.listeners) == 0 {
+		setup.EventHub.UnregisterBlockEvent(setup.deliverBlock)
+	}
+}
+
+// deliverBlock is the block callback of the event hub, it gives the summary of the block to the listeners
+func (setup *FabricSetup) deliverBlock(block *common.Block) {
+	setup.blockListeners.mutex.Lock()
+	var listeners []*blockListener
+	for handle := range setup.blockListeners.listeners {
+		listeners = append(listeners, handle)
+	}
+	setup.blockListeners.mutex.Unlock()
+	if len(listeners) == 0 {
+		return
+	}
+
+	decoded, err := decodeBlock(block)
+	if err != nil {
+		setup.logger().Errorf("Unable to decode the block for the block listeners: %v", err)
+		return
+	}
+	summary := blockSummary(decoded)
+	dispatcher := setup.getDispatcher()
+	for _, handle := range listeners {
+		handle := handle
+		dispatcher.dispatch(func() { handle.callback(summary) })
+	}
+}
+
+// blockSummary summarizes the decoded block
+func blockSummary(decoded *Block) BlockSummary {
+	summary := BlockSummary{
+		Number:		decoded.Number,
+		Height:		decoded.Number + 1,
+		TxCount:	len(decoded.Transactions),
+	}
+	for _, transaction := range decoded.Transactions {
+		summary.ChannelID = transaction.ChannelID
+		summary.TxIDs = append(summary.TxIDs, transaction.TxID)
+		summary.ValidationCodes = append(summary.ValidationCodes, transaction.ValidationCode)
+	}
+	return summary
+}
@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const defaultCertExpiryWarning = 30 * 24 * time.Hour
+
+// CertificateExpiry is the expiry date of a certificate used by the setup
+type CertificateExpiry struct {
+	Name		string
+	Path		string
+	NotAfter	time.Time
+}
+
+// CertificateExpiries returns the expiry date of the certificates checked during the initialization
+func (setup *FabricSetup) CertificateExpiries() []CertificateExpiry {
+	return setup.certificateExpiries
+}
+
+// checkCertificateExpiry reads the PEM certificate and records its expiry date.
+// It warns when the certificate expires within CertExpiryWarning, and fails when it has already expired.
+func (setup *FabricSetup) checkCertificateExpiry(name string, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Unable to read the %s certificate: %v", name, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("No PEM certificate found in %s", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("Unable to parse the %s certificate: %v", name, err)
+	}
+
+	setup.certificateExpiries = append(setup.certificateExpiries, CertificateExpiry{
+		Name:		name,
+		Path:		path,
+		NotAfter:	cert.NotAfter,
+	})
+
+	warning := setup.CertExpiryWarning
+	if warning == 0 {
+		warning = defaultCertExpiryWarning
+	}
+	remaining := time.Until(cert.NotAfter)
+	if remaining <= 0 {
+		return fmt.Errorf("The %s certificate (%s) expired on %s", name, path, cert.NotAfter)
+	}
+	if remaining < warning {
+		setup.logger().Printf("Warning: the %s certificate (%s) expires on %s", name, path, cert.NotAfter)
+	}
+
+	return nil
+}
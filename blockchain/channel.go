@@ -0,0 +1,355 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/common/crypto"
+	fabricConfig "github.com/hyperledger/fabric/common/config"
+	"github.com/hyperledger/fabric/protos/common"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+const defaultOrdererProbeTimeout = 3 * time.Second
+
+// GetConfigSequence returns the sequence number of the current channel configuration.
+// The sequence is incremented at each configuration update, so it can be polled
+// cheaply to know when the full configuration needs to be fetched again.
+func (setup *FabricSetup) GetConfigSequence() (uint64, error) {
+	config, err := setup.getChannelConfig()
+	if err != nil {
+		return 0, err
+	}
+	return config.Sequence, nil
+}
+
+// OrdererStatus is an orderer of the channel configuration and whether it can be reached
+type OrdererStatus struct {
+	Address		string
+	Reachable	bool
+	Error		string	// Why the orderer can't be reached
+}
+
+// ListOrderers returns the orderers known by the channel configuration, and probes each of them.
+// An orderer is reachable when a connection can be opened to its address within OrdererProbeTimeout.
+func (setup *FabricSetup) ListOrderers() ([]OrdererStatus, error) {
+	config, err := setup.getChannelConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := setup.ordererAddresses(config)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := setup.OrdererProbeTimeout
+	if timeout == 0 {
+		timeout = defaultOrdererProbeTimeout
+	}
+
+	statuses := make([]OrdererStatus, len(addresses))
+	for i, address := range addresses {
+		statuses[i].Address = address
+		connection, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			statuses[i].Error = err.Error()
+			continue
+		}
+		connection.Close()
+		statuses[i].Reachable = true
+	}
+
+	return statuses, nil
+}
+
+// ordererAddresses returns the addresses of the orderers, a value of the channel group of the configuration
+func (setup *FabricSetup) ordererAddresses(config *common.Config) ([]string, error) {
+	value, ok := config.ChannelGroup.GetValues()[fabricConfig.OrdererAddressesKey]
+	if !ok {
+		return nil, fmt.Errorf("No orderer addresses in the configuration of the channel (%s)", setup.ChannelId)
+	}
+	addresses := &common.OrdererAddresses{}
+	if err := proto.Unmarshal(value.Value, addresses); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the orderer addresses: %v", err)
+	}
+	return addresses.Addresses, nil
+}
+
+// checkChannelMembership fails with the peers of the channel that haven't joined it
+func (setup *FabricSetup) checkChannelMembership() error {
+	notJoined, err := setup.peersNotJoined(setup.ChannelId, setup.ownPeers(setup.Channel))
+	if err != nil {
+		return err
+	}
+	if len(notJoined) > 0 {
+		var urls []string
+		for _, peer := range notJoined {
+			urls = append(urls, peer.URL())
+		}
+		return fmt.Errorf("The peers %s haven't joined the channel (%s)", strings.Join(urls, ", "), setup.ChannelId)
+	}
+	return nil
+}
+
+// peersNotJoined asks each peer the list of channels it has joined (cscc GetChannels)
+// and returns the peers that haven't joined the channel
+func (setup *FabricSetup) peersNotJoined(channelID string, peers []api.Peer) ([]api.Peer, error) {
+	var notJoined []api.Peer
+	for _, peer := range peers {
+		response, err := setup.Client.QueryChannels(peer)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to query the channels of the peer %s: %v", peer.URL(), err)
+		}
+		joined := false
+		for _, joinedChannel := range response.Channels {
+			if joinedChannel.ChannelId == channelID {
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			notJoined = append(notJoined, peer)
+		}
+	}
+	return notJoined, nil
+}
+
+// CreateChannel creates the channel of the setup from ChannelConfig, unless the orderer already knows it.
+// With JoinChannel false, Initialize leaves the channel as is, so it can be created and joined step by step.
+func (setup *FabricSetup) CreateChannel() error {
+	if !setup.Initialized {
+		return fmt.Errorf("Unable to create the channel (%s): the setup is not initialized", setup.ChannelId)
+	}
+	// The organisation admin creates the channel, then the user context is restored
+	return setup.asUser(setup.orgUser, func() error {
+		if _, err := setup.getGenesisBlock(setup.Channel); err == nil {
+			setup.logger().Printf("Channel %s already created", setup.ChannelId)
+			return nil
+		}
+		if err := setup.createChannel(setup.ChannelId, setup.Channel, setup.ChannelConfig); errors.Is(err, ErrChannelExists) {
+			setup.logger().Printf("Channel %s created by another process", setup.ChannelId)
+		} else if err != nil {
+			return setupError(PhaseChannelCreate, err)
+		}
+		return nil
+	})
+}
+
+// JoinPeers makes the peers of the organisation that haven't joined the channel of the setup join it.
+// The channel must exist, see CreateChannel.
+func (setup *FabricSetup) JoinPeers() error {
+	if !setup.Initialized {
+		return fmt.Errorf("Unable to join the channel (%s): the setup is not initialized", setup.ChannelId)
+	}
+	// The organisation admin joins the peers, then the user context is restored
+	return setup.asUser(setup.orgUser, func() error {
+		notJoined, err := setup.peersNotJoined(setup.ChannelId, setup.ownPeers(setup.Channel))
+		if err != nil {
+			return err
+		}
+		if len(notJoined) == 0 {
+			setup.logger().Printf("Every peer already joined the channel %s", setup.ChannelId)
+			return nil
+		}
+		genesisBlock, err := setup.getGenesisBlock(setup.Channel)
+		if err != nil {
+			return setupError(PhaseChannelJoin, fmt.Errorf("Error getting genesis block, is the channel created? %v", err))
+		}
+		txID, nonce, err := setup.newTxID()
+		if err != nil {
+			return err
+		}
+		err = setup.Channel.JoinChannel(&api.JoinChannelRequest{
+			Targets:		notJoined,
+			GenesisBlock:	genesisBlock,
+			TxID:			txID,
+			Nonce:			nonce,
+		})
+		if err != nil {
+			return setupError(PhaseChannelJoin, fmt.Errorf("Error joining channel: %v", err))
+		}
+		return nil
+	})
+}
+
+// createAndJoinChannel creates the channel when the orderer doesn't know it yet, and makes the peers
+// of the organisation that haven't joined it join it. This way the initialization succeeds on a fresh network
+// as well as on a network set up by a previous run, even one interrupted between the two steps.
+// The pre-enrolled admins are used, the organisation admin is left as the user of the client.
+func (setup *FabricSetup) createAndJoinChannel(channelID string, channel api.Channel, channelConfig string) error {
+	setup.Client.SetUserContext(setup.orgUser)
+	notJoined, err := setup.peersNotJoined(channelID, setup.ownPeers(channel))
+	if err != nil {
+		return err
+	}
+
+	// Every peer is in the channel, only initialize the channel from the orderer
+	if len(notJoined) == 0 {
+		if err := channel.Initialize(nil); err != nil {
+			return fmt.Errorf("Error initializing channel: %v", err)
+		}
+		return nil
+	}
+
+	// The orderer only has the genesis block of the channels that exist
+	genesisBlock, err := setup.getGenesisBlock(channel)
+	if err != nil {
+		// Another process creating the channel meanwhile is fine, its genesis block is fetched below
+		if err := setup.createChannel(channelID, channel, channelConfig); err != nil && !errors.Is(err, ErrChannelExists) {
+			return setupError(PhaseChannelCreate, err)
+		}
+		genesisBlock, err = setup.getGenesisBlock(channel)
+		if err != nil {
+			return setupError(PhaseChannelCreate, fmt.Errorf("Error getting genesis block: %v", err))
+		}
+	}
+
+	txID, nonce, err := setup.newTxID()
+	if err != nil {
+		return err
+	}
+	err = channel.JoinChannel(&api.JoinChannelRequest{
+		Targets:		notJoined,
+		GenesisBlock:	genesisBlock,
+		TxID:			txID,
+		Nonce:			nonce,
+	})
+	if err != nil {
+		return fmt.Errorf("Error joining channel: %v", err)
+	}
+
+	return nil
+}
+
+// createChannel sends the channel configuration transaction to the orderer
+func (setup *FabricSetup) createChannel(channelID string, channel api.Channel, channelConfig string) error {
+	configTx, err := ioutil.ReadFile(channelConfig)
+	if err != nil {
+		return fmt.Errorf("Error reading config file: %v", err)
+	}
+	config, err := setup.Client.ExtractChannelConfig(configTx)
+	if err != nil {
+		return fmt.Errorf("Error extracting channel config: %v", err)
+	}
+	configSignature, err := setup.Client.SignChannelConfig(config)
+	if err != nil {
+		return fmt.Errorf("Error signing configuration: %v", err)
+	}
+	txID, nonce, err := setup.newTxID()
+	if err != nil {
+		return err
+	}
+
+	// The channel is created by the orderer admin
+	setup.Client.SetUserContext(setup.ordererUser)
+	err = setup.Client.CreateChannel(&api.CreateChannelRequest{
+		Name:		channelID,
+		Orderer:	setup.orderingService(channel),
+		Config:		config,
+		Signatures:	[]*common.ConfigSignature{configSignature},
+		TxID:		txID,
+		Nonce:		nonce,
+	})
+	setup.Client.SetUserContext(setup.orgUser)
+	if err != nil {
+		// The orderer refuses a channel created since the caller checked it doesn't exist
+		if _, genesisErr := setup.getGenesisBlock(channel); genesisErr == nil {
+			return fmt.Errorf("CreateChannel return error: %v: %w", err, ErrChannelExists)
+		}
+		return fmt.Errorf("CreateChannel return error: %v", err)
+	}
+
+	// Wait for orderer to process channel metadata
+	time.Sleep(time.Second * 3)
+	return nil
+}
+
+// getGenesisBlock fetches the genesis block of the channel from the orderer
+func (setup *FabricSetup) getGenesisBlock(channel api.Channel) (*common.Block, error) {
+	txID, nonce, err := setup.newTxID()
+	if err != nil {
+		return nil, err
+	}
+	return channel.GetGenesisBlock(&api.GenesisBlockRequest{TxID: txID, Nonce: nonce})
+}
+
+// newTxID returns a new nonce and the transaction ID computed from it for the current identity
+func (setup *FabricSetup) newTxID() (string, []byte, error) {
+	creator, err := setup.Client.GetIdentity()
+	if err != nil {
+		return "", nil, fmt.Errorf("Error getting creator: %v", err)
+	}
+	nonce, err := crypto.GetRandomNonce()
+	if err != nil {
+		return "", nil, fmt.Errorf("Could not compute nonce: %v", err)
+	}
+	txID, err := protosUtils.ComputeProposalTxID(nonce, creator)
+	if err != nil {
+		return "", nil, fmt.Errorf("Could not compute TxID: %v", err)
+	}
+	return txID, nonce, nil
+}
+
+// getChannelConfig returns the current configuration of the channel, read from its last configuration block
+func (setup *FabricSetup) getChannelConfig() (*common.Config, error) {
+
+	// Get the last configuration block of the channel
+	block, err := setup.getConfigBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// The configuration block contains only one transaction: the configuration envelope
+	envelope, err := protosUtils.ExtractEnvelope(block, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to extract the envelope of the config block: %v", err)
+	}
+	payload, err := protosUtils.ExtractPayload(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to extract the payload of the config block: %v", err)
+	}
+	configEnvelope := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configEnvelope); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the config envelope: %v", err)
+	}
+	if configEnvelope.Config == nil || configEnvelope.Config.ChannelGroup == nil {
+		return nil, fmt.Errorf("The config block doesn't contain any configuration")
+	}
+
+	return configEnvelope.Config, nil
+}
+
+// getConfigBlock queries the primary peer to get the last configuration block of the channel
+func (setup *FabricSetup) getConfigBlock() (*common.Block, error) {
+
+	// Get the height of the ledger to find the last block
+	info, err := setup.Channel.QueryInfo()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the channel info: %v", err)
+	}
+	if info.Height == 0 {
+		return nil, fmt.Errorf("The ledger of the channel (%s) is empty", setup.ChannelId)
+	}
+	lastBlock, err := setup.Channel.QueryBlock(int(info.Height - 1))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the block %d: %v", info.Height-1, err)
+	}
+
+	// Every block references the last configuration block in its metadata
+	index, err := protosUtils.GetLastConfigIndexFromBlock(lastBlock)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the last config index: %v", err)
+	}
+	configBlock, err := setup.Channel.QueryBlock(int(index))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the config block %d: %v", index, err)
+	}
+
+	return configBlock, nil
+}
@@ -0,0 +1,55 @@
+package blockchain
+
+import (
+	"sync"
+	"testing"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/protos/common"
+)
+
+// genesisOrderer answers every deliver request with a genesis block, keeping the requests
+type genesisOrderer struct {
+	mutex		sync.Mutex
+	requests	[]*common.Envelope
+}
+
+func (o *genesisOrderer) GetURL() string { return "orderer.example.com:7050" }
+
+func (o *genesisOrderer) SendBroadcast(envelope *api.SignedEnvelope) (*common.Status, error) {
+	status := common.Status_SUCCESS
+	return &status, nil
+}
+
+func (o *genesisOrderer) SendDeliver(envelope *api.SignedEnvelope) (chan *common.Block, chan error) {
+	o.mutex.Lock()
+	o.requests = append(o.requests, &common.Envelope{Payload: envelope.Payload, Signature: envelope.Signature})
+	o.mutex.Unlock()
+	blocks := make(chan *common.Block, 1)
+	blocks <- &common.Block{Header: &common.BlockHeader{Number: 0}, Data: &common.BlockData{}}
+	return blocks, make(chan error)
+}
+
+func TestCreateChannelRestoresUserContext(t *testing.T) {
+	setup, _ := newInvokeSetup(t)
+	orderer := &genesisOrderer{}
+	setup.Channel.RemoveOrderer(setup.Channel.GetOrderers()[0])
+	if err := setup.Channel.AddOrderer(orderer); err != nil {
+		t.Fatal(err)
+	}
+	setup.orgUser = setup.Client.GetUserContext()
+	user := NewMSPUser(testUser(t, setup.Client, "user1"), "Org1MSP")
+	setup.Client.SetUserContext(user)
+
+	if err := setup.CreateChannel(); err != nil {
+		t.Fatal(err)
+	}
+	if len(orderer.requests) != 1 {
+		t.Fatalf("%d requests of the genesis block, want 1", len(orderer.requests))
+	}
+	if creator := creatorOfTransaction(t, orderer.requests[0]); string(creator.IdBytes) != string(setup.orgUser.GetEnrollmentCertificate()) {
+		t.Error("The genesis block wasn't requested by the organisation admin")
+	}
+	if setup.Client.GetUserContext() != user {
+		t.Error("The user context of the client wasn't restored")
+	}
+}
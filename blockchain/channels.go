@@ -0,0 +1,212 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fcutil "github.com/hyperledger/fabric-sdk-go/pkg/util"
+)
+
+// ChannelChaincode is the chaincode used on a channel added with AddChannel.
+// The empty fields take the value of the chaincode of the primary channel.
+type ChannelChaincode struct {
+	Id		string
+	Version	string
+	Path	string
+}
+
+// channelTarget is a channel of the setup and the chaincode used on it
+type channelTarget struct {
+	channelID			string
+	channel				api.Channel
+	chaincodeID			string
+	chaincodeVersion	string
+	chaincodePath		string
+	identity			api.User	// Signs the proposals and transactions instead of the user context of the client, when set
+	ctx					context.Context	// Of the caller, its span is the parent of the spans of the operation, when set
+	transientMap		map[string][]byte	// Transient map of the proposals, see WithTransientMap
+}
+
+// callContext returns the context of the caller, a background context when not set
+func (target channelTarget) callContext() context.Context {
+	if target.ctx == nil {
+		return context.Background()
+	}
+	return target.ctx
+}
+
+// primaryTarget returns the channel set up by Initialize, with the chaincode of the setup
+func (setup *FabricSetup) primaryTarget() channelTarget {
+	return channelTarget{
+		channelID:			setup.ChannelId,
+		channel:			setup.Channel,
+		chaincodeID:		setup.ChaincodeId,
+		chaincodeVersion:	setup.ChaincodeVersion,
+		chaincodePath:		setup.ChaincodePath,
+	}
+}
+
+// target returns the channel with the given ID, the primary channel when empty
+func (setup *FabricSetup) target(channelID string) (channelTarget, error) {
+	if channelID == "" || channelID == setup.ChannelId {
+		return setup.primaryTarget(), nil
+	}
+	channel, err := setup.GetChannel(channelID)
+	if err != nil {
+		return channelTarget{}, err
+	}
+
+	target := setup.primaryTarget()
+	target.channelID = channelID
+	target.channel = channel
+	chaincode := setup.ChannelChaincodes[channelID]
+	if chaincode.Id != "" {
+		target.chaincodeID = chaincode.Id
+	}
+	if chaincode.Version != "" {
+		target.chaincodeVersion = chaincode.Version
+	}
+	if chaincode.Path != "" {
+		target.chaincodePath = chaincode.Path
+	}
+	return target, nil
+}
+
+// ChannelManager holds the channels of a setup by channel ID: the primary channel set up by Initialize,
+// and the other channels the peers joined with Add
+type ChannelManager struct {
+	setup		*FabricSetup
+	mutex		sync.Mutex
+	channels	map[string]api.Channel	// The channels added, the primary one excluded
+}
+
+// Channels returns the channel manager of the setup
+func (setup *FabricSetup) Channels() *ChannelManager {
+	manager := &setup.channelManager
+	manager.mutex.Lock()
+	manager.setup = setup
+	manager.mutex.Unlock()
+	return manager
+}
+
+// Add makes the peers join another channel, creating it from its configuration transaction
+// if the orderer doesn't know it, and keeps it with the channels of the setup.
+// The chaincode used on it is given by ChannelChaincodes.
+func (manager *ChannelManager) Add(channelID string, channelConfigPath string) (api.Channel, error) {
+	setup := manager.setup
+	if !setup.Initialized {
+		return nil, fmt.Errorf("Unable to add the channel (%s): the setup is not initialized", channelID)
+	}
+	if channelID == setup.ChannelId {
+		return nil, fmt.Errorf("The channel (%s) is the primary channel", channelID)
+	}
+	if channel, err := manager.Get(channelID); err == nil {
+		return channel, nil
+	}
+
+	channel, err := fcutil.GetChannel(setup.Client, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("Create channel (%s) failed: %v", channelID, err)
+	}
+	if err := setup.useEndorsers(channel); err != nil {
+		return nil, err
+	}
+	if err := setup.useOrderers(channel); err != nil {
+		return nil, err
+	}
+	setup.userMutex.Lock()
+	err = setup.retry(context.Background(), "Channel join", func() error {
+		return setup.createAndJoinChannel(channelID, channel, channelConfigPath)
+	})
+	setup.userMutex.Unlock()
+	if err != nil {
+		return nil, setupError(PhaseChannelJoin, fmt.Errorf("CreateAndJoinChannel return error: %w", err))
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if manager.channels == nil {
+		manager.channels = make(map[string]api.Channel)
+	}
+	manager.channels[channelID] = channel
+	return channel, nil
+}
+
+// Get returns the channel with the given ID, the primary one or one added with Add
+func (manager *ChannelManager) Get(channelID string) (api.Channel, error) {
+	setup := manager.setup
+	if channelID == setup.ChannelId && setup.Channel != nil {
+		return setup.Channel, nil
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	channel, ok := manager.channels[channelID]
+	if !ok {
+		return nil, fmt.Errorf("Unknown channel (%s)", channelID)
+	}
+	return channel, nil
+}
+
+// IDs returns the IDs of the channels, the primary one first
+func (manager *ChannelManager) IDs() []string {
+	ids := []string{manager.setup.ChannelId}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	var added []string
+	for channelID := range manager.channels {
+		added = append(added, channelID)
+	}
+	sort.Strings(added)
+	return append(ids, added...)
+}
+
+// clear forgets the channels added
+func (manager *ChannelManager) clear() {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.channels = nil
+}
+
+// AddChannel is a shortcut of Channels().Add
+func (setup *FabricSetup) AddChannel(channelID string, channelConfigPath string) (api.Channel, error) {
+	return setup.Channels().Add(channelID, channelConfigPath)
+}
+
+// GetChannel is a shortcut of Channels().Get
+func (setup *FabricSetup) GetChannel(channelID string) (api.Channel, error) {
+	return setup.Channels().Get(channelID)
+}
+
+// QueryOnChannel is like QueryWith, on the chaincode of the given channel (the primary one when empty)
+func (setup *FabricSetup) QueryOnChannel(channelID string, function string, args []string) ([]byte, error) {
+	target, err := setup.target(channelID)
+	if err != nil {
+		return nil, err
+	}
+	setup.userMutex.RLock()
+	defer setup.userMutex.RUnlock()
+	return setup.queryOn(target, function, args)
+}
+
+// InvokeOnChannel is like InvokeWith, on the chaincode of the given channel (the primary one when empty)
+func (setup *FabricSetup) InvokeOnChannel(channelID string, function string, args []string) (string, error) {
+	target, err := setup.target(channelID)
+	if err != nil {
+		return "", err
+	}
+	setup.userMutex.RLock()
+	defer setup.userMutex.RUnlock()
+	return setup.invokeFunctionOn(target, function, args, true)
+}
+
+// InstallAndInstantiateCCOnChannel installs the chaincode of the given channel (see ChannelChaincodes) on its peers
+// and instantiates it. The arguments are given to the Init function of the chaincode, ChaincodeInitArgs when nil.
+func (setup *FabricSetup) InstallAndInstantiateCCOnChannel(channelID string, args []string) error {
+	target, err := setup.target(channelID)
+	if err != nil {
+		return err
+	}
+	return setup.installAndInstantiateOn(target, args)
+}
@@ -0,0 +1,183 @@
+package blockchain
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fabricConfig "github.com/hyperledger/fabric/common/config"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Delay between two reads of the configuration sequence while waiting for an update
+const configUpdatePollInterval = 500 * time.Millisecond
+
+// UpdateChannelConfig applies a configuration update transaction (e.g. an anchor peers update made by
+// configtxgen -outputAnchorPeersUpdate, or a capability bump computed with configtxlator) to the channel
+// of the setup, signed by the organisation admin. It waits until the peer has the new configuration.
+func (setup *FabricSetup) UpdateChannelConfig(updateTxPath string) error {
+	updateTx, err := ioutil.ReadFile(updateTxPath)
+	if err != nil {
+		return fmt.Errorf("Unable to read the configuration update: %v", err)
+	}
+	configUpdate, err := setup.Client.ExtractChannelConfig(updateTx)
+	if err != nil {
+		return fmt.Errorf("Unable to extract the configuration update (%s): %v", updateTxPath, err)
+	}
+	return setup.sendConfigUpdate(configUpdate)
+}
+
+// SetAnchorPeers replaces the anchor peers of the organisation of the MSP in the channel configuration,
+// by addresses (host:port). The organisation admin must be the one of this MSP.
+func (setup *FabricSetup) SetAnchorPeers(mspID string, addresses []string) error {
+	anchorPeers := &pb.AnchorPeers{}
+	for _, address := range addresses {
+		host, portString, err := net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("Invalid anchor peer address %s: %v", address, err)
+		}
+		port, err := strconv.Atoi(portString)
+		if err != nil {
+			return fmt.Errorf("Invalid port of the anchor peer %s: %v", address, err)
+		}
+		anchorPeers.AnchorPeers = append(anchorPeers.AnchorPeers, &pb.AnchorPeer{Host: host, Port: int32(port)})
+	}
+	anchorPeersValue, err := proto.Marshal(anchorPeers)
+	if err != nil {
+		return err
+	}
+
+	if !setup.Initialized {
+		return fmt.Errorf("Unable to update the channel (%s): the setup is not initialized", setup.ChannelId)
+	}
+	config, err := setup.getChannelConfig()
+	if err != nil {
+		return err
+	}
+	application, ok := config.ChannelGroup.Groups[fabricConfig.ApplicationGroupKey]
+	if !ok {
+		return fmt.Errorf("The channel %s has no application organisation", setup.ChannelId)
+	}
+	orgName, err := organizationGroupName(application, mspID)
+	if err != nil {
+		return err
+	}
+	org := application.Groups[orgName]
+
+	// Every value and policy of the organisation is read at its version, the anchor peers are written
+	// at the next one, which makes the organisation group itself change version
+	readOrg := &common.ConfigGroup{Version: org.Version, Values: map[string]*common.ConfigValue{}, Policies: map[string]*common.ConfigPolicy{}}
+	writeOrg := &common.ConfigGroup{Version: org.Version + 1, ModPolicy: org.ModPolicy, Values: map[string]*common.ConfigValue{}, Policies: map[string]*common.ConfigPolicy{}}
+	for key, value := range org.Values {
+		readOrg.Values[key] = &common.ConfigValue{Version: value.Version}
+		writeOrg.Values[key] = &common.ConfigValue{Version: value.Version}
+	}
+	for key, policy := range org.Policies {
+		readOrg.Policies[key] = &common.ConfigPolicy{Version: policy.Version}
+		writeOrg.Policies[key] = &common.ConfigPolicy{Version: policy.Version}
+	}
+	anchorPeersConfig := &common.ConfigValue{Value: anchorPeersValue, ModPolicy: "Admins"}
+	if current, ok := org.Values[fabricConfig.AnchorPeersKey]; ok {
+		anchorPeersConfig.Version = current.Version + 1
+		anchorPeersConfig.ModPolicy = current.ModPolicy
+		delete(readOrg.Values, fabricConfig.AnchorPeersKey)
+	}
+	writeOrg.Values[fabricConfig.AnchorPeersKey] = anchorPeersConfig
+
+	configUpdate := &common.ConfigUpdate{
+		ChannelId:	setup.ChannelId,
+		ReadSet:	&common.ConfigGroup{Groups: map[string]*common.ConfigGroup{
+			fabricConfig.ApplicationGroupKey: {Version: application.Version, Groups: map[string]*common.ConfigGroup{orgName: readOrg}},
+		}},
+		WriteSet:	&common.ConfigGroup{Groups: map[string]*common.ConfigGroup{
+			fabricConfig.ApplicationGroupKey: {Version: application.Version, ModPolicy: application.ModPolicy, Groups: map[string]*common.ConfigGroup{orgName: writeOrg}},
+		}},
+	}
+	configUpdateBytes, err := proto.Marshal(configUpdate)
+	if err != nil {
+		return err
+	}
+	return setup.sendConfigUpdate(configUpdateBytes)
+}
+
+// organizationGroupName returns the name of the group of the application organisation of the MSP
+func organizationGroupName(application *common.ConfigGroup, mspID string) (string, error) {
+	for name, group := range application.Groups {
+		mspValue, ok := group.Values[fabricConfig.MSPKey]
+		if !ok {
+			continue
+		}
+		mspConfig := &msp.MSPConfig{}
+		if err := proto.Unmarshal(mspValue.Value, mspConfig); err != nil {
+			return "", fmt.Errorf("Unable to read the MSP of the organisation %s: %v", name, err)
+		}
+		fabricMSPConfig := &msp.FabricMSPConfig{}
+		if err := proto.Unmarshal(mspConfig.Config, fabricMSPConfig); err != nil {
+			return "", fmt.Errorf("Unable to read the MSP of the organisation %s: %v", name, err)
+		}
+		if fabricMSPConfig.Name == mspID {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("No organisation of the MSP %s in the channel", mspID)
+}
+
+// sendConfigUpdate signs the marshalled ConfigUpdate with the organisation admin, sends it to the orderer
+// and waits until the configuration sequence read from the peer increases, up to CommitTimeout
+func (setup *FabricSetup) sendConfigUpdate(configUpdate []byte) error {
+	if !setup.Initialized {
+		return fmt.Errorf("Unable to update the channel (%s): the setup is not initialized", setup.ChannelId)
+	}
+	sequence, err := setup.GetConfigSequence()
+	if err != nil {
+		return err
+	}
+
+	err = setup.asUser(setup.orgUser, func() error {
+		signature, err := setup.Client.SignChannelConfig(configUpdate)
+		if err != nil {
+			return fmt.Errorf("Error signing configuration: %v", err)
+		}
+		txID, nonce, err := setup.newTxID()
+		if err != nil {
+			return err
+		}
+		err = setup.Client.CreateChannel(&api.CreateChannelRequest{
+			Name:		setup.ChannelId,
+			Orderer:	setup.orderingService(setup.Channel),
+			Config:		configUpdate,
+			Signatures:	[]*common.ConfigSignature{signature},
+			TxID:		txID,
+			Nonce:		nonce,
+		})
+		if err != nil {
+			return fmt.Errorf("Channel configuration update return error: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	timeout := setup.CommitTimeout
+	if timeout == 0 {
+		timeout = defaultCommitTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		current, err := setup.GetConfigSequence()
+		if err == nil && current > sequence {
+			setup.logger().Printf("Configuration of the channel %s updated to the sequence %d", setup.ChannelId, current)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &TimeoutError{Operation: "Channel configuration update", Timeout: timeout}
+		}
+		time.Sleep(configUpdatePollInterval)
+	}
+}
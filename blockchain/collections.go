@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// CollectionConfig is a private data collection of the chaincode, in the format of the collections
+// configuration file of Fabric. The members of the collection keep its data, the ledger only gets their hash.
+type CollectionConfig struct {
+	Name				string	`json:"name"`
+	Policy				string	`json:"policy"`	// Members of the collection, in the Fabric policy syntax, e.g. "OR('Org1MSP.member')"
+	RequiredPeerCount	int32	`json:"requiredPeerCount"`	// Peers the data must be disseminated to before the endorsement
+	MaxPeerCount		int32	`json:"maxPeerCount"`
+	BlockToLive			uint64	`json:"blockToLive"`	// Blocks after which the data is purged, never when 0
+	MemberOnlyRead		bool	`json:"memberOnlyRead"`
+}
+
+// LoadCollections reads a collections configuration file, a JSON array of CollectionConfig
+func LoadCollections(path string) ([]CollectionConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the collections configuration: %v", err)
+	}
+	var collections []CollectionConfig
+	if err := json.Unmarshal(content, &collections); err != nil {
+		return nil, fmt.Errorf("Unable to parse the collections configuration (%s): %v", path, err)
+	}
+	return collections, nil
+}
+
+// collections returns the collections of the chaincode: Collections, else the ones of CollectionsConfigFile
+func (setup *FabricSetup) collections() ([]CollectionConfig, error) {
+	if setup.Collections != nil || setup.CollectionsConfigFile == "" {
+		return setup.Collections, nil
+	}
+	return LoadCollections(setup.CollectionsConfigFile)
+}
+
+// collectionsPackage returns the marshalled collection configuration package given to the lifecycle chaincode,
+// nil without collection
+func collectionsPackage(collections []CollectionConfig) ([]byte, error) {
+	if len(collections) == 0 {
+		return nil, nil
+	}
+	configPackage := &collectionConfigPackage{}
+	names := make(map[string]bool)
+	for _, collection := range collections {
+		if collection.Name == "" {
+			return nil, fmt.Errorf("A collection has no name")
+		}
+		if names[collection.Name] {
+			return nil, fmt.Errorf("The collection %s is defined twice", collection.Name)
+		}
+		names[collection.Name] = true
+		if collection.RequiredPeerCount < 0 || collection.MaxPeerCount < collection.RequiredPeerCount {
+			return nil, fmt.Errorf("The collection %s needs %d peers out of %d at most", collection.Name, collection.RequiredPeerCount, collection.MaxPeerCount)
+		}
+		policy, err := cauthdsl.FromString(collection.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid policy of the collection %s (%s): %v", collection.Name, collection.Policy, err)
+		}
+		configPackage.Config = append(configPackage.Config, &collectionConfigProto{
+			StaticCollectionConfig: &staticCollectionConfig{
+				Name:				collection.Name,
+				MemberOrgsPolicy:	&collectionPolicyConfig{SignaturePolicy: policy},
+				RequiredPeerCount:	collection.RequiredPeerCount,
+				MaximumPeerCount:	collection.MaxPeerCount,
+				BlockToLive:		collection.BlockToLive,
+				MemberOnlyRead:		collection.MemberOnlyRead,
+			},
+		})
+	}
+	return proto.Marshal(configPackage)
+}
+
+// createDeployProposalWithCollections is protosUtils.CreateDeployProposalFromCDS (or the upgrade one) with the
+// collection configuration package as last argument of the lifecycle chaincode, which the vendored utils don't support
+func createDeployProposalWithCollections(operation string, channelID string, cds *pb.ChaincodeDeploymentSpec, creator []byte, policy []byte, collections []byte) (*pb.Proposal, string, error) {
+	cdsBytes, err := proto.Marshal(cds)
+	if err != nil {
+		return nil, "", err
+	}
+	lsccOperation := "deploy"
+	if operation == deployUpgrade {
+		lsccOperation = "upgrade"
+	}
+	lsccSpec := &pb.ChaincodeInvocationSpec{
+		ChaincodeSpec: &pb.ChaincodeSpec{
+			Type:			pb.ChaincodeSpec_GOLANG,
+			ChaincodeId:	&pb.ChaincodeID{Name: "lscc"},
+			Input:			&pb.ChaincodeInput{Args: [][]byte{[]byte(lsccOperation), []byte(channelID), cdsBytes, policy, []byte("escc"), []byte("vscc"), collections}},
+		},
+	}
+	return protosUtils.CreateProposalFromCIS(common.HeaderType_ENDORSER_TRANSACTION, channelID, lsccSpec, creator)
+}
+
+// The messages of the collection configuration (common/collection.proto of Fabric 1.1 and later),
+// not in the vendored protos. A oneof with a single field is encoded as this field.
+
+type collectionConfigPackage struct {
+	Config	[]*collectionConfigProto	`protobuf:"bytes,1,rep,name=config"`
+}
+
+func (m *collectionConfigPackage) Reset()			{ *m = collectionConfigPackage{} }
+func (m *collectionConfigPackage) String() string	{ return proto.CompactTextString(m) }
+func (*collectionConfigPackage) ProtoMessage()		{}
+
+type collectionConfigProto struct {
+	StaticCollectionConfig	*staticCollectionConfig	`protobuf:"bytes,1,opt,name=static_collection_config,json=staticCollectionConfig"`
+}
+
+func (m *collectionConfigProto) Reset()			{ *m = collectionConfigProto{} }
+func (m *collectionConfigProto) String() string	{ return proto.CompactTextString(m) }
+func (*collectionConfigProto) ProtoMessage()		{}
+
+type staticCollectionConfig struct {
+	Name				string					`protobuf:"bytes,1,opt,name=name"`
+	MemberOrgsPolicy	*collectionPolicyConfig	`protobuf:"bytes,2,opt,name=member_orgs_policy,json=memberOrgsPolicy"`
+	RequiredPeerCount	int32					`protobuf:"varint,3,opt,name=required_peer_count,json=requiredPeerCount"`
+	MaximumPeerCount	int32					`protobuf:"varint,4,opt,name=maximum_peer_count,json=maximumPeerCount"`
+	BlockToLive			uint64					`protobuf:"varint,5,opt,name=block_to_live,json=blockToLive"`
+	MemberOnlyRead		bool					`protobuf:"varint,6,opt,name=member_only_read,json=memberOnlyRead"`
+}
+
+func (m *staticCollectionConfig) Reset()			{ *m = staticCollectionConfig{} }
+func (m *staticCollectionConfig) String() string	{ return proto.CompactTextString(m) }
+func (*staticCollectionConfig) ProtoMessage()		{}
+
+type collectionPolicyConfig struct {
+	SignaturePolicy	*common.SignaturePolicyEnvelope	`protobuf:"bytes,1,opt,name=signature_policy,json=signaturePolicy"`
+}
+
+func (m *collectionPolicyConfig) Reset()			{ *m = collectionPolicyConfig{} }
+func (m *collectionPolicyConfig) String() string	{ return proto.CompactTextString(m) }
+func (*collectionPolicyConfig) ProtoMessage()		{}
@@ -0,0 +1,119 @@
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// CommitStatus is the outcome of a transaction once its block is committed
+type CommitStatus struct {
+	TxID			string
+	BlockNumber		uint64
+	ValidationCode	pb.TxValidationCode
+	Endorsers		[]string	// URL of the peers whose endorsements are in the transaction
+}
+
+// Valid tells if the transaction is valid, i.e. its writes are applied to the ledger
+func (status *CommitStatus) Valid() bool {
+	return status.ValidationCode == pb.TxValidationCode_VALID
+}
+
+// err returns the typed error of an invalid transaction, nil for a valid one
+func (status *CommitStatus) err() error {
+	if status.Valid() {
+		return nil
+	}
+	cause := fmt.Errorf("Transaction committed in the block %d with the validation code %s", status.BlockNumber, status.ValidationCode)
+	return validationError(status.TxID, status.ValidationCode, cause)
+}
+
+// commitWaiters delivers the commit status of the awaited transactions, read from the blocks received by the event hub.
+// The SDK transaction callback only gives the validation code, not the block.
+type commitWaiters struct {
+	mutex	sync.Mutex
+	waiters	map[string]chan *CommitStatus
+}
+
+// registerTxEvent registers for the commit of the transaction: the returned channel receives its status.
+// The registration must be removed with unregisterTxEvent once the status is received.
+// Registering twice the same transaction replaces the first registration, so a retry never duplicates it.
+func (setup *FabricSetup) registerTxEvent(txID string) (<-chan *CommitStatus, error) {
+	if err := setup.ensureEventHubConnected(); err != nil {
+		return nil, err
+	}
+
+	result := make(chan *CommitStatus, 1)
+	setup.commits.mutex.Lock()
+	defer setup.commits.mutex.Unlock()
+	if setup.commits.waiters == nil {
+		setup.commits.waiters = make(map[string]chan *CommitStatus)
+	}
+	setup.commits.waiters[txID] = result
+	return result, nil
+}
+
+// unregisterTxEvent removes the registration of registerTxEvent
+func (setup *FabricSetup) unregisterTxEvent(txID string) {
+	setup.commits.mutex.Lock()
+	defer setup.commits.mutex.Unlock()
+	delete(setup.commits.waiters, txID)
+}
+
+// deliverCommits is the block callback of the event hub giving their status to the awaited transactions
+func (setup *FabricSetup) deliverCommits(block *common.Block) {
+	if block.Header == nil || block.Data == nil {
+		return
+	}
+	var validationCodes []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		validationCodes = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	setup.commits.mutex.Lock()
+	defer setup.commits.mutex.Unlock()
+	if len(setup.commits.waiters) == 0 {
+		return
+	}
+	for i, data := range block.Data.Data {
+		txID, err := envelopeTxID(data)
+		if err != nil {
+			continue
+		}
+		result, ok := setup.commits.waiters[txID]
+		if !ok {
+			continue
+		}
+		status := &CommitStatus{TxID: txID, BlockNumber: block.Header.Number, ValidationCode: pb.TxValidationCode_INVALID_OTHER_REASON}
+		if i < len(validationCodes) {
+			status.ValidationCode = pb.TxValidationCode(validationCodes[i])
+		}
+		// A replayed block can deliver the status twice, only the first one is kept
+		select {
+		case result <- status:
+		default:
+		}
+	}
+}
+
+// envelopeTxID returns the transaction ID of the envelope of a block
+func envelopeTxID(data []byte) (string, error) {
+	envelope, err := protosUtils.GetEnvelopeFromBlock(data)
+	if err != nil {
+		return "", err
+	}
+	payload, err := protosUtils.ExtractPayload(envelope)
+	if err != nil {
+		return "", err
+	}
+	if payload.Header == nil {
+		return "", fmt.Errorf("The transaction has no header")
+	}
+	channelHeader, err := protosUtils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return "", err
+	}
+	return channelHeader.TxId, nil
+}
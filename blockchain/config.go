@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config is the network parameters of a setup, so the same binary can target another network
+type Config struct {
+	ChannelId			string	// HEROES_CHANNEL_ID, "mychannel" by default
+	ChannelConfig		string	// HEROES_CHANNEL_CONFIG, "fixtures/channel/mychannel.tx" by default
+	FabricVersion		string	// HEROES_FABRIC_VERSION, version of Fabric run by the network, the "1.0" of the fixtures by default
+	ChaincodeId			string	// HEROES_CHAINCODE_ID, "heroes-service" by default
+	ChaincodeVersion	string	// HEROES_CHAINCODE_VERSION, "v1.0.0" by default
+	ChaincodeGoPath		string	// HEROES_CHAINCODE_GOPATH, the GOPATH by default
+	ChaincodePath		string	// HEROES_CHAINCODE_PATH, directory of a Node or Java chaincode, "github.com/chainhero/heroes-service/chaincode" by default
+	ChaincodeLang		string	// HEROES_CHAINCODE_LANG, "golang", "node" or "java", "golang" by default
+	ChaincodeLifecycle	string	// HEROES_CHAINCODE_LIFECYCLE, "v2" for the lifecycle of Fabric 2.x (experimental), the instantiate of Fabric 1.x by default
+	ChaincodeAddress	string	// HEROES_CHAINCODE_ADDRESS, address of the chaincode run as an external service, none by default
+	EndorsementPolicy	string	// HEROES_ENDORSEMENT_POLICY, in the Fabric policy syntax, any member of the organisation by default
+	CollectionsConfig	string	// HEROES_COLLECTIONS_CONFIG, JSON file of the private data collections, none by default
+	Orderers			string	// HEROES_ORDERERS, the other orderers, comma separated host:port[=serverHostOverride], none by default
+	ConfigFile			string	// HEROES_CONFIG_FILE, "config.yaml" by default
+	AdminUser			string	// HEROES_ADMIN_USER, bootstrap admin of the Fabric CA, "admin" by default
+	AdminPassword		string	// HEROES_ADMIN_PASSWORD, its enrollment secret, "adminpw" by default
+	OrdererAdminMSP		string	// HEROES_ORDERER_ADMIN_MSP, MSP directory of the orderer admin in the crypto config, the one of the fixtures by default
+	OrgAdminMSP			string	// HEROES_ORG_ADMIN_MSP, MSP directory of the organisation admin in the crypto config, the one of the fixtures by default
+	StateStore			string	// HEROES_STATE_STORE, directory of the state stores of the enrolled users, "/tmp/enroll_user" by default
+	HSMLibrary			string	// HEROES_PKCS11_LIBRARY, PKCS#11 library of the HSM holding the keys, software keys by default
+	HSMLabel			string	// HEROES_PKCS11_LABEL, label of the token of the HSM
+	HSMPin				string	// HEROES_PKCS11_PIN, user PIN of the token
+	TLSClientCert		string	// HEROES_TLS_CLIENT_CERT, PEM certificate presented to the peers and orderers, none by default
+	TLSClientKey		string	// HEROES_TLS_CLIENT_KEY, its PEM private key
+	VaultAddress		string	// HEROES_VAULT_ADDR, Vault server holding the secrets of the setup, none by default
+	VaultToken			string	// HEROES_VAULT_TOKEN, VAULT_TOKEN by default
+	VaultPath			string	// HEROES_VAULT_PATH, path of the secret in the "secret" key/value engine, "heroes-service" by default
+	SecretsDir			string	// HEROES_SECRETS_DIR, directory of the secret files, used when Vault hasn't the secret, none by default
+	AuditLog			string	// HEROES_AUDIT_LOG, file of the audit log of the invokes and queries, or "syslog", none by default
+	QueryCacheSize		int		// HEROES_QUERY_CACHE_SIZE, queries kept in the cache, none by default
+	ProjectionDriver	string	// HEROES_PROJECTION_DRIVER, "postgres" or "sqlite3", database of the heroes projected by the web application, none by default
+	ProjectionDSN		string	// HEROES_PROJECTION_DSN, data source name of the database
+	PeerConnections		int		// HEROES_PEER_CONNECTIONS, connections opened to a peer, 1 by default
+	PeerMaxIdle			int		// HEROES_PEER_MAX_IDLE, connections to a peer kept without proposal, all by default
+	PeerIdleTimeout		time.Duration	// HEROES_PEER_IDLE_TIMEOUT, e.g. "5m", a connection without proposal is closed after it, never by default
+	PeerKeepAlive		time.Duration	// HEROES_PEER_KEEPALIVE, e.g. "2m", a connection without activity is pinged after it, no ping by default
+}
+
+// DefaultConfig returns the parameters of the heroes-service network, overridden by the environment variables
+func DefaultConfig() Config {
+	return configFrom(os.LookupEnv)
+}
+
+// configFrom returns the parameters of the heroes-service network, overridden by the variables found by lookup
+func configFrom(lookup func(name string) (string, bool)) Config {
+	get := func(name string, defaultValue string) string {
+		if value, ok := lookup(name); ok && value != "" {
+			return value
+		}
+		return defaultValue
+	}
+	getInt := func(name string, defaultValue int) int {
+		value, err := strconv.Atoi(get(name, ""))
+		if err != nil {
+			return defaultValue
+		}
+		return value
+	}
+	getDuration := func(name string) time.Duration {
+		value, err := time.ParseDuration(get(name, "0"))
+		if err != nil {
+			return 0
+		}
+		return value
+	}
+	return Config{
+		ChannelId:			get("HEROES_CHANNEL_ID", "mychannel"),
+		ChannelConfig:		get("HEROES_CHANNEL_CONFIG", "fixtures/channel/mychannel.tx"),
+		FabricVersion:		get("HEROES_FABRIC_VERSION", ""),
+		ChaincodeId:		get("HEROES_CHAINCODE_ID", "heroes-service"),
+		ChaincodeVersion:	get("HEROES_CHAINCODE_VERSION", "v1.0.0"),
+		ChaincodeGoPath:	get("HEROES_CHAINCODE_GOPATH", os.Getenv("GOPATH")),
+		ChaincodePath:		get("HEROES_CHAINCODE_PATH", "github.com/chainhero/heroes-service/chaincode"),
+		ChaincodeLang:		get("HEROES_CHAINCODE_LANG", ""),
+		ChaincodeLifecycle:	get("HEROES_CHAINCODE_LIFECYCLE", ""),
+		ChaincodeAddress:	get("HEROES_CHAINCODE_ADDRESS", ""),
+		EndorsementPolicy:	get("HEROES_ENDORSEMENT_POLICY", ""),
+		CollectionsConfig:	get("HEROES_COLLECTIONS_CONFIG", ""),
+		Orderers:			get("HEROES_ORDERERS", ""),
+		ConfigFile:			get("HEROES_CONFIG_FILE", defaultConfigFile),
+		AdminUser:			get("HEROES_ADMIN_USER", defaultAdminUser),
+		AdminPassword:		get("HEROES_ADMIN_PASSWORD", defaultAdminPassword),
+		OrdererAdminMSP:	get("HEROES_ORDERER_ADMIN_MSP", defaultOrdererAdminCertPath),
+		OrgAdminMSP:		get("HEROES_ORG_ADMIN_MSP", defaultOrgAdminCertPath),
+		StateStore:			get("HEROES_STATE_STORE", defaultStateStoreBasePath),
+		HSMLibrary:			get("HEROES_PKCS11_LIBRARY", ""),
+		HSMLabel:			get("HEROES_PKCS11_LABEL", ""),
+		HSMPin:				get("HEROES_PKCS11_PIN", ""),
+		TLSClientCert:		get("HEROES_TLS_CLIENT_CERT", ""),
+		TLSClientKey:		get("HEROES_TLS_CLIENT_KEY", ""),
+		VaultAddress:		get("HEROES_VAULT_ADDR", ""),
+		VaultToken:			get("HEROES_VAULT_TOKEN", get("VAULT_TOKEN", "")),
+		VaultPath:			get("HEROES_VAULT_PATH", "heroes-service"),
+		SecretsDir:			get("HEROES_SECRETS_DIR", ""),
+		AuditLog:			get("HEROES_AUDIT_LOG", ""),
+		QueryCacheSize:		getInt("HEROES_QUERY_CACHE_SIZE", 0),
+		ProjectionDriver:	get("HEROES_PROJECTION_DRIVER", ""),
+		ProjectionDSN:		get("HEROES_PROJECTION_DSN", ""),
+		PeerConnections:	getInt("HEROES_PEER_CONNECTIONS", 0),
+		PeerMaxIdle:		getInt("HEROES_PEER_MAX_IDLE", 0),
+		PeerIdleTimeout:	getDuration("HEROES_PEER_IDLE_TIMEOUT"),
+		PeerKeepAlive:		getDuration("HEROES_PEER_KEEPALIVE"),
+	}
+}
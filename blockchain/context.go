@@ -0,0 +1,84 @@
+package blockchain
+
+import (
+	"context"
+	"time"
+)
+
+// withContext runs the operation, giving up as soon as the context is done: a TimeoutError
+// wrapping ctx.Err() is returned when the deadline is exceeded, ctx.Err() when it is canceled.
+// Timeout is applied when the context has no deadline.
+// The SDK calls can't be interrupted: an abandoned operation ends in the background,
+// bounded by the timeouts of the SDK, and its result is dropped.
+func (setup *FabricSetup) withContext(ctx context.Context, name string, operation func() error) error {
+	if _, ok := ctx.Deadline(); !ok && setup.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, setup.Timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return contextError(name, err)
+	}
+
+	// Buffered, so the goroutine of an abandoned operation doesn't leak
+	done := make(chan error, 1)
+	go func() {
+		done <- operation()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return contextError(name, ctx.Err())
+	}
+}
+
+// contextError returns a TimeoutError when the deadline of the context is exceeded
+func contextError(name string, err error) error {
+	if err == context.DeadlineExceeded {
+		return &TimeoutError{Operation: name, Cause: err}
+	}
+	return err
+}
+
+// runWithTimeout runs the call, returning a TimeoutError when it doesn't end within the timeout (no limit when not set).
+// Like withContext, the abandoned call ends in the background.
+func runWithTimeout(name string, txID string, timeout time.Duration, call func() error) error {
+	if timeout <= 0 {
+		return call()
+	}
+	done := make(chan error, 1)
+	go func() { done <- call() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return &TimeoutError{Operation: name, TxID: txID, Timeout: timeout}
+	}
+}
+
+// InitializeWithContext is like Initialize, but gives up when the context is done.
+// The setup must not be used after an initialization that gave up.
+func (setup *FabricSetup) InitializeWithContext(ctx context.Context) error {
+	return setup.withContext(ctx, "Initialize", func() error {
+		return setup.initialize(ctx)
+	})
+}
+
+// InstallAndInstantiateCCWithContext is like InstallAndInstantiateCC, but gives up when the context is done
+func (setup *FabricSetup) InstallAndInstantiateCCWithContext(ctx context.Context, args []string) error {
+	return setup.withContext(ctx, "InstallAndInstantiateCC", func() error {
+		return setup.InstallAndInstantiateCC(args)
+	})
+}
+
+// UpgradeCCWithContext is like UpgradeCC, but gives up when the context is done
+func (setup *FabricSetup) UpgradeCCWithContext(ctx context.Context, newVersion string, args [][]byte) error {
+	return setup.withContext(ctx, "UpgradeCC", func() error {
+		return setup.UpgradeCC(newVersion, args)
+	})
+}
@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	sdkUser "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/user"
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+// CredentialFormat is the encoding of the certificate and key files of a user
+type CredentialFormat string
+
+const (
+	// FormatPEM is a PEM certificate file and a PEM key file
+	FormatPEM CredentialFormat = "pem"
+	// FormatDER is a DER certificate file and a DER key file
+	FormatDER CredentialFormat = "der"
+	// FormatBundle is a single PEM file holding the certificate and the key
+	FormatBundle CredentialFormat = "bundle"
+)
+
+// UserCredentials gives the explicit location of the certificate and key of a pre-enrolled user
+type UserCredentials struct {
+	Name		string
+	Format		CredentialFormat	// FormatPEM when empty
+	CertPath	string
+	KeyPath		string				// Not used with FormatBundle
+}
+
+// loadUser reads the certificate and the key of the user and imports the key in the crypto suite
+func loadUser(client api.FabricClient, credentials *UserCredentials) (api.User, error) {
+	var certBlock, keyBlock []byte
+
+	switch credentials.Format {
+	case FormatPEM, "":
+		certData, err := ioutil.ReadFile(credentials.CertPath)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the certificate of %s: %v", credentials.Name, err)
+		}
+		keyData, err := ioutil.ReadFile(credentials.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the key of %s: %v", credentials.Name, err)
+		}
+		if certBlock = findPEMBlock(certData, "CERTIFICATE"); certBlock == nil {
+			return nil, fmt.Errorf("No PEM certificate found in %s", credentials.CertPath)
+		}
+		if keyBlock = findPEMBlock(keyData, "PRIVATE KEY"); keyBlock == nil {
+			return nil, fmt.Errorf("No PEM private key found in %s", credentials.KeyPath)
+		}
+
+	case FormatDER:
+		var err error
+		certBlock, err = ioutil.ReadFile(credentials.CertPath)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the certificate of %s: %v", credentials.Name, err)
+		}
+		keyBlock, err = ioutil.ReadFile(credentials.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the key of %s: %v", credentials.Name, err)
+		}
+
+	case FormatBundle:
+		data, err := ioutil.ReadFile(credentials.CertPath)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the bundle of %s: %v", credentials.Name, err)
+		}
+		if certBlock = findPEMBlock(data, "CERTIFICATE"); certBlock == nil {
+			return nil, fmt.Errorf("No PEM certificate found in the bundle %s", credentials.CertPath)
+		}
+		if keyBlock = findPEMBlock(data, "PRIVATE KEY"); keyBlock == nil {
+			return nil, fmt.Errorf("No PEM private key found in the bundle %s", credentials.CertPath)
+		}
+
+	default:
+		return nil, fmt.Errorf("Unknown credential format (%s) for %s", credentials.Format, credentials.Name)
+	}
+
+	return importUser(client, credentials.Name, certBlock, keyBlock)
+}
+
+// importUser returns the user of the DER certificate and key, the key being imported in the crypto suite
+func importUser(client api.FabricClient, name string, certBlock []byte, keyBlock []byte) (api.User, error) {
+	// Make sure the certificate can be parsed before giving it to the SDK
+	if _, err := x509.ParseCertificate(certBlock); err != nil {
+		return nil, fmt.Errorf("Unable to parse the certificate of %s: %v", name, err)
+	}
+
+	// Import the private key (PKCS#1, PKCS#8 or SEC 1) in the crypto suite
+	privateKey, err := client.GetCryptoSuite().KeyImport(keyBlock, &bccsp.ECDSAPrivateKeyImportOpts{Temporary: true})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to import the key of %s: %v", name, err)
+	}
+
+	// The SDK expects the enrollment certificate to be PEM encoded
+	user := sdkUser.NewUser(name)
+	user.SetEnrollmentCertificate(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBlock}))
+	user.SetPrivateKey(privateKey)
+
+	return user, nil
+}
+
+// findPEMBlock returns the content of the first PEM block whose type ends with the given suffix
+func findPEMBlock(data []byte, typeSuffix string) []byte {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		if strings.HasSuffix(block.Type, typeSuffix) {
+			return block.Bytes
+		}
+	}
+}
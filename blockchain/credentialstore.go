@@ -0,0 +1,295 @@
+package blockchain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fabricClient "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client"
+	kvs "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/keyvaluestore"
+	sdkUser "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/user"
+	fabricCAClient "github.com/hyperledger/fabric-sdk-go/pkg/fabric-ca-client"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+)
+
+// ErrCredentialsNotFound is returned by a CredentialStore without the user, which is enrolled then
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
+// CredentialStore keeps the enrollment certificates of the users, by user name (the state store of the client),
+// and the credentials of the pre-enrolled orderer and organisation admins.
+// The private keys of the enrolled users stay in the keystore of the BCCSP (see config.yaml).
+// GetValue fails with an error matching ErrCredentialsNotFound when the user is unknown.
+type CredentialStore interface {
+	GetValue(key string) ([]byte, error)
+	SetValue(key string, value []byte) error
+}
+
+// fileCredentialStore is the file store of the SDK, telling the unknown users apart
+type fileCredentialStore struct {
+	*kvs.FileKeyValueStore
+}
+
+// NewFileCredentialStore returns a store keeping each user in a file of the directory, the default store
+func NewFileCredentialStore(path string) (CredentialStore, error) {
+	store, err := kvs.CreateNewFileKeyValueStore(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create the credential store (%s): %v", path, err)
+	}
+	return fileCredentialStore{store}, nil
+}
+
+func (store fileCredentialStore) GetValue(key string) ([]byte, error) {
+	if err := checkCredentialName(key); err != nil {
+		return nil, err
+	}
+	value, err := store.FileKeyValueStore.GetValue(key)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No credentials for %s: %w", key, ErrCredentialsNotFound)
+	}
+	return value, err
+}
+
+func (store fileCredentialStore) SetValue(key string, value []byte) error {
+	if err := checkCredentialName(key); err != nil {
+		return err
+	}
+	return store.FileKeyValueStore.SetValue(key, value)
+}
+
+// checkCredentialName refuses the names which aren't a file of the directory of a store, e.g. "../x".
+// The names of WithIdentity come from the requests of the web application and the administrative API.
+func checkCredentialName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return fmt.Errorf("Invalid user name %q", name)
+	}
+	return nil
+}
+
+// memoryCredentialStore keeps the users in memory, they are enrolled again by the next run
+type memoryCredentialStore struct {
+	mutex	sync.Mutex
+	values	map[string][]byte
+}
+
+// NewMemoryCredentialStore returns a store keeping the users in memory, e.g. for the tests or several instances on a host
+func NewMemoryCredentialStore() CredentialStore {
+	return &memoryCredentialStore{values: make(map[string][]byte)}
+}
+
+func (store *memoryCredentialStore) GetValue(key string) ([]byte, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	value, ok := store.values[key]
+	if !ok {
+		return nil, fmt.Errorf("No credentials for %s: %w", key, ErrCredentialsNotFound)
+	}
+	return value, nil
+}
+
+func (store *memoryCredentialStore) SetValue(key string, value []byte) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.values[key] = value
+	return nil
+}
+
+// encryptedFileCredentialStore keeps each user in a file encrypted with AES-GCM, the nonce followed by the ciphertext
+type encryptedFileCredentialStore struct {
+	path	string
+	aead	cipher.AEAD
+}
+
+// NewEncryptedFileCredentialStore returns a store keeping each user in a file of the directory, encrypted
+// with the AES key (16, 24 or 32 bytes)
+func NewEncryptedFileCredentialStore(path string, key []byte) (CredentialStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid key of the credential store: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create the cipher of the credential store: %v", err)
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, fmt.Errorf("Unable to create the credential store (%s): %v", path, err)
+	}
+	return &encryptedFileCredentialStore{path: path, aead: aead}, nil
+}
+
+func (store *encryptedFileCredentialStore) GetValue(key string) ([]byte, error) {
+	if err := checkCredentialName(key); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(store.path, key+".enc"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No credentials for %s: %w", key, ErrCredentialsNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := store.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("The credentials of %s are truncated", key)
+	}
+	value, err := store.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt the credentials of %s: %v", key, err)
+	}
+	return value, nil
+}
+
+func (store *encryptedFileCredentialStore) SetValue(key string, value []byte) error {
+	if err := checkCredentialName(key); err != nil {
+		return err
+	}
+	nonce := make([]byte, store.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	// The user name is authenticated, so the file of a user can't be swapped with the one of another user
+	data := store.aead.Seal(nonce, nonce, value, []byte(key))
+	return ioutil.WriteFile(filepath.Join(store.path, key+".enc"), data, 0600)
+}
+
+// newClient creates the client using the credential store as state store, and gives it the user enrolled
+// before, or enrolls it with the Fabric CA
+func newClient(config api.Config, store CredentialStore, name string, secret string) (api.FabricClient, error) {
+	client := fabricClient.NewClient(config)
+	client.SetCryptoSuite(bccspFactory.GetDefault())
+	client.SetStateStore(store)
+
+	user, err := loadStoredUser(client, store, name)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		caClient, err := fabricCAClient.NewFabricCAClient(config)
+		if err != nil {
+			return nil, fmt.Errorf("NewFabricCAClient return error: %v", err)
+		}
+		key, cert, err := caClient.Enroll(name, secret)
+		if err != nil {
+			return nil, fmt.Errorf("Enroll return error: %v", err)
+		}
+		enrolledUser := sdkUser.NewUser(name)
+		enrolledUser.SetPrivateKey(key)
+		enrolledUser.SetEnrollmentCertificate(cert)
+		if err := client.SaveUserToStateStore(enrolledUser, false); err != nil {
+			return nil, fmt.Errorf("client.SaveUserToStateStore return error: %v", err)
+		}
+		user = NewMSPUser(enrolledUser, config.GetFabricCAID())
+	}
+
+	client.SetUserContext(user)
+	return client, nil
+}
+
+// loadEnrolledUser reads the user enrolled before from the credential store, nil if it is unknown
+func (setup *FabricSetup) loadEnrolledUser(name string) (api.User, error) {
+	return loadStoredUser(setup.Client, setup.credentialStore, name)
+}
+
+// loadStoredUser reads the user from the store, with its private key from the keystore of the client, nil if it is unknown.
+// The client LoadUserFromStateStore returns the user context of the client once it is set, whatever the name.
+// A store which fails otherwise (e.g. decryption with another key) is an error, the user isn't enrolled again.
+func loadStoredUser(client api.FabricClient, store CredentialStore, name string) (api.User, error) {
+	if err := checkCredentialName(name); err != nil {
+		return nil, err
+	}
+	value, err := store.GetValue(name)
+	if errors.Is(err, ErrCredentialsNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the credentials of %s: %w", name, err)
+	}
+	var userJSON sdkUser.JSON
+	if err := json.Unmarshal(value, &userJSON); err != nil {
+		return nil, fmt.Errorf("Unable to read the credentials of %s: %v", name, err)
+	}
+	key, err := client.GetCryptoSuite().GetKey(userJSON.PrivateKeySKI)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the private key of %s: %v", name, err)
+	}
+	user := sdkUser.NewUser(name)
+	user.SetEnrollmentCertificate(userJSON.EnrollmentCertificate)
+	user.SetPrivateKey(key)
+	return NewMSPUser(user, client.GetConfig().GetFabricCAID()), nil
+}
+
+// preEnrolledCredentials is the value of a pre-enrolled user in the credential store, unlike the enrolled users
+// its key is kept too: it is imported in the crypto suite of each run, not in the keystore
+type preEnrolledCredentials struct {
+	Certificate	[]byte	`json:"certificate"`	// PEM
+	PrivateKey	[]byte	`json:"privateKey"`	// PEM
+}
+
+// loadPreEnrolledUser returns the pre-enrolled user (orderer or organisation admin) of the credential store. Unknown
+// by the store, it is read from the first files of its MSP directories (relative to the crypto config path) and
+// saved in the store: the next runs, or another instance sharing the store, don't need the MSP files.
+func loadPreEnrolledUser(client api.FabricClient, store CredentialStore, name string, keyDir string, certDir string) (api.User, error) {
+	storeKey := "preenrolled-" + name
+	credentials := &preEnrolledCredentials{}
+	fromFiles := false
+	value, err := store.GetValue(storeKey)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(value, credentials); err != nil {
+			return nil, fmt.Errorf("Unable to read the credentials of %s: %v", name, err)
+		}
+	case errors.Is(err, ErrCredentialsNotFound):
+		cryptoConfigPath := client.GetConfig().GetCryptoConfigPath()
+		if credentials.PrivateKey, err = readFirstFile(filepath.Join(cryptoConfigPath, keyDir)); err != nil {
+			return nil, fmt.Errorf("Unable to read the private key of %s: %v", name, err)
+		}
+		if credentials.Certificate, err = readFirstFile(filepath.Join(cryptoConfigPath, certDir)); err != nil {
+			return nil, fmt.Errorf("Unable to read the certificate of %s: %v", name, err)
+		}
+		fromFiles = true
+	default:
+		return nil, fmt.Errorf("Unable to read the credentials of %s: %w", name, err)
+	}
+
+	certBlock := findPEMBlock(credentials.Certificate, "CERTIFICATE")
+	if certBlock == nil {
+		return nil, fmt.Errorf("No PEM certificate found for %s", name)
+	}
+	keyBlock := findPEMBlock(credentials.PrivateKey, "PRIVATE KEY")
+	if keyBlock == nil {
+		return nil, fmt.Errorf("No PEM private key found for %s", name)
+	}
+	user, err := importUser(client, name, certBlock, keyBlock)
+	if err != nil {
+		return nil, err
+	}
+	if fromFiles {
+		value, _ := json.Marshal(credentials)
+		if err := store.SetValue(storeKey, value); err != nil {
+			return nil, fmt.Errorf("Unable to save the credentials of %s: %v", name, err)
+		}
+	}
+	return user, nil
+}
+
+// readFirstFile reads the first file of the directory, like the SDK does for the MSP directories
+func readFirstFile(dir string) ([]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			return ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		}
+	}
+	return nil, fmt.Errorf("No file in %s", dir)
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCredentialStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heroes-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileStore, err := NewFileCredentialStore(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedStore, err := NewEncryptedFileCredentialStore(filepath.Join(dir, "encrypted"), bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]CredentialStore{
+		"file":			fileStore,
+		"memory":		NewMemoryCredentialStore(),
+		"encrypted":	encryptedStore,
+	}
+	for name, store := range stores {
+		if _, err := store.GetValue("alice"); !errors.Is(err, ErrCredentialsNotFound) {
+			t.Errorf("%s: got %v for an unknown user, want ErrCredentialsNotFound", name, err)
+		}
+		if err := store.SetValue("alice", []byte("certificate")); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		value, err := store.GetValue("alice")
+		if err != nil || string(value) != "certificate" {
+			t.Errorf("%s: got %q, %v", name, value, err)
+		}
+	}
+}
+
+func TestEncryptedCredentialStoreWithAnotherKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heroes-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := NewEncryptedFileCredentialStore(dir, bytes.Repeat([]byte{1}, 32))
+	if err := store.SetValue("alice", []byte("certificate")); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewEncryptedFileCredentialStore(dir, bytes.Repeat([]byte{2}, 32))
+	_, err = other.GetValue("alice")
+	if err == nil || errors.Is(err, ErrCredentialsNotFound) {
+		t.Errorf("Got %v, want a decryption error, not an unknown user", err)
+	}
+}
+
+func TestCredentialStoresRefusePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heroes-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileStore, _ := NewFileCredentialStore(filepath.Join(dir, "file"))
+	encryptedStore, _ := NewEncryptedFileCredentialStore(filepath.Join(dir, "encrypted"), bytes.Repeat([]byte{1}, 32))
+	for _, store := range []CredentialStore{fileStore, encryptedStore} {
+		for _, name := range []string{"", "../alice", "a/b", `a\\b`, ".."} {
+			if err := store.SetValue(name, []byte("x")); err == nil {
+				t.Errorf("The name %q was accepted by SetValue", name)
+			}
+			if _, err := store.GetValue(name); err == nil || errors.Is(err, ErrCredentialsNotFound) {
+				t.Errorf("The name %q was accepted by GetValue", name)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "alice.json")); !os.IsNotExist(err) {
+		t.Error("A file was written out of the store")
+	}
+}
@@ -0,0 +1,342 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// ChaincodeLang is the language (runtime) of the chaincode
+type ChaincodeLang string
+
+const (
+	LangGolang	ChaincodeLang = "golang"
+	LangNode	ChaincodeLang = "node"
+	LangJava	ChaincodeLang = "java"
+)
+
+// specType returns the type of the chaincode spec for the language, Go when not set
+func (lang ChaincodeLang) specType() (pb.ChaincodeSpec_Type, error) {
+	switch lang {
+	case "", LangGolang:
+		return pb.ChaincodeSpec_GOLANG, nil
+	case LangNode:
+		return pb.ChaincodeSpec_NODE, nil
+	case LangJava:
+		return pb.ChaincodeSpec_JAVA, nil
+	}
+	return pb.ChaincodeSpec_UNDEFINED, fmt.Errorf("Unknown chaincode language: %s", lang)
+}
+
+// validateChaincodeLang checks the language of the chaincode can be deployed, with a lifecycle and collections
+// supported by the Fabric version of the network, before any network call
+func (setup *FabricSetup) validateChaincodeLang() error {
+	if _, err := setup.ChaincodeLang.specType(); err != nil {
+		return err
+	}
+	if setup.ChaincodeLifecycle != LifecycleLegacy && setup.ChaincodeLifecycle != LifecycleV2 {
+		return fmt.Errorf("Unknown chaincode lifecycle: %s", setup.ChaincodeLifecycle)
+	}
+	if setup.ChaincodeLifecycle == LifecycleV2 {
+		if err := setup.requireFabric(fabricLifecycleV2, "The v2 lifecycle"); err != nil {
+			return err
+		}
+	}
+	if len(setup.Collections) > 0 || setup.CollectionsConfigFile != "" {
+		if err := setup.requireFabric(fabricCollections, "A private data collection"); err != nil {
+			return err
+		}
+	}
+	if setup.ChaincodeAddress != "" {
+		if setup.ChaincodeLifecycle != LifecycleV2 {
+			return fmt.Errorf("A chaincode run as an external service can only be deployed with the v2 lifecycle")
+		}
+		return setup.requireFabric(fabricExternalChaincode, "A chaincode run as an external service")
+	}
+	if (setup.ChaincodeLang == "" || setup.ChaincodeLang == LangGolang) && setup.ChaincodeGoPath == "" {
+		return fmt.Errorf("A Go chaincode can't be deployed without ChaincodeGoPath")
+	}
+	return nil
+}
+
+// initArgs returns the arguments of the Init function: the given ones, else ChaincodeInitArgs, else ["init"].
+// Like for QueryWith and InvokeWith, the first argument is the function name, so it can't be empty.
+func (setup *FabricSetup) initArgs(args []string) ([]string, error) {
+	if args == nil {
+		args = setup.ChaincodeInitArgs
+	}
+	if args == nil {
+		return []string{"init"}, nil
+	}
+	if len(args) == 0 || args[0] == "" {
+		return nil, fmt.Errorf("The init arguments must start with the function name")
+	}
+	return args, nil
+}
+
+// Deploy operations of the lifecycle system chaincode
+const (
+	deployInstantiate	= "instantiate"
+	deployUpgrade		= "upgrade"
+)
+
+// deployOn sends the instantiate (or upgrade) proposal of the chaincode to the peers of the target channel,
+// then sends the transaction to the orderer and waits for the deploy to be committed.
+// With the v2 lifecycle, the definition of the chaincode is approved and committed instead, see defineOn.
+func (setup *FabricSetup) deployOn(target channelTarget, operation string, args []string, policy []byte) error {
+	if setup.ChaincodeLifecycle == LifecycleV2 {
+		return setup.defineOn(target, args, policy)
+	}
+	proposal, err := setup.createDeployProposal(target, operation, args, policy)
+	if err != nil {
+		return err
+	}
+	var responses []*api.TransactionProposalResponse
+	err = setup.retry(target.callContext(), "The "+operation+" proposal", func() (err error) {
+		responses, err = target.channel.SendTransactionProposal(proposal, 0, setup.ownPeers(target.channel))	// Every peer of the organisation has the chaincode installed
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Send %s proposal return error: %v", operation, err)
+	}
+	if err := checkDeployResponses(operation, responses); err != nil {
+		return err
+	}
+	return setup.commitDeploy(target, operation, proposal.TransactionID, responses)
+}
+
+// checkDeployResponses checks every peer accepted the proposal: a rejected proposal (like an Init returning
+// an error) must not be sent to the orderer
+func checkDeployResponses(operation string, responses []*api.TransactionProposalResponse) error {
+	for _, response := range responses {
+		if response.Err != nil {
+			return fmt.Errorf("The %s proposal is rejected by %s: %v", operation, response.Endorser, response.Err)
+		}
+		if status := response.ProposalResponse.GetResponse().GetStatus(); status != 200 {
+			return fmt.Errorf("The %s proposal is rejected by %s with status %d: %s", operation, response.Endorser, status, response.ProposalResponse.GetResponse().GetMessage())
+		}
+	}
+	return nil
+}
+
+// commitDeploy sends the endorsed deploy transaction to the orderer and waits for it to be committed
+func (setup *FabricSetup) commitDeploy(target channelTarget, operation string, txID string, responses []*api.TransactionProposalResponse) error {
+
+	// Register for the deploy event before sending the transaction
+	committed, err := setup.registerTxEvent(txID)
+	if err != nil {
+		return fmt.Errorf("Register the %s event return error: %w", operation, err)
+	}
+	defer setup.unregisterTxEvent(txID)
+
+	err = runWithTimeout("Ordering", txID, setup.OrderingTimeout, func() error {
+		return setup.createAndSendTransaction(target, responses)
+	})
+	if err != nil {
+		return fmt.Errorf("Create and send %s transaction return error: %w", operation, err)
+	}
+	commitTimeout := setup.CommitTimeout
+	if commitTimeout == 0 {
+		commitTimeout = defaultCommitTimeout
+	}
+
+	select {
+		case status := <-committed:
+			return status.err()
+		case <-time.After(commitTimeout):
+			return &TimeoutError{Operation: "Commit event of the " + operation, TxID: txID, Timeout: commitTimeout}
+	}
+}
+
+// endorsementPolicy returns the marshalled signature policy envelope of endorsementEnvelope
+func (setup *FabricSetup) endorsementPolicy() ([]byte, error) {
+	envelope, err := setup.endorsementEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := proto.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to marshal the endorsement policy: %v", err)
+	}
+	return policy, nil
+}
+
+// endorsementEnvelope builds EndorsementRule, or parses EndorsementPolicy, into a signature policy envelope.
+// Without policy, like the SDK, any member of the organisation can endorse.
+func (setup *FabricSetup) endorsementEnvelope() (*common.SignaturePolicyEnvelope, error) {
+	switch {
+	case setup.EndorsementRule != nil:
+		return setup.EndorsementRule.envelope()
+	case setup.EndorsementPolicy != "":
+		envelope, err := cauthdsl.FromString(setup.EndorsementPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid endorsement policy (%s): %v", setup.EndorsementPolicy, err)
+		}
+		return envelope, nil
+	default:
+		return cauthdsl.SignedByMspMember(setup.Client.GetConfig().GetFabricCAID()), nil
+	}
+}
+
+// createDeployProposal builds and signs the proposal of the lifecycle system chaincode deploying the chaincode
+func (setup *FabricSetup) createDeployProposal(target channelTarget, operation string, args []string, policy []byte) (*api.TransactionProposal, error) {
+	specType, err := setup.ChaincodeLang.specType()
+	if err != nil {
+		return nil, err
+	}
+	argsArray := make([][]byte, len(args))
+	for i, arg := range args {
+		argsArray[i] = []byte(arg)
+	}
+	cds := &pb.ChaincodeDeploymentSpec{ChaincodeSpec: &pb.ChaincodeSpec{
+		Type:			specType,
+		ChaincodeId:	&pb.ChaincodeID{Name: target.chaincodeID, Path: target.chaincodePath, Version: target.chaincodeVersion},
+		Input:			&pb.ChaincodeInput{Args: argsArray},
+	}}
+
+	creator, err := setup.Client.GetIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the identity of the creator: %v", err)
+	}
+	collections, err := setup.collections()
+	if err != nil {
+		return nil, err
+	}
+	collectionsConfig, err := collectionsPackage(collections)
+	if err != nil {
+		return nil, err
+	}
+	var proposal *pb.Proposal
+	var txID string
+	if collectionsConfig != nil {
+		proposal, txID, err = createDeployProposalWithCollections(operation, target.channelID, cds, creator, policy, collectionsConfig)
+	} else {
+		create := protosUtils.CreateDeployProposalFromCDS
+		if operation == deployUpgrade {
+			create = protosUtils.CreateUpgradeProposalFromCDS
+		}
+		proposal, txID, err = create(target.channelID, cds, creator, policy, []byte("escc"), []byte("vscc"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create the %s proposal: %v", operation, err)
+	}
+
+	signedProposal, err := setup.signProposal(proposal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.TransactionProposal{
+		TransactionID:	txID,
+		SignedProposal:	signedProposal,
+		Proposal:		proposal,
+	}, nil
+}
+
+// installPackage installs the chaincode package on the peers of the organisation in the target channel.
+// The SDK only installs Go chaincodes, so the install proposal is built here for the other languages.
+func (setup *FabricSetup) installPackage(target channelTarget, chaincodePackage []byte) error {
+	specType, err := setup.ChaincodeLang.specType()
+	if err != nil {
+		return err
+	}
+	cds := &pb.ChaincodeDeploymentSpec{
+		ChaincodeSpec:	&pb.ChaincodeSpec{
+			Type:			specType,
+			ChaincodeId:	&pb.ChaincodeID{Name: target.chaincodeID, Path: target.chaincodePath, Version: target.chaincodeVersion},
+		},
+		CodePackage:	chaincodePackage,
+	}
+
+	creator, err := setup.Client.GetIdentity()
+	if err != nil {
+		return fmt.Errorf("Unable to get the identity of the creator: %v", err)
+	}
+	proposal, txID, err := protosUtils.CreateInstallProposalFromCDS(cds, creator)
+	if err != nil {
+		return fmt.Errorf("Unable to create the install proposal: %v", err)
+	}
+	signedProposal, err := setup.signProposal(proposal)
+	if err != nil {
+		return err
+	}
+
+	responses, err := target.channel.SendTransactionProposal(&api.TransactionProposal{
+		TransactionID:	txID,
+		SignedProposal:	signedProposal,
+		Proposal:		proposal,
+	}, 0, setup.ownPeers(target.channel))
+	if err != nil {
+		return err
+	}
+	for _, response := range responses {
+		if response.Err != nil {
+			return fmt.Errorf("The install proposal is rejected by %s: %v", response.Endorser, response.Err)
+		}
+		if status := response.ProposalResponse.GetResponse().GetStatus(); status != 200 {
+			return fmt.Errorf("The install proposal is rejected by %s with status %d: %s", response.Endorser, status, response.ProposalResponse.GetResponse().GetMessage())
+		}
+	}
+	return nil
+}
+
+// IsChaincodeInstalled tells if the chaincode is installed in its current version on every peer of the channel.
+// An error is returned when a peer can't be queried, (false, nil) when the chaincode isn't installed.
+func (setup *FabricSetup) IsChaincodeInstalled() (bool, error) {
+	return setup.isInstalledOn(setup.primaryTarget())
+}
+
+// IsChaincodeInstantiated tells if the chaincode is instantiated (its definition committed with the v2 lifecycle)
+// in its current version on the channel.
+// An error is returned when the channel can't be queried, (false, nil) when the chaincode isn't instantiated.
+func (setup *FabricSetup) IsChaincodeInstantiated() (bool, error) {
+	return setup.isInstantiatedOn(setup.primaryTarget())
+}
+
+// isInstalledOn asks each peer of the organisation in the target channel the chaincodes installed on it
+// (lscc getinstalledchaincodes, or the package of the label with the v2 lifecycle)
+func (setup *FabricSetup) isInstalledOn(target channelTarget) (bool, error) {
+	if setup.ChaincodeLifecycle == LifecycleV2 {
+		packageID, err := setup.installedPackageOn(target)
+		return packageID != "", err
+	}
+	for _, peer := range setup.ownPeers(target.channel) {
+		response, err := setup.Client.QueryInstalledChaincodes(peer)
+		if err != nil {
+			return false, fmt.Errorf("Unable to query the chaincodes installed on the peer %s: %v", peer.URL(), err)
+		}
+		if !containsChaincode(response, target.chaincodeID, target.chaincodeVersion) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// isInstantiatedOn asks the primary peer the chaincodes instantiated on the target channel (lscc getchaincodes,
+// or the definition committed with the v2 lifecycle)
+func (setup *FabricSetup) isInstantiatedOn(target channelTarget) (bool, error) {
+	if setup.ChaincodeLifecycle == LifecycleV2 {
+		definition, err := setup.committedDefinitionOn(target)
+		return definition != nil && definition.Version == target.chaincodeVersion, err
+	}
+	response, err := target.channel.QueryInstantiatedChaincodes()
+	if err != nil {
+		return false, fmt.Errorf("Unable to query the chaincodes instantiated on the channel (%s): %v", target.channelID, err)
+	}
+	return containsChaincode(response, target.chaincodeID, target.chaincodeVersion), nil
+}
+
+// containsChaincode tells if the chaincode is in the response, in the given version
+func containsChaincode(response *pb.ChaincodeQueryResponse, chaincodeID string, version string) bool {
+	for _, chaincode := range response.GetChaincodes() {
+		if chaincode.Name == chaincodeID && chaincode.Version == version {
+			return true
+		}
+	}
+	return false
+}
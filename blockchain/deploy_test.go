@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEndorsementPolicyMalformed(t *testing.T) {
+	for _, policy := range []string{
+		"AND(",
+		"AND('Org1MSP.member'",
+		"OR('Org1MSP.member',)",
+		"AND('Org1MSP.owner')",
+		"AND('Org1MSP')",
+		"NOT('Org1MSP.member')",
+		"AND(Org1MSP.member)",
+		"'Org1MSP.member' OR 'Org2MSP.member'",
+	} {
+		// Without client, a network call would panic
+		setup := &FabricSetup{EndorsementPolicy: policy, ChaincodeGoPath: "/go"}
+		if _, err := setup.endorsementPolicy(); err == nil || !strings.Contains(err.Error(), policy) {
+			t.Errorf("%q: got %v, want an error naming the policy", policy, err)
+		}
+		if err := setup.InstantiateCC(nil); err == nil || !strings.Contains(err.Error(), "Invalid endorsement policy") {
+			t.Errorf("%q: the instantiate returned %v", policy, err)
+		}
+		if err := setup.InstallAndInstantiateCC(nil); err == nil || !strings.Contains(err.Error(), "Invalid endorsement policy") {
+			t.Errorf("%q: the install returned %v", policy, err)
+		}
+	}
+
+	setup := &FabricSetup{EndorsementPolicy: "OR('Org1MSP.member', AND('Org2MSP.admin', 'Org3MSP.member'))"}
+	if _, err := setup.endorsementPolicy(); err != nil {
+		t.Errorf("A valid policy was refused: %v", err)
+	}
+}
+
+func TestEndorsementRuleMalformed(t *testing.T) {
+	for _, rule := range []*EndorsementRule{
+		{},
+		{MSPIDs: []string{"Org1MSP", ""}},
+		{MSPIDs: []string{"Org1MSP"}, N: 2},
+		{MSPIDs: []string{"Org1MSP"}, N: -1},
+		{MSPIDs: []string{"Org1MSP"}, Role: "owner"},
+	} {
+		setup := &FabricSetup{EndorsementRule: rule}
+		if _, err := setup.endorsementPolicy(); err == nil {
+			t.Errorf("The rule %+v was accepted", rule)
+		}
+	}
+}
+
+func TestValidateChaincodeLang(t *testing.T) {
+	tests := []struct {
+		name	string
+		setup	*FabricSetup
+		valid	bool
+	}{
+		{"Go by default", &FabricSetup{ChaincodeGoPath: "/go"}, true},
+		{"Go", &FabricSetup{ChaincodeLang: LangGolang, ChaincodeGoPath: "/go"}, true},
+		{"Go without GOPATH", &FabricSetup{}, false},
+		{"Go without GOPATH, explicit", &FabricSetup{ChaincodeLang: LangGolang}, false},
+		{"Node", &FabricSetup{ChaincodeLang: LangNode}, true},
+		{"Java", &FabricSetup{ChaincodeLang: LangJava}, true},
+		{"unknown language", &FabricSetup{ChaincodeLang: "cobol", ChaincodeGoPath: "/go"}, false},
+		{"case of the language", &FabricSetup{ChaincodeLang: "Node"}, false},
+		{"unknown lifecycle", &FabricSetup{ChaincodeLang: LangNode, ChaincodeLifecycle: "v3"}, false},
+		{"external service", &FabricSetup{ChaincodeAddress: "chaincode:9999", ChaincodeLifecycle: LifecycleV2, FabricVersion: "2.4"}, true},
+		{"external service with lscc", &FabricSetup{ChaincodeAddress: "chaincode:9999", FabricVersion: "2.4"}, false},
+		{"external service before Fabric 2.4", &FabricSetup{ChaincodeAddress: "chaincode:9999", ChaincodeLifecycle: LifecycleV2, FabricVersion: "2.2"}, false},
+		{"v2 lifecycle", &FabricSetup{ChaincodeLang: LangNode, ChaincodeLifecycle: LifecycleV2, FabricVersion: "2.0.1"}, true},
+		{"v2 lifecycle on Fabric 1.0", &FabricSetup{ChaincodeLang: LangNode, ChaincodeLifecycle: LifecycleV2}, false},
+		{"collections", &FabricSetup{ChaincodeLang: LangNode, CollectionsConfigFile: "collections.json", FabricVersion: "1.1"}, true},
+		{"collections on Fabric 1.0", &FabricSetup{ChaincodeLang: LangNode, Collections: []CollectionConfig{{Name: "secrets"}}}, false},
+		{"invalid Fabric version", &FabricSetup{ChaincodeLang: LangNode, ChaincodeLifecycle: LifecycleV2, FabricVersion: "two"}, false},
+	}
+	for _, test := range tests {
+		if err := test.setup.validateChaincodeLang(); (err == nil) != test.valid {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fabricClient "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/events"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/peer"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+const (
+	defaultDevModeAddress	= "localhost:9999"
+	devModeUser				= "developer"
+)
+
+// devInvocation is a proposal executed by the development server of the chaincode, see chaincode/devserver.go
+type devInvocation struct {
+	TxID			string		`json:"txId"`
+	Args			[][]byte	`json:"args"`
+	SignedProposal	[]byte		`json:"signedProposal"`
+}
+
+// devResult is the response of the chaincode to a devInvocation, with the last event it set
+type devResult struct {
+	Status			int32	`json:"status"`
+	Message			string	`json:"message"`
+	Payload			[]byte	`json:"payload"`
+	EventName		string	`json:"eventName"`
+	EventPayload	[]byte	`json:"eventPayload"`
+}
+
+// devModeAddress returns the address of the development server, DevModeAddress or its default
+func (setup *FabricSetup) devModeAddress() string {
+	if setup.DevModeAddress == "" {
+		return defaultDevModeAddress
+	}
+	return setup.DevModeAddress
+}
+
+// initializeDevMode sets up the client, the channel and the event hub of the development mode. The only peer
+// of the channel is the development server, signing nothing. The transactions are ordered by the setup itself,
+// each in a block of its own given at once to the event hub, the chaincode having already applied their writes.
+func (setup *FabricSetup) initializeDevMode(config api.Config) error {
+	client := fabricClient.NewClient(config)
+	client.SetCryptoSuite(bccspFactory.GetDefault())
+	user, err := newDevModeUser(client, config.GetFabricCAID())
+	if err != nil {
+		return setupError(PhaseEnrollment, err)
+	}
+	client.SetUserContext(user)
+
+	channel, err := client.NewChannel(setup.ChannelId)
+	if err != nil {
+		return setupError(PhaseConfig, fmt.Errorf("Create channel (%s) failed: %v", setup.ChannelId, err))
+	}
+	address := setup.devModeAddress()
+	processor := &devProcessor{address: address, client: &http.Client{Timeout: setup.ProposalTimeout}}
+	devPeer, err := peer.NewPeerFromProcessor(address, processor, config)
+	if err != nil {
+		return setupError(PhaseConfig, err)
+	}
+	if err := channel.AddPeer(devPeer); err != nil {
+		return setupError(PhaseConfig, err)
+	}
+
+	hub, err := events.NewEventHub(client)
+	if err != nil {
+		return setupError(PhaseEventHubConnect, fmt.Errorf("Error creating new event hub: %v", err))
+	}
+	eventHub := &devEventHub{EventHub: hub, connected: true}
+	if err := channel.AddOrderer(&devOrderer{url: address, eventHub: eventHub}); err != nil {
+		return setupError(PhaseConfig, err)
+	}
+	if setup.QueryCacheSize > 0 {
+		eventHub.RegisterBlockEvent(setup.invalidateQueryCache)
+	}
+	eventHub.RegisterBlockEvent(setup.deliverCommits)
+
+	setup.Client = client
+	setup.Channel = channel
+	setup.EventHub = eventHub
+	setup.submissions.reopen()
+	setup.Initialized = true
+	setup.logger().Printf("Development mode: the chaincode is run by the development server %s", address)
+	return nil
+}
+
+// newDevModeUser returns a user of the MSP with a self-signed certificate, the development server checking no identity
+func newDevModeUser(client api.FabricClient, mspID string) (api.User, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:	big.NewInt(1),
+		Subject:		pkix.Name{CommonName: devModeUser},
+		NotBefore:		time.Now(),
+		NotAfter:		time.Now().AddDate(1, 0, 0),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	user, err := importUser(client, devModeUser, certificate, keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewMSPUser(user, mspID), nil
+}
+
+// devProcessor endorses the proposals with the responses of the chaincode run by the development server
+type devProcessor struct {
+	address	string
+	client	*http.Client
+}
+
+// ProcessProposal has the proposal executed by the development server
+func (processor *devProcessor) ProcessProposal(proposal *api.TransactionProposal) (*api.TransactionProposalResponse, error) {
+	proposalPayload, err := protosUtils.GetChaincodeProposalPayload(proposal.Proposal.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the proposal payload: %v", err)
+	}
+	spec := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(proposalPayload.Input, spec); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the chaincode invocation: %v", err)
+	}
+	if spec.ChaincodeSpec == nil || spec.ChaincodeSpec.ChaincodeId == nil || spec.ChaincodeSpec.Input == nil {
+		return nil, fmt.Errorf("The proposal invokes no chaincode")
+	}
+	signedProposal, err := proto.Marshal(proposal.SignedProposal)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := processor.invoke(&devInvocation{TxID: proposal.TransactionID, Args: spec.ChaincodeSpec.Input.Args, SignedProposal: signedProposal})
+	if err != nil {
+		return nil, err
+	}
+	response := &pb.Response{Status: result.Status, Message: result.Message, Payload: result.Payload}
+	var event []byte
+	if result.EventName != "" {
+		event, err = protosUtils.GetBytesChaincodeEvent(&pb.ChaincodeEvent{
+			ChaincodeId:	spec.ChaincodeSpec.ChaincodeId.Name,
+			TxId:			proposal.TransactionID,
+			EventName:		result.EventName,
+			Payload:		result.EventPayload,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The response payload of a peer, for the transaction and its events
+	header, err := protosUtils.GetHeader(proposal.Proposal.Header)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the proposal header: %v", err)
+	}
+	hash, err := protosUtils.GetProposalHash1(header, proposal.Proposal.Payload, nil)
+	if err != nil {
+		return nil, err
+	}
+	responsePayload, err := protosUtils.GetBytesProposalResponsePayload(hash, response, nil, event, spec.ChaincodeSpec.ChaincodeId)
+	if err != nil {
+		return nil, err
+	}
+	return &api.TransactionProposalResponse{
+		Endorser:			processor.address,
+		Status:				result.Status,
+		Proposal:			proposal,
+		ProposalResponse:	&pb.ProposalResponse{Version: 1, Response: response, Payload: responsePayload, Endorsement: &pb.Endorsement{}},
+	}, nil
+}
+
+// invoke sends the invocation to the development server and returns the response of the chaincode
+func (processor *devProcessor) invoke(invocation *devInvocation) (*devResult, error) {
+	body, err := json.Marshal(invocation)
+	if err != nil {
+		return nil, err
+	}
+	httpResponse, err := processor.client.Post("http://" + processor.address + "/invoke", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, &PeerUnreachableError{Peer: processor.address, Cause: err}
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(httpResponse.Body)
+		return nil, fmt.Errorf("The development server %s return status %d: %s", processor.address, httpResponse.StatusCode, bytes.TrimSpace(message))
+	}
+	result := &devResult{}
+	if err := json.NewDecoder(httpResponse.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("Invalid response of the development server %s: %v", processor.address, err)
+	}
+	return result, nil
+}
+
+// devEventHub is the event hub of the SDK, given the blocks of the devOrderer instead of connecting to a peer
+type devEventHub struct {
+	api.EventHub
+	mutex		sync.Mutex
+	connected	bool
+}
+
+func (hub *devEventHub) IsConnected() bool {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return hub.connected
+}
+
+func (hub *devEventHub) Connect() error {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.connected = true
+	return nil
+}
+
+func (hub *devEventHub) Disconnect() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.connected = false
+}
+
+// deliver gives the block to the listeners of the event hub, as a peer would, unless it is disconnected
+func (hub *devEventHub) deliver(block *common.Block) {
+	if !hub.IsConnected() {
+		return
+	}
+	hub.EventHub.(blockReceiver).Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+}
+
+// devOrderer orders each transaction in a block of its own, delivered at once to the event hub of the development mode
+type devOrderer struct {
+	url			string
+	eventHub	*devEventHub
+	mutex		sync.Mutex
+	height		uint64
+}
+
+func (o *devOrderer) GetURL() string {
+	return o.url
+}
+
+func (o *devOrderer) SendBroadcast(envelope *api.SignedEnvelope) (*common.Status, error) {
+	data, err := proto.Marshal(&common.Envelope{Payload: envelope.Payload, Signature: envelope.Signature})
+	if err != nil {
+		return nil, err
+	}
+	// The blocks are delivered in order
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	metadata := make([][]byte, common.BlockMetadataIndex_TRANSACTIONS_FILTER+1)
+	metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = []byte{byte(pb.TxValidationCode_VALID)}
+	o.eventHub.deliver(&common.Block{
+		Header:		&common.BlockHeader{Number: o.height},
+		Data:		&common.BlockData{Data: [][]byte{data}},
+		Metadata:	&common.BlockMetadata{Metadata: metadata},
+	})
+	o.height++
+	status := common.Status_SUCCESS
+	return &status, nil
+}
+
+func (o *devOrderer) SendDeliver(envelope *api.SignedEnvelope) (chan *common.Block, chan error) {
+	errors := make(chan error, 1)
+	errors <- fmt.Errorf("The development mode keeps no block")
+	return make(chan *common.Block), errors
+}
+
+// pingDevServer checks the development server accepts a connection
+func (setup *FabricSetup) pingDevServer(ctx context.Context) error {
+	connection, err := (&net.Dialer{}).DialContext(ctx, "tcp", setup.devModeAddress())
+	if err != nil {
+		return err
+	}
+	return connection.Close()
+}
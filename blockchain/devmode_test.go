@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDevServer answers like the development server of the heroes-service chaincode for the hello key
+type fakeDevServer struct {
+	mutex		sync.Mutex
+	hello		string
+	invocations	[]devInvocation
+}
+
+func (server *fakeDevServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var invocation devInvocation
+	if err := json.NewDecoder(r.Body).Decode(&invocation); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.invocations = append(server.invocations, invocation)
+	var args []string
+	for _, arg := range invocation.Args {
+		args = append(args, string(arg))
+	}
+	result := devResult{Status: 200}
+	switch strings.Join(args[:3], " ") {
+	case "invoke query hello":
+		result.Payload = []byte(server.hello)
+	case "invoke invoke hello":
+		server.hello = args[3]
+		result.EventName, result.EventPayload = "helloUpdated", []byte(args[3])
+	default:
+		result.Status, result.Message = 500, "Unknown action"
+	}
+	json.NewEncoder(w).Encode(&result)
+}
+
+func TestDevMode(t *testing.T) {
+	devServer := &fakeDevServer{hello: "word"}
+	server := httptest.NewServer(devServer)
+	defer server.Close()
+	setup := &FabricSetup{
+		ChannelId:		"mychannel",
+		ChaincodeId:	"heroes-service",
+		DevMode:		true,
+		DevModeAddress:	strings.TrimPrefix(server.URL, "http://"),
+		Logger:			NoopLogger{},
+	}
+	if err := setup.initializeDevMode(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	defer setup.Close()
+
+	events := make(chan string, 1)
+	if _, err := setup.RegisterChaincodeEvent("helloUpdated", func(ccID string, txID string, payload []byte) {
+		events <- txID + " " + string(payload)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	txID, err := setup.InvokeWith(context.Background(), "invoke", []string{"invoke", "hello", "dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		if event != txID + " dev" {
+			t.Errorf("Got the event %q of the transaction %s", event, txID)
+		}
+	default:
+		t.Error("The event of the chaincode wasn't delivered")
+	}
+	if devServer.invocations[0].TxID != txID || len(devServer.invocations[0].SignedProposal) == 0 {
+		t.Errorf("The invocation %+v isn't the proposal of the transaction %s", devServer.invocations[0], txID)
+	}
+
+	payload, err := setup.QueryWith(context.Background(), "invoke", []string{"query", "hello"})
+	if err != nil || string(payload) != "dev" {
+		t.Errorf("Got %q, %v, want the value invoked", payload, err)
+	}
+	if _, err := setup.QueryWith(context.Background(), "invoke", []string{"query", "unknown"}); err == nil {
+		t.Error("The rejection of the chaincode wasn't returned")
+	}
+	if report := setup.Health(context.Background()); !report.Healthy() {
+		t.Errorf("The development mode is unhealthy: %v", report.Errors)
+	}
+}
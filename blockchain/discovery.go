@@ -0,0 +1,282 @@
+package blockchain
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fabricConfig "github.com/hyperledger/fabric/common/config"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"google.golang.org/grpc"
+)
+
+const defaultDiscoveryInterval = time.Minute
+
+// Topology is the network known by the configuration of the channel.
+// The Fabric version of the SDK has no discovery service, the channel configuration holds the anchor peers
+// of the organisations and the orderers, which can change without redeploying the service.
+type Topology struct {
+	Peers		[]DiscoveredPeer
+	Orderers	[]DiscoveredOrderer
+}
+
+// DiscoveredOrderer is an orderer of the channel
+type DiscoveredOrderer struct {
+	Address	string	// Mapped by DiscoveryAddresses
+	Host	string	// Host name in the channel configuration, checked by the TLS certificate
+}
+
+// DiscoveredPeer is an anchor peer of an organisation of the channel
+type DiscoveredPeer struct {
+	MSPID			string
+	Address			string	// Mapped by DiscoveryAddresses
+	Host			string	// Host name in the channel configuration, checked by the TLS certificate
+	tlsRootCerts	[][]byte
+}
+
+// DiscoverTopology reads the anchor peers and the orderers of the channel from its last configuration.
+// With an EndorsementRule, only the peers of its MSPs are returned: the others can't satisfy the policy.
+func (setup *FabricSetup) DiscoverTopology() (*Topology, error) {
+	if !setup.Initialized {
+		return nil, fmt.Errorf("Unable to discover the topology: the setup is not initialized")
+	}
+	config, err := setup.getChannelConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	topology := &Topology{}
+	orderers, err := setup.ordererAddresses(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range orderers {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid orderer address %s: %v", address, err)
+		}
+		topology.Orderers = append(topology.Orderers, DiscoveredOrderer{Address: setup.discoveryAddress(address), Host: host})
+	}
+
+	application, ok := config.ChannelGroup.Groups[fabricConfig.ApplicationGroupKey]
+	if !ok {
+		return topology, nil
+	}
+	var organizations []string
+	for name := range application.Groups {
+		organizations = append(organizations, name)
+	}
+	sort.Strings(organizations)
+	for _, name := range organizations {
+		peers, err := discoverOrganizationPeers(application.Groups[name])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the organisation %s of the channel configuration: %v", name, err)
+		}
+		for _, discovered := range peers {
+			if !setup.satisfiesPolicy(discovered.MSPID) {
+				continue
+			}
+			discovered.Address = setup.discoveryAddress(discovered.Address)
+			topology.Peers = append(topology.Peers, discovered)
+		}
+	}
+	return topology, nil
+}
+
+// discoverOrganizationPeers returns the anchor peers of an application organisation of the channel configuration
+func discoverOrganizationPeers(group *common.ConfigGroup) ([]DiscoveredPeer, error) {
+	mspValue, ok := group.Values[fabricConfig.MSPKey]
+	if !ok {
+		return nil, fmt.Errorf("No MSP")
+	}
+	mspConfig := &msp.MSPConfig{}
+	if err := proto.Unmarshal(mspValue.Value, mspConfig); err != nil {
+		return nil, err
+	}
+	fabricMSPConfig := &msp.FabricMSPConfig{}
+	if err := proto.Unmarshal(mspConfig.Config, fabricMSPConfig); err != nil {
+		return nil, err
+	}
+
+	anchorValue, ok := group.Values[fabricConfig.AnchorPeersKey]
+	if !ok {
+		return nil, nil
+	}
+	anchorPeers := &pb.AnchorPeers{}
+	if err := proto.Unmarshal(anchorValue.Value, anchorPeers); err != nil {
+		return nil, err
+	}
+	var peers []DiscoveredPeer
+	for _, anchorPeer := range anchorPeers.AnchorPeers {
+		peers = append(peers, DiscoveredPeer{
+			MSPID:			fabricMSPConfig.Name,
+			Address:		fmt.Sprintf("%s:%d", anchorPeer.Host, anchorPeer.Port),
+			Host:			anchorPeer.Host,
+			tlsRootCerts:	fabricMSPConfig.TlsRootCerts,
+		})
+	}
+	return peers, nil
+}
+
+// satisfiesPolicy tells if a peer of the MSP can endorse for the EndorsementRule, any can without rule
+func (setup *FabricSetup) satisfiesPolicy(mspID string) bool {
+	if setup.EndorsementRule == nil {
+		return true
+	}
+	for _, ruleMSPID := range setup.EndorsementRule.MSPIDs {
+		if ruleMSPID == mspID {
+			return true
+		}
+	}
+	return false
+}
+
+// discoveryAddress returns the address to use for an address of the channel configuration, see DiscoveryAddresses
+func (setup *FabricSetup) discoveryAddress(address string) string {
+	if mapped, ok := setup.DiscoveryAddresses[address]; ok {
+		return mapped
+	}
+	return address
+}
+
+// RefreshTopology adds to the channel the peers and orderers of DiscoverTopology it doesn't know yet, and removes
+// the ones added by a previous refresh that are gone. The peers and the orderer of config.yaml are always kept.
+// It waits for the Query and Invoke in progress.
+func (setup *FabricSetup) RefreshTopology() error {
+	topology, err := setup.DiscoverTopology()
+	if err != nil {
+		return err
+	}
+
+	setup.userMutex.Lock()
+	defer setup.userMutex.Unlock()
+	channel := setup.Channel
+	config := setup.Client.GetConfig()
+
+	known := make(map[string]bool)
+	for _, channelPeer := range channel.GetPeers() {
+		known[channelPeer.URL()] = true
+	}
+	peers := make(map[string]bool)
+	for _, discovered := range topology.Peers {
+		peers[discovered.Address] = true
+		if known[discovered.Address] {
+			continue
+		}
+		channelPeer, err := setup.newDiscoveredPeer(discovered, config)
+		if err != nil {
+			return err
+		}
+		if err := channel.AddPeer(channelPeer); err != nil {
+			return fmt.Errorf("Error adding peer: %v", err)
+		}
+		setup.discoveredPeers[discovered.Address] = true
+		WithFields(setup.logger(), Fields{FieldPeer: discovered.Address}).Printf("Peer of %s discovered", discovered.MSPID)
+	}
+	for _, channelPeer := range channel.GetPeers() {
+		if setup.discoveredPeers[channelPeer.URL()] && !peers[channelPeer.URL()] {
+			channel.RemovePeer(channelPeer)
+			delete(setup.discoveredPeers, channelPeer.URL())
+			WithFields(setup.logger(), Fields{FieldPeer: channelPeer.URL()}).Printf("Peer gone from the channel configuration")
+		}
+	}
+
+	known = make(map[string]bool)
+	for _, channelOrderer := range channel.GetOrderers() {
+		known[channelOrderer.GetURL()] = true
+	}
+	orderers := make(map[string]bool)
+	for _, discovered := range topology.Orderers {
+		address := discovered.Address
+		orderers[address] = true
+		if known[address] {
+			continue
+		}
+		// The orderers of the channel are expected to share the TLS root certificate of the one of config.yaml
+		if err := channel.AddOrderer(setup.newOrderer(address, config.GetOrdererTLSCertificate(), discovered.Host)); err != nil {
+			return fmt.Errorf("Error adding orderer: %v", err)
+		}
+		setup.discoveredOrderers[address] = true
+		setup.logger().Printf("Orderer %s discovered", address)
+	}
+	for _, channelOrderer := range channel.GetOrderers() {
+		if setup.discoveredOrderers[channelOrderer.GetURL()] && !orderers[channelOrderer.GetURL()] {
+			channel.RemoveOrderer(channelOrderer)
+			delete(setup.discoveredOrderers, channelOrderer.GetURL())
+			setup.logger().Printf("Orderer %s gone from the channel configuration", channelOrderer.GetURL())
+		}
+	}
+	return nil
+}
+
+// newDiscoveredPeer returns a peer keeping its connection, trusting the TLS root certificates of its MSP
+func (setup *FabricSetup) newDiscoveredPeer(discovered DiscoveredPeer, config api.Config) (api.Peer, error) {
+	setup.endorsersMutex.Lock()
+	defer setup.endorsersMutex.Unlock()
+	if setup.endorsers == nil {
+		setup.endorsers = make(map[string]*endorser)
+	}
+	processor, ok := setup.endorsers[discovered.Address]
+	if !ok {
+		options := []grpc.DialOption{grpc.WithBlock()}
+		if config.IsTLSEnabled() {
+			certPool := x509.NewCertPool()
+			for _, certificate := range discovered.tlsRootCerts {
+				certPool.AppendCertsFromPEM(certificate)
+			}
+			options = append(options, setup.tlsDialOption(certPool, discovered.Host))
+		} else {
+			options = append(options, grpc.WithInsecure())
+		}
+		processor = setup.newEndorser(discovered.Address, func() ([]grpc.DialOption, error) { return options, nil })
+		setup.endorsers[discovered.Address] = processor
+	}
+	channelPeer, err := newEndorserPeer(discovered.Address, processor, config)
+	if err != nil {
+		return nil, fmt.Errorf("NewPeer return error: %v", err)
+	}
+	return channelPeer, nil
+}
+
+// startDiscovery refreshes the topology every DiscoveryInterval, when Discovery is enabled
+func (setup *FabricSetup) startDiscovery() {
+	setup.discoveredPeers = make(map[string]bool)
+	setup.discoveredOrderers = make(map[string]bool)
+	if !setup.Discovery {
+		return
+	}
+	interval := setup.DiscoveryInterval
+	if interval == 0 {
+		interval = defaultDiscoveryInterval
+	}
+	if err := setup.RefreshTopology(); err != nil {
+		setup.logger().Errorf("Unable to discover the topology: %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	setup.stopDiscovery = func() {
+		close(stop)
+		<-done
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := setup.RefreshTopology(); err != nil {
+					setup.logger().Errorf("Unable to refresh the topology: %v", err)
+				}
+			}
+		}
+	}()
+}
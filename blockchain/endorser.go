@@ -0,0 +1,367 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/peer"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	defaultDialTimeout		= 10 * time.Second	// Same connection timeout as the SDK peers
+	defaultPeerConnections	= 1
+	defaultKeepAliveTimeout	= 20 * time.Second	// Same as gRPC
+)
+
+// endorser sends the proposals to a peer, with a timeout on the connection
+// distinct from the timeout on the execution of the proposal.
+// The connections are opened on demand and kept for the next proposals, the SDK peers open one per proposal.
+// A proposal goes to the connection carrying the fewest, a new connection is opened while every one carries some,
+// up to maxConns. Beyond maxIdle connections without proposal, or after idleTimeout without one, they are closed.
+type endorser struct {
+	target			string
+	dialOptions		func() ([]grpc.DialOption, error)	// Read at each connection, so the rotated certificates are used
+	dialTimeout		time.Duration
+	proposalTimeout	time.Duration
+	maxConns		int
+	maxIdle			int
+	idleTimeout		time.Duration
+
+	connectionMutex	sync.Mutex
+	connections		[]*pooledConn
+	dialing			int			// Connections being dialed
+	dialed			*sync.Cond	// Signaled at the end of each dial
+}
+
+// pooledConn is a connection of an endorser with its proposals in progress
+type pooledConn struct {
+	connection	*grpc.ClientConn
+	inFlight	int
+	lastUsed	time.Time
+}
+
+// conn returns a connection to the peer for a proposal, to give back with releaseConn.
+// The connection is dialed without holding the pool, so the other proposals and releases don't wait for it.
+func (e *endorser) conn() (*pooledConn, error) {
+	e.connectionMutex.Lock()
+	if e.dialed == nil {
+		e.dialed = sync.NewCond(&e.connectionMutex)
+	}
+	for {
+		e.closeIdle(time.Now())
+		least := e.leastUsed()
+		full := len(e.connections)+e.dialing >= e.maxConns
+		if least != nil && (least.inFlight == 0 || full) {
+			least.inFlight++
+			e.connectionMutex.Unlock()
+			return least, nil
+		}
+		if !full {
+			break
+		}
+		// No connection yet, the ones being dialed fill the pool
+		e.dialed.Wait()
+	}
+	e.dialing++
+	e.connectionMutex.Unlock()
+
+	connection, err := e.dial()
+
+	e.connectionMutex.Lock()
+	defer e.connectionMutex.Unlock()
+	e.dialing--
+	e.dialed.Broadcast()
+	if err != nil {
+		// When an additional connection can't be opened, the proposal shares one
+		least := e.leastUsed()
+		if least == nil {
+			return nil, err
+		}
+		least.inFlight++
+		return least, nil
+	}
+	pooled := &pooledConn{connection: connection, inFlight: 1}
+	e.connections = append(e.connections, pooled)
+	return pooled, nil
+}
+
+// leastUsed returns the connection carrying the fewest proposals, nil when there is none
+func (e *endorser) leastUsed() *pooledConn {
+	var least *pooledConn
+	for _, pooled := range e.connections {
+		if least == nil || pooled.inFlight < least.inFlight {
+			least = pooled
+		}
+	}
+	return least
+}
+
+// dial opens a connection to the peer within the dial timeout
+func (e *endorser) dial() (*grpc.ClientConn, error) {
+	options, err := e.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	dialContext, cancelDial := context.WithTimeout(context.Background(), e.dialTimeout)
+	defer cancelDial()
+	connection, err := grpc.DialContext(dialContext, e.target, options...)
+	if err != nil {
+		return nil, &PeerUnreachableError{Peer: e.target, Cause: err}
+	}
+	return connection, nil
+}
+
+// releaseConn gives back the connection at the end of a proposal. After a failure of the connection,
+// it is closed so the next proposals open a new one.
+func (e *endorser) releaseConn(pooled *pooledConn, failed bool) {
+	e.connectionMutex.Lock()
+	defer e.connectionMutex.Unlock()
+	pooled.inFlight--
+	pooled.lastUsed = time.Now()
+	if failed {
+		e.remove(pooled)
+		return
+	}
+	if pooled.inFlight > 0 {
+		return
+	}
+	idle := 0
+	for _, other := range e.connections {
+		if other.inFlight == 0 {
+			idle++
+		}
+	}
+	if idle > e.maxIdle {
+		e.remove(pooled)
+	}
+}
+
+// closeIdle closes the connections without proposal since idleTimeout, if set
+func (e *endorser) closeIdle(now time.Time) {
+	if e.idleTimeout <= 0 {
+		return
+	}
+	for _, pooled := range append([]*pooledConn(nil), e.connections...) {
+		if pooled.inFlight == 0 && now.Sub(pooled.lastUsed) > e.idleTimeout {
+			e.remove(pooled)
+		}
+	}
+}
+
+// remove closes the connection and removes it from the pool, unless it was already
+func (e *endorser) remove(pooled *pooledConn) {
+	for i, other := range e.connections {
+		if other == pooled {
+			e.connections = append(e.connections[:i], e.connections[i+1:]...)
+			pooled.connection.Close()
+			return
+		}
+	}
+}
+
+// Close closes the connections to the peer, the proposals in progress fail
+func (e *endorser) Close() {
+	e.connectionMutex.Lock()
+	defer e.connectionMutex.Unlock()
+	for _, pooled := range e.connections {
+		pooled.connection.Close()
+	}
+	e.connections = nil
+}
+
+// ProcessProposal sends the proposal to the peer
+func (e *endorser) ProcessProposal(proposal *api.TransactionProposal) (*api.TransactionProposalResponse, error) {
+	return e.processProposal(context.Background(), proposal)
+}
+
+// processProposal sends the proposal to the peer, the request is cancelled with the context
+func (e *endorser) processProposal(ctx context.Context, proposal *api.TransactionProposal) (*api.TransactionProposalResponse, error) {
+	pooled, err := e.conn()
+	if err != nil {
+		return nil, err
+	}
+	failed := false
+	defer func() { e.releaseConn(pooled, failed) }()
+
+	proposalContext := ctx
+	if e.proposalTimeout > 0 {
+		var cancelProposal context.CancelFunc
+		proposalContext, cancelProposal = context.WithTimeout(proposalContext, e.proposalTimeout)
+		defer cancelProposal()
+	}
+	response, err := pb.NewEndorserClient(pooled.connection).ProcessProposal(proposalContext, proposal.SignedProposal)
+	if err != nil {
+		if code := grpc.Code(err); code == codes.Unavailable || err == grpc.ErrClientConnClosing {
+			// Reported like a failed dial, so the peer is put aside
+			failed = true
+			return nil, &PeerUnreachableError{Peer: e.target, Cause: err}
+		} else if code == codes.DeadlineExceeded {
+			return nil, &TimeoutError{Operation: "Proposal to " + e.target, TxID: proposal.TransactionID, Timeout: e.proposalTimeout, Cause: err}
+		}
+		return nil, err
+	}
+
+	return &api.TransactionProposalResponse{
+		Proposal:			proposal,
+		ProposalResponse:	response,
+		Endorser:			e.target,
+		Status:				response.GetResponse().Status,
+	}, nil
+}
+
+// endorserPeer is a peer of the channels sending its proposals through an endorser, so they can be cancelled
+type endorserPeer struct {
+	api.Peer
+	endorser	*endorser
+}
+
+// newEndorserPeer returns the peer of the URL sending its proposals through the endorser
+func newEndorserPeer(url string, processor *endorser, config api.Config) (api.Peer, error) {
+	channelPeer, err := peer.NewPeerFromProcessor(url, processor, config)
+	if err != nil {
+		return nil, err
+	}
+	return &endorserPeer{Peer: channelPeer, endorser: processor}, nil
+}
+
+// sendProposalContext sends the proposal to the peer, the request is cancelled with the context
+func (p *endorserPeer) sendProposalContext(ctx context.Context, proposal *api.TransactionProposal) (*api.TransactionProposalResponse, error) {
+	return p.endorser.processProposal(ctx, proposal)
+}
+
+// useEndorsers replaces the peers of the channel by peers keeping their connection, and using DialTimeout
+// and ProposalTimeout. The channels of the setup share the connection to a peer.
+func (setup *FabricSetup) useEndorsers(channel api.Channel) error {
+	config := setup.Client.GetConfig()
+	peersConfig, err := config.GetPeersConfig()
+	if err != nil {
+		return fmt.Errorf("Error reading peer config: %v", err)
+	}
+
+	// The peers of the other organisations endorse the proposals too, the primary peer stays one of config.yaml
+	for _, organization := range setup.Organizations {
+		for _, orgPeer := range organization.Peers {
+			orgPeer.Primary = false
+			if setup.rootCertPath() != "" {
+				orgPeer.TLS.Certificate = setup.rootCertPath()
+			}
+			peersConfig = append(peersConfig, orgPeer)
+		}
+	}
+
+	setup.endorsersMutex.Lock()
+	defer setup.endorsersMutex.Unlock()
+	if setup.endorsers == nil {
+		setup.endorsers = make(map[string]*endorser)
+	}
+
+	for _, peerConfig := range peersConfig {
+		url := fmt.Sprintf("%s:%d", peerConfig.Host, peerConfig.Port)
+
+		processor, ok := setup.endorsers[url]
+		if !ok {
+			certificate, serverHostOverride := peerConfig.TLS.Certificate, peerConfig.TLS.ServerHostOverride
+			dialOptions := func() ([]grpc.DialOption, error) {
+				// The connection is blocking, so an unreachable peer fails within the dial timeout
+				options := []grpc.DialOption{grpc.WithBlock()}
+				if !config.IsTLSEnabled() {
+					return append(options, grpc.WithInsecure()), nil
+				}
+				certPool, err := config.GetTLSCACertPool(certificate)
+				if err != nil {
+					return nil, fmt.Errorf("Unable to load the TLS certificate of the peer %s: %v", url, err)
+				}
+				return append(options, setup.tlsDialOption(certPool, serverHostOverride)), nil
+			}
+			if _, err := dialOptions(); err != nil {
+				return err
+			}
+			processor = setup.newEndorser(url, dialOptions)
+			setup.endorsers[url] = processor
+		}
+
+		endorserPeer, err := newEndorserPeer(url, processor, config)
+		if err != nil {
+			return fmt.Errorf("NewPeer return error: %v", err)
+		}
+
+		// Replace the peer created by the SDK with the same URL
+		channel.RemovePeer(endorserPeer)
+		if err := channel.AddPeer(endorserPeer); err != nil {
+			return fmt.Errorf("Error adding peer: %v", err)
+		}
+		if peerConfig.Primary {
+			if err := channel.SetPrimaryPeer(endorserPeer); err != nil {
+				return fmt.Errorf("Error setting the primary peer: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// newEndorser returns an endorser of the peer using the peer connection parameters of the setup
+func (setup *FabricSetup) newEndorser(url string, dialOptions func() ([]grpc.DialOption, error)) *endorser {
+	dialTimeout := setup.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	maxConns := setup.PeerConnections
+	if maxConns <= 0 {
+		maxConns = defaultPeerConnections
+	}
+	maxIdle := setup.PeerMaxIdle
+	if maxIdle <= 0 || maxIdle > maxConns {
+		maxIdle = maxConns
+	}
+	if setup.KeepAliveTime > 0 {
+		keepAliveTimeout := setup.KeepAliveTimeout
+		if keepAliveTimeout == 0 {
+			keepAliveTimeout = defaultKeepAliveTimeout
+		}
+		// The idle connections are pinged too, so they are still open at the next proposal
+		keepAlive := grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: setup.KeepAliveTime, Timeout: keepAliveTimeout, PermitWithoutStream: true})
+		peerOptions := dialOptions
+		dialOptions = func() ([]grpc.DialOption, error) {
+			options, err := peerOptions()
+			if err != nil {
+				return nil, err
+			}
+			return append(options, keepAlive), nil
+		}
+	}
+	return &endorser{
+		target:				url,
+		dialOptions:		dialOptions,
+		dialTimeout:		dialTimeout,
+		proposalTimeout:	setup.ProposalTimeout,
+		maxConns:			maxConns,
+		maxIdle:			maxIdle,
+		idleTimeout:		setup.PeerIdleTimeout,
+	}
+}
+
+// resetEndorsers closes the connections to the peers, the next proposals open new ones
+func (setup *FabricSetup) resetEndorsers() {
+	setup.endorsersMutex.Lock()
+	defer setup.endorsersMutex.Unlock()
+	for _, processor := range setup.endorsers {
+		processor.Close()
+	}
+}
+
+// closeEndorsers closes the connections to the peers
+func (setup *FabricSetup) closeEndorsers() {
+	setup.endorsersMutex.Lock()
+	defer setup.endorsersMutex.Unlock()
+	for _, processor := range setup.endorsers {
+		processor.Close()
+	}
+	setup.endorsers = nil
+}
@@ -0,0 +1,236 @@
+package blockchain
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// listen serves a gRPC server without service on a local port
+func listen(t testing.TB) (*grpc.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+// fakeEndorser endorses every proposal
+type fakeEndorser struct{}
+
+func (fakeEndorser) ProcessProposal(ctx context.Context, proposal *pb.SignedProposal) (*pb.ProposalResponse, error) {
+	return &pb.ProposalResponse{Response: &pb.Response{Status: 200}, Endorsement: &pb.Endorsement{}}, nil
+}
+
+// listenEndorser serves a fakeEndorser on a local port
+// recordingEndorser keeps the proposals before endorsing them
+type recordingEndorser struct {
+	pb.EndorserServer
+	mutex		sync.Mutex
+	proposals	[]*pb.SignedProposal
+}
+
+func (e *recordingEndorser) ProcessProposal(ctx context.Context, proposal *pb.SignedProposal) (*pb.ProposalResponse, error) {
+	e.mutex.Lock()
+	e.proposals = append(e.proposals, proposal)
+	e.mutex.Unlock()
+	return e.EndorserServer.ProcessProposal(ctx, proposal)
+}
+
+func listenEndorser(t testing.TB) (*grpc.Server, string) {
+	return serveEndorser(t, fakeEndorser{})
+}
+
+// serveEndorser serves the endorser on a local port
+func serveEndorser(t testing.TB, endorser pb.EndorserServer) (*grpc.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterEndorserServer(server, endorser)
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+func insecureDial() ([]grpc.DialOption, error) {
+	return []grpc.DialOption{grpc.WithBlock(), grpc.WithInsecure()}, nil
+}
+
+func TestEndorserDialsWithoutHoldingThePool(t *testing.T) {
+	server, address := listen(t)
+	defer server.Stop()
+
+	unblock := make(chan struct{})
+	dials := 0
+	setup := &FabricSetup{PeerConnections: 2}
+	e := setup.newEndorser(address, func() ([]grpc.DialOption, error) {
+		dials++
+		if dials == 2 {
+			<-unblock
+		}
+		return insecureDial()
+	})
+	first, err := e.conn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first connection is busy, so the next proposal dials a second one, which blocks
+	second := make(chan *pooledConn)
+	go func() {
+		pooled, err := e.conn()
+		if err != nil {
+			t.Error(err)
+		}
+		second <- pooled
+	}()
+	for {
+		e.connectionMutex.Lock()
+		dialing := e.dialing
+		e.connectionMutex.Unlock()
+		if dialing == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		e.releaseConn(first, false)
+		pooled, err := e.conn()
+		if err != nil {
+			t.Error(err)
+		} else if pooled != first {
+			t.Error("The idle connection wasn't reused")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("The proposals waited for the dial of another connection")
+	}
+
+	close(unblock)
+	if pooled := <-second; pooled == first {
+		t.Error("The dialed connection wasn't used")
+	}
+	e.Close()
+}
+
+func TestEndorserPoolLimits(t *testing.T) {
+	server, address := listen(t)
+	defer server.Stop()
+
+	setup := &FabricSetup{PeerConnections: 2, PeerMaxIdle: 1, PeerIdleTimeout: 20 * time.Millisecond}
+	e := setup.newEndorser(address, insecureDial)
+	a, _ := e.conn()
+	b, _ := e.conn()
+	c, _ := e.conn()
+	if len(e.connections) != 2 || a == b || (c != a && c != b) {
+		t.Fatalf("%d connections, want 2 shared by 3 proposals", len(e.connections))
+	}
+	e.releaseConn(a, false)
+	e.releaseConn(b, false)
+	e.releaseConn(c, false)
+	if len(e.connections) != 1 {
+		t.Fatalf("%d idle connections kept, want 1", len(e.connections))
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	d, _ := e.conn()
+	if len(e.connections) != 1 || d == a || d == b {
+		t.Error("The connection idle beyond the timeout wasn't replaced")
+	}
+	e.releaseConn(d, true)
+	if len(e.connections) != 0 {
+		t.Error("The failed connection was kept")
+	}
+	e.Close()
+}
+
+func TestEndorserUnavailablePeerIsUnreachable(t *testing.T) {
+	server, address := listen(t)
+	setup := &FabricSetup{}
+	e := setup.newEndorser(address, insecureDial)
+	pooled, err := e.conn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.releaseConn(pooled, false)
+	server.Stop()
+	// Until the transport sees the connection closed, a write fails with Internal
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = e.ProcessProposal(&api.TransactionProposal{SignedProposal: &pb.SignedProposal{}})
+	var unreachable *PeerUnreachableError
+	if !errors.As(err, &unreachable) {
+		t.Fatalf("Got %v, want a PeerUnreachableError", err)
+	}
+	if len(e.connections) != 0 {
+		t.Error("The connection to the peer gone was kept")
+	}
+}
+
+// BenchmarkInvoke measures the endorsement of the proposals of InvokeWith by two peers, through the endorsers keeping
+// their connections and through a connection per proposal like the SDK peers
+func BenchmarkInvoke(b *testing.B) {
+	var addresses []string
+	for i := 0; i < 2; i++ {
+		server, address := listenEndorser(b)
+		defer server.Stop()
+		addresses = append(addresses, address)
+	}
+	setup := &FabricSetup{Logger: NoopLogger{}}
+	proposal := &api.TransactionProposal{TransactionID: "tx", SignedProposal: &pb.SignedProposal{}}
+	targets := func(endorsers []*endorser) []api.Peer {
+		var peers []api.Peer
+		for _, e := range endorsers {
+			p, _ := newEndorserPeer(e.target, e, nil)
+			peers = append(peers, p)
+		}
+		return peers
+	}
+	newEndorsers := func() []*endorser {
+		var endorsers []*endorser
+		for _, address := range addresses {
+			endorsers = append(endorsers, setup.newEndorser(address, insecureDial))
+		}
+		return endorsers
+	}
+
+	b.Run("pooled connections", func(b *testing.B) {
+		endorsers := newEndorsers()
+		peers := targets(endorsers)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := setup.sendProposal(proposal, peers, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		for _, e := range endorsers {
+			e.Close()
+		}
+	})
+	b.Run("connection per proposal", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			endorsers := newEndorsers()
+			if _, err := setup.sendProposal(proposal, targets(endorsers), nil); err != nil {
+				b.Fatal(err)
+			}
+			for _, e := range endorsers {
+				e.Close()
+			}
+		}
+	})
+}
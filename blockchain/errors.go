@@ -0,0 +1,409 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MVCCReadConflictError is returned when a key read by the transaction has been modified
+// by another transaction committed before it
+type MVCCReadConflictError struct {
+	TxID	string
+	Cause	error
+}
+
+func (e *MVCCReadConflictError) Error() string {
+	return fmt.Sprintf("MVCC read conflict for txid(%s): %v", e.TxID, e.Cause)
+}
+
+func (e *MVCCReadConflictError) Unwrap() error { return e.Cause }
+
+// PhantomReadConflictError is returned when the result of a range query done by the
+// transaction has been modified by another transaction committed before it
+type PhantomReadConflictError struct {
+	TxID	string
+	Cause	error
+}
+
+func (e *PhantomReadConflictError) Error() string {
+	return fmt.Sprintf("Phantom read conflict for txid(%s): %v", e.TxID, e.Cause)
+}
+
+func (e *PhantomReadConflictError) Unwrap() error { return e.Cause }
+
+// ExpiredChaincodeError is returned when the transaction has been endorsed by a chaincode
+// version that has been upgraded since
+type ExpiredChaincodeError struct {
+	TxID	string
+	Cause	error
+}
+
+func (e *ExpiredChaincodeError) Error() string {
+	return fmt.Sprintf("Expired chaincode for txid(%s): %v", e.TxID, e.Cause)
+}
+
+func (e *ExpiredChaincodeError) Unwrap() error { return e.Cause }
+
+// EndorsementPolicyFailureError is returned when the endorsements of the transaction don't satisfy
+// the endorsement policy of the chaincode
+type EndorsementPolicyFailureError struct {
+	TxID	string
+	Cause	error
+}
+
+func (e *EndorsementPolicyFailureError) Error() string {
+	return fmt.Sprintf("Endorsement policy failure for txid(%s): %v", e.TxID, e.Cause)
+}
+
+func (e *EndorsementPolicyFailureError) Unwrap() error { return e.Cause }
+
+// PeerUnreachableError is returned when the connection to a peer can't be established within DialTimeout,
+// as opposed to a peer that is reached but too slow to execute the proposal
+type PeerUnreachableError struct {
+	Peer	string
+	Cause	error
+}
+
+func (e *PeerUnreachableError) Error() string {
+	return fmt.Sprintf("Unable to connect to the peer %s: %v", e.Peer, e.Cause)
+}
+
+func (e *PeerUnreachableError) Unwrap() error { return e.Cause }
+
+// TimeoutError is returned when an operation doesn't end within its timeout, or before the deadline of its context
+type TimeoutError struct {
+	Operation	string
+	TxID		string			// The transaction concerned, if any
+	Timeout		time.Duration	// Not set when the deadline is the one of a context
+	Cause		error
+}
+
+func (e *TimeoutError) Error() string {
+	message := e.Operation + " timed out"
+	if e.Timeout > 0 {
+		message += fmt.Sprintf(" after %v", e.Timeout)
+	}
+	if e.TxID != "" {
+		message += fmt.Sprintf(" for txid(%s)", e.TxID)
+	}
+	if e.Cause != nil {
+		message += ": " + e.Cause.Error()
+	}
+	return message
+}
+
+func (e *TimeoutError) Unwrap() error { return e.Cause }
+
+// ErrOverloaded is returned by an invoke finding the submission queue full for SubmitQueueTimeout,
+// so a caller can shed the load (e.g. answer 503) instead of piling up on the orderer
+var ErrOverloaded = errors.New("too many invokes submitted")
+
+var (
+	// ErrChannelExists is matched by the error of the orderer refusing to create a channel that exists,
+	// e.g. created by another process since it was checked
+	ErrChannelExists = errors.New("channel already exists")
+	// ErrChaincodeNotFound is matched by the error of a proposal to a chaincode the peers haven't installed
+	// or instantiated (defined, with the lifecycle of Fabric 2.x)
+	ErrChaincodeNotFound = errors.New("chaincode not found")
+	// ErrEndorsementFailed is matched by the error of a proposal that didn't collect the endorsements required,
+	// an EndorsementError or a ChaincodeError
+	ErrEndorsementFailed = errors.New("endorsement failed")
+	// ErrEventHubNotConnected is matched by the error of an operation needing the event hub, which can't be
+	// connected, e.g. an invoke waiting for its commit
+	ErrEventHubNotConnected = errors.New("event hub not connected")
+)
+
+// ErrorKind is the class of an error of the setup, which the HTTP API, the web application and the administrative
+// API map to their status, so the same error gets the same answer everywhere
+type ErrorKind int
+
+const (
+	KindUnknown				ErrorKind = iota	// Any other failure of the peers or the orderer
+	KindConflict								// Conflict with another transaction, the call can be retried
+	KindTimeout
+	KindCanceled
+	KindNotFound								// The chaincode is unknown to the peers
+	KindAlreadyExists							// The channel exists
+	KindUnavailable								// The setup sheds the load or can't receive the events
+	KindEndorsementFailed						// The proposal didn't collect the endorsements required
+	KindInvalidArgument							// The arguments were refused by the setup or by the chaincode
+)
+
+// KindOf returns the class of the error
+func KindOf(err error) ErrorKind {
+	var mvccConflict *MVCCReadConflictError
+	var phantomConflict *PhantomReadConflictError
+	var timedOut *TimeoutError
+	var invalidArgument *ArgumentError
+	var rejected *ChaincodeError
+	switch {
+	case errors.As(err, &mvccConflict) || errors.As(err, &phantomConflict):
+		return KindConflict
+	case errors.As(err, &timedOut) || errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	case errors.Is(err, context.Canceled):
+		return KindCanceled
+	case errors.Is(err, ErrChaincodeNotFound):
+		return KindNotFound
+	case errors.Is(err, ErrChannelExists):
+		return KindAlreadyExists
+	case errors.Is(err, ErrOverloaded) || errors.Is(err, ErrEventHubNotConnected):
+		return KindUnavailable
+	case errors.As(err, &invalidArgument) || errors.As(err, &rejected):
+		return KindInvalidArgument
+	case errors.Is(err, ErrEndorsementFailed):
+		return KindEndorsementFailed
+	}
+	return KindUnknown
+}
+
+// HTTPStatus maps an error of the setup to an HTTP status, see KindOf.
+// Arguments refused by the setup or the chaincode are the fault of the client, a conflict with another transaction
+// can be retried by it, the other failures come from the peers.
+func HTTPStatus(err error) int {
+	switch KindOf(err) {
+	case KindInvalidArgument:
+		return http.StatusBadRequest
+	case KindConflict, KindAlreadyExists:
+		return http.StatusConflict
+	case KindTimeout:
+		return http.StatusGatewayTimeout
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// chaincodeNotFoundErrors are the messages of the peers not knowing the chaincode of a proposal
+var chaincodeNotFoundErrors = []string{
+	"could not find chaincode with name",
+	"cannot retrieve package for chaincode",
+	"is not defined",
+}
+
+// isChaincodeNotFound tells if the message of the peer says the chaincode isn't installed or instantiated
+func isChaincodeNotFound(message string) bool {
+	for _, notFound := range chaincodeNotFoundErrors {
+		if strings.Contains(message, notFound) {
+			return true
+		}
+	}
+	return false
+}
+
+// EndorsementError is returned when a proposal doesn't collect the endorsements required, for another reason
+// than a rejection of the chaincode (a ChaincodeError) or a timeout. Peer is the first peer failing and Code
+// the gRPC code of its failure, e.g. Unavailable. It matches ErrEndorsementFailed, and ErrChaincodeNotFound
+// when a peer doesn't know the chaincode.
+type EndorsementError struct {
+	Peer				string
+	Code				codes.Code
+	Cause				error
+	chaincodeNotFound	bool
+}
+
+func (e *EndorsementError) Error() string { return e.Cause.Error() }
+
+func (e *EndorsementError) Unwrap() error { return e.Cause }
+
+// Is matches ErrEndorsementFailed, and ErrChaincodeNotFound for a chaincode unknown by a peer
+func (e *EndorsementError) Is(target error) bool {
+	return target == ErrEndorsementFailed || (target == ErrChaincodeNotFound && e.chaincodeNotFound)
+}
+
+// grpcCode returns the gRPC code of the error, or of the first error it wraps with one, Unknown without any
+func grpcCode(err error) codes.Code {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if s, ok := status.FromError(err); ok {
+			return s.Code()
+		}
+	}
+	return codes.Unknown
+}
+
+// ChaincodeError is returned when the chaincode rejects a proposal (shim.Error), with the status and message
+// it returned. With several peers, it is the rejection of the first one.
+type ChaincodeError struct {
+	Peer	string
+	Status	int32
+	Message	string
+	Cause	error	// The failure of the proposal on every peer, when not only the chaincode
+}
+
+func (e *ChaincodeError) Error() string {
+	if e.Cause != nil {
+		return e.Cause.Error()
+	}
+	return fmt.Sprintf("Peer %s returned the status %d: %s", e.Peer, e.Status, e.Message)
+}
+
+func (e *ChaincodeError) Unwrap() error { return e.Cause }
+
+// Is matches ErrEndorsementFailed, a rejection fails the endorsement
+func (e *ChaincodeError) Is(target error) bool { return target == ErrEndorsementFailed }
+
+// ArgumentError is returned when the arguments of a call are refused before any proposal, e.g. by the ArgsSerializer
+type ArgumentError struct {
+	Cause	error
+}
+
+func (e *ArgumentError) Error() string { return "Invalid arguments: " + e.Cause.Error() }
+
+func (e *ArgumentError) Unwrap() error { return e.Cause }
+
+// SetupPhase is the step of the setup (initialization or deployment) where an error happened
+type SetupPhase string
+
+const (
+	PhaseConfig				SetupPhase = "config"
+	PhaseEnrollment			SetupPhase = "enrollment"
+	PhaseChannelCreate		SetupPhase = "channel create"
+	PhaseChannelJoin		SetupPhase = "channel join"
+	PhaseEventHubConnect	SetupPhase = "event hub connect"
+	PhaseInstall			SetupPhase = "install"
+	PhaseInstantiate		SetupPhase = "instantiate"
+	PhaseUpgrade			SetupPhase = "upgrade"
+)
+
+// Errors matched by errors.Is for each phase, e.g. errors.Is(err, ErrEnrollment)
+var (
+	ErrConfig			= errors.New("configuration failed")
+	ErrEnrollment		= errors.New("enrollment failed")
+	ErrChannelCreate	= errors.New("channel creation failed")
+	ErrChannelJoin		= errors.New("channel join failed")
+	ErrEventHubConnect	= errors.New("event hub connection failed")
+	ErrInstall			= errors.New("chaincode install failed")
+	ErrInstantiate		= errors.New("chaincode instantiation failed")
+	ErrUpgrade			= errors.New("chaincode upgrade failed")
+)
+
+var phaseErrors = map[SetupPhase]error{
+	PhaseConfig:			ErrConfig,
+	PhaseEnrollment:		ErrEnrollment,
+	PhaseChannelCreate:		ErrChannelCreate,
+	PhaseChannelJoin:		ErrChannelJoin,
+	PhaseEventHubConnect:	ErrEventHubConnect,
+	PhaseInstall:			ErrInstall,
+	PhaseInstantiate:		ErrInstantiate,
+	PhaseUpgrade:			ErrUpgrade,
+}
+
+// SetupError is an error of the setup with the phase it happened in, so a caller can tell
+// which step failed (and retry only this one). The message is the one of the cause.
+type SetupError struct {
+	Phase	SetupPhase
+	Cause	error
+}
+
+func (e *SetupError) Error() string { return e.Cause.Error() }
+
+func (e *SetupError) Unwrap() error { return e.Cause }
+
+// Is matches the error of the phase
+func (e *SetupError) Is(target error) bool { return target != nil && target == phaseErrors[e.Phase] }
+
+// setupError wraps the error with the phase, unless it already comes from a more precise phase
+func setupError(phase SetupPhase, err error) error {
+	var phased *SetupError
+	if err == nil || errors.As(err, &phased) {
+		return err
+	}
+	return &SetupError{Phase: phase, Cause: err}
+}
+
+// validationError maps the validation code of an invalid transaction to a typed error
+func validationError(txID string, code pb.TxValidationCode, cause error) error {
+	switch code {
+	case pb.TxValidationCode_MVCC_READ_CONFLICT:
+		return &MVCCReadConflictError{TxID: txID, Cause: cause}
+	case pb.TxValidationCode_PHANTOM_READ_CONFLICT:
+		return &PhantomReadConflictError{TxID: txID, Cause: cause}
+	case pb.TxValidationCode_EXPIRED_CHAINCODE:
+		return &ExpiredChaincodeError{TxID: txID, Cause: cause}
+	case pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE:
+		return &EndorsementPolicyFailureError{TxID: txID, Cause: cause}
+	}
+	return &TxValidationError{TxID: txID, Code: code, Cause: cause}
+}
+
+// TxValidationError is returned when the transaction is invalidated with a code without its own error type
+type TxValidationError struct {
+	TxID	string
+	Code	pb.TxValidationCode
+	Cause	error
+}
+
+func (e *TxValidationError) Error() string {
+	return fmt.Sprintf("Error received from eventhub for txid(%s) with code %s: %v", e.TxID, e.Code, e.Cause)
+}
+
+func (e *TxValidationError) Unwrap() error { return e.Cause }
+
+// validationCode returns the validation code of the invalidated transaction the error comes from
+func validationCode(err error) (pb.TxValidationCode, bool) {
+	var mvccConflict *MVCCReadConflictError
+	var phantomConflict *PhantomReadConflictError
+	var expired *ExpiredChaincodeError
+	var policyFailure *EndorsementPolicyFailureError
+	var invalid *TxValidationError
+	switch {
+	case errors.As(err, &mvccConflict):
+		return pb.TxValidationCode_MVCC_READ_CONFLICT, true
+	case errors.As(err, &phantomConflict):
+		return pb.TxValidationCode_PHANTOM_READ_CONFLICT, true
+	case errors.As(err, &expired):
+		return pb.TxValidationCode_EXPIRED_CHAINCODE, true
+	case errors.As(err, &policyFailure):
+		return pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE, true
+	case errors.As(err, &invalid):
+		return invalid.Code, true
+	}
+	return 0, false
+}
+
+// EndorsementMismatchError is returned when two peers simulated the proposal with different results,
+// e.g. because a key was written between the two simulations
+type EndorsementMismatchError struct {
+	Peers	[]string
+}
+
+func (e *EndorsementMismatchError) Error() string {
+	return fmt.Sprintf("The endorsements of %s disagree", strings.Join(e.Peers, " and "))
+}
+
+// ledgerError maps the ledger-level (and connection) error strings returned by the peers to a typed error.
+// Errors not related to the ledger are returned as is.
+func ledgerError(txID string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// The SDK flattens the errors of the peers into strings, so the type is lost on its way
+	var unreachable *PeerUnreachableError
+	if errors.As(err, &unreachable) {
+		return err
+	}
+	if strings.Contains(err.Error(), "Unable to connect to the peer") {
+		return &PeerUnreachableError{Cause: err}
+	}
+
+	for _, code := range []pb.TxValidationCode{
+		pb.TxValidationCode_MVCC_READ_CONFLICT,
+		pb.TxValidationCode_PHANTOM_READ_CONFLICT,
+		pb.TxValidationCode_EXPIRED_CHAINCODE,
+	} {
+		if strings.Contains(err.Error(), code.String()) {
+			return validationError(txID, code, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func isMVCCReadConflict(err error) bool {
+	var target *MVCCReadConflictError
+	return errors.As(err, &target)
+}
+
+func isPhantomReadConflict(err error) bool {
+	var target *PhantomReadConflictError
+	return errors.As(err, &target)
+}
+
+func isExpiredChaincode(err error) bool {
+	var target *ExpiredChaincodeError
+	return errors.As(err, &target)
+}
+
+func isEndorsementPolicyFailure(err error) bool {
+	var target *EndorsementPolicyFailureError
+	return errors.As(err, &target)
+}
+
+func isPeerUnreachable(err error) bool {
+	var target *PeerUnreachableError
+	return errors.As(err, &target)
+}
+
+func isTxValidation(err error) bool {
+	var target *TxValidationError
+	return errors.As(err, &target)
+}
+
+func TestLedgerError(t *testing.T) {
+	tests := []struct {
+		name	string
+		err		error
+		is		func(error) bool
+	}{
+		{"MVCC read conflict", errors.New("Error received from eventhub for txid(1) with code MVCC_READ_CONFLICT"), isMVCCReadConflict},
+		{"phantom read conflict", errors.New("Error received from eventhub for txid(1) with code PHANTOM_READ_CONFLICT"), isPhantomReadConflict},
+		{"expired chaincode", errors.New("Error received from eventhub for txid(1) with code EXPIRED_CHAINCODE"), isExpiredChaincode},
+		{"peer unreachable", errors.New("Unable to connect to the peer localhost:7051: timed out"), isPeerUnreachable},
+		{"wrapped", fmt.Errorf("Invoke failed: %w", errors.New("code MVCC_READ_CONFLICT")), isMVCCReadConflict},
+	}
+	for _, test := range tests {
+		err := ledgerError("1", test.err)
+		if !test.is(err) {
+			t.Errorf("%s: ledgerError returned %T (%v)", test.name, err, err)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: the cause isn't kept", test.name)
+		}
+	}
+
+	other := errors.New("chaincode returned an error")
+	if err := ledgerError("1", other); err != other {
+		t.Errorf("An error unrelated to the ledger was mapped to %T", err)
+	}
+	if err := ledgerError("1", nil); err != nil {
+		t.Errorf("No error was mapped to %v", err)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	tests := []struct {
+		code	pb.TxValidationCode
+		is		func(error) bool
+	}{
+		{pb.TxValidationCode_MVCC_READ_CONFLICT, isMVCCReadConflict},
+		{pb.TxValidationCode_PHANTOM_READ_CONFLICT, isPhantomReadConflict},
+		{pb.TxValidationCode_EXPIRED_CHAINCODE, isExpiredChaincode},
+		{pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE, isEndorsementPolicyFailure},
+		{pb.TxValidationCode_DUPLICATE_TXID, isTxValidation},
+	}
+	for _, test := range tests {
+		err := validationError("1", test.code, errors.New("invalid"))
+		if !test.is(err) {
+			t.Errorf("%s: validationError returned %T", test.code, err)
+		}
+		if code, ok := validationCode(err); !ok || code != test.code {
+			t.Errorf("%s: validationCode returned %s, %t", test.code, code, ok)
+		}
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		err		error
+		kind	ErrorKind
+		status	int
+	}{
+		{&MVCCReadConflictError{TxID: "1"}, KindConflict, http.StatusConflict},
+		{fmt.Errorf("Invoke failed: %w", &PhantomReadConflictError{TxID: "1"}), KindConflict, http.StatusConflict},
+		{&TimeoutError{Operation: "Commit"}, KindTimeout, http.StatusGatewayTimeout},
+		{context.DeadlineExceeded, KindTimeout, http.StatusGatewayTimeout},
+		{context.Canceled, KindCanceled, http.StatusBadGateway},
+		{&EndorsementError{Cause: errors.New("no endorsement"), chaincodeNotFound: true}, KindNotFound, http.StatusNotFound},
+		{&EndorsementError{Cause: errors.New("no endorsement")}, KindEndorsementFailed, http.StatusBadGateway},
+		{ErrChannelExists, KindAlreadyExists, http.StatusConflict},
+		{fmt.Errorf("Invoke failed: %w", ErrOverloaded), KindUnavailable, http.StatusServiceUnavailable},
+		{ErrEventHubNotConnected, KindUnavailable, http.StatusServiceUnavailable},
+		{&ChaincodeError{Peer: "peer0", Status: 500, Message: "Unknown hero"}, KindInvalidArgument, http.StatusBadRequest},
+		{fmt.Errorf("Create transaction proposal return error: %w", &ArgumentError{Cause: errors.New("too long")}), KindInvalidArgument, http.StatusBadRequest},
+		{errors.New("orderer unreachable"), KindUnknown, http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		if kind := KindOf(test.err); kind != test.kind {
+			t.Errorf("%v: kind %d, want %d", test.err, kind, test.kind)
+		}
+		if status := HTTPStatus(test.err); status != test.status {
+			t.Errorf("%v: status %d, want %d", test.err, status, test.status)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+)
+
+const (
+	defaultEventRetries			= 3
+	defaultEventRetryBackoff	= 500 * time.Millisecond
+)
+
+// eventDispatcher delivers the events received from the event hub to the handlers
+// registered through the FabricSetup. The delivery can be paused and resumed.
+//
+// While paused, events are kept in a buffer of at most EventBufferSize entries.
+// When the buffer is full, the oldest buffered event is dropped to make room for
+// the new one, so the event hub is never blocked by a paused application.
+// With a buffer size of 0, every event received while paused is dropped.
+// The buffered events are replayed by a single goroutine at a time, the events received meanwhile
+// are delivered after them.
+type eventDispatcher struct {
+	mutex		sync.Mutex
+	paused		bool
+	replaying	bool
+	limit		int
+	pending		[]func()
+	dropped		uint64
+}
+
+// dispatch delivers the event now, or buffers it if the dispatcher is paused or replays the buffer
+func (d *eventDispatcher) dispatch(deliver func()) {
+	d.mutex.Lock()
+	if d.replaying && !d.paused {
+		// Delivered by the replay, after the events buffered before it
+		d.pending = append(d.pending, deliver)
+		d.mutex.Unlock()
+		return
+	}
+	if !d.paused {
+		d.mutex.Unlock()
+		deliver()
+		return
+	}
+
+	// Nothing can be kept, drop the event
+	if d.limit <= 0 {
+		d.dropped++
+		d.mutex.Unlock()
+		return
+	}
+
+	// The buffer is full, drop the oldest event
+	if len(d.pending) >= d.limit {
+		d.pending = d.pending[1:]
+		d.dropped++
+	}
+	d.pending = append(d.pending, deliver)
+	d.mutex.Unlock()
+}
+
+// pause stops the delivery of the events
+func (d *eventDispatcher) pause() {
+	d.mutex.Lock()
+	d.paused = true
+	d.mutex.Unlock()
+}
+
+// resume delivers the buffered events in order, then restarts the delivery.
+// When another goroutine already replays the buffer, it is left to deliver the events.
+func (d *eventDispatcher) resume() {
+	d.mutex.Lock()
+	d.paused = false
+	if d.replaying {
+		d.mutex.Unlock()
+		return
+	}
+	d.replaying = true
+	for {
+		// Stop when paused again, the next resume replays the rest
+		if d.paused || len(d.pending) == 0 {
+			d.replaying = false
+			d.mutex.Unlock()
+			return
+		}
+		pending := d.pending
+		d.pending = nil
+		d.mutex.Unlock()
+
+		for _, deliver := range pending {
+			deliver()
+		}
+		d.mutex.Lock()
+	}
+}
+
+// getDispatcher returns the event dispatcher of the setup, creating it if needed
+func (setup *FabricSetup) getDispatcher() *eventDispatcher {
+	setup.dispatcherOnce.Do(func() {
+		setup.dispatcher = &eventDispatcher{limit: setup.EventBufferSize}
+	})
+	return setup.dispatcher
+}
+
+// Pause stops the delivery of the events to the registered handlers, without unregistering them.
+// Events received while paused are buffered (up to EventBufferSize, dropping the oldest ones
+// when the buffer is full) and delivered when Resume is called.
+func (setup *FabricSetup) Pause() {
+	setup.getDispatcher().pause()
+}
+
+// Resume delivers the events buffered while paused and restarts the delivery of new events
+func (setup *FabricSetup) Resume() {
+	setup.getDispatcher().resume()
+}
+
+// DroppedEvents returns the number of events dropped because the buffer was full while paused
+func (setup *FabricSetup) DroppedEvents() uint64 {
+	d := setup.getDispatcher()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.dropped
+}
+
+// trackListener keeps the unregistration of an event listener, so Close can remove it
+func (setup *FabricSetup) trackListener(handle interface{}, unregister func()) {
+	setup.listenersMutex.Lock()
+	defer setup.listenersMutex.Unlock()
+	if setup.listeners == nil {
+		setup.listeners = make(map[interface{}]func())
+	}
+	setup.listeners[handle] = unregister
+}
+
+// untrackListener forgets the event listener and returns its unregistration, nil if the listener is unknown
+func (setup *FabricSetup) untrackListener(handle interface{}) func() {
+	setup.listenersMutex.Lock()
+	defer setup.listenersMutex.Unlock()
+	unregister, ok := setup.listeners[handle]
+	if !ok {
+		return nil
+	}
+	delete(setup.listeners, handle)
+	return unregister
+}
+
+// Registration is an event listener registered through the FabricSetup
+type Registration interface {
+	// Unregister stops the listening
+	Unregister() error
+}
+
+// listenerRegistration is the registration of a listener tracked by the setup
+type listenerRegistration struct {
+	setup	*FabricSetup
+	handle	interface{}
+}
+
+func (r *listenerRegistration) Unregister() error {
+	unregister := r.setup.untrackListener(r.handle)
+	if unregister == nil {
+		return fmt.Errorf("Unknown or already removed event registration")
+	}
+	unregister()
+	return nil
+}
+
+// RegisterChaincodeEvent calls the handler for each event named eventName (a regular expression)
+// emitted by the chaincode of the setup with stub.SetEvent, with the chaincode ID, transaction ID and payload of the event.
+// The handler runs on the goroutine of the event hub, through the dispatcher (see Pause): it must not block,
+// otherwise the next events, including the commit events awaited by InvokeWith, are delayed.
+// The returned registration stops the listening, Close stops it too.
+func (setup *FabricSetup) RegisterChaincodeEvent(eventName string, handler func(ccID string, txID string, payload []byte)) (Registration, error) {
+	if err := setup.ensureEventHubConnected(); err != nil {
+		return nil, err
+	}
+
+	dispatcher := setup.getDispatcher()
+	handle := setup.EventHub.RegisterChaincodeEvent(setup.ChaincodeId, eventName, func(event *api.ChaincodeEvent) {
+		dispatcher.dispatch(func() { handler(event.ChaincodeID, event.TxID, event.Payload) })
+	})
+	setup.trackListener(handle, func() { setup.EventHub.UnregisterChaincodeEvent(handle) })
+	return &listenerRegistration{setup: setup, handle: handle}, nil
+}
+
+// UnregisterChaincodeEvent stops the listening started by RegisterChaincodeEvent
+func (setup *FabricSetup) UnregisterChaincodeEvent(registration Registration) error {
+	return registration.Unregister()
+}
+
+// ensureEventHubConnected reconnects the event hub if it is disconnected (e.g. in the middle of a reconnection),
+// retrying with an exponential backoff up to EventRetries times before giving up with ErrEventHubNotConnected
+func (setup *FabricSetup) ensureEventHubConnected() error {
+	if !setup.Initialized || setup.EventHub == nil {
+		return fmt.Errorf("Unable to listen to the events: the setup is not initialized")
+	}
+	retries := setup.EventRetries
+	if retries == 0 {
+		retries = defaultEventRetries
+	}
+	backoff := setup.EventRetryBackoff
+	if backoff == 0 {
+		backoff = defaultEventRetryBackoff
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if setup.EventHub.IsConnected() {
+			return nil
+		}
+		if err = setup.connectEventHub(setup.EventHub); err == nil {
+			return nil
+		}
+		if attempt >= retries {
+			return fmt.Errorf("Unable to connect the event hub after %d attempt(s): %v: %w", attempt+1, err, ErrEventHubNotConnected)
+		}
+		time.Sleep(backoff << uint(attempt))
+	}
+}
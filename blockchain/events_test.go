@@ -0,0 +1,200 @@
+package blockchain
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// fakeEventHub is a connected event hub which, like the one of the SDK, unregisters the block callbacks
+// by comparing their function pointers
+type fakeEventHub struct {
+	mutex			sync.Mutex
+	blockCallbacks	[]func(*common.Block)
+}
+
+func (hub *fakeEventHub) SetPeerAddr(peerURL string, certificate string, serverHostOverride string) {}
+func (hub *fakeEventHub) IsConnected() bool { return true }
+func (hub *fakeEventHub) Connect() error { return nil }
+func (hub *fakeEventHub) Disconnect() {}
+func (hub *fakeEventHub) RegisterChaincodeEvent(ccid string, eventname string, callback func(*api.ChaincodeEvent)) *api.ChainCodeCBE {
+	return &api.ChainCodeCBE{}
+}
+func (hub *fakeEventHub) UnregisterChaincodeEvent(cbe *api.ChainCodeCBE) {}
+func (hub *fakeEventHub) RegisterTxEvent(txID string, callback func(string, pb.TxValidationCode, error)) {}
+func (hub *fakeEventHub) UnregisterTxEvent(txID string) {}
+
+func (hub *fakeEventHub) RegisterBlockEvent(callback func(*common.Block)) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.blockCallbacks = append(hub.blockCallbacks, callback)
+}
+
+func (hub *fakeEventHub) UnregisterBlockEvent(callback func(*common.Block)) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for i, registered := range hub.blockCallbacks {
+		if reflect.ValueOf(registered).Pointer() == reflect.ValueOf(callback).Pointer() {
+			hub.blockCallbacks = append(hub.blockCallbacks[:i], hub.blockCallbacks[i+1:]...)
+			return
+		}
+	}
+}
+
+// deliver sends the block to the registered callbacks and returns their count
+func (hub *fakeEventHub) deliver(block *common.Block) int {
+	hub.mutex.Lock()
+	callbacks := append([]func(*common.Block){}, hub.blockCallbacks...)
+	hub.mutex.Unlock()
+	for _, callback := range callbacks {
+		callback(block)
+	}
+	return len(callbacks)
+}
+
+// emptyBlock returns a block without transaction, the listeners only get blocks with a header and data
+func emptyBlock(number uint64) *common.Block {
+	return &common.Block{Header: &common.BlockHeader{Number: number}, Data: &common.BlockData{}}
+}
+
+func TestRegisterBlockListener(t *testing.T) {
+	hub := &fakeEventHub{}
+	setup := &FabricSetup{EventHub: hub}
+	if _, err := setup.RegisterBlockListener(func(BlockSummary) {}); err == nil {
+		t.Error("A setup not initialized accepted a registration")
+	}
+	if _, err := (&FabricSetup{Initialized: true}).RegisterChaincodeEvent("helloUpdated", func(string, string, []byte) {}); err == nil {
+		t.Error("A setup without event hub accepted a registration")
+	}
+
+	setup.Initialized = true
+	received := map[string]int{}
+	register := func(name string) Registration {
+		registration, err := setup.RegisterBlockListener(func(BlockSummary) { received[name]++ })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return registration
+	}
+	first := register("first")
+	second := register("second")
+
+	if callbacks := hub.deliver(emptyBlock(0)); callbacks != 1 {
+		t.Errorf("%d callbacks registered on the event hub, want 1", callbacks)
+	}
+	if received["first"] != 1 || received["second"] != 1 {
+		t.Errorf("Received %v, want one block for each registration", received)
+	}
+
+	// The other registration keeps listening
+	if err := first.Unregister(); err != nil {
+		t.Fatal(err)
+	}
+	hub.deliver(emptyBlock(0))
+	if received["first"] != 1 || received["second"] != 2 {
+		t.Errorf("Received %v after the first unregistration", received)
+	}
+
+	// The callback of the event hub goes with the last registration
+	if err := second.Unregister(); err != nil {
+		t.Fatal(err)
+	}
+	if callbacks := hub.deliver(emptyBlock(0)); callbacks != 0 {
+		t.Errorf("%d callbacks left on the event hub", callbacks)
+	}
+
+	// Close removes the remaining registrations
+	register("third")
+	if err := setup.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if callbacks := hub.deliver(emptyBlock(0)); callbacks != 0 || received["third"] != 0 {
+		t.Errorf("%d callbacks left on the event hub after Close", callbacks)
+	}
+}
+
+func TestEventSupervisorUnregistersItsCallback(t *testing.T) {
+	answered := make(chan struct{})
+	close(answered)
+	setup, _ := newInvokeSetup(t, &mspEndorser{mspID: "Org1MSP", answer: answered})
+	hub := setup.EventHub.(*fakeEventHub)
+	setup.startEventSupervisor()
+	received := 0
+	if _, err := setup.RegisterBlockListener(func(BlockSummary) { received++ }); err != nil {
+		t.Fatal(err)
+	}
+	if callbacks := hub.deliver(emptyBlock(0)); callbacks != 2 {
+		t.Errorf("%d callbacks registered on the event hub, want the supervisor and the listeners", callbacks)
+	}
+
+	setup.stopEventSupervisor()
+	if callbacks := hub.deliver(emptyBlock(0)); callbacks != 1 || received != 2 {
+		t.Errorf("%d callbacks left on the event hub and %d blocks received, want the listeners", callbacks, received)
+	}
+}
+
+func TestDispatcherResumeKeepsOrder(t *testing.T) {
+	dispatcher := &eventDispatcher{limit: 10}
+	var delivered []int
+	var event func(i int) func()
+	event = func(i int) func() {
+		return func() {
+			delivered = append(delivered, i)
+			if i != 0 {
+				return
+			}
+			// The event hub delivers and another goroutine resumes in the middle of the replay
+			dispatcher.dispatch(event(3))
+			done := make(chan struct{})
+			go func() {
+				dispatcher.resume()
+				close(done)
+			}()
+			<-done
+		}
+	}
+
+	dispatcher.pause()
+	for i := 0; i < 3; i++ {
+		dispatcher.dispatch(event(i))
+	}
+	dispatcher.resume()
+	dispatcher.dispatch(event(4))
+
+	if len(delivered) != 5 {
+		t.Fatalf("Delivered %v, want 5 events", delivered)
+	}
+	for i, got := range delivered {
+		if got != i {
+			t.Fatalf("Delivered %v, want the events in order", delivered)
+		}
+	}
+}
+
+func TestDispatcherPausedDuringReplay(t *testing.T) {
+	dispatcher := &eventDispatcher{limit: 10}
+	var delivered []int
+	dispatcher.pause()
+	for i := 0; i < 3; i++ {
+		i := i
+		dispatcher.dispatch(func() {
+			delivered = append(delivered, i)
+			if i == 0 {
+				dispatcher.pause()
+			}
+		})
+	}
+
+	dispatcher.resume()
+	dispatcher.dispatch(func() { delivered = append(delivered, 3) })
+	if len(delivered) != 3 {
+		t.Fatalf("Delivered %v while paused again", delivered)
+	}
+	dispatcher.resume()
+	if len(delivered) != 4 || delivered[3] != 3 {
+		t.Errorf("Delivered %v, want the events in order", delivered)
+	}
+}
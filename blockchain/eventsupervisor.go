@@ -0,0 +1,208 @@
+package blockchain
+
+import (
+	"sync"
+	"time"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+const (
+	defaultEventSupervisorInterval	= time.Second
+	defaultEventMaxBackoff			= 30 * time.Second
+)
+
+// blockReceiver is the part of the SDK event hub receiving the events from the peer
+type blockReceiver interface {
+	Recv(msg *pb.Event) (bool, error)
+}
+
+// eventSupervisor reconnects the event hub when its connection is lost, and replays the blocks
+// committed in the meantime so the listeners and the pending invokes miss no event.
+// The SDK event hub keeps its registrations while disconnected, they are active again once reconnected.
+type eventSupervisor struct {
+	setup		*FabricSetup
+	stop		chan struct{}
+	done		chan struct{}
+	mutex		sync.Mutex
+	lastBlocks	map[string]uint64	// Number of the last block received, by channel
+
+	// The callback registered on the event hub, the very value given back to UnregisterBlockEvent
+	blockCallback	func(*common.Block)
+}
+
+// startEventSupervisor starts to watch the connection of the event hub every EventSupervisorInterval
+func (setup *FabricSetup) startEventSupervisor() {
+	interval := setup.EventSupervisorInterval
+	if interval < 0 {
+		return
+	}
+	if interval == 0 {
+		interval = defaultEventSupervisorInterval
+	}
+
+	supervisor := &eventSupervisor{
+		setup:		setup,
+		stop:		make(chan struct{}),
+		done:		make(chan struct{}),
+		lastBlocks:	make(map[string]uint64),
+	}
+	if info, err := setup.Channel.QueryInfo(); err == nil && info.Height > 0 {
+		supervisor.lastBlocks[setup.ChannelId] = info.Height - 1
+	}
+	supervisor.blockCallback = func(block *common.Block) { supervisor.trackBlock(block) }
+	setup.EventHub.RegisterBlockEvent(supervisor.blockCallback)
+	setup.supervisor = supervisor
+	go supervisor.run(interval)
+}
+
+// stopEventSupervisor stops the supervisor, if any, and waits for it
+func (setup *FabricSetup) stopEventSupervisor() {
+	if setup.supervisor == nil {
+		return
+	}
+	close(setup.supervisor.stop)
+	<-setup.supervisor.done
+	setup.EventHub.UnregisterBlockEvent(setup.supervisor.blockCallback)
+	setup.supervisor = nil
+}
+
+// run checks the connection until stopped
+func (s *eventSupervisor) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if !s.setup.EventHub.IsConnected() {
+				s.reconnect()
+			}
+		}
+	}
+}
+
+// reconnect connects the event hub again, doubling the wait between the attempts from EventRetryBackoff
+// up to 30s, then replays the missed blocks
+func (s *eventSupervisor) reconnect() {
+	setup := s.setup
+	setup.logger().Errorf("Event hub disconnected")
+	s.notify(false)
+
+	backoff := setup.EventRetryBackoff
+	if backoff == 0 {
+		backoff = defaultEventRetryBackoff
+	}
+	for {
+		err := setup.connectEventHub(setup.EventHub)
+		if err == nil {
+			break
+		}
+		setup.logger().Errorf("Unable to reconnect the event hub, retry in %v: %v", backoff, err)
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > defaultEventMaxBackoff {
+			backoff = defaultEventMaxBackoff
+		}
+	}
+
+	setup.logger().Printf("Event hub reconnected")
+	s.replay()
+	s.notify(true)
+}
+
+// notify reports the state to the metrics and calls OnEventHubState, if set.
+// The query cache is cleared on a disconnection, the blocks committed meanwhile may never be replayed.
+func (s *eventSupervisor) notify(connected bool) {
+	if !connected {
+		s.setup.queryCache.clear()
+	}
+	s.setup.metrics().SetEventHubConnected(connected)
+	if s.setup.OnEventHubState != nil {
+		s.setup.OnEventHubState(connected)
+	}
+}
+
+// trackBlock records the number of the block received by the event hub
+func (s *eventSupervisor) trackBlock(block *common.Block) {
+	channelID, err := blockChannelID(block)
+	if err != nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if last, ok := s.lastBlocks[channelID]; !ok || block.Header.Number > last {
+		s.lastBlocks[channelID] = block.Header.Number
+	}
+}
+
+// lastBlock returns the number of the last block received in the channel
+func (s *eventSupervisor) lastBlock(channelID string) (uint64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	last, ok := s.lastBlocks[channelID]
+	return last, ok
+}
+
+// replay gives to the event hub the blocks committed in the channels of the setup since the last block received,
+// as if the peer had sent them. A block committed while reconnecting can be delivered twice.
+func (s *eventSupervisor) replay() {
+	setup := s.setup
+	receiver, ok := setup.EventHub.(blockReceiver)
+	if !ok {
+		setup.logger().Errorf("The event hub can't replay the missed blocks")
+		return
+	}
+
+	for _, channelID := range setup.Channels().IDs() {
+		last, ok := s.lastBlock(channelID)
+		if !ok {
+			continue
+		}
+		channel, err := setup.Channels().Get(channelID)
+		if err != nil {
+			continue
+		}
+		logger := WithFields(setup.logger(), Fields{FieldChannel: channelID})
+		info, err := channel.QueryInfo()
+		if err != nil {
+			logger.Errorf("Unable to query the missed blocks: %v", err)
+			continue
+		}
+		for number := last + 1; number < info.Height; number++ {
+			if current, _ := s.lastBlock(channelID); number <= current {
+				continue
+			}
+			block, err := channel.QueryBlock(int(number))
+			if err != nil {
+				logger.Errorf("Unable to query the missed block %d: %v", number, err)
+				break
+			}
+			logger.Debugf("Replaying the block %d", number)
+			receiver.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+		}
+	}
+}
+
+// blockChannelID returns the ID of the channel of the block, read from its first transaction
+func blockChannelID(block *common.Block) (string, error) {
+	envelope, err := protosUtils.ExtractEnvelope(block, 0)
+	if err != nil {
+		return "", err
+	}
+	payload, err := protosUtils.ExtractPayload(envelope)
+	if err != nil {
+		return "", err
+	}
+	channelHeader, err := protosUtils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return "", err
+	}
+	return channelHeader.ChannelId, nil
+}
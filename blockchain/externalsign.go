@@ -0,0 +1,191 @@
+package blockchain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/common/crypto"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// The invokes signed outside of the service (e.g. by a mobile wallet or a KMS) go through three steps:
+// PrepareProposal returns the proposal to sign, EndorseSigned sends it with its signature to the peers
+// and returns the transaction to sign, SubmitSigned sends it with its signature to the orderer.
+// Each signature is the ECDSA signature (ASN.1 DER, with a low S like Fabric requires) of the SHA-256 hash
+// of the bytes, by the key of the certificate given to PrepareProposal. The service never holds the key.
+
+// UnsignedProposal is a proposal to sign outside of the service
+type UnsignedProposal struct {
+	TxID		string
+	ChannelID	string
+	Bytes		[]byte	// The marshalled proposal, whose hash is signed
+}
+
+// UnsignedTransaction is an endorsed transaction to sign outside of the service
+type UnsignedTransaction struct {
+	TxID		string
+	ChannelID	string
+	Bytes		[]byte		// The payload of the transaction envelope, whose hash is signed
+	Endorsers	[]string	// The peers which endorsed the proposal
+}
+
+// PrepareProposal returns the unsigned proposal invoking the function of the chaincode of the channel,
+// the primary channel when empty, created by the holder of the PEM certificate in the MSP of the client
+func (setup *FabricSetup) PrepareProposal(channelID string, certificate []byte, function string, args []string, transientData map[string][]byte) (*UnsignedProposal, error) {
+	if !setup.Initialized {
+		return nil, fmt.Errorf("Unable to prepare the proposal: the setup is not initialized")
+	}
+	if len(certificate) == 0 {
+		return nil, fmt.Errorf("The certificate of the signer is empty")
+	}
+	target, err := setup.target(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err = setup.serializeArgs(append([]string{function}, args...))
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := crypto.GetRandomNonce()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to generate a nonce: %v", err)
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:		setup.Client.GetConfig().GetFabricCAID(),
+		IdBytes:	certificate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	txID, proposal, err := chaincodeProposal(target, args, transientData, nonce, creator)
+	if err != nil {
+		return nil, err
+	}
+	proposalBytes, err := proto.Marshal(proposal)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to marshal the proposal: %v", err)
+	}
+	return &UnsignedProposal{TxID: txID, ChannelID: target.channelID, Bytes: proposalBytes}, nil
+}
+
+// EndorseSigned sends the proposal with its signature to the endorsing peers and returns the unsigned transaction
+// made of their endorsements. The endorsements are checked like the ones of InvokeWith.
+func (setup *FabricSetup) EndorseSigned(unsigned *UnsignedProposal, signature []byte) (*UnsignedTransaction, error) {
+	if !setup.Initialized {
+		return nil, fmt.Errorf("Unable to endorse the proposal: the setup is not initialized")
+	}
+	target, err := setup.target(unsigned.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	proposal := &pb.Proposal{}
+	if err := proto.Unmarshal(unsigned.Bytes, proposal); err != nil {
+		return nil, fmt.Errorf("Invalid proposal: %v", err)
+	}
+	channelHeader, err := proposalChannelHeader(proposal)
+	if err != nil {
+		return nil, err
+	}
+	if channelHeader.TxId != unsigned.TxID || channelHeader.ChannelId != target.channelID {
+		return nil, fmt.Errorf("The proposal is not the transaction %s of the channel %s", unsigned.TxID, target.channelID)
+	}
+	transactionProposal := &api.TransactionProposal{
+		TransactionID:	unsigned.TxID,
+		SignedProposal:	&pb.SignedProposal{ProposalBytes: unsigned.Bytes, Signature: signature},
+		Proposal:		proposal,
+	}
+
+	setup.userMutex.RLock()
+	defer setup.userMutex.RUnlock()
+	logger := WithFields(setup.targetLogger(target), Fields{FieldTxID: unsigned.TxID})
+	var responses []*api.TransactionProposalResponse
+	err = setup.retry(target.callContext(), "Transaction proposal", func() (err error) {
+		responses, err = setup.sendProposal(transactionProposal, setup.endorsementTargets(target.channel), noopSpan{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Send transaction proposal return error: %w", ledgerError(unsigned.TxID, err))
+	}
+	if err := checkEndorsementsAgree(responses); err != nil {
+		return nil, err
+	}
+	if err := setup.validateResponses(responses); err != nil {
+		return nil, fmt.Errorf("Invalid endorsements: %w", err)
+	}
+	endorsingPeers := endorsers(responses)
+	WithFields(logger, Fields{FieldPeer: strings.Join(endorsingPeers, ",")}).Debugf("Externally signed proposal endorsed")
+
+	payload, err := transactionPayload(target.channel, responses)
+	if err != nil {
+		return nil, err
+	}
+	return &UnsignedTransaction{TxID: unsigned.TxID, ChannelID: target.channelID, Bytes: payload, Endorsers: endorsingPeers}, nil
+}
+
+// SubmitSigned sends the transaction with its signature to the orderer and waits for its commit, up to CommitTimeout.
+// The status of an invalidated transaction is returned with the typed error of its validation code.
+func (setup *FabricSetup) SubmitSigned(unsigned *UnsignedTransaction, signature []byte) (status *CommitStatus, err error) {
+	if !setup.Initialized {
+		return nil, fmt.Errorf("Unable to submit the transaction: the setup is not initialized")
+	}
+	defer func(start time.Time) { setup.observeOperation("SubmitSigned", start, err) }(time.Now())
+	target, err := setup.target(unsigned.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := protosUtils.UnmarshalPayload(unsigned.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid transaction: %v", err)
+	}
+	channelHeader, err := protosUtils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid transaction: %v", err)
+	}
+	if channelHeader.TxId != unsigned.TxID || channelHeader.ChannelId != target.channelID {
+		return nil, fmt.Errorf("The payload is not the transaction %s of the channel %s", unsigned.TxID, target.channelID)
+	}
+
+	setup.userMutex.RLock()
+	defer setup.userMutex.RUnlock()
+	committed, err := setup.registerTxEvent(unsigned.TxID)
+	if err != nil {
+		return nil, fmt.Errorf("Register the transaction event return error: %w", err)
+	}
+	sent := time.Now()
+	err = runWithTimeout("Ordering", unsigned.TxID, setup.OrderingTimeout, func() error {
+		return setup.broadcast(target.channel, &api.SignedEnvelope{Payload: unsigned.Bytes, Signature: signature})
+	})
+	if err != nil {
+		setup.unregisterTxEvent(unsigned.TxID)
+		return nil, fmt.Errorf("Send transaction return error: %w", err)
+	}
+	return setup.awaitCommit(&pendingTx{
+		txID:			unsigned.TxID,
+		endorsingPeers:	unsigned.Endorsers,
+		committed:		committed,
+		sent:			sent,
+		logger:			WithFields(setup.targetLogger(target), Fields{FieldTxID: unsigned.TxID}),
+	})
+}
+
+// proposalChannelHeader returns the channel header of the proposal, checking its signature header is well formed
+func proposalChannelHeader(proposal *pb.Proposal) (*common.ChannelHeader, error) {
+	header, err := protosUtils.GetHeader(proposal.Header)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proposal header: %v", err)
+	}
+	if _, err := protosUtils.GetSignatureHeader(header.SignatureHeader); err != nil {
+		return nil, fmt.Errorf("Invalid proposal signature header: %v", err)
+	}
+	channelHeader, err := protosUtils.UnmarshalChannelHeader(header.ChannelHeader)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proposal channel header: %v", err)
+	}
+	return channelHeader, nil
+}
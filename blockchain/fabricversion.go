@@ -0,0 +1,58 @@
+package blockchain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version of Fabric run by the network of the fixtures (fixtures/docker-compose.yaml)
+const defaultFabricVersion = "1.0"
+
+// First versions of Fabric with the features of the setup refused on an older network, see "Upgrading the network" in README.md
+const (
+	fabricCollections		= "1.1"	// Private data collections
+	fabricLifecycleV2		= "2.0"	// The _lifecycle system chaincode
+	fabricExternalChaincode	= "2.4"	// The ccaas builder of the peer
+)
+
+// fabricVersion returns the version of Fabric run by the network, FabricVersion or its default
+func (setup *FabricSetup) fabricVersion() string {
+	if setup.FabricVersion == "" {
+		return defaultFabricVersion
+	}
+	return setup.FabricVersion
+}
+
+// requireFabric returns an error when the network runs a version of Fabric older than the one the feature needs
+func (setup *FabricSetup) requireFabric(version string, feature string) error {
+	current, err := parseFabricVersion(setup.fabricVersion())
+	if err != nil {
+		return err
+	}
+	required, err := parseFabricVersion(version)
+	if err != nil {
+		return err
+	}
+	if current[0] < required[0] || (current[0] == required[0] && current[1] < required[1]) {
+		return fmt.Errorf("%s needs Fabric %s or later, the network runs Fabric %s (see FabricVersion)", feature, version, setup.fabricVersion())
+	}
+	return nil
+}
+
+// parseFabricVersion returns the major and minor numbers of a version like "1.4" or "2.4.1"
+func parseFabricVersion(version string) ([2]int, error) {
+	var numbers [2]int
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return numbers, fmt.Errorf("Invalid Fabric version: %s", version)
+	}
+	for i := range numbers {
+		number, err := strconv.Atoi(parts[i])
+		if err != nil || number < 0 {
+			return numbers, fmt.Errorf("Invalid Fabric version: %s", version)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
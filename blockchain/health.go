@@ -0,0 +1,159 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// Components of the HealthReport errors, besides the URLs of the peers and orderers
+const (
+	ComponentEnrollment	= "enrollment"
+	ComponentChannel	= "channel"
+	ComponentEventHub	= "eventhub"
+	ComponentChaincode	= "chaincode"
+)
+
+// HealthReport is the status of each component used by the setup
+type HealthReport struct {
+	Enrolled	bool			// The client has an enrolled user
+	Peers		map[string]bool	// Peers of the channel answering a ledger query, by URL
+	Orderers	map[string]bool	// Orderers of the channel accepting a connection, by URL
+	EventHub	bool			// The event hub is connected
+	Chaincode	bool			// The chaincode is instantiated in ChaincodeVersion
+
+	// Why each unhealthy component is unhealthy, by component: one of the Component constants,
+	// or the URL of a peer or an orderer
+	Errors		map[string]string
+}
+
+// Healthy tells if every component is healthy
+func (report *HealthReport) Healthy() bool {
+	if !report.Enrolled || !report.EventHub || !report.Chaincode {
+		return false
+	}
+	for _, healthy := range report.Peers {
+		if !healthy {
+			return false
+		}
+	}
+	for _, healthy := range report.Orderers {
+		if !healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// Health checks the client is enrolled, each peer of the channel answers a ledger query (qscc GetChainInfo),
+// each orderer accepts a connection, the event hub is connected and the chaincode is instantiated in its version.
+// The checks run concurrently, each one gives up after HealthCheckTimeout or when the context is done,
+// so a probe doesn't hang on an unresponsive component. In development mode, the peer and the chaincode are healthy
+// when the development server accepts a connection.
+func (setup *FabricSetup) Health(ctx context.Context) *HealthReport {
+	timeout := setup.HealthCheckTimeout
+	if timeout == 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	report := &HealthReport{Peers: map[string]bool{}, Orderers: map[string]bool{}, Errors: map[string]string{}}
+
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	check := func(component string, call func(ctx context.Context) error, healthy func(bool)) {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			err := probe(ctx, timeout, call)
+			mutex.Lock()
+			defer mutex.Unlock()
+			healthy(err == nil)
+			if err != nil {
+				report.Errors[component] = err.Error()
+			}
+		}()
+	}
+
+	check(ComponentEnrollment, func(ctx context.Context) error {
+		if setup.Client == nil || setup.Client.GetUserContext() == nil || len(setup.Client.GetUserContext().GetEnrollmentCertificate()) == 0 {
+			return fmt.Errorf("The client is not enrolled")
+		}
+		return nil
+	}, func(healthy bool) { report.Enrolled = healthy })
+
+	if setup.Channel == nil {
+		check(ComponentChannel, func(ctx context.Context) error {
+			return fmt.Errorf("The channel (%s) is not initialized", setup.ChannelId)
+		}, func(bool) {})
+	} else {
+		for _, peer := range setup.Channel.GetPeers() {
+			peer := peer
+			check(peer.URL(), func(ctx context.Context) error {
+				if setup.DevMode {
+					return setup.pingDevServer(ctx)
+				}
+				_, err := setup.ledgerHeight(peer)
+				return err
+			}, func(healthy bool) { report.Peers[peer.URL()] = healthy })
+		}
+		for _, orderer := range setup.Channel.GetOrderers() {
+			url := orderer.GetURL()
+			check(url, func(ctx context.Context) error {
+				connection, err := (&net.Dialer{}).DialContext(ctx, "tcp", url)
+				if err != nil {
+					return err
+				}
+				return connection.Close()
+			}, func(healthy bool) { report.Orderers[url] = healthy })
+		}
+	}
+
+	check(ComponentEventHub, func(ctx context.Context) error {
+		if setup.EventHub == nil || !setup.EventHub.IsConnected() {
+			return ErrEventHubNotConnected
+		}
+		return nil
+	}, func(healthy bool) { report.EventHub = healthy })
+
+	check(ComponentChaincode, func(ctx context.Context) error {
+		if setup.Channel == nil {
+			return fmt.Errorf("The channel (%s) is not initialized", setup.ChannelId)
+		}
+		// The development server runs the chaincode without instantiate
+		if setup.DevMode {
+			return setup.pingDevServer(ctx)
+		}
+		instantiated, err := setup.IsChaincodeInstantiated()
+		if err != nil {
+			return err
+		}
+		if !instantiated {
+			return fmt.Errorf("The chaincode %s is not instantiated in the version %s", setup.ChaincodeId, setup.ChaincodeVersion)
+		}
+		return nil
+	}, func(healthy bool) { report.Chaincode = healthy })
+
+	wait.Wait()
+	return report
+}
+
+// probe runs the check, giving up after the timeout or when the context is done.
+// The SDK calls can't be cancelled, so the call keeps running in the background after giving up.
+func probe(ctx context.Context, timeout time.Duration, call func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- call(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("No answer within %v", timeout)
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,33 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// KeyModification is a modification of a key of the world state, by a valid transaction
+type KeyModification struct {
+	TxID		string		`json:"txId"`
+	Timestamp	time.Time	`json:"timestamp"`	// Of the transaction, set by the client creating it
+	Value		[]byte		`json:"value"`		// Empty for a deletion
+	IsDelete	bool		`json:"isDelete"`
+}
+
+// GetHistory returns the modifications of the key, oldest first, read by the history function of the chaincode.
+// The key is the one of the world state, e.g. "hero_" followed by the id for a hero.
+func (setup *FabricSetup) GetHistory(key string) ([]KeyModification, error) {
+	if key == "" {
+		return nil, fmt.Errorf("The key of the history is empty")
+	}
+	payload, err := setup.QueryWith(context.Background(), "invoke", []string{"query", "history", key})
+	if err != nil {
+		return nil, err
+	}
+	var modifications []KeyModification
+	if err := json.Unmarshal(payload, &modifications); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the history of the key %s: %v", key, err)
+	}
+	return modifications, nil
+}
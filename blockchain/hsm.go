@@ -0,0 +1,55 @@
+package blockchain
+
+import (
+	"fmt"
+	"os"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/bccsp/pkcs11"
+)
+
+// HSMConfig is the PKCS#11 token (an HSM or SoftHSM) holding the signing keys of the client,
+// instead of the software keystore of the SDK
+type HSMConfig struct {
+	Library		string	// Path of the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	Label		string	// Label of the token, which selects its slot
+	Pin			string	// User PIN of the token
+	SoftVerify	bool	// Verify the signatures in software rather than with the token
+}
+
+// validate checks the parameters before loading the library
+func (hsm *HSMConfig) validate() error {
+	if hsm.Library == "" || hsm.Label == "" || hsm.Pin == "" {
+		return fmt.Errorf("The HSM configuration needs the library, the token label and the PIN")
+	}
+	if _, err := os.Stat(hsm.Library); err != nil {
+		return fmt.Errorf("Unable to find the PKCS#11 library: %v", err)
+	}
+	return nil
+}
+
+// cspConfig returns the configuration of the BCCSP: the one of the SDK configuration, with the PKCS#11
+// provider of HSM when set. The hash family, the security level and the keystore are kept.
+func (setup *FabricSetup) cspConfig(sdkConfig *bccspFactory.FactoryOpts) (*bccspFactory.FactoryOpts, error) {
+	if setup.HSM == nil {
+		return sdkConfig, nil
+	}
+	if err := setup.HSM.validate(); err != nil {
+		return nil, err
+	}
+
+	hsm := setup.HSM
+	opts := &pkcs11.PKCS11Opts{
+		Library:	hsm.Library,
+		Label:		hsm.Label,
+		Pin:		hsm.Pin,
+		SoftVerify:	hsm.SoftVerify,
+	}
+	if sdkConfig != nil && sdkConfig.SwOpts != nil {
+		opts.SecLevel = sdkConfig.SwOpts.SecLevel
+		opts.HashFamily = sdkConfig.SwOpts.HashFamily
+		if sdkConfig.SwOpts.FileKeystore != nil {
+			opts.FileKeystore = &pkcs11.FileKeystoreOpts{KeyStorePath: sdkConfig.SwOpts.FileKeystore.KeyStorePath}
+		}
+	}
+	return &bccspFactory.FactoryOpts{ProviderName: "PKCS11", Pkcs11Opts: opts}, nil
+}
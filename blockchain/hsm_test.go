@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+)
+
+func TestCSPConfig(t *testing.T) {
+	sdkConfig := &bccspFactory.FactoryOpts{
+		ProviderName:	"SW",
+		SwOpts:			&bccspFactory.SwOpts{
+			SecLevel:		384,
+			HashFamily:		"SHA3",
+			FileKeystore:	&bccspFactory.FileKeystoreOpts{KeyStorePath: "/tmp/keystore"},
+		},
+	}
+	setup := &FabricSetup{}
+	if config, err := setup.cspConfig(sdkConfig); err != nil || config != sdkConfig {
+		t.Errorf("Without HSM, got %v, %v, want the configuration of the SDK", config, err)
+	}
+
+	library, err := ioutil.TempFile("", "libpkcs11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	library.Close()
+	defer os.Remove(library.Name())
+	for _, hsm := range []*HSMConfig{
+		{Label: "heroes", Pin: "98765432"},
+		{Library: library.Name(), Pin: "98765432"},
+		{Library: library.Name(), Label: "heroes"},
+		{Library: "/missing/libsofthsm2.so", Label: "heroes", Pin: "98765432"},
+	} {
+		setup.HSM = hsm
+		if _, err := setup.cspConfig(sdkConfig); err == nil {
+			t.Errorf("The HSM configuration %+v was accepted", hsm)
+		}
+	}
+
+	setup.HSM = &HSMConfig{Library: library.Name(), Label: "heroes", Pin: "98765432", SoftVerify: true}
+	config, err := setup.cspConfig(sdkConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := config.Pkcs11Opts
+	if config.ProviderName != "PKCS11" || opts.Library != library.Name() || opts.Label != "heroes" || opts.Pin != "98765432" || !opts.SoftVerify {
+		t.Errorf("The token isn't configured: %+v", opts)
+	}
+	if opts.SecLevel != 384 || opts.HashFamily != "SHA3" || opts.FileKeystore.KeyStorePath != "/tmp/keystore" {
+		t.Errorf("The settings of the SDK weren't kept: %+v", opts)
+	}
+}
+
+func TestHSMFromEnvironment(t *testing.T) {
+	library, err := ioutil.TempFile("", "libpkcs11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	library.Close()
+	defer os.Remove(library.Name())
+	environment := map[string]string{
+		"HEROES_PKCS11_LIBRARY":	library.Name(),
+		"HEROES_PKCS11_LABEL":		"heroes",
+		"HEROES_PKCS11_PIN":		"98765432",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := environment[name]
+		return value, ok
+	}
+
+	setup := NewFabricSetupFromConfig(configFrom(lookup))
+	if hsm := setup.HSM; hsm == nil || hsm.Library != library.Name() || hsm.Label != "heroes" || hsm.Pin != "98765432" {
+		t.Fatalf("The token of the environment isn't configured: %+v", hsm)
+	}
+	config, err := setup.cspConfig(&bccspFactory.FactoryOpts{SwOpts: &bccspFactory.SwOpts{SecLevel: 256, HashFamily: "SHA2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The PKCS#11 provider loads the library, which isn't one
+	if _, err := bccspFactory.GetBCCSPFromOpts(config); err == nil {
+		t.Error("The PKCS#11 provider was created without a PKCS#11 library")
+	}
+
+	delete(environment, "HEROES_PKCS11_LIBRARY")
+	if setup := NewFabricSetupFromConfig(configFrom(lookup)); setup.HSM != nil {
+		t.Errorf("A token is configured without library: %+v", setup.HSM)
+	}
+}
+
+// TestSoftHSM signs with a key generated in the SoftHSM token given like to DefaultConfig, e.g.
+// softhsm2-util --init-token --slot 0 --label heroes --pin 98765432 --so-pin 1234
+func TestSoftHSM(t *testing.T) {
+	hsm := &HSMConfig{
+		Library:	os.Getenv("HEROES_PKCS11_LIBRARY"),
+		Label:		os.Getenv("HEROES_PKCS11_LABEL"),
+		Pin:		os.Getenv("HEROES_PKCS11_PIN"),
+	}
+	if hsm.validate() != nil {
+		t.Skip("No SoftHSM token, set HEROES_PKCS11_LIBRARY, HEROES_PKCS11_LABEL and HEROES_PKCS11_PIN")
+	}
+	setup := &FabricSetup{HSM: hsm}
+	config, err := setup.cspConfig(&bccspFactory.FactoryOpts{SwOpts: &bccspFactory.SwOpts{SecLevel: 256, HashFamily: "SHA2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csp, err := bccspFactory.GetBCCSPFromOpts(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := csp.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Private() {
+		t.Error("The token returned no private key")
+	}
+	digest, err := csp.Hash([]byte("heroes-service"), &bccsp.SHAOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := csp.Sign(key, digest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := csp.Verify(publicKey, signature, digest, nil); !valid {
+		t.Errorf("The signature of the token isn't valid: %v", err)
+	}
+
+	// The key stays in the token, found again by its SKI
+	found, err := csp.GetKey(key.SKI())
+	if err != nil || !found.Private() {
+		t.Errorf("The key isn't kept in the token: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+	sdkUser "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/user"
+)
+
+// expireCachedIdentity removes the identity cached in the state store, so it will be enrolled again, when:
+//  - its certificate has expired (always checked, whatever the TTL)
+//  - it has been cached for longer than the TTL (if the TTL is set), which catches revoked
+//    certificates that are still valid on the client side
+func expireCachedIdentity(stateStorePath string, name string, ttl time.Duration) error {
+	file := filepath.Join(stateStorePath, name+".json")
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to read the cached identity of %s: %v", name, err)
+	}
+
+	expired := ttl > 0 && time.Since(info.ModTime()) > ttl
+	if !expired {
+		notAfter, err := cachedCertificateExpiry(file)
+		if err != nil {
+			return err
+		}
+		expired = time.Now().After(notAfter)
+	}
+	if !expired {
+		return nil
+	}
+
+	if err := os.Remove(file); err != nil {
+		return fmt.Errorf("Unable to remove the expired identity of %s: %v", name, err)
+	}
+	return nil
+}
+
+// cachedCertificateExpiry returns the expiry date of the certificate of an identity cached in the state store
+func cachedCertificateExpiry(file string) (time.Time, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to read the cached identity %s: %v", file, err)
+	}
+	var cached sdkUser.JSON
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return time.Time{}, fmt.Errorf("Unable to unmarshal the cached identity %s: %v", file, err)
+	}
+	block, _ := pem.Decode(cached.EnrollmentCertificate)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("No certificate in the cached identity %s", file)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to parse the certificate of the cached identity %s: %v", file, err)
+	}
+	return cert.NotAfter, nil
+}
@@ -1,19 +1,28 @@
 package blockchain
 
 import (
-	fcutil "github.com/hyperledger/fabric-sdk-go/pkg/util"
+	"bytes"
 	api "github.com/hyperledger/fabric-sdk-go/api"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const defaultCommitTimeout = 30 * time.Second
+
 // InvokeHello
 func (setup *FabricSetup) InvokeHello(value string) (string, error) {
+	txID, _, err := setup.InvokeHelloWithEndorsers(value)
+	return txID, err
+}
+
+// InvokeHelloWithEndorsers is like InvokeHello, but also returns the URL of the peers whose endorsement was used
+func (setup *FabricSetup) InvokeHelloWithEndorsers(value string) (txID string, endorsingPeers []string, err error) {
 
 	// Prepare arguments
 	var args[]string
 	args = append(args, "invoke")
-	args = append(args, "invoke")
 	args = append(args, "hello")
 	args = append(args, value)
 
@@ -21,39 +30,196 @@ func (setup *FabricSetup) InvokeHello(value string) (string, error) {
 	transientDataMap := make(map[string][]byte)
 	transientDataMap["result"] = []byte("Transient data in hello invoke")
 
+	// Submitted like any other invoke, retried on a conflict
+	setup.userMutex.RLock()
+	defer setup.userMutex.RUnlock()
+	status, err := setup.invokeStatusOn(setup.primaryTarget(), "invoke", args, transientDataMap, true)
+	if err != nil {
+		return "", nil, fmt.Errorf("Invoke hello return error: %w", err)
+	}
+	return status.TxID, status.Endorsers, nil
+}
+
+// invokeFunctionOn calls the function of the chaincode of the target channel and waits for the commit.
+// With retryConflicts, an invoke in conflict with another transaction is executed again.
+func (setup *FabricSetup) invokeFunctionOn(target channelTarget, function string, args []string, retryConflicts bool) (string, error) {
+	status, err := setup.invokeStatusOn(target, function, args, target.transientMap, retryConflicts)
+	if err != nil {
+		return "", err
+	}
+	return status.TxID, nil
+}
+
+// invokeStatusOn is invokeFunctionOn with the transient data of the proposal, returning the commit status of the transaction
+func (setup *FabricSetup) invokeStatusOn(target channelTarget, function string, args []string, transientData map[string][]byte, retryConflicts bool) (*CommitStatus, error) {
+	if !setup.Initialized {
+		return nil, fmt.Errorf("Unable to invoke the chaincode: the setup is not initialized")
+	}
+	var status *CommitStatus
+	invoke := func() (err error) {
+		status, _, err = setup.invokeOn(target, append([]string{function}, args...), transientData)
+		return err
+	}
+	// The invoke runs on a worker of the submission queue
+	var err error
+	submitErr := setup.submit(func() {
+		if retryConflicts {
+			err = setup.retryConflicts(setup.targetLogger(target), invoke)
+		} else {
+			err = invoke()
+		}
+	})
+	if submitErr != nil {
+		return nil, submitErr
+	}
+	if err != nil {
+		return status, fmt.Errorf("Invoke of %s return error: %w", function, err)
+	}
+	return status, nil
+}
+
+// invokeOn endorses the proposal on the target channel, sends the transaction to the orderer and waits for its commit.
+// The status of an invalidated transaction is returned with the typed error of its validation code.
+func (setup *FabricSetup) invokeOn(target channelTarget, args []string, transientData map[string][]byte) (status *CommitStatus, endorsingPeers []string, err error) {
+	span := setup.startTargetSpan(target, "Invoke")
+	defer func() { endSpan(span, err) }()
+	defer func(start time.Time) { setup.observeOperation("Invoke", start, err) }(time.Now())
+	var pending *pendingTx
+	defer func(start time.Time) {
+		setup.audit("Invoke", target, args, start, func(record *AuditRecord) {
+			if pending != nil {
+				record.TxID = pending.txID
+				record.EndorsingPeers = pending.endorsingPeers
+			}
+			if status != nil {
+				record.ValidationCode = status.ValidationCode.String()
+			}
+		}, err)
+	}(time.Now())
+
+	pending, err = setup.sendTransactionOn(target, args, transientData, span)
+	if err != nil {
+		return nil, nil, err
+	}
+	commitSpan := startChildSpan(span, "Commit")
+	commitSpan.SetAttribute(AttributeTxID, pending.txID)
+	status, err = setup.awaitCommit(pending)
+	if status != nil {
+		commitSpan.SetAttribute(AttributeBlock, strconv.FormatUint(status.BlockNumber, 10))
+	}
+	endSpan(commitSpan, err)
+	if err != nil {
+		return status, nil, err
+	}
+	return status, pending.endorsingPeers, nil
+}
+
+// pendingTx is a transaction sent to the orderer, waiting for its commit
+type pendingTx struct {
+	txID			string
+	endorsingPeers	[]string
+	committed		<-chan *CommitStatus	// Registered by registerTxEvent, see awaitCommit
+	sent			time.Time
+	logger			Logger
+}
+
+// sendTransactionOn endorses the proposal on the target channel and sends the transaction to the orderer.
+// The commit of the transaction must be awaited with awaitCommit.
+func (setup *FabricSetup) sendTransactionOn(target channelTarget, args []string, transientData map[string][]byte, span Span) (*pendingTx, error) {
+
 	// Make a next transaction proposal and send it
-	transactionProposalResponse, txID, err := fcutil.CreateAndSendTransactionProposal(
-		setup.Channel,
-		setup.ChaincodeId,
-		setup.ChannelId,
-		args,
-		[]api.Peer{setup.Channel.GetPrimaryPeer()},
-		transientDataMap,
-	)
+	// The transaction ID computed by ComputeTxID, if any, is used here
+	proposal, err := setup.createProposalOn(target, args, transientData)
 	if err != nil {
-		return "", fmt.Errorf("Create and send transaction proposal in the invoke hello return error: %v", err)
+		return nil, fmt.Errorf("Create transaction proposal return error: %w", err)
+	}
+	txID := proposal.TransactionID
+	span.SetAttribute(AttributeTxID, txID)
+	logger := WithFields(setup.targetLogger(target), Fields{FieldTxID: txID})
+	logger.Debugf("Transaction proposal created")
+	var transactionProposalResponse []*api.TransactionProposalResponse
+	proposalStart := time.Now()
+	err = setup.retry(target.callContext(), "Transaction proposal", func() (err error) {
+		// The targets are selected again at each attempt, so an unreachable peer is replaced
+		transactionProposalResponse, err = setup.sendProposal(proposal, setup.endorsementTargets(target.channel), span)
+		return err
+	})
+	setup.metrics().ObserveProposal(time.Since(proposalStart), err)
+	if err != nil {
+		return nil, fmt.Errorf("Send transaction proposal return error: %w", ledgerError(txID, err))
+	}
+
+	// Endorsements with different results would make an invalid transaction, don't send it
+	if err := checkEndorsementsAgree(transactionProposalResponse); err != nil {
+		return nil, err
+	}
+	if err := setup.validateResponses(transactionProposalResponse); err != nil {
+		return nil, fmt.Errorf("Invalid endorsements: %w", err)
 	}
+	endorsingPeers := endorsers(transactionProposalResponse)
+	span.SetAttribute(AttributePeer, strings.Join(endorsingPeers, ","))
+	WithFields(logger, Fields{FieldPeer: strings.Join(endorsingPeers, ",")}).Debugf("Transaction proposal endorsed")
 
 	// Register the Fabric SDK to listen to the event that will come back when the transaction will be send
-	done, fail := fcutil.RegisterTxEvent(txID, setup.EventHub)
+	committed, err := setup.registerTxEvent(txID)
+	if err != nil {
+		return nil, fmt.Errorf("Register the transaction event return error: %w", err)
+	}
 
 	// Send the final transaction signed by endorser
-	if _, err := fcutil.CreateAndSendTransaction(setup.Channel, transactionProposalResponse); err != nil {
-		return "", fmt.Errorf("Create and send transaction in the invoke hello return error: %v", err)
+	sent := time.Now()
+	orderingSpan := startChildSpan(span, "Order")
+	orderingSpan.SetAttribute(AttributeTxID, txID)
+	err = runWithTimeout("Ordering", txID, setup.OrderingTimeout, func() error {
+		return setup.createAndSendTransaction(target, transactionProposalResponse)
+	})
+	endSpan(orderingSpan, err)
+	if err != nil {
+		setup.unregisterTxEvent(txID)
+		return nil, fmt.Errorf("Create and send transaction return error: %w", err)
+	}
+	return &pendingTx{txID: txID, endorsingPeers: endorsingPeers, committed: committed, sent: sent, logger: logger}, nil
+}
+
+// awaitCommit waits for the commit of the transaction sent, up to CommitTimeout.
+// The status of an invalidated transaction is returned with the typed error of its validation code.
+func (setup *FabricSetup) awaitCommit(pending *pendingTx) (*CommitStatus, error) {
+	defer setup.unregisterTxEvent(pending.txID)
+	commitTimeout := setup.CommitTimeout
+	if commitTimeout == 0 {
+		commitTimeout = defaultCommitTimeout
 	}
 
 	// Wait for the result of the submission
 	select {
-		// Transaction Ok
-		case <-done:
-			return txID, nil
-
-		// Transaction failed
-		case <-fail:
-			return "", fmt.Errorf("Error received from eventhub for txid(%s) error(%v)", txID, fail)
+		case status := <-pending.committed:
+			status.Endorsers = pending.endorsingPeers
+			setup.metrics().ObserveCommit(time.Since(pending.sent), status.ValidationCode.String())
+			// Transaction failed, the error is typed according to the validation code
+			if err := status.err(); err != nil {
+				pending.logger.Errorf("Transaction invalidated in the block %d: %v", status.BlockNumber, err)
+				return status, err
+			}
+			// Transaction Ok
+			pending.logger.Debugf("Transaction committed in the block %d", status.BlockNumber)
+			return status, nil
 
 		// Transaction timeout
-		case <-time.After(time.Second * 30):
-			return "", fmt.Errorf("Didn't receive block event for txid(%s)", txID)
+		case <-time.After(commitTimeout):
+			return nil, &TimeoutError{Operation: "Commit event", TxID: pending.txID, Timeout: commitTimeout}
+	}
+}
+
+// checkEndorsementsAgree makes sure every peer simulated the proposal with the same result
+// (same response payload and same read/write set)
+func checkEndorsementsAgree(responses []*api.TransactionProposalResponse) error {
+	if len(responses) < 2 {
+		return nil
+	}
+	for _, response := range responses[1:] {
+		if !bytes.Equal(responses[0].ProposalResponse.Payload, response.ProposalResponse.Payload) {
+			return &EndorsementMismatchError{Peers: []string{responses[0].Endorser, response.Endorser}}
+		}
 	}
-}
\ No newline at end of file
+	return nil
+}
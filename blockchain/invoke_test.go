@@ -0,0 +1,227 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fabricClient "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// committingOrderer orders every transaction in a block of its own, delivered at once to the setup as if by the event hub
+type committingOrderer struct {
+	setup		*FabricSetup
+	codes		[]pb.TxValidationCode	// Validation code of each transaction in order, valid beyond
+	mutex		sync.Mutex
+	envelopes	[]*common.Envelope
+}
+
+func (o *committingOrderer) GetURL() string { return "orderer.example.com:7050" }
+
+func (o *committingOrderer) SendBroadcast(envelope *api.SignedEnvelope) (*common.Status, error) {
+	transaction := &common.Envelope{Payload: envelope.Payload, Signature: envelope.Signature}
+	data, err := proto.Marshal(transaction)
+	if err != nil {
+		return nil, err
+	}
+	o.mutex.Lock()
+	o.envelopes = append(o.envelopes, transaction)
+	number := uint64(len(o.envelopes))
+	code := pb.TxValidationCode_VALID
+	if int(number) <= len(o.codes) {
+		code = o.codes[number-1]
+	}
+	o.mutex.Unlock()
+
+	metadata := make([][]byte, common.BlockMetadataIndex_TRANSACTIONS_FILTER+1)
+	metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = []byte{byte(code)}
+	o.setup.deliverCommits(&common.Block{
+		Header:		&common.BlockHeader{Number: number},
+		Data:		&common.BlockData{Data: [][]byte{data}},
+		Metadata:	&common.BlockMetadata{Metadata: metadata},
+	})
+	status := common.Status_SUCCESS
+	return &status, nil
+}
+
+func (o *committingOrderer) SendDeliver(envelope *api.SignedEnvelope) (chan *common.Block, chan error) {
+	return make(chan *common.Block), make(chan error)
+}
+
+// ordered returns the transactions ordered so far
+func (o *committingOrderer) ordered() []*common.Envelope {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return append([]*common.Envelope{}, o.envelopes...)
+}
+
+// newInvokeSetup returns an initialized setup whose channel has a peer for each endorser and the orderer,
+// its client signing as the admin of Org1MSP
+func newInvokeSetup(t *testing.T, endorsers ...pb.EndorserServer) (*FabricSetup, *committingOrderer) {
+	client := fabricClient.NewClient(testConfig)
+	client.SetCryptoSuite(bccspFactory.GetDefault())
+	client.SetUserContext(NewMSPUser(testUser(t, client, "admin"), "Org1MSP"))
+	channel, err := client.NewChannel("mychannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := &FabricSetup{
+		Client:			client,
+		Channel:		channel,
+		ChannelId:		"mychannel",
+		ChaincodeId:	"heroes-service",
+		EventHub:		&fakeEventHub{},
+		Logger:			NoopLogger{},
+		Initialized:	true,
+	}
+	for _, endorser := range endorsers {
+		server, address := serveEndorser(t, endorser)
+		t.Cleanup(server.Stop)
+		peer, err := newEndorserPeer(address, setup.newEndorser(address, insecureDial), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := channel.AddPeer(peer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orderer := &committingOrderer{setup: setup}
+	if err := channel.AddOrderer(orderer); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { setup.Close() })
+	return setup, orderer
+}
+
+// creatorOfTransaction returns the creator in the header of the transaction
+func creatorOfTransaction(t testing.TB, envelope *common.Envelope) *msp.SerializedIdentity {
+	payload, err := protosUtils.UnmarshalPayload(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureHeader, err := protosUtils.GetSignatureHeader(payload.Header.SignatureHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(signatureHeader.Creator, creator); err != nil {
+		t.Fatal(err)
+	}
+	return creator
+}
+
+func TestInvokeAsEnrolledUser(t *testing.T) {
+	answered := make(chan struct{})
+	close(answered)
+	setup, orderer := newInvokeSetup(t, &mspEndorser{mspID: "Org1MSP", answer: answered})
+	admin := setup.Client.GetUserContext()
+	// A user of the organisation, as returned by EnrollUser
+	user := NewMSPUser(testUser(t, setup.Client, "user1"), "Org1MSP")
+
+	var status CommitStatus
+	txID, err := setup.InvokeWith(context.Background(), "invoke", []string{"hello", "user1"}, WithUser(user), WithCommitStatus(&status))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.TxID != txID || !status.Valid() || len(status.Endorsers) != 1 {
+		t.Errorf("Got the status %+v of the transaction %s", status, txID)
+	}
+
+	transactions := orderer.ordered()
+	if len(transactions) != 1 {
+		t.Fatalf("%d transactions ordered, want 1", len(transactions))
+	}
+	creator := creatorOfTransaction(t, transactions[0])
+	if creator.Mspid != "Org1MSP" || string(creator.IdBytes) != string(user.GetEnrollmentCertificate()) {
+		t.Errorf("The transaction was created by %s of %s", creator.IdBytes, creator.Mspid)
+	}
+	suite := setup.Client.GetCryptoSuite()
+	digest, _ := suite.Hash(transactions[0].Payload, &bccsp.SHAOpts{})
+	publicKey, _ := user.GetPrivateKey().PublicKey()
+	if valid, err := suite.Verify(publicKey, transactions[0].Signature, digest, nil); !valid {
+		t.Errorf("The transaction isn't signed by the key of the user: %v", err)
+	}
+	if setup.Client.GetUserContext() != admin {
+		t.Error("The user context of the client was changed")
+	}
+}
+
+func TestInvokeWithoutConflictRetries(t *testing.T) {
+	answered := make(chan struct{})
+	close(answered)
+	setup, orderer := newInvokeSetup(t, &mspEndorser{mspID: "Org1MSP", answer: answered})
+	setup.ConflictRetryDelay = time.Millisecond
+	orderer.codes = []pb.TxValidationCode{pb.TxValidationCode_MVCC_READ_CONFLICT}
+	if _, err := setup.InvokeWith(context.Background(), "invoke", []string{"invoke", "hello", "world"}); err != nil {
+		t.Fatal(err)
+	}
+	if transactions := len(orderer.ordered()); transactions != 2 {
+		t.Errorf("%d transactions ordered, want the conflicting one executed again", transactions)
+	}
+
+	orderer.codes = append(orderer.codes, pb.TxValidationCode_VALID, pb.TxValidationCode_MVCC_READ_CONFLICT)
+	_, err := setup.InvokeWith(context.Background(), "invoke", []string{"invoke", "hello", "world"}, WithoutConflictRetries())
+	if KindOf(err) != KindConflict {
+		t.Errorf("Got %v, want the conflict", err)
+	}
+	if transactions := len(orderer.ordered()); transactions != 3 {
+		t.Errorf("%d transactions ordered, want the conflicting one not executed again", transactions)
+	}
+}
+
+func TestInvokeHelloWithEndorsers(t *testing.T) {
+	answered := make(chan struct{})
+	close(answered)
+	endorser := &recordingEndorser{EndorserServer: &mspEndorser{mspID: "Org1MSP", answer: answered}}
+	setup, orderer := newInvokeSetup(t, endorser)
+
+	txID, endorsers, err := setup.InvokeHelloWithEndorsers("world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orderer.ordered()) != 1 || len(endorsers) != 1 || endorsers[0] != setup.Channel.GetPeers()[0].URL() {
+		t.Errorf("The transaction %s was endorsed by %v", txID, endorsers)
+	}
+	if len(endorser.proposals) != 1 {
+		t.Fatalf("%d proposals endorsed, want 1", len(endorser.proposals))
+	}
+	proposal, err := protosUtils.GetProposal(endorser.proposals[0].ProposalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := protosUtils.GetChaincodeProposalPayload(proposal.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload.TransientMap["result"]) != "Transient data in hello invoke" {
+		t.Errorf("Got the transient map %v", payload.TransientMap)
+	}
+}
+
+func TestCheckEndorsementsAgree(t *testing.T) {
+	response := func(peer string, payload string) *api.TransactionProposalResponse {
+		return &api.TransactionProposalResponse{Endorser: peer, ProposalResponse: &pb.ProposalResponse{Payload: []byte(payload)}}
+	}
+	if err := checkEndorsementsAgree(nil); err != nil {
+		t.Errorf("No endorsement: %v", err)
+	}
+	if err := checkEndorsementsAgree([]*api.TransactionProposalResponse{response("peer0", "a")}); err != nil {
+		t.Errorf("A single endorsement: %v", err)
+	}
+	if err := checkEndorsementsAgree([]*api.TransactionProposalResponse{response("peer0", "a"), response("peer1", "a")}); err != nil {
+		t.Errorf("The same endorsements: %v", err)
+	}
+	var mismatch *EndorsementMismatchError
+	if err := checkEndorsementsAgree([]*api.TransactionProposalResponse{response("peer0", "a"), response("peer1", "b")}); !errors.As(err, &mismatch) {
+		t.Errorf("Different endorsements: %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// ChainInfo is the state of the ledger of the channel
+type ChainInfo struct {
+	Height				uint64
+	CurrentBlockHash	[]byte
+	PreviousBlockHash	[]byte
+}
+
+// Block is a block of the ledger with its transactions decoded
+type Block struct {
+	Number			uint64			`json:"number"`
+	Hash			[]byte			`json:"hash"`	// Hash of the header, the PreviousHash of the next block
+	PreviousHash	[]byte			`json:"previousHash"`
+	DataHash		[]byte			`json:"dataHash"`
+	Transactions	[]Transaction	`json:"transactions"`
+}
+
+// Transaction is a transaction of the ledger decoded from its envelope
+type Transaction struct {
+	TxID			string		`json:"txId"`
+	ChannelID		string		`json:"channelId"`
+	Type			string		`json:"type"`				// ENDORSER_TRANSACTION, CONFIG...
+	Timestamp		time.Time	`json:"timestamp"`			// Set by the client creating the transaction
+	CreatorMSPID	string		`json:"creatorMspId"`
+	ValidationCode	string		`json:"validationCode"`	// VALID, MVCC_READ_CONFLICT...
+	ChaincodeID		string		`json:"chaincodeId,omitempty"`	// For an endorser transaction, like its read/write set
+	Reads			[]KeyRead	`json:"reads,omitempty"`
+	Writes			[]KeyWrite	`json:"writes,omitempty"`
+}
+
+// QueryInfo returns the height of the ledger and the hashes of its last blocks, as known by the primary peer
+func (setup *FabricSetup) QueryInfo() (*common.BlockchainInfo, error) {
+	if err := setup.checkPeers(); err != nil {
+		return nil, err
+	}
+	info, err := setup.Channel.QueryInfo()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the channel info: %v", err)
+	}
+	return info, nil
+}
+
+// QueryChainInfo is like QueryInfo, with the information in a ChainInfo
+func (setup *FabricSetup) QueryChainInfo() (*ChainInfo, error) {
+	info, err := setup.QueryInfo()
+	if err != nil {
+		return nil, err
+	}
+	return &ChainInfo{
+		Height:				info.Height,
+		CurrentBlockHash:	info.CurrentBlockHash,
+		PreviousBlockHash:	info.PreviousBlockHash,
+	}, nil
+}
+
+// QueryBlockByNumber returns the block of the ledger with the given number
+func (setup *FabricSetup) QueryBlockByNumber(number uint64) (*Block, error) {
+	if err := setup.checkPeers(); err != nil {
+		return nil, err
+	}
+	block, err := setup.Channel.QueryBlock(int(number))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the block %d: %v", number, err)
+	}
+	return decodeBlock(block)
+}
+
+// QueryBlockByHash returns the block of the ledger with the given header hash
+func (setup *FabricSetup) QueryBlockByHash(hash []byte) (*Block, error) {
+	if err := setup.checkPeers(); err != nil {
+		return nil, err
+	}
+	block, err := setup.Channel.QueryBlockByHash(hash)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the block %x: %v", hash, err)
+	}
+	return decodeBlock(block)
+}
+
+// QueryTransaction returns the transaction with the given ID, with its validation code
+func (setup *FabricSetup) QueryTransaction(txID string) (*Transaction, error) {
+	if err := setup.checkPeers(); err != nil {
+		return nil, err
+	}
+	processed, err := setup.Channel.QueryTransaction(txID)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query the transaction %s: %v", txID, err)
+	}
+	transaction, err := decodeTransaction(processed.TransactionEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	transaction.ValidationCode = pb.TxValidationCode(processed.ValidationCode).String()
+	return transaction, nil
+}
+
+// ExportLedger writes the blocks of the given range (inclusive) to w, decoded like QueryBlockByNumber, one JSON object
+// per line. The blocks are fetched one at a time, so a large range is streamed; on error, the blocks before are written.
+func (setup *FabricSetup) ExportLedger(w io.Writer, fromBlock, toBlock uint64) error {
+	if fromBlock > toBlock {
+		return fmt.Errorf("Invalid block range: %d > %d", fromBlock, toBlock)
+	}
+	if err := setup.checkPeers(); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for number := fromBlock; number <= toBlock; number++ {
+		block, err := setup.QueryBlockByNumber(number)
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(block); err != nil {
+			return fmt.Errorf("Unable to write the block %d: %v", number, err)
+		}
+		// number would overflow when toBlock is the largest uint64
+		if number == toBlock {
+			break
+		}
+	}
+	return nil
+}
+
+// decodeBlock decodes the transactions of the block, with their validation code read from the block metadata
+func decodeBlock(block *common.Block) (*Block, error) {
+	if block.Header == nil || block.Data == nil {
+		return nil, fmt.Errorf("The block has no header or no data")
+	}
+	decoded := &Block{
+		Number:			block.Header.Number,
+		Hash:			block.Header.Hash(),
+		PreviousHash:	block.Header.PreviousHash,
+		DataHash:		block.Header.DataHash,
+	}
+
+	// The validation codes are set by the committing peer, one byte per transaction
+	var validationCodes []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		validationCodes = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+	for i, data := range block.Data.Data {
+		envelope, err := protosUtils.GetEnvelopeFromBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to extract the transaction %d of the block %d: %v", i, block.Header.Number, err)
+		}
+		transaction, err := decodeTransaction(envelope)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode the transaction %d of the block %d: %v", i, block.Header.Number, err)
+		}
+		if i < len(validationCodes) {
+			transaction.ValidationCode = pb.TxValidationCode(validationCodes[i]).String()
+		}
+		decoded.Transactions = append(decoded.Transactions, *transaction)
+	}
+	return decoded, nil
+}
+
+// decodeTransaction decodes the headers of the transaction and, for an endorser transaction,
+// the read/write set of its first action
+func decodeTransaction(envelope *common.Envelope) (*Transaction, error) {
+	payload, err := protosUtils.ExtractPayload(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Header == nil {
+		return nil, fmt.Errorf("The transaction has no header")
+	}
+	channelHeader, err := protosUtils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, err
+	}
+	transaction := &Transaction{
+		TxID:		channelHeader.TxId,
+		ChannelID:	channelHeader.ChannelId,
+		Type:		common.HeaderType(channelHeader.Type).String(),
+	}
+	if timestamp := channelHeader.Timestamp; timestamp != nil {
+		transaction.Timestamp = time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC()
+	}
+	signatureHeader, err := protosUtils.GetSignatureHeader(payload.Header.SignatureHeader)
+	if err != nil {
+		return nil, err
+	}
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(signatureHeader.Creator, creator); err == nil {
+		transaction.CreatorMSPID = creator.Mspid
+	}
+
+	if common.HeaderType(channelHeader.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return transaction, nil
+	}
+	tx, err := protosUtils.GetTransaction(payload.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(tx.Actions) == 0 {
+		return transaction, nil
+	}
+	_, action, err := protosUtils.GetPayloads(tx.Actions[0])
+	if err != nil {
+		return nil, err
+	}
+	if action.ChaincodeId != nil {
+		transaction.ChaincodeID = action.ChaincodeId.Name
+	}
+	transaction.Reads, transaction.Writes, err = parseResults(action.Results)
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// checkPeers fails when the channel has no peer to query
+func (setup *FabricSetup) checkPeers() error {
+	if setup.Channel == nil || len(setup.Channel.GetPeers()) == 0 {
+		return fmt.Errorf("No peer configured in the channel (%s)", setup.ChannelId)
+	}
+	return nil
+}
+
+// VerifyBlockChain fetches the blocks from the given range (inclusive) and checks the hash chain is intact:
+// the previous hash of each block must match the computed hash of its predecessor header.
+// The returned error identifies the first broken link.
+func (setup *FabricSetup) VerifyBlockChain(from, to uint64) error {
+	if from > to {
+		return fmt.Errorf("Invalid block range: %d > %d", from, to)
+	}
+
+	previous, err := setup.Channel.QueryBlock(int(from))
+	if err != nil {
+		return fmt.Errorf("Unable to query the block %d: %v", from, err)
+	}
+
+	for number := from + 1; number <= to; number++ {
+		block, err := setup.Channel.QueryBlock(int(number))
+		if err != nil {
+			return fmt.Errorf("Unable to query the block %d: %v", number, err)
+		}
+		if block.Header == nil || previous.Header == nil {
+			return fmt.Errorf("Missing header in the block %d or %d", number-1, number)
+		}
+		if block.Header.Number != number {
+			return fmt.Errorf("Block %d returned when querying the block %d", block.Header.Number, number)
+		}
+
+		// The header of each block contains the hash of the previous header
+		if !bytes.Equal(block.Header.PreviousHash, previous.Header.Hash()) {
+			return fmt.Errorf("Broken hash chain between the blocks %d and %d: previous hash %x, expected %x",
+				number-1, number, block.Header.PreviousHash, previous.Header.Hash())
+		}
+		previous = block
+	}
+
+	return nil
+}
@@ -0,0 +1,500 @@
+package blockchain
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/common/crypto"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ChaincodeLifecycle is the way the chaincode is deployed
+type ChaincodeLifecycle string
+
+const (
+	LifecycleLegacy	ChaincodeLifecycle = ""		// Install and instantiate with lscc (Fabric 1.x)
+	LifecycleV2		ChaincodeLifecycle = "v2"	// Install, approve and commit a definition with _lifecycle (Fabric 2.x), experimental
+)
+
+// The v2 lifecycle is experimental: the SDK and the vendored protos are the ones of Fabric 1.0, the messages of
+// _lifecycle are declared below and the peers of Fabric 2.x may refuse them in a later version.
+
+// Name of the lifecycle system chaincode of Fabric 2.x
+const lifecycleChaincode = "_lifecycle"
+
+
+// lifecycleLabel returns the label of the package of the chaincode of the target
+func lifecycleLabel(target channelTarget) string {
+	return target.chaincodeID + "_" + target.chaincodeVersion
+}
+
+// installPackageOn installs the chaincode of the target channel on the peers of the organisation with _lifecycle.
+// The package holds the code package of the legacy install and its metadata, like "peer lifecycle chaincode package".
+func (setup *FabricSetup) installPackageOn(target channelTarget) error {
+	label := lifecycleLabel(target)
+	setup.targetLogger(target).Printf("Chaincode %s (label %s) will be installed with the v2 lifecycle, which is experimental", target.chaincodeID, label)
+
+	span := setup.startSpan("Install")
+	chaincodePackage, err := setup.lifecyclePackage(target, label)
+	var responses []*api.TransactionProposalResponse
+	if err == nil {
+		err = setup.retry(target.callContext(), "Install", func() (err error) {
+			_, responses, err = setup.lifecycleProposal(target, "", "InstallChaincode", &installChaincodeArgs{ChaincodeInstallPackage: chaincodePackage}, setup.ownPeers(target.channel))
+			return err
+		})
+	}
+	endSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("Send install proposal return error: %v", err)
+	}
+
+	result := &installChaincodeResult{}
+	if err := proto.Unmarshal(responses[0].ProposalResponse.GetResponse().Payload, result); err != nil {
+		return fmt.Errorf("Unable to unmarshal the install result: %v", err)
+	}
+	setup.targetLogger(target).Printf("Chaincode %s installed (package %s)", target.chaincodeID, result.PackageID)
+	return nil
+}
+
+// lifecyclePackage builds the .tar.gz package of the chaincode installed with _lifecycle
+// With ChaincodeAddress, the code package only holds the connection.json of the chaincode server.
+func (setup *FabricSetup) lifecyclePackage(target channelTarget, label string) ([]byte, error) {
+	if setup.ChaincodeAddress != "" {
+		connection, err := json.Marshal(map[string]interface{}{"address": setup.ChaincodeAddress, "dial_timeout": "10s", "tls_required": false})
+		if err != nil {
+			return nil, err
+		}
+		codePackage, err := tarGzip(map[string][]byte{"connection.json": connection})
+		if err != nil {
+			return nil, err
+		}
+		metadata, err := json.Marshal(map[string]string{"type": "ccaas", "label": label})
+		if err != nil {
+			return nil, err
+		}
+		return tarGzip(map[string][]byte{"metadata.json": metadata, "code.tar.gz": codePackage})
+	}
+
+	codePackage, err := packageChaincode(setup.targetLogger(target), setup.ChaincodeLang, setup.ChaincodeGoPath, target.chaincodePath, setup.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	lang := setup.ChaincodeLang
+	if lang == "" {
+		lang = LangGolang
+	}
+	metadata, err := json.Marshal(map[string]string{"path": target.chaincodePath, "type": string(lang), "label": label})
+	if err != nil {
+		return nil, err
+	}
+	return tarGzip(map[string][]byte{"metadata.json": metadata, "code.tar.gz": codePackage})
+}
+
+// tarGzip returns the .tar.gz archive of the files, by name, in a deterministic order
+func tarGzip(files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Size: int64(len(files[name])), Mode: 0644, ModTime: time.Time{}}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tarWriter.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+// installedPackageOn returns the ID of the package of the chaincode of the target installed on every peer
+// of the organisation, empty when a peer hasn't it
+func (setup *FabricSetup) installedPackageOn(target channelTarget) (string, error) {
+	label := lifecycleLabel(target)
+	packageID := ""
+	for _, peer := range setup.ownPeers(target.channel) {
+		_, responses, err := setup.lifecycleProposal(target, "", "QueryInstalledChaincodes", &queryInstalledChaincodesArgs{}, []api.Peer{peer})
+		if err != nil {
+			return "", fmt.Errorf("Unable to query the chaincodes installed on the peer %s: %v", peer.URL(), err)
+		}
+		result := &queryInstalledChaincodesResult{}
+		if err := proto.Unmarshal(responses[0].ProposalResponse.GetResponse().Payload, result); err != nil {
+			return "", fmt.Errorf("Unable to unmarshal the chaincodes installed on the peer %s: %v", peer.URL(), err)
+		}
+		found := ""
+		for _, installed := range result.InstalledChaincodes {
+			if installed.Label == label {
+				found = installed.PackageID
+			}
+		}
+		if found == "" {
+			return "", nil
+		}
+		packageID = found
+	}
+	return packageID, nil
+}
+
+// committedDefinitionOn returns the definition of the chaincode committed on the target channel, nil when there is none
+func (setup *FabricSetup) committedDefinitionOn(target channelTarget) (*queryChaincodeDefinitionResult, error) {
+	_, responses, err := setup.lifecycleProposal(target, target.channelID, "QueryChaincodeDefinition", &queryChaincodeDefinitionArgs{Name: target.chaincodeID}, setup.ownPeers(target.channel))
+	if err != nil {
+		if strings.Contains(err.Error(), "is not defined") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Unable to query the definition of the chaincode on the channel (%s): %v", target.channelID, err)
+	}
+	definition := &queryChaincodeDefinitionResult{}
+	if err := proto.Unmarshal(responses[0].ProposalResponse.GetResponse().Payload, definition); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the definition of the chaincode: %v", err)
+	}
+	return definition, nil
+}
+
+// defineOn deploys the installed chaincode of the target channel with the v2 lifecycle: the definition of its
+// current version (at the next sequence) is approved for the organisation, committed once approved by enough
+// organisations, then the Init function of the chaincode is called with the arguments.
+// The other organisations approve the definition with their own admins, an error lists the missing approvals.
+func (setup *FabricSetup) defineOn(target channelTarget, args []string, policy []byte) error {
+	logger := setup.targetLogger(target)
+	packageID, err := setup.installedPackageOn(target)
+	if err != nil {
+		return err
+	}
+	if packageID == "" {
+		return fmt.Errorf("The chaincode %s (label %s) is not installed", target.chaincodeID, lifecycleLabel(target))
+	}
+	committed, err := setup.committedDefinitionOn(target)
+	if err != nil {
+		return err
+	}
+	collections, err := setup.collections()
+	if err != nil {
+		return err
+	}
+	collectionsConfig, err := collectionsPackage(collections)
+	if err != nil {
+		return err
+	}
+	validationParameter, err := proto.Marshal(&applicationPolicy{SignaturePolicy: policy})
+	if err != nil {
+		return fmt.Errorf("Unable to marshal the endorsement policy: %v", err)
+	}
+	definition := &chaincodeDefinitionArgs{
+		Sequence:				1,
+		Name:					target.chaincodeID,
+		Version:				target.chaincodeVersion,
+		EndorsementPlugin:		"escc",
+		ValidationPlugin:		"vscc",
+		ValidationParameter:	validationParameter,
+		Collections:			collectionsConfig,
+		InitRequired:			true,
+	}
+	if committed != nil {
+		definition.Sequence = committed.Sequence + 1
+	}
+
+	// The approval is skipped when done, e.g. by a previous run waiting for the other organisations
+	readiness, err := setup.commitReadiness(target, definition)
+	if err != nil {
+		return err
+	}
+	mspID := setup.Client.GetConfig().GetFabricCAID()
+	if !readiness.Approvals[mspID] {
+		approval := *definition
+		approval.Source = &chaincodeSource{LocalPackage: &chaincodeSourceLocal{PackageID: packageID}}
+		if err := setup.lifecycleTransaction(target, "ApproveChaincodeDefinitionForMyOrg", &approval, setup.ownPeers(target.channel)); err != nil {
+			return err
+		}
+		logger.Printf("Definition of the chaincode %s approved for %s (version %s, sequence %d)", target.chaincodeID, mspID, definition.Version, definition.Sequence)
+		if readiness, err = setup.commitReadiness(target, definition); err != nil {
+			return err
+		}
+	}
+	var missing []string
+	for organization, approved := range readiness.Approvals {
+		if !approved {
+			missing = append(missing, organization)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("The definition of the chaincode %s (sequence %d) is not approved yet by %s", target.chaincodeID, definition.Sequence, strings.Join(missing, ", "))
+	}
+
+	if err := setup.lifecycleTransaction(target, "CommitChaincodeDefinition", definition, target.channel.GetPeers()); err != nil {
+		return err
+	}
+	logger.Printf("Definition of the chaincode %s committed on %s (version %s, sequence %d)", target.chaincodeID, target.channelID, definition.Version, definition.Sequence)
+	return setup.initOn(target, args)
+}
+
+// commitReadiness returns the organisations of the channel and whether each one approved the definition
+func (setup *FabricSetup) commitReadiness(target channelTarget, definition *chaincodeDefinitionArgs) (*checkCommitReadinessResult, error) {
+	_, responses, err := setup.lifecycleProposal(target, target.channelID, "CheckCommitReadiness", definition, setup.ownPeers(target.channel))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to check the commit readiness of the chaincode %s: %v", target.chaincodeID, err)
+	}
+	readiness := &checkCommitReadinessResult{}
+	if err := proto.Unmarshal(responses[0].ProposalResponse.GetResponse().Payload, readiness); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the commit readiness: %v", err)
+	}
+	return readiness, nil
+}
+
+// lifecycleTransaction calls the function of _lifecycle on the target channel, endorsed by the peers,
+// and waits for the transaction to be committed
+func (setup *FabricSetup) lifecycleTransaction(target channelTarget, function string, args proto.Message, peers []api.Peer) error {
+	var proposal *api.TransactionProposal
+	var responses []*api.TransactionProposalResponse
+	err := setup.retry(target.callContext(), "The "+function+" proposal", func() (err error) {
+		proposal, responses, err = setup.lifecycleProposal(target, target.channelID, function, args, peers)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return setup.commitDeploy(target, function, proposal.TransactionID, responses)
+}
+
+// lifecycleProposal sends the proposal calling the function of _lifecycle with the marshalled arguments
+// to the peers, on the channel (none for the functions of the peer like the install), and checks they accepted it
+func (setup *FabricSetup) lifecycleProposal(target channelTarget, channelID string, function string, args proto.Message, peers []api.Peer) (*api.TransactionProposal, []*api.TransactionProposalResponse, error) {
+	if len(peers) == 0 {
+		return nil, nil, fmt.Errorf("No peer to send the %s proposal to", function)
+	}
+	argsBytes, err := proto.Marshal(args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to marshal the arguments of %s: %v", function, err)
+	}
+	lifecycleTarget := channelTarget{channelID: channelID, channel: target.channel, chaincodeID: lifecycleChaincode}
+	proposal, err := setup.deployProposal(lifecycleTarget, []string{function, string(argsBytes)}, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	responses, err := target.channel.SendTransactionProposal(proposal, 0, peers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkDeployResponses(function, responses); err != nil {
+		return nil, nil, err
+	}
+	return proposal, responses, nil
+}
+
+// initOn calls the Init function of the chaincode of the target channel, required by the definitions
+// committed by defineOn before any other transaction
+func (setup *FabricSetup) initOn(target channelTarget, args []string) error {
+	span := setup.startSpan("Init")
+	var proposal *api.TransactionProposal
+	var responses []*api.TransactionProposalResponse
+	err := setup.retry(target.callContext(), "The init proposal", func() (err error) {
+		if proposal, err = setup.deployProposal(target, args, true); err != nil {
+			return err
+		}
+		responses, err = target.channel.SendTransactionProposal(proposal, 0, setup.endorsementTargets(target.channel))
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Send init proposal return error: %v", err)
+	} else if err = checkDeployResponses("init", responses); err == nil {
+		err = setup.commitDeploy(target, "init", proposal.TransactionID, responses)
+	}
+	endSpan(span, err)
+	return err
+}
+
+// deployProposal creates and signs, with the user context, the proposal calling the chaincode of the target,
+// flagged as the call of its Init function when isInit
+func (setup *FabricSetup) deployProposal(target channelTarget, args []string, isInit bool) (*api.TransactionProposal, error) {
+	nonce, err := crypto.GetRandomNonce()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to generate a nonce: %v", err)
+	}
+	creator, err := setup.Client.GetIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the identity of the creator: %v", err)
+	}
+	txID, proposal, err := chaincodeProposal(target, args, nil, nonce, creator)
+	if err != nil {
+		return nil, err
+	}
+	if isInit {
+		if proposal.Payload, err = withIsInit(proposal.Payload); err != nil {
+			return nil, err
+		}
+	}
+	signedProposal, err := setup.signProposal(proposal)
+	if err != nil {
+		return nil, err
+	}
+	return &api.TransactionProposal{
+		TransactionID:	txID,
+		SignedProposal:	signedProposal,
+		Proposal:		proposal,
+	}, nil
+}
+
+// withIsInit flags the invocation spec of the proposal payload as the call of the Init function.
+// The ChaincodeInput of Fabric 2.x has an is_init field, not in the vendored protos: the invocation spec
+// holding only this field is appended to the one of the payload, the peer merges them.
+func withIsInit(proposalPayload []byte) ([]byte, error) {
+	payload := &pb.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(proposalPayload, payload); err != nil {
+		return nil, err
+	}
+	isInitSpec, err := proto.Marshal(&initInvocationSpec{ChaincodeSpec: &initChaincodeSpec{Input: &initChaincodeInput{IsInit: true}}})
+	if err != nil {
+		return nil, err
+	}
+	payload.Input = append(payload.Input, isInitSpec...)
+	return proto.Marshal(payload)
+}
+
+// The fields of ChaincodeInvocationSpec, ChaincodeSpec and ChaincodeInput (peer/chaincode.proto of Fabric 2.x)
+// leading to is_init
+
+type initInvocationSpec struct {
+	ChaincodeSpec	*initChaincodeSpec	`protobuf:"bytes,1,opt,name=chaincode_spec,json=chaincodeSpec"`
+}
+
+func (m *initInvocationSpec) Reset()			{ *m = initInvocationSpec{} }
+func (m *initInvocationSpec) String() string	{ return proto.CompactTextString(m) }
+func (*initInvocationSpec) ProtoMessage()		{}
+
+type initChaincodeSpec struct {
+	Input	*initChaincodeInput	`protobuf:"bytes,3,opt,name=input"`
+}
+
+func (m *initChaincodeSpec) Reset()			{ *m = initChaincodeSpec{} }
+func (m *initChaincodeSpec) String() string	{ return proto.CompactTextString(m) }
+func (*initChaincodeSpec) ProtoMessage()		{}
+
+type initChaincodeInput struct {
+	IsInit	bool	`protobuf:"varint,3,opt,name=is_init,json=isInit"`
+}
+
+func (m *initChaincodeInput) Reset()			{ *m = initChaincodeInput{} }
+func (m *initChaincodeInput) String() string	{ return proto.CompactTextString(m) }
+func (*initChaincodeInput) ProtoMessage()		{}
+
+// The messages of _lifecycle (peer/lifecycle/lifecycle.proto of Fabric 2.x), not in the vendored protos.
+// Like for the collections, a oneof with a single field set is encoded as this field, and a message
+// already marshalled is kept as bytes.
+
+type installChaincodeArgs struct {
+	ChaincodeInstallPackage	[]byte	`protobuf:"bytes,1,opt,name=chaincode_install_package,json=chaincodeInstallPackage"`
+}
+
+func (m *installChaincodeArgs) Reset()			{ *m = installChaincodeArgs{} }
+func (m *installChaincodeArgs) String() string	{ return proto.CompactTextString(m) }
+func (*installChaincodeArgs) ProtoMessage()		{}
+
+type installChaincodeResult struct {
+	PackageID	string	`protobuf:"bytes,1,opt,name=package_id,json=packageId"`
+	Label		string	`protobuf:"bytes,2,opt,name=label"`
+}
+
+func (m *installChaincodeResult) Reset()			{ *m = installChaincodeResult{} }
+func (m *installChaincodeResult) String() string	{ return proto.CompactTextString(m) }
+func (*installChaincodeResult) ProtoMessage()		{}
+
+type queryInstalledChaincodesArgs struct{}
+
+func (m *queryInstalledChaincodesArgs) Reset()			{ *m = queryInstalledChaincodesArgs{} }
+func (m *queryInstalledChaincodesArgs) String() string	{ return proto.CompactTextString(m) }
+func (*queryInstalledChaincodesArgs) ProtoMessage()		{}
+
+type queryInstalledChaincodesResult struct {
+	InstalledChaincodes	[]*installChaincodeResult	`protobuf:"bytes,1,rep,name=installed_chaincodes,json=installedChaincodes"`
+}
+
+func (m *queryInstalledChaincodesResult) Reset()			{ *m = queryInstalledChaincodesResult{} }
+func (m *queryInstalledChaincodesResult) String() string	{ return proto.CompactTextString(m) }
+func (*queryInstalledChaincodesResult) ProtoMessage()		{}
+
+// chaincodeDefinitionArgs are the arguments of ApproveChaincodeDefinitionForMyOrg, CheckCommitReadiness and
+// CommitChaincodeDefinition, only the approval has a source
+type chaincodeDefinitionArgs struct {
+	Sequence			int64				`protobuf:"varint,1,opt,name=sequence"`
+	Name				string				`protobuf:"bytes,2,opt,name=name"`
+	Version				string				`protobuf:"bytes,3,opt,name=version"`
+	EndorsementPlugin	string				`protobuf:"bytes,4,opt,name=endorsement_plugin,json=endorsementPlugin"`
+	ValidationPlugin	string				`protobuf:"bytes,5,opt,name=validation_plugin,json=validationPlugin"`
+	ValidationParameter	[]byte				`protobuf:"bytes,6,opt,name=validation_parameter,json=validationParameter"`
+	Collections			[]byte				`protobuf:"bytes,7,opt,name=collections"`	// A marshalled collectionConfigPackage
+	InitRequired		bool				`protobuf:"varint,8,opt,name=init_required,json=initRequired"`
+	Source				*chaincodeSource	`protobuf:"bytes,9,opt,name=source"`
+}
+
+func (m *chaincodeDefinitionArgs) Reset()			{ *m = chaincodeDefinitionArgs{} }
+func (m *chaincodeDefinitionArgs) String() string	{ return proto.CompactTextString(m) }
+func (*chaincodeDefinitionArgs) ProtoMessage()		{}
+
+type chaincodeSource struct {
+	LocalPackage	*chaincodeSourceLocal	`protobuf:"bytes,2,opt,name=local_package,json=localPackage"`
+}
+
+func (m *chaincodeSource) Reset()			{ *m = chaincodeSource{} }
+func (m *chaincodeSource) String() string	{ return proto.CompactTextString(m) }
+func (*chaincodeSource) ProtoMessage()		{}
+
+type chaincodeSourceLocal struct {
+	PackageID	string	`protobuf:"bytes,1,opt,name=package_id,json=packageId"`
+}
+
+func (m *chaincodeSourceLocal) Reset()			{ *m = chaincodeSourceLocal{} }
+func (m *chaincodeSourceLocal) String() string	{ return proto.CompactTextString(m) }
+func (*chaincodeSourceLocal) ProtoMessage()		{}
+
+// applicationPolicy is the validation parameter of the definition, here a marshalled signature policy envelope
+type applicationPolicy struct {
+	SignaturePolicy	[]byte	`protobuf:"bytes,1,opt,name=signature_policy,json=signaturePolicy"`
+}
+
+func (m *applicationPolicy) Reset()			{ *m = applicationPolicy{} }
+func (m *applicationPolicy) String() string	{ return proto.CompactTextString(m) }
+func (*applicationPolicy) ProtoMessage()		{}
+
+type checkCommitReadinessResult struct {
+	Approvals	map[string]bool	`protobuf:"bytes,1,rep,name=approvals" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+}
+
+func (m *checkCommitReadinessResult) Reset()			{ *m = checkCommitReadinessResult{} }
+func (m *checkCommitReadinessResult) String() string	{ return proto.CompactTextString(m) }
+func (*checkCommitReadinessResult) ProtoMessage()		{}
+
+type queryChaincodeDefinitionArgs struct {
+	Name	string	`protobuf:"bytes,1,opt,name=name"`
+}
+
+func (m *queryChaincodeDefinitionArgs) Reset()			{ *m = queryChaincodeDefinitionArgs{} }
+func (m *queryChaincodeDefinitionArgs) String() string	{ return proto.CompactTextString(m) }
+func (*queryChaincodeDefinitionArgs) ProtoMessage()		{}
+
+type queryChaincodeDefinitionResult struct {
+	Sequence	int64	`protobuf:"varint,1,opt,name=sequence"`
+	Version		string	`protobuf:"bytes,2,opt,name=version"`
+}
+
+func (m *queryChaincodeDefinitionResult) Reset()			{ *m = queryChaincodeDefinitionResult{} }
+func (m *queryChaincodeDefinitionResult) String() string	{ return proto.CompactTextString(m) }
+func (*queryChaincodeDefinitionResult) ProtoMessage()		{}
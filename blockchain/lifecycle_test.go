@@ -0,0 +1,54 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestWithIsInit(t *testing.T) {
+	spec, err := proto.Marshal(&pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{
+		Type:			pb.ChaincodeSpec_GOLANG,
+		ChaincodeId:	&pb.ChaincodeID{Name: "heroes-service"},
+		Input:			&pb.ChaincodeInput{Args: [][]byte{[]byte("init")}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := proto.Marshal(&pb.ChaincodeProposalPayload{Input: spec})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flagged, err := withIsInit(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &pb.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(flagged, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	// chaincode_spec (1) { input (3) { is_init (3): true } }, like the ChaincodeInput of Fabric 2.x
+	if !bytes.Equal(decoded.Input, append(spec, 0x0a, 0x04, 0x1a, 0x02, 0x18, 0x01)) {
+		t.Errorf("Input %x, want the spec followed by is_init", decoded.Input)
+	}
+
+	// The peer merges both specs, the spec of the proposal is kept
+	invocation := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(decoded.Input, invocation); err != nil {
+		t.Fatal(err)
+	}
+	chaincodeSpec := invocation.ChaincodeSpec
+	if chaincodeSpec.ChaincodeId.Name != "heroes-service" || len(chaincodeSpec.Input.Args) != 1 || string(chaincodeSpec.Input.Args[0]) != "init" {
+		t.Errorf("The spec of the proposal changed: %v", chaincodeSpec)
+	}
+	init := &initInvocationSpec{}
+	if err := proto.Unmarshal(decoded.Input, init); err != nil {
+		t.Fatal(err)
+	}
+	if init.ChaincodeSpec == nil || init.ChaincodeSpec.Input == nil || !init.ChaincodeSpec.Input.IsInit {
+		t.Errorf("is_init isn't set: %v", init)
+	}
+}
@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Logger receives the messages of the setup. It is kept minimal so a structured logger
+// can be plugged with a small adapter.
+type Logger interface {
+	Printf(format string, args ...interface{})
+	Debugf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Fields attached to the messages, to correlate them
+const (
+	FieldChannel	= "channel"
+	FieldChaincode	= "chaincode"
+	FieldTxID		= "txID"
+	FieldPeer		= "peer"
+	FieldOrderer	= "orderer"
+)
+
+// Fields are the key/value pairs attached to a message
+type Fields map[string]interface{}
+
+// String formats the fields as " key=value", sorted by key
+func (fields Fields) String() string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var builder strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&builder, " %s=%v", key, fields[key])
+	}
+	return builder.String()
+}
+
+// with returns the fields merged with the other ones, which take precedence
+func (fields Fields) with(other Fields) Fields {
+	merged := make(Fields, len(fields)+len(other))
+	for key, value := range fields {
+		merged[key] = value
+	}
+	for key, value := range other {
+		merged[key] = value
+	}
+	return merged
+}
+
+// FieldLogger is a Logger attaching fields to its messages, e.g. the adapter of a structured logger.
+// The fields given to a Logger not implementing it are appended to the messages.
+type FieldLogger interface {
+	Logger
+	WithFields(fields Fields) Logger
+}
+
+// StdLogger writes the messages with the standard log package, followed by their fields.
+// Debug messages are dropped unless Debug is set.
+type StdLogger struct {
+	Debug	bool
+	fields	Fields
+}
+
+func (l StdLogger) Printf(format string, args ...interface{}) {
+	log.Print(fmt.Sprintf(format, args...) + l.fields.String())
+}
+
+func (l StdLogger) Debugf(format string, args ...interface{}) {
+	if l.Debug {
+		log.Print("DEBUG " + fmt.Sprintf(format, args...) + l.fields.String())
+	}
+}
+
+func (l StdLogger) Errorf(format string, args ...interface{}) {
+	log.Print("ERROR " + fmt.Sprintf(format, args...) + l.fields.String())
+}
+
+func (l StdLogger) WithFields(fields Fields) Logger {
+	return StdLogger{Debug: l.Debug, fields: l.fields.with(fields)}
+}
+
+// NoopLogger drops every message, for a quiet operation
+type NoopLogger struct{}
+
+func (NoopLogger) Printf(format string, args ...interface{}) {}
+func (NoopLogger) Debugf(format string, args ...interface{}) {}
+func (NoopLogger) Errorf(format string, args ...interface{}) {}
+func (l NoopLogger) WithFields(fields Fields) Logger { return l }
+
+// fieldsLogger appends its fields to the messages of a Logger not implementing FieldLogger
+type fieldsLogger struct {
+	logger	Logger
+	fields	Fields
+}
+
+func (l fieldsLogger) Printf(format string, args ...interface{}) {
+	l.logger.Printf("%s%s", fmt.Sprintf(format, args...), l.fields)
+}
+
+func (l fieldsLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf("%s%s", fmt.Sprintf(format, args...), l.fields)
+}
+
+func (l fieldsLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf("%s%s", fmt.Sprintf(format, args...), l.fields)
+}
+
+func (l fieldsLogger) WithFields(fields Fields) Logger {
+	return fieldsLogger{logger: l.logger, fields: l.fields.with(fields)}
+}
+
+// WithFields returns the logger attaching the fields to its messages
+func WithFields(logger Logger, fields Fields) Logger {
+	if fieldLogger, ok := logger.(FieldLogger); ok {
+		return fieldLogger.WithFields(fields)
+	}
+	return fieldsLogger{logger: logger, fields: fields}
+}
+
+// logger returns the logger of the setup, a StdLogger when not set
+func (setup *FabricSetup) logger() Logger {
+	if setup.Logger == nil {
+		return StdLogger{}
+	}
+	return setup.Logger
+}
+
+// targetLogger returns the logger of the setup with the channel and the chaincode of the target
+func (setup *FabricSetup) targetLogger(target channelTarget) Logger {
+	return WithFields(setup.logger(), Fields{FieldChannel: target.channelID, FieldChaincode: target.chaincodeID})
+}
@@ -0,0 +1,40 @@
+package blockchain
+
+import (
+	"time"
+)
+
+// Metrics receives the measures of the operations of the setup, e.g. the collector of the metrics package.
+// Like Tracer, it keeps the package free of any monitoring dependency.
+type Metrics interface {
+	// ObserveOperation measures an Initialize, Invoke or Query, err is nil when it succeeded
+	ObserveOperation(operation string, duration time.Duration, err error)
+	// ObserveProposal measures the endorsement of a transaction proposal
+	ObserveProposal(duration time.Duration, err error)
+	// ObserveCommit measures the wait for the commit of a transaction, from its sending to the orderer,
+	// with its validation code ("VALID" for a valid transaction)
+	ObserveCommit(duration time.Duration, validationCode string)
+	// SetEventHubConnected reports the connection state of the event hub
+	SetEventHubConnected(connected bool)
+}
+
+// noopMetrics is used when no metrics are set
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveOperation(operation string, duration time.Duration, err error)	{}
+func (noopMetrics) ObserveProposal(duration time.Duration, err error)						{}
+func (noopMetrics) ObserveCommit(duration time.Duration, validationCode string)				{}
+func (noopMetrics) SetEventHubConnected(connected bool)										{}
+
+// metrics returns the metrics of the setup, measures dropped when not set
+func (setup *FabricSetup) metrics() Metrics {
+	if setup.Metrics == nil {
+		return noopMetrics{}
+	}
+	return setup.Metrics
+}
+
+// observeOperation measures the operation started at start, to be deferred with the named error of the operation
+func (setup *FabricSetup) observeOperation(operation string, start time.Time, err error) {
+	setup.metrics().ObserveOperation(operation, time.Since(start), err)
+}
@@ -0,0 +1,410 @@
+// Package mocks provides test doubles of the blockchain package
+package mocks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"github.com/chainhero/heroes-service/blockchain"
+)
+
+const chaincodeID = "heroes-service"
+
+// Ledger is an in-memory blockchain.ChainService running the functions of the heroes-service chaincode:
+// the states, their history and the chaincode events are kept in memory, each invoke is committed at once
+type Ledger struct {
+	// Returned by every operation when set, e.g. a *blockchain.TimeoutError
+	Err	error
+
+	mutex		sync.Mutex
+	closed		bool
+	txCount		int
+	states		map[string][]byte
+	history		map[string][]blockchain.KeyModification
+	handlers	map[*registration]*regexp.Regexp
+}
+
+// NewLedger returns a ledger initialized like the chaincode: hello is "word", there is no hero
+func NewLedger() *Ledger {
+	ledger := &Ledger{
+		states:		make(map[string][]byte),
+		history:	make(map[string][]blockchain.KeyModification),
+		handlers:	make(map[*registration]*regexp.Regexp),
+	}
+	ledger.put("init", "hello", []byte("word"))
+	return ledger
+}
+
+var _ blockchain.ChainService = (*Ledger)(nil)
+
+// IsInitialized is true until Close
+func (ledger *Ledger) IsInitialized() bool {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+	return !ledger.closed
+}
+
+// QueryWith runs the query actions of the chaincode: hello, hero, history and rich.
+// It fails when the context is already done, the options are not used.
+func (ledger *Ledger) QueryWith(ctx context.Context, function string, args []string, options ...blockchain.CallOption) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+	if err := ledger.check(function, args); err != nil {
+		return nil, err
+	}
+	if args[0] != "query" {
+		return nil, fmt.Errorf("Unknown action %s, check the first argument", args[0])
+	}
+
+	switch {
+	case args[1] == "hello":
+		return ledger.states["hello"], nil
+	case args[1] == "hero" && len(args) == 3:
+		return ledger.states["hero_" + args[2]], nil
+	case args[1] == "history" && len(args) == 3:
+		modifications := ledger.history[args[2]]
+		if modifications == nil {
+			modifications = []blockchain.KeyModification{}
+		}
+		return json.Marshal(modifications)
+	case args[1] == "rich" && len(args) == 5:
+		return ledger.queryRich(args[2], args[3], args[4])
+	}
+	return nil, fmt.Errorf("Unknown query action, check the second argument")
+}
+
+// InvokeWith runs the invoke actions of the chaincode, hello and hero, and returns the ID of the transaction.
+// Like the chaincode, the hero action emits heroCreated or heroUpdated with the hero as payload.
+// It fails when the context is already done, the options are not used.
+func (ledger *Ledger) InvokeWith(ctx context.Context, function string, args []string, options ...blockchain.CallOption) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	txID, eventName, err := ledger.invoke(function, args)
+	if err != nil {
+		return "", err
+	}
+	if eventName != "" {
+		ledger.Emit(eventName, txID, []byte(args[3]))
+	}
+	return txID, nil
+}
+
+// invoke runs the invoke action, and returns the name of the event to emit, if any
+func (ledger *Ledger) invoke(function string, args []string) (string, string, error) {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+	if err := ledger.check(function, args); err != nil {
+		return "", "", err
+	}
+	if args[0] != "invoke" {
+		return "", "", fmt.Errorf("Unknown action %s, check the first argument", args[0])
+	}
+
+	ledger.txCount++
+	txID := fmt.Sprintf("tx%d", ledger.txCount)
+	switch {
+	case args[1] == "hello" && len(args) == 3:
+		ledger.put(txID, "hello", []byte(args[2]))
+	case args[1] == "hero" && len(args) == 4:
+		eventName := "heroUpdated"
+		if _, ok := ledger.states["hero_" + args[2]]; !ok {
+			eventName = "heroCreated"
+		}
+		ledger.put(txID, "hero_" + args[2], []byte(args[3]))
+		return txID, eventName, nil
+	default:
+		return "", "", fmt.Errorf("Unknown invoke action, check the second argument")
+	}
+	return txID, "", nil
+}
+
+// QueryHello returns the value of hello
+func (ledger *Ledger) QueryHello() (string, error) {
+	payload, err := ledger.QueryWith(context.Background(), "invoke", []string{"query", "hello"})
+	return string(payload), err
+}
+
+// InvokeHello sets the value of hello
+func (ledger *Ledger) InvokeHello(value string) (string, error) {
+	return ledger.InvokeWith(context.Background(), "invoke", []string{"invoke", "hello", value})
+}
+
+// QueryRich returns a page of the states matching the selector, see queryRich
+func (ledger *Ledger) QueryRich(selector string, pageSize int, bookmark string) (*blockchain.RichQueryPage, error) {
+	payload, err := ledger.QueryWith(context.Background(), "invoke", []string{"query", "rich", selector, strconv.Itoa(pageSize), bookmark})
+	if err != nil {
+		return nil, err
+	}
+	page := &blockchain.RichQueryPage{}
+	if err := json.Unmarshal(payload, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// GetHistory returns the modifications of the key, oldest first
+func (ledger *Ledger) GetHistory(key string) ([]blockchain.KeyModification, error) {
+	if key == "" {
+		return nil, fmt.Errorf("The key of the history is empty")
+	}
+	payload, err := ledger.QueryWith(context.Background(), "invoke", []string{"query", "history", key})
+	if err != nil {
+		return nil, err
+	}
+	var modifications []blockchain.KeyModification
+	if err := json.Unmarshal(payload, &modifications); err != nil {
+		return nil, err
+	}
+	return modifications, nil
+}
+
+// Health reports a healthy setup without peer or orderer, unless Err is set. The context is not used.
+func (ledger *Ledger) Health(ctx context.Context) *blockchain.HealthReport {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+	report := &blockchain.HealthReport{Peers: map[string]bool{}, Orderers: map[string]bool{}, Errors: map[string]string{}}
+	if ledger.Err != nil {
+		report.Errors[blockchain.ComponentChaincode] = ledger.Err.Error()
+		return report
+	}
+	report.Enrolled = true
+	report.EventHub = true
+	report.Chaincode = true
+	return report
+}
+
+// RegisterChaincodeEvent calls the handler for each event named eventName (a regular expression) given to Emit
+func (ledger *Ledger) RegisterChaincodeEvent(eventName string, handler func(ccID string, txID string, payload []byte)) (blockchain.Registration, error) {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+	if ledger.Err != nil {
+		return nil, ledger.Err
+	}
+	pattern, err := regexp.Compile("^" + eventName + "$")
+	if err != nil {
+		return nil, fmt.Errorf("Invalid event name %s: %v", eventName, err)
+	}
+	r := &registration{ledger: ledger, handler: handler}
+	ledger.handlers[r] = pattern
+	return r, nil
+}
+
+// Emit calls the handlers registered for the event, like a chaincode calling stub.SetEvent in the transaction txID
+func (ledger *Ledger) Emit(eventName string, txID string, payload []byte) {
+	ledger.mutex.Lock()
+	var handlers []func(ccID string, txID string, payload []byte)
+	for r, pattern := range ledger.handlers {
+		if pattern.MatchString(eventName) {
+			handlers = append(handlers, r.handler)
+		}
+	}
+	ledger.mutex.Unlock()
+	for _, handler := range handlers {
+		handler(chaincodeID, txID, payload)
+	}
+}
+
+// Close removes the event handlers, the operations fail afterwards
+func (ledger *Ledger) Close() error {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+	ledger.closed = true
+	ledger.handlers = make(map[*registration]*regexp.Regexp)
+	return nil
+}
+
+// check returns the error of the ledger for a call of the chaincode
+func (ledger *Ledger) check(function string, args []string) error {
+	if ledger.Err != nil {
+		return ledger.Err
+	}
+	if ledger.closed {
+		return fmt.Errorf("The ledger is closed")
+	}
+	if function != "invoke" {
+		return fmt.Errorf("Unknown function %s, the chaincode only has invoke", function)
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("The number of arguments is insufficient")
+	}
+	return nil
+}
+
+// put writes the state and records its modification
+func (ledger *Ledger) put(txID string, key string, value []byte) {
+	ledger.states[key] = value
+	ledger.history[key] = append(ledger.history[key], blockchain.KeyModification{
+		TxID:		txID,
+		Timestamp:	time.Now().UTC(),
+		Value:		value,
+	})
+}
+
+// queryRich returns the page of the JSON states matching the selector, by key, like the chaincode.
+// The selector supports the equality of fields, the operators $eq, $ne, $gt, $gte, $lt, $lte and $regex,
+// $and, and the key as the _id field.
+func (ledger *Ledger) queryRich(selector string, pageSizeArg string, bookmark string) ([]byte, error) {
+	var selectorObject map[string]interface{}
+	if err := json.Unmarshal([]byte(selector), &selectorObject); err != nil {
+		return nil, fmt.Errorf("The selector must be a JSON object")
+	}
+	pageSize, err := strconv.Atoi(pageSizeArg)
+	if err != nil || pageSize <= 0 {
+		return nil, fmt.Errorf("The page size must be a positive number")
+	}
+	offset := 0
+	if bookmark != "" {
+		if offset, err = strconv.Atoi(bookmark); err != nil || offset < 0 {
+			return nil, fmt.Errorf("Invalid bookmark")
+		}
+	}
+
+	var keys []string
+	for key := range ledger.states {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	page := blockchain.RichQueryPage{Records: []blockchain.RichQueryRecord{}}
+	index := 0
+	for _, key := range keys {
+		var document map[string]interface{}
+		if json.Unmarshal(ledger.states[key], &document) != nil {
+			continue
+		}
+		document["_id"] = key
+		if !matches(document, selectorObject) {
+			continue
+		}
+		if index >= offset {
+			if len(page.Records) == pageSize {
+				page.Bookmark = strconv.Itoa(offset + pageSize)
+				break
+			}
+			page.Records = append(page.Records, blockchain.RichQueryRecord{Key: key, Value: json.RawMessage(ledger.states[key])})
+		}
+		index++
+	}
+	return json.Marshal(page)
+}
+
+// matches tells if the document satisfies every field of the selector
+func matches(document map[string]interface{}, selector map[string]interface{}) bool {
+	for field, condition := range selector {
+		if field == "$and" {
+			selectors, _ := condition.([]interface{})
+			for _, selector := range selectors {
+				if selector, ok := selector.(map[string]interface{}); !ok || !matches(document, selector) {
+					return false
+				}
+			}
+			continue
+		}
+		value, ok := document[field]
+		operators, isOperators := condition.(map[string]interface{})
+		if !isOperators {
+			if !ok || !equal(value, condition) {
+				return false
+			}
+			continue
+		}
+		for operator, operand := range operators {
+			if !ok || !compare(operator, value, operand) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compare applies a comparison operator, with the CouchDB collation: null sorts before any other value
+func compare(operator string, value interface{}, operand interface{}) bool {
+	order, comparable := collate(value, operand)
+	switch operator {
+	case "$eq":
+		return equal(value, operand)
+	case "$ne":
+		return !equal(value, operand)
+	case "$gt":
+		return comparable && order > 0
+	case "$gte":
+		return comparable && order >= 0
+	case "$lt":
+		return comparable && order < 0
+	case "$lte":
+		return comparable && order <= 0
+	case "$regex":
+		value, isString := value.(string)
+		pattern, isPattern := operand.(string)
+		if !isString || !isPattern {
+			return false
+		}
+		matched, err := regexp.MatchString(pattern, value)
+		return err == nil && matched
+	}
+	return false
+}
+
+// collate orders two JSON values of the same type, nil being before anything
+func collate(a interface{}, b interface{}) (int, bool) {
+	if b == nil {
+		if a == nil {
+			return 0, true
+		}
+		return 1, true
+	}
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// equal compares two decoded JSON values
+func equal(a interface{}, b interface{}) bool {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return string(aJSON) == string(bJSON)
+}
+
+// registration is a handler registered on the ledger
+type registration struct {
+	ledger	*Ledger
+	handler	func(ccID string, txID string, payload []byte)
+}
+
+func (r *registration) Unregister() error {
+	r.ledger.mutex.Lock()
+	defer r.ledger.mutex.Unlock()
+	if _, ok := r.ledger.handlers[r]; !ok {
+		return fmt.Errorf("Unknown or already removed event registration")
+	}
+	delete(r.ledger.handlers, r)
+	return nil
+}
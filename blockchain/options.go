@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"time"
+)
+
+// The options below set the parameters of the FabricSetup which have no variable in Config
+
+// newInitOptions gathers the options given to Initialize
+func newInitOptions(options []InitOption) *initOptions {
+	initOptions := &initOptions{}
+	for _, option := range options {
+		option(initOptions)
+	}
+	return initOptions
+}
+
+// apply sets the parameters of the options on the setup
+func (options *initOptions) apply(setup *FabricSetup) {
+	for _, setting := range options.settings {
+		setting(setup)
+	}
+}
+
+// withSetting applies the setting to the setup before its initialization
+func withSetting(setting func(*FabricSetup)) InitOption {
+	return func(options *initOptions) {
+		options.settings = append(options.settings, setting)
+	}
+}
+
+// WithEventBufferSize keeps at most size events while the delivery is paused, see Pause
+func WithEventBufferSize(size int) InitOption {
+	return withSetting(func(setup *FabricSetup) {
+		setup.EventBufferSize = size
+	})
+}
+
+// WithOrdererUserCredentials uses the pre-enrolled orderer admin instead of the one of the crypto-config directory
+func WithOrdererUserCredentials(credentials *UserCredentials) InitOption {
+	return withSetting(func(setup *FabricSetup) {
+		setup.OrdererUserCredentials = credentials
+	})
+}
+
+// WithOrgUserCredentials uses the pre-enrolled organisation admin instead of the one of the crypto-config directory
+func WithOrgUserCredentials(credentials *UserCredentials) InitOption {
+	return withSetting(func(setup *FabricSetup) {
+		setup.OrgUserCredentials = credentials
+	})
+}
+
+// WithLaunchRetries retries the queries while the chaincode is launching, waiting delay between them.
+// Negative retries disable them.
+func WithLaunchRetries(retries int, delay time.Duration) InitOption {
+	return withSetting(func(setup *FabricSetup) {
+		setup.LaunchRetries = retries
+		setup.LaunchRetryDelay = delay
+	})
+}
+
+// WithEndorseUntilPolicy proceeds with the invokes once the endorsements satisfy the endorsement policy of the
+// chaincode, the proposals still pending are cancelled
+func WithEndorseUntilPolicy() InitOption {
+	return withSetting(func(setup *FabricSetup) {
+		setup.EndorseUntilPolicy = true
+	})
+}
+
+// WithTracer traces the network operations with the tracer
+func WithTracer(tracer Tracer) InitOption {
+	return withSetting(func(setup *FabricSetup) {
+		setup.Tracer = tracer
+	})
+}
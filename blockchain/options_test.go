@@ -0,0 +1,42 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(operation string) Span { return noopSpan{} }
+
+func TestInitOptions(t *testing.T) {
+	orderer := &UserCredentials{Name: "Admin", CertPath: "orderer.pem", KeyPath: "orderer.key"}
+	org := &UserCredentials{Name: "Admin", Format: FormatBundle, CertPath: "org.pem"}
+	tracer := noopTracer{}
+	options := newInitOptions([]InitOption{
+		WithProfile("prod"),
+		WithEventBufferSize(42),
+		WithOrdererUserCredentials(orderer),
+		WithOrgUserCredentials(org),
+		WithLaunchRetries(-1, time.Second),
+		WithTracer(tracer),
+	})
+	if options.profile != "prod" {
+		t.Errorf("Profile %q, want prod", options.profile)
+	}
+
+	setup := NewFabricSetup()
+	options.apply(setup)
+	if setup.EventBufferSize != 42 || setup.getDispatcher().limit != 42 {
+		t.Errorf("Buffer of %d events, want 42", setup.EventBufferSize)
+	}
+	if setup.OrdererUserCredentials != orderer || setup.OrgUserCredentials != org {
+		t.Errorf("Credentials %+v and %+v not set", setup.OrdererUserCredentials, setup.OrgUserCredentials)
+	}
+	if setup.LaunchRetries != -1 || setup.LaunchRetryDelay != time.Second {
+		t.Errorf("Launch retries %d every %v, want -1 every 1s", setup.LaunchRetries, setup.LaunchRetryDelay)
+	}
+	if setup.Tracer != tracer {
+		t.Errorf("Tracer %v not set", setup.Tracer)
+	}
+}
@@ -0,0 +1,294 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/protos/common"
+	ab "github.com/hyperledger/fabric/protos/orderer"
+	"google.golang.org/grpc"
+)
+
+const (
+	ordererDialTimeout			= 3 * time.Second	// Same connection timeout as the SDK orderers
+	defaultOrdererRetryInterval	= 30 * time.Second
+)
+
+// OrdererEndpoint is an orderer of the ordering service besides the one of config.yaml,
+// verified by the orderer TLS certificate of config.yaml
+type OrdererEndpoint struct {
+	Address				string	// host:port
+	ServerHostOverride	string	// Name in the TLS certificate of the orderer, the host of the address when not set
+}
+
+// ordererClient sends the envelopes to an orderer like the SDK orderers, which open a connection per call.
+// Its TLS root certificate is read at each connection and the client certificate is presented, if any,
+// so the rotated certificates are used without a restart.
+type ordererClient struct {
+	url			string
+	dialOptions	func() ([]grpc.DialOption, error)
+}
+
+// useOrderers replaces the orderers of the channel by orderers using the TLS settings of the setup, see ordererClient,
+// and adds the Orderers
+func (setup *FabricSetup) useOrderers(channel api.Channel) error {
+	config := setup.Client.GetConfig()
+	known := make(map[string]bool)
+	for _, channelOrderer := range channel.GetOrderers() {
+		known[channelOrderer.GetURL()] = true
+		if _, ok := channelOrderer.(*ordererClient); ok {
+			continue
+		}
+		channel.RemoveOrderer(channelOrderer)
+		replacement := setup.newOrderer(channelOrderer.GetURL(), config.GetOrdererTLSCertificate(), config.GetOrdererTLSServerHostOverride())
+		if err := channel.AddOrderer(replacement); err != nil {
+			return fmt.Errorf("Error adding orderer: %v", err)
+		}
+	}
+	for _, endpoint := range setup.Orderers {
+		if endpoint.Address == "" {
+			return fmt.Errorf("An orderer has no address")
+		}
+		if known[endpoint.Address] {
+			continue
+		}
+		known[endpoint.Address] = true
+		if err := channel.AddOrderer(setup.newOrderer(endpoint.Address, config.GetOrdererTLSCertificate(), endpoint.ServerHostOverride)); err != nil {
+			return fmt.Errorf("Error adding orderer: %v", err)
+		}
+	}
+	return nil
+}
+
+// ordererPool keeps the health of the orderers like peerPool, and the orderer which accepted the last transaction
+type ordererPool struct {
+	peerPool
+	preferred	string
+}
+
+// report records the outcome of a broadcast to the orderer: an orderer which failed is put aside,
+// one which accepted the transaction is preferred
+func (pool *ordererPool) report(url string, err error, retryInterval time.Duration) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if err != nil {
+		if pool.unhealthy == nil {
+			pool.unhealthy = make(map[string]time.Time)
+		}
+		pool.unhealthy[url] = time.Now().Add(retryInterval)
+		return
+	}
+	delete(pool.unhealthy, url)
+	pool.preferred = url
+}
+
+// isPreferred tells if the orderer accepted the last transaction
+func (pool *ordererPool) isPreferred(url string) bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.preferred == url
+}
+
+// reportOrderer records the outcome of a broadcast to the orderer in the pool of the setup
+func (setup *FabricSetup) reportOrderer(url string, err error) {
+	retryInterval := setup.OrdererRetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultOrdererRetryInterval
+	}
+	if err != nil && setup.orderers.healthy(url) {
+		WithFields(setup.logger(), Fields{FieldOrderer: url}).Errorf("Orderer unavailable, put aside for %v: %v", retryInterval, err)
+	}
+	setup.orderers.report(url, err, retryInterval)
+}
+
+// orderingTargets returns the orderers of the channel in the order they are tried: the one which accepted
+// the last transaction, the other healthy ones, then the ones put aside
+func (setup *FabricSetup) orderingTargets(channel api.Channel) []api.Orderer {
+	var preferred, healthy, unhealthy []api.Orderer
+	for _, channelOrderer := range channel.GetOrderers() {
+		switch url := channelOrderer.GetURL(); {
+		case !setup.orderers.healthy(url):
+			unhealthy = append(unhealthy, channelOrderer)
+		case setup.orderers.isPreferred(url):
+			preferred = append(preferred, channelOrderer)
+		default:
+			healthy = append(healthy, channelOrderer)
+		}
+	}
+	return append(append(preferred, healthy...), unhealthy...)
+}
+
+// orderingService returns the orderers of the channel as a single one, failing over from one to the next
+func (setup *FabricSetup) orderingService(channel api.Channel) api.Orderer {
+	return &failoverOrderer{setup: setup, channel: channel}
+}
+
+// failoverOrderer sends to one orderer of the channel at a time, in the order of orderingTargets.
+// A transaction goes to the next orderer while one can't be reached or can't order it, e.g. during the election
+// of a Raft leader (SERVICE_UNAVAILABLE), but not when it is rejected.
+type failoverOrderer struct {
+	setup	*FabricSetup
+	channel	api.Channel
+}
+
+// GetURL returns the address of the orderer tried first
+func (o *failoverOrderer) GetURL() string {
+	targets := o.setup.orderingTargets(o.channel)
+	if len(targets) == 0 {
+		return ""
+	}
+	return targets[0].GetURL()
+}
+
+// SendBroadcast sends the envelope to the first orderer accepting it
+func (o *failoverOrderer) SendBroadcast(envelope *api.SignedEnvelope) (*common.Status, error) {
+	targets := o.setup.orderingTargets(o.channel)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("No orderer to send the transaction to")
+	}
+	var failures []string
+	for _, target := range targets {
+		status, err := target.SendBroadcast(envelope)
+		if err != nil && !canFailOver(status) {
+			return status, fmt.Errorf("Orderer %s return error: %v", target.GetURL(), err)
+		}
+		o.setup.reportOrderer(target.GetURL(), err)
+		if err == nil {
+			return status, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", target.GetURL(), err))
+	}
+	return nil, fmt.Errorf("No orderer accepted the transaction: %s", strings.Join(failures, "; "))
+}
+
+// SendDeliver sends the seek request to the orderer tried first
+func (o *failoverOrderer) SendDeliver(envelope *api.SignedEnvelope) (chan *common.Block, chan error) {
+	targets := o.setup.orderingTargets(o.channel)
+	if len(targets) == 0 {
+		errors := make(chan error, 1)
+		errors <- fmt.Errorf("No orderer to send the seek request to")
+		return make(chan *common.Block), errors
+	}
+	return targets[0].SendDeliver(envelope)
+}
+
+// canFailOver tells if the broadcast which failed with the status (none when the orderer couldn't be reached)
+// may succeed on another orderer
+func canFailOver(status *common.Status) bool {
+	return status == nil || *status == common.Status_SERVICE_UNAVAILABLE || *status == common.Status_INTERNAL_SERVER_ERROR
+}
+
+// newOrderer returns an orderer verified by the TLS root certificate in the file certificate
+func (setup *FabricSetup) newOrderer(url string, certificate string, serverHostOverride string) api.Orderer {
+	config := setup.Client.GetConfig()
+	return &ordererClient{
+		url:			url,
+		dialOptions:	func() ([]grpc.DialOption, error) {
+			options := []grpc.DialOption{grpc.WithTimeout(ordererDialTimeout)}
+			if !config.IsTLSEnabled() {
+				return append(options, grpc.WithInsecure()), nil
+			}
+			certPool, err := config.GetTLSCACertPool(certificate)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to load the TLS certificate of the orderer %s: %v", url, err)
+			}
+			return append(options, setup.tlsDialOption(certPool, serverHostOverride)), nil
+		},
+	}
+}
+
+// GetURL returns the address of the orderer
+func (o *ordererClient) GetURL() string {
+	return o.url
+}
+
+// SendBroadcast sends the envelope to the orderer and returns its status
+func (o *ordererClient) SendBroadcast(envelope *api.SignedEnvelope) (*common.Status, error) {
+	connection, err := o.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer connection.Close()
+
+	stream, err := ab.NewAtomicBroadcastClient(connection).Broadcast(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Error Create NewAtomicBroadcastClient %v", err)
+	}
+	if err := stream.Send(&common.Envelope{Payload: envelope.Payload, Signature: envelope.Signature}); err != nil {
+		return nil, fmt.Errorf("Failed to send a envelope to orderer: %v", err)
+	}
+	stream.CloseSend()
+
+	response, err := stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("error broadcast response : %v", err)
+	}
+	if response.Status != common.Status_SUCCESS {
+		return &response.Status, fmt.Errorf("broadcast response is not success : %v", response.Status)
+	}
+	return &response.Status, nil
+}
+
+// SendDeliver sends the seek request to the orderer and returns the blocks requested.
+// The error channel receives at most one error, the block channel is closed once every block is received.
+func (o *ordererClient) SendDeliver(envelope *api.SignedEnvelope) (chan *common.Block, chan error) {
+	blocks := make(chan *common.Block)
+	errors := make(chan error, 1)
+	if envelope == nil {
+		errors <- fmt.Errorf("Envelope cannot be nil")
+		return blocks, errors
+	}
+	connection, err := o.dial()
+	if err != nil {
+		errors <- err
+		return blocks, errors
+	}
+	stream, err := ab.NewAtomicBroadcastClient(connection).Deliver(context.Background())
+	if err != nil {
+		connection.Close()
+		errors <- fmt.Errorf("Error creating NewAtomicBroadcastClient %s", err)
+		return blocks, errors
+	}
+	if err := stream.Send(&common.Envelope{Payload: envelope.Payload, Signature: envelope.Signature}); err != nil {
+		connection.Close()
+		errors <- fmt.Errorf("Failed to send block request to orderer: %s", err)
+		return blocks, errors
+	}
+
+	go func() {
+		defer connection.Close()
+		for {
+			response, err := stream.Recv()
+			if err != nil {
+				errors <- fmt.Errorf("Got error from ordering service: %s", err)
+				return
+			}
+			switch t := response.Type.(type) {
+			case *ab.DeliverResponse_Status:
+				if t.Status != common.Status_SUCCESS {
+					errors <- fmt.Errorf("Got error status from ordering service: %s", t.Status)
+					return
+				}
+				close(blocks)
+				return
+			case *ab.DeliverResponse_Block:
+				blocks <- t.Block
+			default:
+				errors <- fmt.Errorf("Received unknown response from ordering service: %s", t)
+				return
+			}
+		}
+	}()
+	return blocks, errors
+}
+
+// dial opens a connection to the orderer
+func (o *ordererClient) dial() (*grpc.ClientConn, error) {
+	options, err := o.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Dial(o.url, options...)
+}
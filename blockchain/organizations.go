@@ -0,0 +1,52 @@
+package blockchain
+
+import (
+	"fmt"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+)
+
+// Organization is another organisation of the network than the one of config.yaml.
+// Its peers are added to the channels of the setup, so the transaction proposals are endorsed by the peers
+// of every organisation, as needed by a policy like "AND('Org1MSP.member','Org2MSP.member')".
+// A peer only accepts the administration proposals (channel join, chaincode install) from an admin of its
+// organisation: the organisation joins its peers and installs the chaincode with its own setup.
+type Organization struct {
+	MSPID	string
+	Peers	[]api.PeerConfig	// The TLS certificates are relative to the crypto config path like in config.yaml
+}
+
+// validateOrganizations checks each organisation has an MSP ID and peers
+func (setup *FabricSetup) validateOrganizations() error {
+	for _, organization := range setup.Organizations {
+		if organization.MSPID == "" {
+			return fmt.Errorf("An organisation has no MSP ID")
+		}
+		if len(organization.Peers) == 0 {
+			return fmt.Errorf("The organisation %s has no peer", organization.MSPID)
+		}
+	}
+	return nil
+}
+
+// organizationOf returns the MSP ID of the other organisation of the peer, "" for a peer of config.yaml
+func (setup *FabricSetup) organizationOf(peer api.Peer) string {
+	for _, organization := range setup.Organizations {
+		for _, peerConfig := range organization.Peers {
+			if fmt.Sprintf("%s:%d", peerConfig.Host, peerConfig.Port) == peer.URL() {
+				return organization.MSPID
+			}
+		}
+	}
+	return ""
+}
+
+// ownPeers returns the peers of the channel administered by the setup, the ones of config.yaml
+func (setup *FabricSetup) ownPeers(channel api.Channel) []api.Peer {
+	var peers []api.Peer
+	for _, peer := range channel.GetPeers() {
+		if setup.organizationOf(peer) == "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
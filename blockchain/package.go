@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Only these files are kept in the package of a Go chaincode, like the SDK packager does
+var packagedExtensions = []string{".go", ".c", ".h"}
+
+// Files excluded from the package when no ExcludePatterns is set, by language
+var defaultExcludePatterns = map[ChaincodeLang][]string{
+	LangGolang:	{"*_test.go"},
+	LangNode:	{"node_modules"},
+	LangJava:	{"build", "target", ".gradle"},
+}
+
+// packageChaincode builds the .tar.gz package of the chaincode, leaving out the files and directories
+// matching one of the exclude patterns.
+// A Go chaincode is found in the GOPATH, and its files are named relative to the GOPATH. The chaincode
+// in another language is found in the chaincode path (a directory), and its files are put under "src/".
+// A pattern is a glob matched against the base name and against the path relative to the chaincode
+// directory, e.g. "*_test.go", "testdata" or "vendor/github.com/unused".
+// The packaged files are logged at the debug level.
+func packageChaincode(logger Logger, lang ChaincodeLang, goPath string, chaincodePath string, excludePatterns []string) ([]byte, error) {
+	if lang == "" {
+		lang = LangGolang
+	}
+	if lang == LangGolang && goPath == "" {
+		return nil, fmt.Errorf("No GOPATH to package the chaincode from")
+	}
+	if excludePatterns == nil {
+		excludePatterns = defaultExcludePatterns[lang]
+	}
+	for _, pattern := range excludePatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid exclude pattern (%s): %v", pattern, err)
+		}
+	}
+
+	projectDir := chaincodePath
+	if lang == LangGolang {
+		projectDir = filepath.Join(goPath, "src", chaincodePath)
+	}
+	var codePackage bytes.Buffer
+	gzipWriter := gzip.NewWriter(&codePackage)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err := filepath.Walk(projectDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(projectDir, path)
+		if err != nil {
+			return err
+		}
+		if relativePath != "." && isExcluded(relativePath, excludePatterns) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || (lang == LangGolang && !isPackagedSource(path)) {
+			return nil
+		}
+
+		// The name in the package is relative to the GOPATH for Go, as expected by the peer
+		name := filepath.Join("src", relativePath)
+		if lang == LangGolang {
+			if name, err = filepath.Rel(goPath, path); err != nil {
+				return err
+			}
+		}
+		logger.Debugf("Packaging %s", name)
+		return packFile(tarWriter, path, filepath.ToSlash(name), info)
+	})
+	tarWriter.Close()
+	gzipWriter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to package the chaincode (%s): %v", chaincodePath, err)
+	}
+
+	return codePackage.Bytes(), nil
+}
+
+// isExcluded tells if the path matches one of the patterns
+func isExcluded(relativePath string, patterns []string) bool {
+	slashPath := filepath.ToSlash(relativePath)
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if matched, _ := filepath.Match(pattern, filepath.Base(relativePath)); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, slashPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isPackagedSource tells if the file is kept in the package, based on its extension
+func isPackagedSource(path string) bool {
+	extension := filepath.Ext(path)
+	for _, kept := range packagedExtensions {
+		if kept == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// packFile writes the file in the archive
+func packFile(tarWriter *tar.Writer, path string, name string, info os.FileInfo) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Use a deterministic "zero-time" so the same sources always give the same package
+	header := &tar.Header{
+		Name:		name,
+		Size:		info.Size(),
+		Mode:		int64(info.Mode()),
+		ModTime:	time.Time{},
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tarWriter, file)
+	return err
+}
@@ -0,0 +1,175 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+)
+
+// How long an unreachable peer is put aside when PeerRetryInterval is not set
+const defaultPeerRetryInterval = 30 * time.Second
+
+// peerPool keeps the health of the peers: a peer found unreachable is put aside for PeerRetryInterval,
+// and another healthy peer of the channel endorses in its place
+type peerPool struct {
+	mutex		sync.Mutex
+	unhealthy	map[string]time.Time	// End of the exclusion of the unreachable peers, by URL
+}
+
+// healthy tells if the peer isn't put aside
+func (pool *peerPool) healthy(url string) bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	until, ok := pool.unhealthy[url]
+	if ok && time.Now().After(until) {
+		delete(pool.unhealthy, url)
+		return true
+	}
+	return !ok
+}
+
+// report records the outcome of a request to the peer: an unreachable peer is put aside,
+// a peer that answered is healthy again
+func (pool *peerPool) report(url string, err error, retryInterval time.Duration) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	var unreachable *PeerUnreachableError
+	if err != nil && errors.As(err, &unreachable) {
+		if pool.unhealthy == nil {
+			pool.unhealthy = make(map[string]time.Time)
+		}
+		pool.unhealthy[url] = time.Now().Add(retryInterval)
+		return
+	}
+	delete(pool.unhealthy, url)
+}
+
+// clear forgets the health of the peers
+func (pool *peerPool) clear() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.unhealthy = nil
+}
+
+// reportPeer records the outcome of a request to the peer in the pool of the setup
+func (setup *FabricSetup) reportPeer(url string, err error) {
+	retryInterval := setup.PeerRetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultPeerRetryInterval
+	}
+	if err != nil && setup.peers.healthy(url) {
+		var unreachable *PeerUnreachableError
+		if errors.As(err, &unreachable) {
+			WithFields(setup.logger(), Fields{FieldPeer: url}).Errorf("Peer unreachable, put aside for %v", retryInterval)
+		}
+	}
+	setup.peers.report(url, err, retryInterval)
+}
+
+// endorsementTargets returns the peers of the channel the proposals are sent to: the EndorsingPeers, every peer
+// when not set. An unreachable one is replaced by a healthy peer of the channel not selected, when there is one.
+// When every peer is put aside, the selected ones are tried anyway.
+func (setup *FabricSetup) endorsementTargets(channel api.Channel) []api.Peer {
+	var selected, others []api.Peer
+	for _, peer := range channel.GetPeers() {
+		if setup.isEndorsingPeer(peer.URL()) {
+			selected = append(selected, peer)
+		} else {
+			others = append(others, peer)
+		}
+	}
+
+	var targets, substitutes []api.Peer
+	for _, peer := range others {
+		if setup.peers.healthy(peer.URL()) {
+			substitutes = append(substitutes, peer)
+		}
+	}
+	for _, peer := range selected {
+		if setup.peers.healthy(peer.URL()) {
+			targets = append(targets, peer)
+		} else if len(substitutes) > 0 {
+			WithFields(setup.logger(), Fields{FieldPeer: peer.URL()}).Debugf("Peer replaced by %s", substitutes[0].URL())
+			targets = append(targets, substitutes[0])
+			substitutes = substitutes[1:]
+		}
+	}
+	if len(targets) == 0 {
+		return selected
+	}
+	return targets
+}
+
+// isEndorsingPeer tells if the peer is one of the EndorsingPeers, every peer is when not set
+func (setup *FabricSetup) isEndorsingPeer(url string) bool {
+	if len(setup.EndorsingPeers) == 0 {
+		return true
+	}
+	for _, endorsingPeer := range setup.EndorsingPeers {
+		if trimScheme(endorsingPeer) == url {
+			return true
+		}
+	}
+	return false
+}
+
+// trimScheme returns the host:port of a peer URL, the SDK peers have no scheme
+func trimScheme(url string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(url, "grpcs://"), "grpc://")
+}
+
+// validateEndorsingPeers checks that every one of the EndorsingPeers is a peer of the channel
+func (setup *FabricSetup) validateEndorsingPeers(channel api.Channel) error {
+	for _, endorsingPeer := range setup.EndorsingPeers {
+		url := trimScheme(endorsingPeer)
+		found := false
+		for _, peer := range channel.GetPeers() {
+			if peer.URL() == url {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("The endorsing peer %s is not a peer of the channel %s", endorsingPeer, channel.GetName())
+		}
+	}
+	return nil
+}
+
+// eventPeerAddress is the event endpoint of a peer
+type eventPeerAddress struct {
+	url					string
+	certificate			string
+	serverHostOverride	string
+}
+
+// connectEventHub connects the event hub to the first event peer that answers, starting with the current one.
+// The SDK event hub keeps its registrations when it moves to another peer.
+// Nothing is done when another caller connected it in the meantime.
+func (setup *FabricSetup) connectEventHub(eventHub api.EventHub) error {
+	setup.eventPeersMutex.Lock()
+	defer setup.eventPeersMutex.Unlock()
+	if eventHub.IsConnected() {
+		return nil
+	}
+	if len(setup.eventPeers) == 0 {
+		return eventHub.Connect()
+	}
+
+	var failures []string
+	for attempt := 0; attempt < len(setup.eventPeers); attempt++ {
+		address := setup.eventPeers[setup.eventPeer]
+		eventHub.SetPeerAddr(address.url, address.certificate, address.serverHostOverride)
+		err := eventHub.Connect()
+		if err == nil {
+			WithFields(setup.logger(), Fields{FieldPeer: address.url}).Printf("EventHub connected to peer")
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", address.url, err))
+		setup.eventPeer = (setup.eventPeer + 1) % len(setup.eventPeers)
+	}
+	return fmt.Errorf("No event peer answered: %s", strings.Join(failures, "; "))
+}
@@ -0,0 +1,162 @@
+package blockchain
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// PolicyRole is the role the signers of an EndorsementRule must have in their MSP
+type PolicyRole string
+
+const (
+	RoleMember	PolicyRole = "member"
+	RoleAdmin	PolicyRole = "admin"
+)
+
+// EndorsementRule is an endorsement policy requiring the signatures of N of the MSPs, by an identity with the role.
+// E.g. {MSPIDs: []string{"Org1MSP", "Org2MSP"}} is "AND('Org1MSP.member','Org2MSP.member')".
+type EndorsementRule struct {
+	MSPIDs	[]string
+	Role	PolicyRole	// RoleMember when not set
+	N		int			// Signatures needed, one per MSP when not set
+}
+
+// envelope builds the signature policy of the rule
+func (rule *EndorsementRule) envelope() (*common.SignaturePolicyEnvelope, error) {
+	if len(rule.MSPIDs) == 0 {
+		return nil, fmt.Errorf("The endorsement rule has no MSP")
+	}
+	n := rule.N
+	if n == 0 {
+		n = len(rule.MSPIDs)
+	}
+	if n < 0 || n > len(rule.MSPIDs) {
+		return nil, fmt.Errorf("The endorsement rule needs %d signatures out of %d MSPs", n, len(rule.MSPIDs))
+	}
+
+	var role msp.MSPRole_MSPRoleType
+	switch rule.Role {
+	case "", RoleMember:
+		role = msp.MSPRole_MEMBER
+	case RoleAdmin:
+		role = msp.MSPRole_ADMIN
+	default:
+		return nil, fmt.Errorf("Unknown role in the endorsement rule: %s", rule.Role)
+	}
+
+	principals := make([]*msp.MSPPrincipal, len(rule.MSPIDs))
+	policies := make([]*common.SignaturePolicy, len(rule.MSPIDs))
+	for i, mspID := range rule.MSPIDs {
+		if mspID == "" {
+			return nil, fmt.Errorf("An MSP ID of the endorsement rule is empty")
+		}
+		principals[i] = &msp.MSPPrincipal{
+			PrincipalClassification:	msp.MSPPrincipal_ROLE,
+			Principal:					protosUtils.MarshalOrPanic(&msp.MSPRole{Role: role, MspIdentifier: mspID}),
+		}
+		policies[i] = cauthdsl.SignedBy(int32(i))
+	}
+
+	return &common.SignaturePolicyEnvelope{
+		Version:	0,
+		Rule:		cauthdsl.NOutOf(int32(n), policies),
+		Identities:	principals,
+	}, nil
+}
+
+// policyCheck tells if the identities of the MSPs satisfy a signature policy, consuming the ones it uses
+type policyCheck func(mspIDs []string, used []bool) bool
+
+// endorsementsCheck returns the check of the endorsements against the signature policy, evaluated like the peers do.
+// The client only knows the MSP of the endorsers: a principal other than the member role of an MSP can't be checked.
+func endorsementsCheck(envelope *common.SignaturePolicyEnvelope) (func([]*api.TransactionProposalResponse) bool, error) {
+	check, err := compilePolicy(envelope.Rule, envelope.Identities)
+	if err != nil {
+		return nil, err
+	}
+	return func(responses []*api.TransactionProposalResponse) bool {
+		mspIDs := endorserMSPs(responses)
+		return check(mspIDs, make([]bool, len(mspIDs)))
+	}, nil
+}
+
+// compilePolicy builds the check of the signature policy, like cauthdsl: an NOutOf keeps the identities used by
+// the rules it counts, a SignedBy uses the first identity not used yet matching its principal
+func compilePolicy(policy *common.SignaturePolicy, principals []*msp.MSPPrincipal) (policyCheck, error) {
+	switch rule := policy.GetType().(type) {
+	case *common.SignaturePolicy_NOutOf_:
+		var checks []policyCheck
+		for _, subPolicy := range rule.NOutOf.GetRules() {
+			check, err := compilePolicy(subPolicy, principals)
+			if err != nil {
+				return nil, err
+			}
+			checks = append(checks, check)
+		}
+		n := rule.NOutOf.GetN()
+		return func(mspIDs []string, used []bool) bool {
+			verified := int32(0)
+			ruleUsed := make([]bool, len(used))
+			for _, check := range checks {
+				copy(ruleUsed, used)
+				if check(mspIDs, ruleUsed) {
+					verified++
+					copy(used, ruleUsed)
+				}
+			}
+			return verified >= n
+		}, nil
+
+	case *common.SignaturePolicy_SignedBy:
+		if rule.SignedBy < 0 || int(rule.SignedBy) >= len(principals) {
+			return nil, fmt.Errorf("The policy is signed by the identity %d, out of the %d of the policy", rule.SignedBy, len(principals))
+		}
+		principal := principals[rule.SignedBy]
+		if principal.PrincipalClassification != msp.MSPPrincipal_ROLE {
+			return nil, fmt.Errorf("The %s principals can't be checked by the client", principal.PrincipalClassification)
+		}
+		role := &msp.MSPRole{}
+		if err := proto.Unmarshal(principal.Principal, role); err != nil {
+			return nil, fmt.Errorf("Invalid role in the policy: %v", err)
+		}
+		if role.Role != msp.MSPRole_MEMBER {
+			return nil, fmt.Errorf("The %s role of %s can't be checked by the client", role.Role, role.MspIdentifier)
+		}
+		return func(mspIDs []string, used []bool) bool {
+			for i, mspID := range mspIDs {
+				if !used[i] && mspID == role.MspIdentifier {
+					used[i] = true
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("Unknown signature policy: %T", rule)
+	}
+}
+
+// endorserMSPs returns the MSP of each distinct endorser of the responses, empty when unreadable
+func endorserMSPs(responses []*api.TransactionProposalResponse) []string {
+	var mspIDs []string
+	seen := make(map[string]bool)
+	for _, response := range responses {
+		endorser := response.ProposalResponse.GetEndorsement().GetEndorser()
+		if seen[string(endorser)] {
+			continue
+		}
+		seen[string(endorser)] = true
+		identity := &msp.SerializedIdentity{}
+		if err := proto.Unmarshal(endorser, identity); err != nil {
+			identity.Mspid = ""
+		}
+		mspIDs = append(mspIDs, identity.Mspid)
+	}
+	return mspIDs
+}
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"testing"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// endorsedBy returns a response endorsed by the identity of the MSP
+func endorsedBy(mspID string, certificate string) *api.TransactionProposalResponse {
+	endorser, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: []byte(certificate)})
+	return &api.TransactionProposalResponse{ProposalResponse: &pb.ProposalResponse{Endorsement: &pb.Endorsement{Endorser: endorser}}}
+}
+
+func TestEndorsementsCheck(t *testing.T) {
+	org1Peer0 := endorsedBy("Org1MSP", "peer0.org1")
+	org1Peer1 := endorsedBy("Org1MSP", "peer1.org1")
+	org2Peer0 := endorsedBy("Org2MSP", "peer0.org2")
+	org3Peer0 := endorsedBy("Org3MSP", "peer0.org3")
+	tests := []struct {
+		policy		string
+		responses	[]*api.TransactionProposalResponse
+		satisfied	bool
+	}{
+		{"OR('Org1MSP.member','Org2MSP.member')", []*api.TransactionProposalResponse{org2Peer0}, true},
+		{"OR('Org1MSP.member','Org2MSP.member')", []*api.TransactionProposalResponse{org3Peer0}, false},
+		{"AND('Org1MSP.member','Org2MSP.member')", []*api.TransactionProposalResponse{org1Peer0}, false},
+		{"AND('Org1MSP.member','Org2MSP.member')", []*api.TransactionProposalResponse{org2Peer0, org1Peer0}, true},
+		{"AND('Org1MSP.member','Org1MSP.member')", []*api.TransactionProposalResponse{org1Peer0, org2Peer0}, false},
+		{"AND('Org1MSP.member','Org1MSP.member')", []*api.TransactionProposalResponse{org1Peer0, org1Peer0}, false},
+		{"AND('Org1MSP.member','Org1MSP.member')", []*api.TransactionProposalResponse{org1Peer0, org1Peer1}, true},
+		{"AND('Org1MSP.member',OR('Org2MSP.member','Org3MSP.member'))", []*api.TransactionProposalResponse{org3Peer0, org1Peer0}, true},
+		{"AND('Org1MSP.member',OR('Org1MSP.member','Org2MSP.member'))", []*api.TransactionProposalResponse{org1Peer0}, false},
+	}
+	for _, test := range tests {
+		envelope, err := cauthdsl.FromString(test.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check, err := endorsementsCheck(envelope)
+		if err != nil {
+			t.Fatalf("%s: %v", test.policy, err)
+		}
+		if satisfied := check(test.responses); satisfied != test.satisfied {
+			t.Errorf("%s by %v: satisfied %t", test.policy, endorserMSPs(test.responses), satisfied)
+		}
+	}
+
+	// Two of three organisations, as an EndorsementRule
+	envelope, err := (&EndorsementRule{MSPIDs: []string{"Org1MSP", "Org2MSP", "Org3MSP"}, N: 2}).envelope()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err := endorsementsCheck(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check([]*api.TransactionProposalResponse{org1Peer0, org1Peer1}) || !check([]*api.TransactionProposalResponse{org1Peer0, org3Peer0}) {
+		t.Error("The rule isn't evaluated by organisation")
+	}
+}
+
+func TestEndorsementsCheckUnknownRole(t *testing.T) {
+	for _, policy := range []string{"OR('Org1MSP.admin','Org2MSP.member')", "AND('Org1MSP.member','Org2MSP.admin')"} {
+		envelope, err := cauthdsl.FromString(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := endorsementsCheck(envelope); err == nil {
+			t.Errorf("%s: the admin role was checked", policy)
+		}
+	}
+}
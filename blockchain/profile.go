@@ -0,0 +1,138 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"gopkg.in/yaml.v2"
+)
+
+// The profiles file describes the network environments (dev, test, prod...) with the variables of Config:
+//
+//	prod:
+//	  variables:
+//	    HEROES_CONFIG_FILE: config-prod.yaml
+//	    HEROES_CHANNEL_ID: heroes
+//	    HEROES_CHAINCODE_VERSION: v1.2.0
+//	  required:
+//	    - HEROES_VAULT_ADDR
+//	    - HEROES_TLS_CLIENT_CERT
+const (
+	defaultProfilesFile	= "profiles.yaml"
+	defaultProfile		= "dev"	// The fixtures network, DefaultConfig, when it isn't in the profiles file
+)
+
+// Profile is a network environment of the profiles file
+type Profile struct {
+	Variables	map[string]string	`yaml:"variables"`	// Variables of Config (HEROES_...), overridden by the environment
+	Required	[]string			`yaml:"required"`	// Variables which can't be empty, set by the profile or the environment
+}
+
+// InitOption adjusts the setup initialized by Initialize
+type InitOption func(*initOptions)
+
+type initOptions struct {
+	profile			string
+	profilesFile	string
+	settings		[]func(*FabricSetup)	// Applied to the setup before its initialization
+}
+
+// WithProfile initializes the setup of the network of the profile, HEROES_PROFILE by default
+func WithProfile(name string) InitOption {
+	return func(options *initOptions) {
+		options.profile = name
+	}
+}
+
+// WithProfilesFile reads the profiles from the file, HEROES_PROFILES ("profiles.yaml" when not set) by default
+func WithProfilesFile(path string) InitOption {
+	return func(options *initOptions) {
+		options.profilesFile = path
+	}
+}
+
+// LoadProfiles reads the profiles file, by profile name
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the profiles file: %w", err)
+	}
+	profiles := make(map[string]Profile)
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("Invalid profiles file %s: %v", path, err)
+	}
+	return profiles, nil
+}
+
+// ProfileConfig returns the Config of the profile, HEROES_PROFILE when empty, read from the profiles file,
+// HEROES_PROFILES ("profiles.yaml" when not set) when empty. The environment variables take precedence over
+// the variables of the profile. Without profile, or for the "dev" profile missing from the file, it is DefaultConfig.
+// The error, matched by errors.Is(err, ErrConfig), lists the required variables not set.
+func ProfileConfig(name string, profilesFile string) (Config, error) {
+	if name == "" {
+		name = os.Getenv("HEROES_PROFILE")
+	}
+	if profilesFile == "" {
+		profilesFile = os.Getenv("HEROES_PROFILES")
+	}
+	if profilesFile == "" {
+		profilesFile = defaultProfilesFile
+	}
+	if name == "" {
+		return DefaultConfig(), nil
+	}
+
+	profiles, err := LoadProfiles(profilesFile)
+	if errors.Is(err, os.ErrNotExist) && name == defaultProfile {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, setupError(PhaseConfig, err)
+	}
+	profile, ok := profiles[name]
+	if !ok && name == defaultProfile {
+		return DefaultConfig(), nil
+	}
+	if !ok {
+		var names []string
+		for profileName := range profiles {
+			names = append(names, profileName)
+		}
+		sort.Strings(names)
+		return Config{}, setupError(PhaseConfig, fmt.Errorf("Unknown profile %s in %s, expected one of %s", name, profilesFile, strings.Join(names, ", ")))
+	}
+
+	// The variables read by configFrom are the known ones
+	known := make(map[string]bool)
+	lookup := func(variable string) (string, bool) {
+		known[variable] = true
+		if value, ok := os.LookupEnv(variable); ok && value != "" {
+			return value, true
+		}
+		value, ok := profile.Variables[variable]
+		return value, ok
+	}
+	config := configFrom(lookup)
+
+	var problems []string
+	for variable := range profile.Variables {
+		if !known[variable] {
+			problems = append(problems, fmt.Sprintf("unknown variable %s", variable))
+		}
+	}
+	for _, variable := range profile.Required {
+		if !known[variable] {
+			problems = append(problems, fmt.Sprintf("unknown required variable %s", variable))
+		} else if value, _ := lookup(variable); value == "" {
+			problems = append(problems, fmt.Sprintf("%s is required", variable))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return Config{}, setupError(PhaseConfig, fmt.Errorf("Invalid profile %s: %s", name, strings.Join(problems, ", ")))
+	}
+	return config, nil
+}
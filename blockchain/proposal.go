@@ -0,0 +1,423 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/common/crypto"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"google.golang.org/grpc/codes"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+const (
+	defaultReservedNonceTTL	= 10 * time.Minute
+	maxReservedNonces		= 1000
+)
+
+// reservedNonce is a nonce reserved by ComputeTxID
+type reservedNonce struct {
+	nonce		[]byte
+	reserved	time.Time
+}
+
+// ComputeTxID returns the transaction ID that will be assigned to the next invoke of
+// the given function with the given arguments. A nonce is reserved for the identity of the
+// options (the current identity when not set), and used by the next matching invoke of this identity,
+// so event listeners keyed by this transaction ID can be registered before submitting the transaction.
+// The nonce is forgotten when not used within ReservedNonceTTL.
+func (setup *FabricSetup) ComputeTxID(function string, args []string, options ...CallOption) (string, error) {
+	target, err := setup.callTarget(setup.primaryTarget(), options)
+	if err != nil {
+		return "", err
+	}
+
+	// The transaction ID is the hash of the nonce and the identity of the creator
+	creator, err := setup.creatorOf(target)
+	if err != nil {
+		return "", fmt.Errorf("Unable to get the identity of the creator: %v", err)
+	}
+	nonce, err := crypto.GetRandomNonce()
+	if err != nil {
+		return "", fmt.Errorf("Unable to generate a nonce: %v", err)
+	}
+	txID, err := protosUtils.ComputeProposalTxID(nonce, creator)
+	if err != nil {
+		return "", fmt.Errorf("Unable to compute the transaction ID: %v", err)
+	}
+
+	// Keep the nonce for the next invoke of this function by this creator
+	setup.noncesMutex.Lock()
+	defer setup.noncesMutex.Unlock()
+	if setup.reservedNonces == nil {
+		setup.reservedNonces = make(map[string]reservedNonce)
+	}
+	setup.expireReservedNonces(time.Now())
+	setup.reservedNonces[nonceKey(creator, append([]string{function}, args...))] = reservedNonce{nonce: nonce, reserved: time.Now()}
+
+	return txID, nil
+}
+
+// nonceKey returns the key of a reserved nonce for the creator and the chaincode arguments
+func nonceKey(creator []byte, args []string) string {
+	return string(creator) + "\x00" + strings.Join(args, "\x00")
+}
+
+// expireReservedNonces forgets the nonces reserved for longer than ReservedNonceTTL, and the oldest ones
+// when there is no room for another one
+func (setup *FabricSetup) expireReservedNonces(now time.Time) {
+	ttl := setup.ReservedNonceTTL
+	if ttl <= 0 {
+		ttl = defaultReservedNonceTTL
+	}
+	for key, reserved := range setup.reservedNonces {
+		if now.Sub(reserved.reserved) > ttl {
+			delete(setup.reservedNonces, key)
+		}
+	}
+	for len(setup.reservedNonces) >= maxReservedNonces {
+		var oldestKey string
+		var oldest time.Time
+		for key, reserved := range setup.reservedNonces {
+			if oldestKey == "" || reserved.reserved.Before(oldest) {
+				oldestKey, oldest = key, reserved.reserved
+			}
+		}
+		delete(setup.reservedNonces, oldestKey)
+	}
+}
+
+// takeReservedNonce returns and forgets the nonce reserved for the creator and the chaincode arguments, if any
+func (setup *FabricSetup) takeReservedNonce(creator []byte, args []string) []byte {
+	setup.noncesMutex.Lock()
+	defer setup.noncesMutex.Unlock()
+	setup.expireReservedNonces(time.Now())
+	key := nonceKey(creator, args)
+	reserved, ok := setup.reservedNonces[key]
+	if !ok {
+		return nil
+	}
+	delete(setup.reservedNonces, key)
+	return reserved.nonce
+}
+
+// createProposal creates and signs a transaction proposal for the chaincode of the primary channel
+func (setup *FabricSetup) createProposal(args []string, transientData map[string][]byte) (*api.TransactionProposal, error) {
+	return setup.createProposalOn(setup.primaryTarget(), args, transientData)
+}
+
+// createProposalOn creates and signs a transaction proposal for the chaincode of the target channel.
+// If a transaction ID has been computed for these arguments, its nonce is used.
+func (setup *FabricSetup) createProposalOn(target channelTarget, args []string, transientData map[string][]byte) (*api.TransactionProposal, error) {
+	return setup.newProposalOn(target, args, transientData, true)
+}
+
+// createUnreservedProposalOn is createProposalOn leaving the nonce reserved for these arguments to their invoke
+func (setup *FabricSetup) createUnreservedProposalOn(target channelTarget, args []string, transientData map[string][]byte) (*api.TransactionProposal, error) {
+	return setup.newProposalOn(target, args, transientData, false)
+}
+
+// newProposalOn creates and signs the proposal, with the reserved nonce of the arguments when useReserved
+func (setup *FabricSetup) newProposalOn(target channelTarget, args []string, transientData map[string][]byte, useReserved bool) (*api.TransactionProposal, error) {
+	setup.proposalMutex.Lock()
+	defer setup.proposalMutex.Unlock()
+
+	// The nonces are reserved for a creator, see ComputeTxID
+	creator, err := setup.creatorOf(target)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the identity of the creator: %v", err)
+	}
+	var nonce []byte
+	if useReserved {
+		nonce = setup.takeReservedNonce(creator, args)
+	}
+	args, err = setup.serializeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// No reserved nonce, let the SDK generate one, it can only sign with the user context
+	if nonce == nil {
+		if target.identity == nil {
+			return target.channel.CreateTransactionProposal(target.chaincodeID, target.channelID, args, true, transientData)
+		}
+		if nonce, err = crypto.GetRandomNonce(); err != nil {
+			return nil, fmt.Errorf("Unable to generate a nonce: %v", err)
+		}
+	}
+
+	txID, proposal, err := chaincodeProposal(target, args, transientData, nonce, creator)
+	if err != nil {
+		return nil, err
+	}
+
+	signedProposal, err := setup.signProposalAs(proposal, target.identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.TransactionProposal{
+		TransactionID:	txID,
+		SignedProposal:	signedProposal,
+		Proposal:		proposal,
+	}, nil
+}
+
+// chaincodeProposal builds the unsigned proposal invoking the chaincode of the target, like the SDK does
+func chaincodeProposal(target channelTarget, args []string, transientData map[string][]byte, nonce []byte, creator []byte) (string, *pb.Proposal, error) {
+	argsArray := make([][]byte, len(args))
+	for i, arg := range args {
+		argsArray[i] = []byte(arg)
+	}
+	spec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{
+		Type:			pb.ChaincodeSpec_GOLANG,
+		ChaincodeId:	&pb.ChaincodeID{Name: target.chaincodeID},
+		Input:			&pb.ChaincodeInput{Args: argsArray},
+	}}
+
+	txID, err := protosUtils.ComputeProposalTxID(nonce, creator)
+	if err != nil {
+		return "", nil, fmt.Errorf("Unable to compute the transaction ID: %v", err)
+	}
+	proposal, _, err := protosUtils.CreateChaincodeProposalWithTxIDNonceAndTransient(
+		txID,
+		common.HeaderType_ENDORSER_TRANSACTION,
+		target.channelID,
+		spec,
+		nonce,
+		creator,
+		transientData,
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("Unable to create the proposal: %v", err)
+	}
+	return txID, proposal, nil
+}
+
+// signProposal signs the proposal with the key of the current user
+func (setup *FabricSetup) signProposal(proposal *pb.Proposal) (*pb.SignedProposal, error) {
+	return setup.signProposalAs(proposal, nil)
+}
+
+// signProposalAs signs the proposal with the key of the user, the current user when nil
+func (setup *FabricSetup) signProposalAs(proposal *pb.Proposal, user api.User) (*pb.SignedProposal, error) {
+	if user == nil {
+		user = setup.Client.GetUserContext()
+	}
+	if user == nil {
+		return nil, fmt.Errorf("No user context to sign the proposal")
+	}
+
+	proposalBytes, err := proto.Marshal(proposal)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to marshal the proposal: %v", err)
+	}
+
+	signature, err := setup.sign(user, proposalBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to sign the proposal: %v", err)
+	}
+
+	return &pb.SignedProposal{ProposalBytes: proposalBytes, Signature: signature}, nil
+}
+
+// sign signs the hash of the message with the key of the user
+func (setup *FabricSetup) sign(user api.User, message []byte) ([]byte, error) {
+	cryptoSuite := setup.Client.GetCryptoSuite()
+	digest, err := cryptoSuite.Hash(message, &bccsp.SHAOpts{})
+	if err != nil {
+		return nil, err
+	}
+	return cryptoSuite.Sign(user.GetPrivateKey(), digest, nil)
+}
+
+// contextPeer is a peer whose proposals are cancelled with their context, see endorserPeer
+type contextPeer interface {
+	sendProposalContext(ctx context.Context, proposal *api.TransactionProposal) (*api.TransactionProposalResponse, error)
+}
+
+// sendProposal sends the proposal to the target peers and collects their endorsements.
+// When MinEndorsements is set, the collection stops as soon as this number of successful
+// endorsements is received. With EndorseUntilPolicy, it stops as soon as the endorsements satisfy the
+// endorsement policy (and are at least MinEndorsements when set); a policy with roles the client can't check,
+// e.g. admin, is ignored. Once the collection stops, the requests still pending are cancelled, or abandoned
+// on the peers not created by useEndorsers, and their responses ignored.
+// When EndorsementDeadline is set, the collection stops at the deadline, and the endorsements
+// received so far are used if they are enough.
+// The endorsement by each peer is traced under the span, see ParentSpan.
+func (setup *FabricSetup) sendProposal(proposal *api.TransactionProposal, targets []api.Peer, span Span) ([]*api.TransactionProposalResponse, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("No peer to send the transaction proposal to")
+	}
+
+	// By default, every peer must endorse the proposal
+	required := setup.MinEndorsements
+	var satisfied func([]*api.TransactionProposalResponse) bool
+	if setup.EndorseUntilPolicy {
+		satisfied = setup.endorsementsCheck()
+	}
+	if required <= 0 || required > len(targets) {
+		required = len(targets)
+		if satisfied != nil {
+			required = 1
+		}
+	}
+
+	// Send the proposal to every peer at the same time
+	// The channel is buffered so the cancelled requests don't leak their goroutine
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan *api.TransactionProposalResponse, len(targets))
+	for _, peer := range targets {
+		go func(peer api.Peer) {
+			peerSpan := startChildSpan(span, "Endorse")
+			peerSpan.SetAttribute(AttributePeer, peer.URL())
+			peerSpan.SetAttribute(AttributeTxID, proposal.TransactionID)
+			var response *api.TransactionProposalResponse
+			var err error
+			if sender, ok := peer.(contextPeer); ok {
+				response, err = sender.sendProposalContext(ctx, proposal)
+			} else {
+				response, err = peer.SendProposal(proposal)
+			}
+			if err != nil {
+				response = &api.TransactionProposalResponse{
+					Endorser:	peer.URL(),
+					Err:		fmt.Errorf("Error calling endorser '%s': %w", peer.URL(), err),
+					Proposal:	proposal,
+				}
+			}
+			endEndorsementSpan(peerSpan, response)
+			results <- response
+		}(peer)
+	}
+
+	var deadline <-chan time.Time
+	if setup.EndorsementDeadline > 0 {
+		timer := time.NewTimer(setup.EndorsementDeadline)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	// Collect the endorsements until we have enough of them
+	var endorsements []*api.TransactionProposalResponse
+	enough := func() bool {
+		return len(endorsements) >= required && (satisfied == nil || satisfied(endorsements))
+	}
+	var failures []string
+	var timedOut *TimeoutError
+	var rejected *ChaincodeError
+	var failed *EndorsementError
+collect:
+	for received := 0; received < len(targets) && !enough(); received++ {
+		select {
+		case response := <-results:
+			logger := WithFields(setup.logger(), Fields{FieldTxID: proposal.TransactionID, FieldPeer: response.Endorser})
+			setup.reportPeer(response.Endorser, response.Err)
+			if response.Err != nil {
+				logger.Errorf("Endorsement failed: %v", response.Err)
+				errors.As(response.Err, &timedOut)
+				failures = append(failures, response.Err.Error())
+				if failed == nil {
+					failed = &EndorsementError{Peer: response.Endorser, Code: grpcCode(response.Err)}
+				}
+				failed.chaincodeNotFound = failed.chaincodeNotFound || isChaincodeNotFound(response.Err.Error())
+				continue
+			}
+			if status := response.ProposalResponse.GetResponse().GetStatus(); status != 200 {
+				logger.Errorf("Endorsement rejected with status %d: %s", status, response.ProposalResponse.GetResponse().GetMessage())
+				failures = append(failures, fmt.Sprintf("Endorser %s return status %d: %s", response.Endorser, status, response.ProposalResponse.GetResponse().GetMessage()))
+				if rejected == nil {
+					rejected = &ChaincodeError{Peer: response.Endorser, Status: status, Message: response.ProposalResponse.GetResponse().GetMessage()}
+				}
+				if isChaincodeNotFound(response.ProposalResponse.GetResponse().GetMessage()) {
+					if failed == nil {
+						failed = &EndorsementError{Peer: response.Endorser, Code: codes.Unknown}
+					}
+					failed.chaincodeNotFound = true
+				}
+				continue
+			}
+			endorsements = append(endorsements, response)
+
+		case <-deadline:
+			failures = append(failures, fmt.Sprintf("Endorsement deadline (%v) reached", setup.EndorsementDeadline))
+			timedOut = &TimeoutError{Operation: "Endorsement", Timeout: setup.EndorsementDeadline}
+			break collect
+		}
+	}
+
+	if !enough() {
+		err := fmt.Errorf("Only %d endorsement(s) received out of the %d required: %s", len(endorsements), required, strings.Join(failures, "; "))
+		if len(endorsements) >= required {
+			err = fmt.Errorf("The %d endorsement(s) received don't satisfy the endorsement policy: %s", len(endorsements), strings.Join(failures, "; "))
+		}
+		// Missing endorsements because of a timeout are a timeout of the proposal
+		if timedOut != nil {
+			return nil, &TimeoutError{Operation: timedOut.Operation, TxID: proposal.TransactionID, Timeout: timedOut.Timeout, Cause: err}
+		}
+		// A chaincode missing on a peer isn't a rejection of the chaincode
+		if failed != nil && failed.chaincodeNotFound {
+			failed.Cause = err
+			return nil, failed
+		}
+		// The rejection of the chaincode is kept typed, e.g. for the errors of the application
+		if rejected != nil {
+			rejected.Cause = err
+			return nil, rejected
+		}
+		if failed != nil {
+			failed.Cause = err
+			return nil, failed
+		}
+		return nil, err
+	}
+
+	return endorsements, nil
+}
+
+// endorsementsCheck returns the check of the endorsements against the endorsement policy, nil when the policy
+// can't be checked by the client
+func (setup *FabricSetup) endorsementsCheck() func([]*api.TransactionProposalResponse) bool {
+	envelope, err := setup.endorsementEnvelope()
+	if err == nil {
+		var check func([]*api.TransactionProposalResponse) bool
+		if check, err = endorsementsCheck(envelope); err == nil {
+			return check
+		}
+	}
+	setup.logger().Debugf("Every endorsement is collected, the endorsement policy can't be checked: %v", err)
+	return nil
+}
+
+// endorsers returns the URL of the peers that endorsed the proposal
+func endorsers(responses []*api.TransactionProposalResponse) []string {
+	var urls []string
+	for _, response := range responses {
+		urls = append(urls, response.Endorser)
+	}
+	return urls
+}
+
+// ResponseValidator checks the endorsements of a proposal before the transaction is sent to the orderer.
+// It allows to enforce custom rules, like requiring two endorsements or an endorsement from a given organisation.
+type ResponseValidator func(responses []*api.TransactionProposalResponse) error
+
+// validateResponses runs the response validator of the setup, or checks every response has a 200 status
+func (setup *FabricSetup) validateResponses(responses []*api.TransactionProposalResponse) error {
+	if setup.ResponseValidator != nil {
+		return setup.ResponseValidator(responses)
+	}
+	for _, response := range responses {
+		if status := response.ProposalResponse.GetResponse().GetStatus(); status != 200 {
+			return fmt.Errorf("Endorser %s return status %d", response.Endorser, status)
+		}
+	}
+	return nil
+}
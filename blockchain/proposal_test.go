@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fabricClient "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"golang.org/x/net/context"
+)
+
+func TestComputeTxID(t *testing.T) {
+	client := fabricClient.NewClient(nil)
+	client.SetCryptoSuite(bccspFactory.GetDefault())
+	setup := &FabricSetup{Client: client}
+	alice := NewMSPUser(testUser(t, client, "alice"), "Org1MSP")
+	bob := NewMSPUser(testUser(t, client, "bob"), "Org1MSP")
+	args := []string{"invoke", "invoke", "hello", "world"}
+	proposalTxID := func(user MSPUser, args []string) string {
+		proposal, err := setup.createProposalOn(channelTarget{chaincodeID: "heroes-service", identity: user}, args, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proposal.TransactionID
+	}
+
+	txID, err := setup.ComputeTxID(args[0], args[1:], WithUser(alice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposalTxID(bob, args) == txID {
+		t.Error("The nonce of alice was used by bob")
+	}
+	if proposalTxID(alice, []string{"invoke", "invoke", "hello", "you"}) == txID {
+		t.Error("The nonce was used by other arguments")
+	}
+	if proposalTxID(alice, args) != txID {
+		t.Error("The nonce wasn't used by the invoke")
+	}
+	if proposalTxID(alice, args) == txID {
+		t.Error("The nonce was used twice")
+	}
+
+	setup.ReservedNonceTTL = time.Millisecond
+	txID, _ = setup.ComputeTxID(args[0], args[1:], WithUser(alice))
+	time.Sleep(5 * time.Millisecond)
+	if proposalTxID(alice, args) == txID {
+		t.Error("The nonce was used after its expiry")
+	}
+}
+
+func TestReservedNoncesLimit(t *testing.T) {
+	client := fabricClient.NewClient(nil)
+	client.SetCryptoSuite(bccspFactory.GetDefault())
+	setup := &FabricSetup{Client: client}
+	alice := NewMSPUser(testUser(t, client, "alice"), "Org1MSP")
+	for i := 0; i < maxReservedNonces+10; i++ {
+		if _, err := setup.ComputeTxID("invoke", []string{fmt.Sprint(i)}, WithUser(alice)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(setup.reservedNonces) != maxReservedNonces {
+		t.Errorf("%d nonces kept, want %d", len(setup.reservedNonces), maxReservedNonces)
+	}
+	creator, _ := setup.creatorOf(channelTarget{identity: alice})
+	if setup.takeReservedNonce(creator, []string{"invoke", "0"}) != nil {
+		t.Error("The oldest nonce was kept")
+	}
+	if setup.takeReservedNonce(creator, []string{"invoke", fmt.Sprint(maxReservedNonces + 9)}) == nil {
+		t.Error("The newest nonce was forgotten")
+	}
+}
+
+func TestQueryAllPeersKeepsReservedNonce(t *testing.T) {
+	if _, _, err := (&FabricSetup{}).QueryAllPeers("invoke", []string{"query", "hello"}); err == nil {
+		t.Error("A setup not initialized was queried")
+	}
+
+	answered := make(chan struct{})
+	close(answered)
+	setup, _ := newInvokeSetup(t, &mspEndorser{mspID: "Org1MSP", answer: answered})
+	args := []string{"invoke", "hello", "world"}
+	txID, err := setup.ComputeTxID("invoke", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _, err := setup.QueryAllPeers("invoke", args)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Got %v, %v", results, err)
+	}
+	invokeTxID, err := setup.InvokeWith(context.Background(), "invoke", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invokeTxID != txID {
+		t.Errorf("The invoke has the transaction ID %s, want the one computed %s", invokeTxID, txID)
+	}
+}
+
+// mspEndorser endorses every proposal as a peer of the MSP once answer is closed, the request being cancelled meanwhile
+type mspEndorser struct {
+	mspID		string
+	answer		<-chan struct{}
+	received	chan struct{}	// Closed when the proposal is received, if set
+	cancelled	chan struct{}	// Closed when the proposal is cancelled, if set
+}
+
+func (e *mspEndorser) ProcessProposal(ctx context.Context, proposal *pb.SignedProposal) (*pb.ProposalResponse, error) {
+	if e.received != nil {
+		close(e.received)
+	}
+	select {
+	case <-e.answer:
+	case <-ctx.Done():
+		if e.cancelled != nil {
+			close(e.cancelled)
+		}
+		return nil, ctx.Err()
+	}
+	return &pb.ProposalResponse{Response: &pb.Response{Status: 200}, Endorsement: endorsedBy(e.mspID, e.mspID).ProposalResponse.Endorsement}, nil
+}
+
+func TestSendProposalUntilPolicy(t *testing.T) {
+	setup := &FabricSetup{Logger: NoopLogger{}, EndorseUntilPolicy: true}
+	proposal := &api.TransactionProposal{TransactionID: "tx", SignedProposal: &pb.SignedProposal{}}
+	targets := func(endorsers ...*mspEndorser) []api.Peer {
+		var peers []api.Peer
+		for _, endorser := range endorsers {
+			server, address := serveEndorser(t, endorser)
+			t.Cleanup(server.Stop)
+			target, err := newEndorserPeer(address, setup.newEndorser(address, insecureDial), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			peers = append(peers, target)
+		}
+		return peers
+	}
+	answered := make(chan struct{})
+	close(answered)
+
+	// The endorsement of Org1MSP, given once the peer of Org2MSP has the proposal, is enough:
+	// the proposal to the peer of Org2MSP, which never answers, is cancelled
+	setup.EndorsementPolicy = "OR('Org1MSP.member','Org2MSP.member')"
+	slow := &mspEndorser{mspID: "Org2MSP", received: make(chan struct{}), cancelled: make(chan struct{})}
+	peers := targets(&mspEndorser{mspID: "Org1MSP", answer: slow.received}, slow)
+	responses, err := setup.sendProposal(proposal, peers, noopSpan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 || responses[0].Endorser != peers[0].URL() {
+		t.Errorf("Got %d endorsements, want the one of the peer of Org1MSP", len(responses))
+	}
+	select {
+	case <-slow.cancelled:
+	case <-time.After(10 * time.Second):
+		t.Error("The proposal to the peer of Org2MSP wasn't cancelled")
+	}
+
+	// Both organisations must endorse
+	setup.EndorsementPolicy = "AND('Org1MSP.member','Org2MSP.member')"
+	peers = targets(&mspEndorser{mspID: "Org1MSP", answer: answered}, &mspEndorser{mspID: "Org2MSP", answer: answered})
+	if responses, err := setup.sendProposal(proposal, peers, noopSpan{}); err != nil || len(responses) != 2 {
+		t.Errorf("Got %d endorsements, %v, want both", len(responses), err)
+	}
+}
+
+func TestAwaitCommitEndorsers(t *testing.T) {
+	setup := &FabricSetup{Logger: NoopLogger{}}
+	committed := make(chan *CommitStatus, 1)
+	committed <- &CommitStatus{TxID: "tx", BlockNumber: 4}
+	status, err := setup.awaitCommit(&pendingTx{txID: "tx", endorsingPeers: []string{"peer0:7051", "peer1:8051"}, committed: committed, logger: NoopLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Endorsers) != 2 || status.Endorsers[0] != "peer0:7051" {
+		t.Errorf("Endorsers %v, want the ones of the transaction", status.Endorsers)
+	}
+}
@@ -3,9 +3,58 @@ package blockchain
 import (
 	fcutil "github.com/hyperledger/fabric-sdk-go/pkg/util"
 	api "github.com/hyperledger/fabric-sdk-go/api"
+	"bytes"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
 )
 
+const (
+	defaultLaunchRetries	= 5
+	defaultLaunchRetryDelay	= 500 * time.Millisecond
+)
+
+// queryOn calls the function of the chaincode of the target channel on the endorsing peers of this channel
+func (setup *FabricSetup) queryOn(target channelTarget, function string, args []string) (_ []byte, err error) {
+	if !setup.Initialized {
+		return nil, fmt.Errorf("Unable to query the chaincode: the setup is not initialized")
+	}
+
+	span := setup.startTargetSpan(target, "Query")
+	defer func() { endSpan(span, err) }()
+	defer func(start time.Time) { setup.observeOperation("Query", start, err) }(time.Now())
+	defer func(start time.Time) {
+		setup.audit("Query", target, append([]string{function}, args...), start, func(*AuditRecord) {}, err)
+	}(time.Now())
+
+	payload, cacheKey, generation := setup.cachedQuery(target, append([]string{function}, args...))
+	if payload != nil {
+		return payload, nil
+	}
+
+	responses, err := setup.queryAs(target, append([]string{function}, args...), span)
+	if err != nil {
+		return nil, fmt.Errorf("Query of %s return error: %w", function, ledgerError("", err))
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("No peer answered the query of %s", function)
+	}
+
+	// A peer behind the others (or with a non-deterministic chaincode) answers something else
+	payload = responses[0].ProposalResponse.GetResponse().Payload
+	for _, response := range responses[1:] {
+		if !bytes.Equal(payload, response.ProposalResponse.GetResponse().Payload) {
+			return nil, fmt.Errorf("The peers returned different payloads for the query of %s", function)
+		}
+	}
+
+	setup.cacheQuery(target, cacheKey, generation, responses[0])
+	return payload, nil
+}
+
 // QueryHello query the chaincode to get state of hello
 func (setup *FabricSetup) QueryHello() (string, error) {
 
@@ -16,16 +65,149 @@ func (setup *FabricSetup) QueryHello() (string, error) {
 	args = append(args, "hello")
 
 	// Make the proposal and submit it to the network (via out primary peer)
-	transactionProposalResponses, _, err := fcutil.CreateAndSendTransactionProposal(
-		setup.Channel,
-		setup.ChaincodeId,
-		setup.ChannelId,
-		args,
-		[]api.Peer{setup.Channel.GetPrimaryPeer()},	// Peer contacted when submitted the proposal
-		nil,
-	)
+	payload, err := setup.query(args)
+	if err != nil {
+		return "", fmt.Errorf("Create and send transaction proposal return error in the query hello: %w", err)
+	}
+	return string(payload), nil
+}
+
+// query sends the query proposal to the primary peer and returns its payload.
+// A peer answering that the chaincode is still launching (cold peer after a deploy)
+// is retried after a short delay, up to LaunchRetries times.
+func (setup *FabricSetup) query(args []string) (payload []byte, err error) {
+	span := setup.startSpan("Query")
+	span.SetAttribute(AttributePeer, setup.Channel.GetPrimaryPeer().URL())
+	defer func() { endSpan(span, err) }()
+
+	args, err = setup.serializeArgs(args)
 	if err != nil {
-		return "", fmt.Errorf("Create and send transaction proposal return error in the query hello: %v", err)
+		return nil, err
+	}
+
+	retries, delay := setup.launchRetries()
+	for attempt := 0; ; attempt++ {
+		transactionProposalResponses, txID, err := fcutil.CreateAndSendTransactionProposal(
+			setup.Channel,
+			setup.ChaincodeId,
+			setup.ChannelId,
+			args,
+			[]api.Peer{setup.Channel.GetPrimaryPeer()},	// Peer contacted when submitted the proposal
+			nil,
+		)
+		if err == nil {
+			return transactionProposalResponses[0].ProposalResponse.GetResponse().Payload, nil
+		}
+
+		// Only the launch of the chaincode is transient, other errors (like not found) are returned as is
+		if !isChaincodeLaunching(err) || attempt >= retries {
+			return nil, ledgerError(txID, err)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// launchRetries returns the retries of a query while the chaincode is launching, and the delay between them
+func (setup *FabricSetup) launchRetries() (int, time.Duration) {
+	retries := setup.LaunchRetries
+	if retries == 0 {
+		retries = defaultLaunchRetries
+	}
+	delay := setup.LaunchRetryDelay
+	if delay == 0 {
+		delay = defaultLaunchRetryDelay
+	}
+	return retries, delay
+}
+
+// isChaincodeLaunching tells if the error comes from a chaincode that is not started yet on the peer
+func isChaincodeLaunching(err error) bool {
+	return strings.Contains(err.Error(), "chaincode is already launching")
+}
+
+// PeerQueryResult is the answer of one peer to a query
+type PeerQueryResult struct {
+	Peer			string
+	Payload			[]byte
+	LedgerHeight	uint64	// Height of the ledger of the peer when it was queried, 0 if unknown
+	Error			string	// Why the peer didn't answer, the payload is empty
+}
+
+// QueryAllPeers sends the same query to every peer of the channel and returns the answer of each of them,
+// with the height of its ledger. The flag tells whether every peer that answered returned the same payload:
+// when they disagree, the caller can pick the answer of the peer with the highest ledger height.
+func (setup *FabricSetup) QueryAllPeers(function string, args []string) (results []PeerQueryResult, agree bool, err error) {
+	if !setup.Initialized {
+		return nil, false, fmt.Errorf("Unable to query the chaincode: the setup is not initialized")
+	}
+	setup.userMutex.RLock()
+	defer setup.userMutex.RUnlock()
+	span := setup.startSpan("QueryAllPeers")
+	defer func() { endSpan(span, err) }()
+
+	// The same proposal is sent to every peer, so their answers are comparable.
+	// It is a query: the nonce reserved by ComputeTxID for these arguments is left to their invoke.
+	proposal, err := setup.createUnreservedProposalOn(setup.primaryTarget(), append([]string{function}, args...), nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("Create transaction proposal in the query of all peers return error: %v", err)
+	}
+	span.SetAttribute(AttributeTxID, proposal.TransactionID)
+
+	peers := setup.Channel.GetPeers()
+	results = make([]PeerQueryResult, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(result *PeerQueryResult, peer api.Peer) {
+			defer wg.Done()
+			result.Peer = peer.URL()
+			if height, err := setup.ledgerHeight(peer); err == nil {
+				result.LedgerHeight = height
+			}
+			response, err := peer.SendProposal(proposal)
+			if err != nil {
+				result.Error = err.Error()
+				return
+			}
+			if status := response.ProposalResponse.GetResponse().GetStatus(); status != 200 {
+				result.Error = fmt.Sprintf("Status %d: %s", status, response.ProposalResponse.GetResponse().GetMessage())
+				return
+			}
+			result.Payload = response.ProposalResponse.GetResponse().Payload
+		}(&results[i], peer)
+	}
+	wg.Wait()
+
+	// Compare the payloads of the peers that answered
+	agree = true
+	var reference []byte
+	answered := 0
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		if answered > 0 && !bytes.Equal(reference, result.Payload) {
+			agree = false
+		}
+		reference = result.Payload
+		answered++
+	}
+	if answered == 0 {
+		return results, false, fmt.Errorf("No peer answered the query")
+	}
+
+	return results, agree, nil
+}
+
+// ledgerHeight queries the peer (qscc GetChainInfo) to get the height of its ledger
+func (setup *FabricSetup) ledgerHeight(peer api.Peer) (uint64, error) {
+	payloads, err := setup.Channel.QueryByChaincode("qscc", []string{"GetChainInfo", setup.ChannelId}, []api.Peer{peer})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to query the chain info of the peer %s: %v", peer.URL(), err)
+	}
+	info := &common.BlockchainInfo{}
+	if err := proto.Unmarshal(payloads[0], info); err != nil {
+		return 0, fmt.Errorf("Unable to unmarshal the chain info of the peer %s: %v", peer.URL(), err)
 	}
-	return string(transactionProposalResponses[0].ProposalResponse.GetResponse().Payload), nil
-}
\ No newline at end of file
+	return info.Height, nil
+}
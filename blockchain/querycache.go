@@ -0,0 +1,205 @@
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/ledger/rwset"
+	"github.com/hyperledger/fabric/protos/ledger/rwset/kvrwset"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// queryCache keeps the payloads of the last QueryCacheSize queries, by channel, chaincode, caller and arguments.
+// An entry depends on the keys read by the chaincode to answer, the read set of the endorsement: it is removed
+// when a valid transaction of a block writes one of them. A rich or range query doesn't record every key it reads,
+// its entry is removed by any write in the namespace of the chaincode.
+type queryCache struct {
+	mutex		sync.Mutex
+	entries		map[string]*list.Element
+	recent		*list.List	// Of *queryCacheEntry, the most recently used first
+	generation	uint64		// Incremented by each invalidation, a query answered before isn't kept
+}
+
+type queryCacheEntry struct {
+	key			string
+	channelID	string
+	payload		[]byte
+	keys		map[string]bool	// Keys read, see stateKey
+	namespaces	map[string]bool	// Namespaces read as a whole
+}
+
+// stateKey identifies a key of the world state across the chaincodes
+func stateKey(namespace string, key string) string {
+	return namespace + "\x00" + key
+}
+
+// cachedQuery returns the payload of the query in the cache, if any. On a miss, it returns the key and
+// the generation to give to cacheQuery, no key when the cache is disabled.
+func (setup *FabricSetup) cachedQuery(target channelTarget, args []string) ([]byte, string, uint64) {
+	// The transient data isn't part of the key
+	if setup.QueryCacheSize <= 0 || setup.EventHub == nil || target.transientMap != nil {
+		return nil, "", 0
+	}
+	// The blocks are missed while the event hub is disconnected, see eventSupervisor
+	if !setup.EventHub.IsConnected() {
+		setup.queryCache.clear()
+		return nil, "", 0
+	}
+	identity := target.identity
+	if identity == nil {
+		identity = setup.Client.GetUserContext()
+	}
+	var identityName string
+	if identity != nil {
+		identityName = identity.GetName()
+	}
+	key := strings.Join([]string{target.channelID, target.chaincodeID, identityName, hashArgs(args)}, "\x00")
+
+	cache := &setup.queryCache
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.entries[key]; ok {
+		cache.recent.MoveToFront(element)
+		return append([]byte(nil), element.Value.(*queryCacheEntry).payload...), "", 0
+	}
+	return nil, key, cache.generation
+}
+
+// cacheQuery keeps the payload of the query answered by the response, unless a block invalidated the cache
+// since the lookup. The least recently used entry is removed beyond QueryCacheSize.
+func (setup *FabricSetup) cacheQuery(target channelTarget, key string, generation uint64, response *api.TransactionProposalResponse) {
+	if key == "" {
+		return
+	}
+	entry := &queryCacheEntry{
+		key:		key,
+		channelID:	target.channelID,
+		payload:	response.ProposalResponse.GetResponse().Payload,
+		keys:		make(map[string]bool),
+		namespaces:	make(map[string]bool),
+	}
+	if err := readDependencies(response, target.chaincodeID, entry); err != nil {
+		WithFields(setup.targetLogger(target), Fields{FieldPeer: response.Endorser}).Debugf("Query not cached: %v", err)
+		return
+	}
+
+	cache := &setup.queryCache
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.generation != generation {
+		return
+	}
+	if cache.entries == nil {
+		cache.entries = make(map[string]*list.Element)
+		cache.recent = list.New()
+	}
+	if element, ok := cache.entries[key]; ok {
+		cache.recent.Remove(element)
+	}
+	cache.entries[key] = cache.recent.PushFront(entry)
+	for cache.recent.Len() > setup.QueryCacheSize {
+		cache.removeElement(cache.recent.Back())
+	}
+}
+
+// readDependencies fills the keys and namespaces the query depends on from the read set of its endorsement
+func readDependencies(response *api.TransactionProposalResponse, chaincodeID string, entry *queryCacheEntry) error {
+	responsePayload, err := protosUtils.GetProposalResponsePayload(response.ProposalResponse.Payload)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal the proposal response payload: %v", err)
+	}
+	action, err := protosUtils.GetChaincodeAction(responsePayload.Extension)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal the chaincode action: %v", err)
+	}
+	txRwSet := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(action.Results, txRwSet); err != nil {
+		return fmt.Errorf("Unable to unmarshal the read/write set: %v", err)
+	}
+
+	readsChaincode := false
+	for _, nsRwSet := range txRwSet.NsRwset {
+		kvRwSet := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(nsRwSet.Rwset, kvRwSet); err != nil {
+			return fmt.Errorf("Unable to unmarshal the read/write set of %s: %v", nsRwSet.Namespace, err)
+		}
+		if len(kvRwSet.RangeQueriesInfo) > 0 {
+			entry.namespaces[nsRwSet.Namespace] = true
+		}
+		for _, read := range kvRwSet.Reads {
+			entry.keys[stateKey(nsRwSet.Namespace, read.Key)] = true
+			readsChaincode = readsChaincode || nsRwSet.Namespace == chaincodeID
+		}
+	}
+	// The keys of a rich query aren't in the read set
+	if !readsChaincode {
+		entry.namespaces[chaincodeID] = true
+	}
+	return nil
+}
+
+// invalidateQueryCache is the block callback of the event hub removing the entries of the cache
+// read by the valid transactions of the block
+func (setup *FabricSetup) invalidateQueryCache(block *common.Block) {
+	decoded, err := decodeBlock(block)
+	if err != nil {
+		// The keys written are unknown
+		setup.logger().Errorf("Unable to decode the block for the query cache, the cache is cleared: %v", err)
+		setup.queryCache.clear()
+		return
+	}
+
+	cache := &setup.queryCache
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, transaction := range decoded.Transactions {
+		if transaction.ValidationCode != pb.TxValidationCode_VALID.String() || len(transaction.Writes) == 0 {
+			continue
+		}
+		cache.generation++
+		for _, element := range cache.elements() {
+			entry := element.Value.(*queryCacheEntry)
+			if entry.channelID != transaction.ChannelID {
+				continue
+			}
+			for _, write := range transaction.Writes {
+				if entry.namespaces[write.Namespace] || entry.keys[stateKey(write.Namespace, write.Key)] {
+					cache.removeElement(element)
+					break
+				}
+			}
+		}
+	}
+}
+
+// elements returns the elements of the cache, the mutex being held
+func (cache *queryCache) elements() []*list.Element {
+	if cache.recent == nil {
+		return nil
+	}
+	elements := make([]*list.Element, 0, cache.recent.Len())
+	for element := cache.recent.Front(); element != nil; element = element.Next() {
+		elements = append(elements, element)
+	}
+	return elements
+}
+
+// removeElement removes the entry of the element, the mutex being held
+func (cache *queryCache) removeElement(element *list.Element) {
+	cache.recent.Remove(element)
+	delete(cache.entries, element.Value.(*queryCacheEntry).key)
+}
+
+// clear removes every entry
+func (cache *queryCache) clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.generation++
+	cache.entries = nil
+	cache.recent = nil
+}
@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	defaultConnectRetries		= 3
+	defaultRetryInterval		= time.Second
+	defaultConflictRetries		= 3
+	defaultConflictRetryDelay	= 100 * time.Millisecond
+)
+
+// Validation codes of a transaction in conflict with a concurrent one, executed again by default
+var defaultRetryableCodes = []pb.TxValidationCode{
+	pb.TxValidationCode_MVCC_READ_CONFLICT,
+	pb.TxValidationCode_PHANTOM_READ_CONFLICT,
+}
+
+// Messages of the gRPC and network errors raised while a peer or the orderer is not ready
+var connectionErrors = []string{
+	"connection refused",
+	"no such host",
+	"transport is closing",
+	"timed out when dialing",
+	"code = Unavailable",
+	"Unable to connect to the peer",
+}
+
+// isConnectionError tells if the error comes from a peer or an orderer that can't be reached.
+// The errors of the endorsement or the validation are not connection errors.
+func isConnectionError(err error) bool {
+	var unreachable *PeerUnreachableError
+	if errors.As(err, &unreachable) {
+		return true
+	}
+	for _, message := range connectionErrors {
+		if strings.Contains(err.Error(), message) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry calls the step again while it fails with a connection error, up to ConnectRetries times,
+// waiting RetryInterval before the first retry and doubling the wait at each one.
+// Once the context is done (cancelled by the caller, or its deadline exceeded), the step isn't called again.
+func (setup *FabricSetup) retry(ctx context.Context, step string, call func() error) error {
+	retries := setup.ConnectRetries
+	if retries == 0 {
+		retries = defaultConnectRetries
+	}
+	interval := setup.RetryInterval
+	if interval == 0 {
+		interval = defaultRetryInterval
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || !isConnectionError(err) || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		wait := interval << uint(attempt)
+		setup.logger().Printf("%s failed (%v), retry %d/%d in %v", step, err, attempt+1, retries, wait)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryConflicts executes the invoke again while it fails because of a concurrent transaction, up to ConflictRetries
+// times, waiting ConflictRetryDelay before the first execution again and doubling the wait at each one.
+// Each execution is a new transaction, with a new ID.
+func (setup *FabricSetup) retryConflicts(logger Logger, invoke func() error) error {
+	retries := setup.ConflictRetries
+	if retries == 0 {
+		retries = defaultConflictRetries
+	}
+	delay := setup.ConflictRetryDelay
+	if delay == 0 {
+		delay = defaultConflictRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := invoke()
+		if err == nil || !setup.isConflict(err) || attempt >= retries {
+			return err
+		}
+		wait := delay << uint(attempt)
+		logger.Printf("Transaction in conflict (%v), execution again %d/%d in %v", err, attempt+1, retries, wait)
+		time.Sleep(wait)
+	}
+}
+
+// isConflict tells if the invoke failed because of a concurrent transaction: its transaction is invalidated
+// with one of RetryableCodes, or its endorsements disagree
+func (setup *FabricSetup) isConflict(err error) bool {
+	var mismatch *EndorsementMismatchError
+	if errors.As(err, &mismatch) {
+		return true
+	}
+	code, ok := validationCode(err)
+	if !ok {
+		return false
+	}
+	codes := setup.RetryableCodes
+	if codes == nil {
+		codes = defaultRetryableCodes
+	}
+	for _, retryable := range codes {
+		if code == retryable {
+			return true
+		}
+	}
+	return false
+}
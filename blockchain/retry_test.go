@@ -0,0 +1,67 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryUntilSuccess(t *testing.T) {
+	setup := &FabricSetup{RetryInterval: time.Millisecond, Logger: NoopLogger{}}
+	calls := 0
+	err := setup.retry(context.Background(), "Step", func() error {
+		calls++
+		if calls <= 2 {
+			return errors.New("dial tcp 127.0.0.1:7051: connection refused")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Got %v after %d calls, want success after 3", err, calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	refused := errors.New("connection refused")
+	tests := []struct {
+		name	string
+		setup	*FabricSetup
+		ctx		func() context.Context
+		err		error
+		calls	int
+	}{
+		{"retries exhausted", &FabricSetup{ConnectRetries: 2}, context.Background, refused, 3},
+		{"retries disabled", &FabricSetup{ConnectRetries: -1}, context.Background, refused, 1},
+		{"not a connection error", &FabricSetup{}, context.Background, errors.New("chaincode error"), 1},
+		{"deadline of the caller", &FabricSetup{}, context.Background, context.DeadlineExceeded, 1},
+		{"context cancelled", &FabricSetup{}, func() context.Context {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx
+		}, refused, 1},
+	}
+	for _, test := range tests {
+		test.setup.RetryInterval = time.Millisecond
+		test.setup.Logger = NoopLogger{}
+		calls := 0
+		err := test.setup.retry(test.ctx(), "Step", func() error {
+			calls++
+			return test.err
+		})
+		if err != test.err || calls != test.calls {
+			t.Errorf("%s: got %v after %d calls, want %v after %d", test.name, err, calls, test.err, test.calls)
+		}
+	}
+}
+
+func TestRetryStopsWaitingWhenCancelled(t *testing.T) {
+	setup := &FabricSetup{RetryInterval: time.Hour, Logger: NoopLogger{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	setup.retry(ctx, "Step", func() error { return errors.New("connection refused") })
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("The retry waited %v after the context was done", elapsed)
+	}
+}
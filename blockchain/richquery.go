@@ -0,0 +1,43 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// RichQueryPage is a page of the records matching a rich query
+type RichQueryPage struct {
+	Records		[]RichQueryRecord	`json:"records"`
+	Bookmark	string				`json:"bookmark"`	// Gives the next page to QueryRich, empty on the last page
+}
+
+// RichQueryRecord is a state matching a rich query, its value is the JSON document stored
+type RichQueryRecord struct {
+	Key		string			`json:"key"`
+	Value	json.RawMessage	`json:"value"`
+}
+
+// QueryRich returns the page of pageSize records matching the CouchDB selector (e.g. {"name":"Batman"}),
+// starting at the bookmark of the previous page, empty for the first one.
+// The peers must use CouchDB as state database, the chaincode runs the query.
+func (setup *FabricSetup) QueryRich(selector string, pageSize int, bookmark string) (*RichQueryPage, error) {
+	var selectorObject map[string]interface{}
+	if err := json.Unmarshal([]byte(selector), &selectorObject); err != nil {
+		return nil, fmt.Errorf("The selector must be a JSON object: %v", err)
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("The page size must be positive, not %d", pageSize)
+	}
+
+	payload, err := setup.QueryWith(context.Background(), "invoke", []string{"query", "rich", selector, strconv.Itoa(pageSize), bookmark})
+	if err != nil {
+		return nil, err
+	}
+	page := &RichQueryPage{}
+	if err := json.Unmarshal(payload, page); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the page of the rich query: %v", err)
+	}
+	return page, nil
+}
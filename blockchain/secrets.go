@@ -0,0 +1,250 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+)
+
+// Names of the secrets read by Initialize from the SecretProvider, each one replacing a setting of the setup
+const (
+	SecretAdminPassword		= "admin-password"		// AdminPassword
+	SecretOrdererAdminCert	= "orderer-admin-cert"	// PEM certificate of the orderer admin, with its key replaces OrdererUserCredentials
+	SecretOrdererAdminKey	= "orderer-admin-key"
+	SecretOrgAdminCert		= "org-admin-cert"		// PEM certificate of the organisation admin, with its key replaces OrgUserCredentials
+	SecretOrgAdminKey		= "org-admin-key"
+	SecretTLSRootCerts		= "tls-root-certs"		// PEM bundle replacing TLSRootCertPath
+	SecretTLSClientCert		= "tls-client-cert"		// PEM client certificate, with its key replaces TLSClientCertPath and TLSClientKeyPath
+	SecretTLSClientKey		= "tls-client-key"
+)
+
+const defaultVaultTimeout = 10 * time.Second
+
+// ErrSecretNotFound is returned by a SecretProvider without the secret, the setting of the setup is used then
+var ErrSecretNotFound = errors.New("Secret not found")
+
+// SecretProvider gives the secrets of the setup by name (see the Secret constants),
+// so nothing sensitive has to be kept in config.yaml or the fixtures
+type SecretProvider interface {
+	Secret(name string) ([]byte, error)
+}
+
+// FileSecretProvider reads each secret from the file of the same name in Dir, e.g. a mounted secret volume
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Secret reads the file of the secret
+func (provider FileSecretProvider) Secret(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(provider.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrSecretNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the secret %s: %v", name, err)
+	}
+	return data, nil
+}
+
+// SecretProviders asks each provider in turn, until one has the secret
+type SecretProviders []SecretProvider
+
+// Secret returns the secret of the first provider having it
+func (providers SecretProviders) Secret(name string) ([]byte, error) {
+	for _, provider := range providers {
+		data, err := provider.Secret(name)
+		if err != ErrSecretNotFound {
+			return data, err
+		}
+	}
+	return nil, ErrSecretNotFound
+}
+
+// VaultSecretProvider reads the secrets from the fields of a secret of the key/value engine of HashiCorp Vault,
+// one field per secret name
+type VaultSecretProvider struct {
+	Address		string			// Address of the Vault server, e.g. https://vault:8200
+	Token		string			// Token allowed to read the secret
+	Mount		string			// Mount path of the key/value engine, "secret" when not set
+	Path		string			// Path of the secret in the engine, e.g. heroes-service
+	KVVersion	int				// Version of the key/value engine, 2 when not set
+	Client		*http.Client	// Client of the Vault API, with a 10s timeout when not set
+}
+
+// Secret reads the field of the secret
+func (provider VaultSecretProvider) Secret(name string) ([]byte, error) {
+	mount := provider.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s", strings.TrimSuffix(provider.Address, "/"), mount, provider.Path)
+	if provider.KVVersion != 1 {
+		url = fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(provider.Address, "/"), mount, provider.Path)
+	}
+	client := provider.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultVaultTimeout}
+	}
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Vault-Token", provider.Token)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the secret %s from Vault: %v", name, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrSecretNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to read the secret %s from Vault: status %d", name, response.StatusCode)
+	}
+
+	// The fields are in data with the version 1 of the engine, in data.data with the version 2
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Invalid Vault response: %v", err)
+	}
+	fields := body.Data
+	if provider.KVVersion != 1 {
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(body.Data, &versioned); err != nil {
+			return nil, fmt.Errorf("Invalid Vault response: %v", err)
+		}
+		fields = versioned.Data
+	}
+	var values map[string]string
+	if err := json.Unmarshal(fields, &values); err != nil {
+		return nil, fmt.Errorf("Invalid Vault secret %s: the fields must be strings", provider.Path)
+	}
+	value, ok := values[name]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	return []byte(value), nil
+}
+
+// secret returns the secret of the SecretProvider, nil when there is no provider or it hasn't the secret
+func (setup *FabricSetup) secret(name string) ([]byte, error) {
+	if setup.SecretProvider == nil {
+		return nil, nil
+	}
+	data, err := setup.SecretProvider.Secret(name)
+	if err == ErrSecretNotFound {
+		return nil, nil
+	}
+	return data, err
+}
+
+// adminPassword returns the enrollment secret of the admin, from the SecretProvider or AdminPassword
+func (setup *FabricSetup) adminPassword() (string, error) {
+	password, err := setup.secret(SecretAdminPassword)
+	if err != nil || password == nil {
+		return setup.AdminPassword, err
+	}
+	return strings.TrimSpace(string(password)), nil
+}
+
+// secretUser returns the pre-enrolled user from the certificate and key secrets, nil when the provider hasn't them
+func (setup *FabricSetup) secretUser(client api.FabricClient, name string, certSecret string, keySecret string) (api.User, error) {
+	certData, err := setup.secret(certSecret)
+	if err != nil || certData == nil {
+		return nil, err
+	}
+	keyData, err := setup.secret(keySecret)
+	if err != nil {
+		return nil, err
+	}
+	if keyData == nil {
+		return nil, fmt.Errorf("The secret %s has no key secret %s", certSecret, keySecret)
+	}
+	certBlock := findPEMBlock(certData, "CERTIFICATE")
+	if certBlock == nil {
+		return nil, fmt.Errorf("No PEM certificate found in the secret %s", certSecret)
+	}
+	keyBlock := findPEMBlock(keyData, "PRIVATE KEY")
+	if keyBlock == nil {
+		return nil, fmt.Errorf("No PEM private key found in the secret %s", keySecret)
+	}
+	return importUser(client, name, certBlock, keyBlock)
+}
+
+// rootCertPath returns the CA bundle verifying the peers and the orderers: the file written from the SecretProvider,
+// or TLSRootCertPath
+func (setup *FabricSetup) rootCertPath() string {
+	if setup.secretRootCertPath != "" {
+		return setup.secretRootCertPath
+	}
+	return setup.TLSRootCertPath
+}
+
+// writeSecretRootCerts writes the CA bundle of the SecretProvider, if any, to a file since the SDK reads the
+// certificates from files. The file is replaced at once, so a connection never reads a partial bundle.
+func (setup *FabricSetup) writeSecretRootCerts() ([]byte, error) {
+	rootCerts, err := setup.secret(SecretTLSRootCerts)
+	if err != nil || rootCerts == nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile("", "heroes-tls-root-certs")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to write the TLS root certificates: %v", err)
+	}
+	_, err = file.Write(rootCerts)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && setup.secretRootCertPath != "" {
+		err = os.Rename(file.Name(), setup.secretRootCertPath)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("Unable to write the TLS root certificates: %v", err)
+	}
+	if setup.secretRootCertPath == "" {
+		setup.secretRootCertPath = file.Name()
+	}
+	return rootCerts, nil
+}
+
+// removeSecretRootCerts removes the file written by writeSecretRootCerts
+func (setup *FabricSetup) removeSecretRootCerts() {
+	if setup.secretRootCertPath != "" {
+		os.Remove(setup.secretRootCertPath)
+		setup.secretRootCertPath = ""
+	}
+}
+
+// secretCertificateSource reads the client TLS certificate from the SecretProvider
+type secretCertificateSource struct {
+	setup *FabricSetup
+}
+
+// Certificate reads the certificate and key secrets
+func (source secretCertificateSource) Certificate() ([]byte, []byte, error) {
+	certPEM, err := source.setup.secret(SecretTLSClientCert)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := source.setup.secret(SecretTLSClientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if certPEM == nil || keyPEM == nil {
+		return nil, nil, fmt.Errorf("The secrets %s and %s are required together", SecretTLSClientCert, SecretTLSClientKey)
+	}
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,74 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ArgsSerializer transforms the arguments given to the chaincode function (the function name excluded)
+// before they are put in the proposal
+type ArgsSerializer func(args []string) ([][]byte, error)
+
+// ArgsFraming is a built-in serialization of the chaincode arguments
+type ArgsFraming string
+
+const (
+	// FramingNone sends the arguments as is
+	FramingNone ArgsFraming = ""
+	// FramingLengthPrefixed prefixes each argument with its length, as a 4 bytes big-endian integer
+	FramingLengthPrefixed ArgsFraming = "length-prefixed"
+)
+
+// LengthPrefixed frames each argument as its length (4 bytes, big-endian) followed by its bytes
+func LengthPrefixed(args []string) ([][]byte, error) {
+	framed := make([][]byte, len(args))
+	for i, arg := range args {
+		framed[i] = make([]byte, 4+len(arg))
+		binary.BigEndian.PutUint32(framed[i], uint32(len(arg)))
+		copy(framed[i][4:], arg)
+	}
+	return framed, nil
+}
+
+// DecodeLengthPrefixed reads back an argument framed by LengthPrefixed
+func DecodeLengthPrefixed(framed []byte) ([]byte, error) {
+	if len(framed) < 4 {
+		return nil, fmt.Errorf("Framed argument too short: %d bytes", len(framed))
+	}
+	length := binary.BigEndian.Uint32(framed)
+	if uint64(len(framed)-4) != uint64(length) {
+		return nil, fmt.Errorf("Framed argument length mismatch: prefix %d, got %d bytes", length, len(framed)-4)
+	}
+	return framed[4:], nil
+}
+
+// serializeArgs applies the serializer (or the framing) of the setup to the chaincode arguments.
+// The first argument is the function name, it is never transformed.
+func (setup *FabricSetup) serializeArgs(args []string) ([]string, error) {
+	serializer := setup.ArgsSerializer
+	if serializer == nil {
+		switch setup.ArgsFraming {
+		case FramingNone:
+			return args, nil
+		case FramingLengthPrefixed:
+			serializer = LengthPrefixed
+		default:
+			return nil, fmt.Errorf("Unknown arguments framing: %s", setup.ArgsFraming)
+		}
+	}
+	if len(args) == 0 {
+		return args, nil
+	}
+
+	serialized, err := serializer(args[1:])
+	if err != nil {
+		return nil, &ArgumentError{Cause: err}
+	}
+
+	// The SDK takes the arguments as strings, which can hold any byte
+	result := []string{args[0]}
+	for _, arg := range serialized {
+		result = append(result, string(arg))
+	}
+	return result, nil
+}
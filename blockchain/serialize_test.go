@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestLengthPrefixedRoundTrip(t *testing.T) {
+	tests := []struct {
+		name	string
+		args	[]string
+	}{
+		{"no argument", nil},
+		{"empty", []string{""}},
+		{"binary", []string{"\x00\x01\xff\xfe\x00"}},
+		{"several", []string{"hero", "", "a longer argument with spaces", "\x00"}},
+	}
+	for _, test := range tests {
+		framed, err := LengthPrefixed(test.args)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(framed) != len(test.args) {
+			t.Fatalf("%s: %d framed arguments, want %d", test.name, len(framed), len(test.args))
+		}
+		for i, arg := range framed {
+			decoded, err := DecodeLengthPrefixed(arg)
+			if err != nil {
+				t.Errorf("%s: argument %d: %v", test.name, i, err)
+			} else if !bytes.Equal(decoded, []byte(test.args[i])) {
+				t.Errorf("%s: argument %d decoded to %q, want %q", test.name, i, decoded, test.args[i])
+			}
+		}
+	}
+}
+
+func TestDecodeLengthPrefixedErrors(t *testing.T) {
+	tests := []struct {
+		name	string
+		framed	[]byte
+	}{
+		{"nothing", nil},
+		{"truncated prefix", []byte{0, 0, 1}},
+		{"truncated argument", []byte{0, 0, 0, 3, 'a', 'b'}},
+		{"trailing bytes", []byte{0, 0, 0, 1, 'a', 'b'}},
+		{"huge length", []byte{0xff, 0xff, 0xff, 0xff, 'a'}},
+	}
+	for _, test := range tests {
+		if decoded, err := DecodeLengthPrefixed(test.framed); err == nil {
+			t.Errorf("%s: decoded to %q, want an error", test.name, decoded)
+		}
+	}
+}
+
+func TestSerializeArgs(t *testing.T) {
+	setup := &FabricSetup{ArgsFraming: FramingLengthPrefixed}
+	args, err := setup.serializeArgs([]string{"invoke", "hero"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 || args[0] != "invoke" || args[1] != "\x00\x00\x00\x04hero" {
+		t.Errorf("Got %q, want the function name as is and the argument framed", args)
+	}
+
+	setup.ArgsSerializer = func(args []string) ([][]byte, error) { return nil, errors.New("too long") }
+	var invalid *ArgumentError
+	if _, err := setup.serializeArgs([]string{"invoke", "hero"}); !errors.As(err, &invalid) {
+		t.Errorf("Got %v, want an ArgumentError", err)
+	}
+
+	setup.ArgsSerializer = nil
+	setup.ArgsFraming = "unknown"
+	if _, err := setup.serializeArgs([]string{"invoke"}); err == nil {
+		t.Error("An unknown framing was accepted")
+	}
+}
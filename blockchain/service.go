@@ -0,0 +1,29 @@
+package blockchain
+
+import (
+	"context"
+)
+
+// ChainService is the chaincode operations used by the web application, implemented by FabricSetup
+// and by the in-memory ledger of the mocks package, so the layers above can run without a Fabric network
+type ChainService interface {
+	// IsInitialized tells if the operations can be called
+	IsInitialized() bool
+	// Traced under the span of the context (e.g. of the HTTP request) and giving up when it is done
+	QueryWith(ctx context.Context, function string, args []string, options ...CallOption) ([]byte, error)
+	InvokeWith(ctx context.Context, function string, args []string, options ...CallOption) (string, error)
+	QueryHello() (string, error)
+	InvokeHello(value string) (string, error)
+	QueryRich(selector string, pageSize int, bookmark string) (*RichQueryPage, error)
+	GetHistory(key string) ([]KeyModification, error)
+	Health(ctx context.Context) *HealthReport
+	RegisterChaincodeEvent(eventName string, handler func(ccID string, txID string, payload []byte)) (Registration, error)
+	Close() error
+}
+
+var _ ChainService = (*FabricSetup)(nil)
+
+// IsInitialized tells if Initialize succeeded and the setup is not closed
+func (setup *FabricSetup) IsInitialized() bool {
+	return setup.Initialized
+}
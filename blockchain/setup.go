@@ -6,8 +6,14 @@ import (
 	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
 	fcutil "github.com/hyperledger/fabric-sdk-go/pkg/util"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/events"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 // FabricSetup Implementation
@@ -20,47 +26,549 @@ type FabricSetup struct {
 	ChannelConfig		string
 	ChaincodeId			string
 	ChaincodeVersion	string
-	ChaincodeGoPath		string
-	ChaincodePath 		string
+	ChaincodeGoPath		string	// Only needed by a Go chaincode
+	ChaincodePath 		string	// Package path of a Go chaincode in the GOPATH, directory of the chaincode in another language
+	ChaincodeLang		ChaincodeLang	// Go when not set
+
+	// Version of Fabric run by the peers, the orderer and the CA, e.g. "2.4", the "1.0" of the fixtures when not set.
+	// The features of a later version are refused until the network is upgraded, see "Upgrading the network" in README.md.
+	FabricVersion	string
+
+	// Deployment of the chaincode: the instantiate of Fabric 1.x when not set, or the lifecycle of Fabric 2.x
+	// (LifecycleV2, experimental, Fabric 2.0 at least) approving and committing a definition of the chaincode, see defineOn
+	ChaincodeLifecycle	ChaincodeLifecycle
+
+	// Address the peers dial to reach the chaincode run as an external service (chaincode-as-a-service),
+	// e.g. "heroes-chaincode:9999", in plaintext. The package installed then only holds this address, the chaincode
+	// isn't built by the peer (see chaincode/server.go). Needs LifecycleV2 and Fabric 2.4 for the ccaas builder.
+	ChaincodeAddress	string
+
+	// Development mode: the proposals are executed by the chaincode served at DevModeAddress ("localhost:9999"
+	// when not set) by "go run -tags devmode ./chaincode", on the mock stub of the shim (see chaincode/devserver.go).
+	// Initialize then connects to no peer, orderer nor CA, and InstallAndInstantiateCC does nothing.
+	DevMode			bool
+	DevModeAddress	string
+
+	// Chaincode used on each channel added with AddChannel, the chaincode of the primary channel by default
+	ChannelChaincodes	map[string]ChannelChaincode
+
+	// Create and join the channel during the initialization. When false (client-only mode),
+	// the peers are expected to have already joined the channel.
+	JoinChannel					bool
+	// Only create the channel and join the peers not joined yet, so the initialization succeeds
+	// on a network already set up. When false, the channel is created unless the primary peer has joined it.
+	CreateChannelIfMissing		bool
+	// Don't check that the peers have joined the channel in client-only mode
+	SkipChannelMembershipCheck	bool
+
+	// Endorsement policy of the chaincode set by the instantiate and the upgrade, in the Fabric policy syntax
+	// (e.g. "OR('Org1MSP.member','Org2MSP.member')"). Any member of the organisation when not set.
+	EndorsementPolicy	string
+	EndorsementRule		*EndorsementRule	// The same policy as a structure, taking precedence over EndorsementPolicy
+
+	// Arguments given to the Init function of the chaincode by the instantiate and the upgrade,
+	// when none are given to InstallAndInstantiateCC or UpgradeCC: the function name first, then its
+	// arguments, each sent as the bytes of the string. ["init"] when not set.
+	ChaincodeInitArgs	[]string
+
+	// Private data collections of the chaincode, set by the instantiate and the upgrade (Fabric 1.1 at least).
+	// CollectionsConfigFile is read when Collections is not set, see LoadCollections.
+	Collections				[]CollectionConfig
+	CollectionsConfigFile	string
+
+	// Glob patterns of the files and directories left out of the chaincode package,
+	// matched against the base name and the path relative to the chaincode directory.
+	// Defaults to excluding the "*_test.go" files.
+	ExcludePatterns	[]string
+
+	// Network parameters, the defaults are applied when not set
+	ConfigFile				string	// SDK configuration file, "config.yaml" by default
+	AdminUser				string	// User enrolled with the Fabric CA, "admin" by default
+	AdminPassword			string	// Its enrollment secret, "adminpw" by default
+	OrdererAdminCertPath	string	// MSP directory (holding keystore and signcerts) of the orderer admin, relative to the crypto config path
+	OrgAdminCertPath		string	// MSP directory (holding keystore and signcerts) of the organisation admin, relative to the crypto config path
+
+	// Pre-enrolled admins read from the crypto config, for a layout not following the admin MSP directories above.
+	// The key and certificate paths are relative to the crypto config path, <AdminCertPath>/keystore and
+	// <AdminCertPath>/signcerts by default.
+	OrdererKeystorePath		string
+	OrdererSignCertPath		string
+	OrdererUserName			string	// "ordererAdmin" by default
+	OrgKeystorePath			string
+	OrgSignCertPath			string
+	OrgUserName				string	// "peerorg1Admin" by default
+
+	// Other organisations of the network, whose peers endorse the proposals too.
+	// The channel is then joined as with CreateChannelIfMissing.
+	Organizations		[]Organization
+
+	// TLS of the peer, orderer and event hub connections, overriding config.yaml
+	TLSEnabled			bool	// Plaintext connections when false, true by NewFabricSetup
+	TLSRootCertPath		string	// CA bundle verifying every peer and the orderer, the certificates of config.yaml when not set
+
+	// Client certificate presented to the peers and the orderers (mutual TLS), none when not set.
+	// TLSClientCertSource, e.g. a secret store, replaces the files TLSClientCertPath and TLSClientKeyPath.
+	// The certificates are read again every TLSReloadInterval (1 minute when not set, negative to disable),
+	// see ReloadTLSCertificates. The SDK event hub can't present a client certificate.
+	TLSClientCertPath	string
+	TLSClientKeyPath	string
+	TLSClientCertSource	CertificateSource
+	TLSReloadInterval	time.Duration
+
+	// Source of the admin password, the pre-enrolled admins and the TLS certificates, replacing the settings
+	// above for the secrets it has, see the Secret constants
+	SecretProvider		SecretProvider
+
+	// Keeps a record of every Invoke and Query (caller, function, hash of the arguments, transaction ID,
+	// endorsers and validation code), none when not set
+	AuditSink			AuditSink
+
+	// Store of the enrolled users, a file store in the state store of the MSP (under StateStoreBasePath) when not set
+	CredentialStore		CredentialStore
+
+	// PKCS#11 token generating and keeping the private keys of the enrolled users, software keys when not set
+	HSM					*HSMConfig
+
+	// Directory holding the state stores, one sub-directory per MSP ID
+	StateStoreBasePath	string
+	RemoveStateOnClose	bool	// Close also removes StateStoreBasePath, like Reset
+
+	// Duration after which the enrolled identity cached in the state store is enrolled again,
+	// no limit when not set. An identity with an expired certificate is always enrolled again.
+	IdentityCacheTTL	time.Duration
+
+	// Limit of the operations called with a context without deadline (InitializeWithContext, QueryWith...),
+	// no limit when not set
+	Timeout				time.Duration
+
+	// Retries of the client creation, the channel join and the proposals while a peer or the orderer
+	// can't be reached (e.g. still starting)
+	ConnectRetries		int				// 3 when not set, negative to disable
+	RetryInterval		time.Duration	// Delay before the first retry, doubled at each one, 1s when not set
+
+	// Peer connection parameters
+	DialTimeout			time.Duration	// Connection to a peer, 10s when not set
+	ProposalTimeout		time.Duration	// Execution of a proposal by a connected peer, no limit when not set
+
+	// Pool of the connections to a peer, shared by the proposals of every channel. A new connection is opened while
+	// the others carry proposals, up to PeerConnections (1 when not set). PeerMaxIdle connections without proposal are
+	// kept (PeerConnections when not set), for PeerIdleTimeout (no limit when not set).
+	PeerConnections		int
+	PeerMaxIdle			int
+	PeerIdleTimeout		time.Duration
+
+	// Keep-alive of the connections to the peers: a connection without activity for KeepAliveTime is pinged,
+	// and closed without answer within KeepAliveTimeout (20s when not set). No ping when KeepAliveTime is not set.
+	// The peers close the connections pinged more often than their peer.keepalive.minInterval (60s by default).
+	KeepAliveTime		time.Duration
+	KeepAliveTimeout	time.Duration
+
+	// Peers the proposals are sent to, by URL (host:port), every peer of the channel when not set.
+	// An unreachable peer is put aside for PeerRetryInterval (30s when not set), and replaced by another healthy peer.
+	EndorsingPeers		[]string
+	PeerRetryInterval	time.Duration
+
+	// Orderers besides the one of config.yaml, e.g. the other nodes of a Raft ordering service. A transaction goes
+	// to one orderer, and to the next one while it can't be reached or can't order (e.g. during a leader election).
+	// An orderer which failed is put aside for OrdererRetryInterval (30s when not set).
+	Orderers				[]OrdererEndpoint
+	OrdererRetryInterval	time.Duration
+
+	// With Discovery, the anchor peers and the orderers of the channel configuration are added to the channel,
+	// and refreshed every DiscoveryInterval (1 minute when not set), see RefreshTopology.
+	// DiscoveryAddresses maps the addresses of the configuration to the ones reachable by the service,
+	// e.g. "peer0.org1.example.com:7051" to "localhost:7051".
+	Discovery			bool
+	DiscoveryInterval	time.Duration
+	DiscoveryAddresses	map[string]string
+
+	// Invoke timeouts, a TimeoutError is returned when reached
+	OrderingTimeout		time.Duration	// Sending the transaction to the orderer, no limit when not set
+	CommitTimeout		time.Duration	// Waiting for the commit event of the transaction, 30s when not set
+
+	// Nonces reserved by ComputeTxID are forgotten when not used by an invoke within ReservedNonceTTL,
+	// 10 minutes when not set. The oldest ones are forgotten beyond 1000 nonces.
+	ReservedNonceTTL	time.Duration
+
+	// Executions again of an invoke in conflict with a concurrent transaction, see WithoutConflictRetries
+	ConflictRetries		int						// 3 when not set, negative to disable
+	ConflictRetryDelay	time.Duration			// Delay before the first execution again, doubled at each one, 100ms when not set
+	RetryableCodes		[]pb.TxValidationCode	// MVCC and phantom read conflicts when not set, a mismatch of the endorsements is always retried
+
+	// The invokes run on SubmitParallelism workers (8 when not set), the next ones wait in a queue of
+	// SubmitQueueSize invokes (100 when not set), then the callers wait for room up to SubmitQueueTimeout
+	// (no limit when not set, negative to fail at once) before failing with ErrOverloaded.
+	// The workers start at most SubmitRate invokes per second (no limit when not set), with bursts of
+	// SubmitBurst invokes (1 when not set).
+	SubmitParallelism	int
+	SubmitQueueSize		int
+	SubmitQueueTimeout	time.Duration
+	SubmitRate			float64
+	SubmitBurst			int
+
+	// Pre-enrolled users parameters
+	// When not set, the users are read from the crypto-config directory layout
+	OrdererUserCredentials	*UserCredentials
+	OrgUserCredentials		*UserCredentials
+
+	// Serialization of the chaincode arguments, ArgsSerializer takes precedence over ArgsFraming
+	ArgsSerializer		ArgsSerializer
+	ArgsFraming			ArgsFraming
+
+	// Query parameters
+	LaunchRetries		int				// Retries while the chaincode is launching, 5 when not set, negative to disable
+	LaunchRetryDelay	time.Duration	// Delay between these retries, 500ms when not set
+	QueryCacheSize		int				// Queries whose payload is kept until a block writes the keys they read, no cache when not set
+
+	// Timeout to connect to an orderer when probing it, 3s when not set
+	OrdererProbeTimeout	time.Duration
+
+	// Timeout of each check of Health, 2s when not set
+	HealthCheckTimeout	time.Duration
+
+	// Endorsement parameters
+	MinEndorsements		int				// Endorsements needed to proceed with an invoke, every peer when not set
+	EndorseUntilPolicy	bool			// Proceed once the endorsements satisfy the endorsement policy, see sendProposal
+	EndorsementDeadline	time.Duration	// Maximum time to collect the endorsements, no limit when not set
+
+	ResponseValidator	ResponseValidator	// Checks the endorsements before ordering, every status must be 200 when not set
+
+	// Warn when a certificate expires within this duration, 30 days when not set
+	CertExpiryWarning	time.Duration
+
+	// Tracer used to trace the network operations, no tracing when not set
+	Tracer				Tracer
+
+	// Metrics receiving the measures of the operations, e.g. a metrics.Collector, none when not set
+	Metrics				Metrics
+
+	// Logger receiving the messages of the setup, a StdLogger when not set (NoopLogger for a quiet operation)
+	Logger				Logger
+
+	// Events parameters
+	EventPeerIndex		int				// Peer the event hub connects to first, among the peers with an event endpoint, then the next ones when unreachable
+	EventBufferSize		int				// Maximum number of events kept while paused
+	EventRetries		int				// Reconnections of the event hub tried before registering an event, 3 when not set, negative to disable
+	EventRetryBackoff	time.Duration	// Delay before the first reconnection, doubled at each one, 500ms when not set
+
+	// The connection of the event hub is checked every EventSupervisorInterval (1s when not set, negative to disable):
+	// once lost, it is reconnected and the blocks committed in the meantime are replayed.
+	// OnEventHubState is called, if set, when the connection is lost and when it is back.
+	EventSupervisorInterval	time.Duration
+	OnEventHubState			func(connected bool)
+
+	certificateExpiries	[]CertificateExpiry
+
+	ordererUser			api.User	// Pre-enrolled admins, kept to join other channels
+	orgUser				api.User
+
+	channelManager		ChannelManager
+
+	credentialStore		CredentialStore	// Store used by the client
+
+	endorsers			map[string]*endorser	// Connections to the peers shared by the channels, by URL
+	endorsersMutex		sync.Mutex
+	peers				peerPool
+	orderers			ordererPool
+
+	eventPeers			[]eventPeerAddress	// The peers with an event endpoint, from EventPeerIndex
+	eventPeer			int					// The one the event hub connects to
+	eventPeersMutex		sync.Mutex
+
+	discoveredPeers		map[string]bool	// Peers and orderers added by RefreshTopology, by URL
+	discoveredOrderers	map[string]bool
+	stopDiscovery		func()
+
+	clientCertificate	clientCertificate
+	stopTLSReload		func()
+	secretClientCert	bool	// The SecretProvider has the client TLS certificate
+	secretRootCertPath	string	// File of the TLS root certificates of the SecretProvider
+
+	listeners			map[interface{}]func()	// Unregistration of the event listeners, by registration handle
+	listenersMutex		sync.Mutex
+
+	dispatcher			*eventDispatcher
+	dispatcherOnce		sync.Once
+
+	supervisor			*eventSupervisor
+	blockListeners		blockListeners
+	commits				commitWaiters
+	queryCache			queryCache
+
+	userMutex			sync.RWMutex	// Held while the user context of the client is switched, see asUser
+
+	reservedNonces		map[string]reservedNonce
+	noncesMutex			sync.Mutex
+
+	submissions			submitQueue
+	proposalMutex		sync.Mutex	// Serializes the creation of the transaction IDs and the signature of the proposals
 }
 
-// Initialize reads the configuration file and sets up the client, chain and event hub
-func Initialize() (*FabricSetup, error) {
+const (
+	defaultConfigFile			= "config.yaml"
+	defaultAdminUser			= "admin"
+	defaultAdminPassword		= "adminpw"
+	defaultOrdererAdminCertPath	= "ordererOrganizations/example.com/users/Admin@example.com"
+	defaultOrgAdminCertPath		= "peerOrganizations/org1.example.com/users/Admin@org1.example.com"
+	defaultOrdererUserName		= "ordererAdmin"
+	defaultOrgUserName			= "peerorg1Admin"
+	defaultStateStoreBasePath	= "/tmp/enroll_user"
+)
+
+// StateStorePathForMSP returns the directory of the state store holding the identities of the given MSP
+func (setup *FabricSetup) StateStorePathForMSP(mspID string) string {
+	basePath := setup.StateStoreBasePath
+	if basePath == "" {
+		basePath = defaultStateStoreBasePath
+	}
+	return filepath.Join(basePath, mspID)
+}
+
+// NewFabricSetup returns a setup of the heroes-service network, to be adjusted before calling its Initialize method.
+// The network parameters are the ones of DefaultConfig.
+func NewFabricSetup() *FabricSetup {
+	return NewFabricSetupFromConfig(DefaultConfig())
+}
+
+// NewFabricSetupFromConfig returns a setup of the network described by the config
+func NewFabricSetupFromConfig(config Config) *FabricSetup {
+	setup := &FabricSetup {
 
-	// Add parameters for the initialization
-	setup := FabricSetup {
 		// Channel parameters
-		ChannelId:		"mychannel",
-		ChannelConfig:	"fixtures/channel/mychannel.tx",
+		ChannelId:				config.ChannelId,
+		ChannelConfig:			config.ChannelConfig,
+		JoinChannel:			true,
+		CreateChannelIfMissing:	true,
+		TLSEnabled:				true,
 
 		// Chaincode parameters
-		ChaincodeId:		"heroes-service",
-		ChaincodeVersion:	"v1.0.0",
-		ChaincodeGoPath:	os.Getenv("GOPATH"),
-		ChaincodePath:		"github.com/chainhero/heroes-service/chaincode",	
+		FabricVersion:			config.FabricVersion,
+		ChaincodeId:			config.ChaincodeId,
+		ChaincodeVersion:		config.ChaincodeVersion,
+		ChaincodeGoPath:		config.ChaincodeGoPath,
+		ChaincodePath:			config.ChaincodePath,
+		ChaincodeLang:			ChaincodeLang(config.ChaincodeLang),
+		ChaincodeLifecycle:		ChaincodeLifecycle(config.ChaincodeLifecycle),
+		ChaincodeAddress:		config.ChaincodeAddress,
+		EndorsementPolicy:		config.EndorsementPolicy,
+		CollectionsConfigFile:	config.CollectionsConfig,
+
+		// Network parameters
+		ConfigFile:				config.ConfigFile,
+		AdminUser:				config.AdminUser,
+		AdminPassword:			config.AdminPassword,
+		OrdererAdminCertPath:	config.OrdererAdminMSP,
+		OrgAdminCertPath:		config.OrgAdminMSP,
+		StateStoreBasePath:		config.StateStore,
+	}
+	if config.HSMLibrary != "" {
+		setup.HSM = &HSMConfig{Library: config.HSMLibrary, Label: config.HSMLabel, Pin: config.HSMPin}
+	}
+	for _, orderer := range strings.Split(config.Orderers, ",") {
+		if orderer = strings.TrimSpace(orderer); orderer != "" {
+			address := strings.SplitN(orderer, "=", 2)
+			endpoint := OrdererEndpoint{Address: address[0]}
+			if len(address) == 2 {
+				endpoint.ServerHostOverride = address[1]
+			}
+			setup.Orderers = append(setup.Orderers, endpoint)
+		}
+	}
+	if config.TLSClientCert != "" {
+		setup.TLSClientCertPath = config.TLSClientCert
+		setup.TLSClientKeyPath = config.TLSClientKey
+	}
+	var providers SecretProviders
+	if config.VaultAddress != "" {
+		providers = append(providers, VaultSecretProvider{Address: config.VaultAddress, Token: config.VaultToken, Path: config.VaultPath})
+	}
+	if config.SecretsDir != "" {
+		providers = append(providers, FileSecretProvider{Dir: config.SecretsDir})
+	}
+	if len(providers) > 0 {
+		setup.SecretProvider = providers
+	}
+	switch config.AuditLog {
+	case "":
+	case "syslog":
+		setup.AuditSink = &SyslogAuditSink{}
+	default:
+		setup.AuditSink = &FileAuditSink{Path: config.AuditLog}
+	}
+	setup.QueryCacheSize = config.QueryCacheSize
+	setup.PeerConnections = config.PeerConnections
+	setup.PeerMaxIdle = config.PeerMaxIdle
+	setup.PeerIdleTimeout = config.PeerIdleTimeout
+	setup.KeepAliveTime = config.PeerKeepAlive
+	return setup
+}
+
+// Initialize reads the configuration file and sets up the client, chain and event hub
+// with the parameters of the profile, e.g. Initialize(WithProfile("prod")), see ProfileConfig.
+// Without profile, they are the default parameters of NewFabricSetup. The parameters without variable
+// in Config are set by the other options, e.g. WithTracer.
+func Initialize(options ...InitOption) (*FabricSetup, error) {
+	initOptions := newInitOptions(options)
+	config, err := ProfileConfig(initOptions.profile, initOptions.profilesFile)
+	if err != nil {
+		return nil, err
+	}
+	return InitializeWithConfig(config, options...)
+}
+
+// InitializeWithConfig is like Initialize, but sets up the network described by the config.
+// The profile options are ignored, the config being given.
+func InitializeWithConfig(config Config, options ...InitOption) (*FabricSetup, error) {
+	setup := NewFabricSetupFromConfig(config)
+	newInitOptions(options).apply(setup)
+	if err := setup.Initialize(); err != nil {
+		return nil, err
 	}
+	return setup, nil
+}
+
+// InitializeWithTracer is like Initialize, but traces the network operations with the given tracer.
+//
+// Deprecated: use Initialize(WithTracer(tracer)), which takes the profile into account.
+func InitializeWithTracer(tracer Tracer) (*FabricSetup, error) {
+	setup := NewFabricSetup()
+	setup.Tracer = tracer
+	if err := setup.Initialize(); err != nil {
+		return nil, err
+	}
+	return setup, nil
+}
+
+// Initialize reads the configuration file and sets up the client, chain and event hub of the setup
+func (setup *FabricSetup) Initialize() error {
+	return setup.initialize(context.Background())
+}
+
+// initialize is Initialize, the connections being retried until the context is done
+func (setup *FabricSetup) initialize(ctx context.Context) (err error) {
+
+	// Apply the defaults of the parameters not set
+	if setup.ConfigFile == "" {
+		setup.ConfigFile = defaultConfigFile
+	}
+	if setup.AdminUser == "" {
+		setup.AdminUser = defaultAdminUser
+	}
+	if setup.AdminPassword == "" {
+		setup.AdminPassword = defaultAdminPassword
+	}
+	if setup.OrdererAdminCertPath == "" {
+		setup.OrdererAdminCertPath = defaultOrdererAdminCertPath
+	}
+	if setup.OrgAdminCertPath == "" {
+		setup.OrgAdminCertPath = defaultOrgAdminCertPath
+	}
+	if setup.OrdererKeystorePath == "" {
+		setup.OrdererKeystorePath = filepath.Join(setup.OrdererAdminCertPath, "keystore")
+	}
+	if setup.OrdererSignCertPath == "" {
+		setup.OrdererSignCertPath = filepath.Join(setup.OrdererAdminCertPath, "signcerts")
+	}
+	if setup.OrdererUserName == "" {
+		setup.OrdererUserName = defaultOrdererUserName
+	}
+	if setup.OrgKeystorePath == "" {
+		setup.OrgKeystorePath = filepath.Join(setup.OrgAdminCertPath, "keystore")
+	}
+	if setup.OrgSignCertPath == "" {
+		setup.OrgSignCertPath = filepath.Join(setup.OrgAdminCertPath, "signcerts")
+	}
+	if setup.OrgUserName == "" {
+		setup.OrgUserName = defaultOrgUserName
+	}
+
+	span := setup.startSpan("Initialize")
+	defer func() { endSpan(span, err) }()
+	defer func(start time.Time) { setup.observeOperation("Initialize", start, err) }(time.Now())
 
 	// Initialize the configuration
-	// This will read the config.yaml, in order to tell to
+	// This will read the config file (config.yaml), in order to tell to
 	// the SDK all options and how contact a peer
-	configImpl, err := fsgConfig.InitConfig("config.yaml");
+	configImpl, err := fsgConfig.InitConfig(setup.ConfigFile);
 	if err != nil {
-		return nil, fmt.Errorf("Initialize the config failed: %v", err)
+		return setupError(PhaseConfig, fmt.Errorf("Initialize the config failed: %v", err))
+	}
+	if setup.DevMode {
+		return setup.initializeDevMode(configImpl)
+	}
+
+	// The secrets of the SecretProvider replace the settings of the setup, see the Secret constants
+	clientCert, err := setup.secret(SecretTLSClientCert)
+	if err != nil {
+		return setupError(PhaseConfig, err)
+	}
+	setup.secretClientCert = clientCert != nil
+	if _, err := setup.loadTLSCertificates(); err != nil {
+		return setupError(PhaseConfig, err)
+	}
+	if err := setup.applyTLSConfig(configImpl); err != nil {
+		return setupError(PhaseConfig, err)
+	}
+	if err := setup.validateOrganizations(); err != nil {
+		return setupError(PhaseConfig, err)
+	}
+
+	// Check the TLS certificate of the orderer before any channel operation
+	if configImpl.IsTLSEnabled() {
+		if err := setup.checkCertificateExpiry("orderer TLS", configImpl.GetOrdererTLSCertificate()); err != nil {
+			return setupError(PhaseConfig, err)
+		}
+		if setup.TLSClientCertSource == nil && setup.TLSClientCertPath != "" {
+			if err := setup.checkCertificateExpiry("client TLS", setup.TLSClientCertPath); err != nil {
+				return setupError(PhaseConfig, err)
+			}
+		}
 	}
 
 	// Initialize blockchain cryptographic service provider (BCCSP)
-	// This tool manages certificates and keys
-	err = bccspFactory.InitFactories(configImpl.GetCSPConfig())
+	// This tool manages certificates and keys, in software or in the HSM
+	cspConfig, err := setup.cspConfig(configImpl.GetCSPConfig())
+	if err != nil {
+		return setupError(PhaseConfig, err)
+	}
+	err = bccspFactory.InitFactories(cspConfig)
 	if err != nil {
-		return nil, fmt.Errorf("Failed getting ephemeral software-based BCCSP [%s]", err)
+		return setupError(PhaseConfig, fmt.Errorf("Failed getting the %s BCCSP [%s]", cspConfig.ProviderName, err))
+	}
+
+	// Each organisation has its own state store, so identities of different organisations don't collide
+	if setup.StateStoreBasePath == "" {
+		setup.StateStoreBasePath = defaultStateStoreBasePath
+	}
+	store := setup.CredentialStore
+	if store == nil {
+		stateStorePath := setup.StateStorePathForMSP(configImpl.GetFabricCAID())
+
+		// The identity cached by a previous run is dropped when it is too old or expired,
+		// so it will be enrolled again
+		if err := expireCachedIdentity(stateStorePath, setup.AdminUser, setup.IdentityCacheTTL); err != nil {
+			return setupError(PhaseEnrollment, err)
+		}
+		if store, err = NewFileCredentialStore(stateStorePath); err != nil {
+			return setupError(PhaseEnrollment, err)
+		}
 	}
+	setup.credentialStore = store
 
 	// This will make a user access (here the admin) to interact with the network
 	// To do so, it will contact the Fabric CA to check if the user has access
 	// and give it to him (enrollment)
-	client, err := fcutil.GetClient("admin", "adminpw", "/tmp/enroll_user", configImpl)
+	adminPassword, err := setup.adminPassword()
+	if err != nil {
+		return setupError(PhaseEnrollment, err)
+	}
+	var client api.FabricClient
+	err = setup.retry(ctx, "Client creation", func() (err error) {
+		client, err = newClient(configImpl, store, setup.AdminUser, adminPassword)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Create client failed: %v", err)
+		return setupError(PhaseEnrollment, fmt.Errorf("Create client failed: %w", err))
 	}
 	setup.Client = client
 
@@ -69,141 +577,435 @@ func Initialize() (*FabricSetup, error) {
 	// make some peer join it
 	channel, err := fcutil.GetChannel(setup.Client, setup.ChannelId)
 	if err != nil {
-		return nil, fmt.Errorf("Create channel (%s) failed: %v", setup.ChannelId, err)
+		return setupError(PhaseConfig, fmt.Errorf("Create channel (%s) failed: %v", setup.ChannelId, err))
 	}
 	setup.Channel = channel
 
+	// The SDK peers open a connection per proposal, with a fixed connection timeout and none on the proposal
+	if err := setup.useEndorsers(channel); err != nil {
+		return setupError(PhaseConfig, err)
+	}
+	if err := setup.useOrderers(channel); err != nil {
+		return setupError(PhaseConfig, err)
+	}
+	if err := setup.validateEndorsingPeers(channel); err != nil {
+		return setupError(PhaseConfig, err)
+	}
+
 	// Get an orderer user that will validate a proposed order
-	// The authentication will be made with local certificates
-	ordererUser, err := fcutil.GetPreEnrolledUser(
-		client,
-		"ordererOrganizations/example.com/users/Admin@example.com/keystore",
-		"ordererOrganizations/example.com/users/Admin@example.com/signcerts",
-		"ordererAdmin",
-	)
+	// The authentication will be made with the certificates of the credential store (read from the local ones
+	// the first time), or the ones of the SecretProvider
+	ordererUser, err := setup.secretUser(client, setup.OrdererUserName, SecretOrdererAdminCert, SecretOrdererAdminKey)
+	if err == nil && ordererUser == nil {
+		if setup.OrdererUserCredentials != nil {
+			ordererUser, err = loadUser(client, setup.OrdererUserCredentials)
+		} else {
+			ordererUser, err = loadPreEnrolledUser(client, store, setup.OrdererUserName, setup.OrdererKeystorePath, setup.OrdererSignCertPath)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("Unable to get the orderer user failed: %v", err)
+		return setupError(PhaseEnrollment, fmt.Errorf("Unable to get the orderer user failed: %w", err))
 	}
 
 	// Get an organisation user (admin) that will be used to sign the proposal
-	// The authentication will be made with local certificates
-	orgUser, err := fcutil.GetPreEnrolledUser(
-		client,
-		"peerOrganizations/org1.example.com/users/Admin@org1.example.com/keystore",
-		"peerOrganizations/org1.example.com/users/Admin@org1.example.com/signcerts",
-		"peerorg1Admin",
-	)
+	// The authentication will be made with the certificates of the credential store, or the ones of the SecretProvider
+	orgUser, err := setup.secretUser(client, setup.OrgUserName, SecretOrgAdminCert, SecretOrgAdminKey)
+	if err == nil && orgUser == nil {
+		if setup.OrgUserCredentials != nil {
+			orgUser, err = loadUser(client, setup.OrgUserCredentials)
+		} else {
+			orgUser, err = loadPreEnrolledUser(client, store, setup.OrgUserName, setup.OrgKeystorePath, setup.OrgSignCertPath)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("Unable to get the organisation user failed: %v", err)
+		return setupError(PhaseEnrollment, fmt.Errorf("Unable to get the organisation user failed: %w", err))
 	}
 
+	setup.ordererUser = ordererUser
+	setup.orgUser = orgUser
+
 	// Initialize the channel "mychannel" based on the genesis block by
 	// 1. locating in fixtures/channel/mychannel.tx and
 	// 2. joining the peer given in the configuration file to this channel
-	if err := fcutil.CreateAndJoinChannel(client, ordererUser, orgUser, channel, setup.ChannelConfig); err != nil {
-		return nil, fmt.Errorf("CreateAndJoinChannel return error: %v", err)
+	if setup.JoinChannel {
+		err := setup.retry(ctx, "Channel join", func() error {
+			// The SDK would make the peers of the other organisations join too
+			if setup.CreateChannelIfMissing || len(setup.Organizations) > 0 {
+				return setup.createAndJoinChannel(setup.ChannelId, channel, setup.ChannelConfig)
+			}
+			return fcutil.CreateAndJoinChannel(client, ordererUser, orgUser, channel, setup.ChannelConfig)
+		})
+		if err != nil {
+			return setupError(PhaseChannelJoin, fmt.Errorf("CreateAndJoinChannel return error: %w", err))
+		}
 	}
 
 	// Give the organisation user to the client for next proposal
 	client.SetUserContext(orgUser)
 
+	// In client-only mode, make sure the peers are in the channel, otherwise every query would fail
+	if !setup.JoinChannel && !setup.SkipChannelMembershipCheck {
+		if err := setup.checkChannelMembership(); err != nil {
+			return setupError(PhaseChannelJoin, err)
+		}
+	}
+
 	// Setup Event Hub
 	// This will allow us to listen for some event from the chaincode
 	// and act on it. We won't use it for now.
-	eventHub, err := getEventHub(client)
+	eventHub, err := setup.getEventHub(client)
 	if err != nil {
-		return nil, err
+		return setupError(PhaseEventHubConnect, err)
+	}
+	if err := setup.connectEventHub(eventHub); err != nil {
+		return setupError(PhaseEventHubConnect, fmt.Errorf("Failed eventHub.Connect() [%s]", err))
 	}
-	if err := eventHub.Connect(); err != nil {
-		return nil, fmt.Errorf("Failed eventHub.Connect() [%s]", err)
+	// The cache is invalidated before the invokes are told their transaction is committed
+	if setup.QueryCacheSize > 0 {
+		eventHub.RegisterBlockEvent(setup.invalidateQueryCache)
 	}
+	eventHub.RegisterBlockEvent(setup.deliverCommits)
 	setup.EventHub = eventHub
+	setup.metrics().SetEventHubConnected(true)
+	setup.startEventSupervisor()
 
 	// Tell that the initialization is done
+	setup.submissions.reopen()
 	setup.Initialized = true
+	setup.startDiscovery()
+	setup.startTLSReload()
+
+	return nil
+ }
+
+ // Close waits for the invokes submitted, unregisters the event listeners, disconnects the event hub,
+ // closes the connections to the peers and forgets the channels added with AddChannel.
+ // With RemoveStateOnClose, the state store directory is removed too (see Reset).
+ // It can be called several times, and after an initialization that failed midway.
+ func (setup *FabricSetup) Close() error {
+	if setup.stopDiscovery != nil {
+		setup.stopDiscovery()
+		setup.stopDiscovery = nil
+	}
+	if setup.stopTLSReload != nil {
+		setup.stopTLSReload()
+		setup.stopTLSReload = nil
+	}
+	defer setup.removeSecretRootCerts()
+	setup.channelManager.clear()
+	setup.submissions.close()
+
+	setup.listenersMutex.Lock()
+	listeners := setup.listeners
+	setup.listeners = nil
+	setup.listenersMutex.Unlock()
 
-	return &setup, nil
+	if setup.EventHub != nil {
+		setup.stopEventSupervisor()
+		for _, unregister := range listeners {
+			unregister()
+		}
+		// Nothing is done when the event hub is not connected
+		setup.EventHub.Disconnect()
+	}
+	setup.closeEndorsers()
+	setup.peers.clear()
+	setup.orderers.clear()
+	setup.queryCache.clear()
+
+	setup.Initialized = false
+	if setup.RemoveStateOnClose {
+		return setup.removeStateStore()
+	}
+	return nil
  }
 
- // getEventHub initialize the event hub
- func getEventHub(client api.FabricClient) (api.EventHub, error) {
+ // Reset closes the setup (see Close) and removes its state store directory, StateStoreBasePath, so the identities
+ // are enrolled again by the next initialization. It fails when StateStoreBasePath is not set, nothing is removed then.
+ // The peers can't leave a channel, the joined channels are kept.
+ func (setup *FabricSetup) Reset() error {
+	if err := setup.Close(); err != nil {
+		return err
+	}
+	return setup.removeStateStore()
+ }
+
+ // removeStateStore removes the StateStoreBasePath directory, never a default one
+ func (setup *FabricSetup) removeStateStore() error {
+	if setup.StateStoreBasePath == "" {
+		return fmt.Errorf("No StateStoreBasePath to reset")
+	}
+	return RemoveStateStore(setup.StateStoreBasePath)
+ }
+
+ // RemoveStateStore removes the state store directory of the enrolled users. It refuses an empty path,
+ // the root and the current directories, e.g. from an environment variable set by mistake.
+ func RemoveStateStore(path string) error {
+	switch filepath.Clean(path) {
+	case ".":
+		return fmt.Errorf("No state store to remove")
+	case string(filepath.Separator):
+		return fmt.Errorf("The state store can't be the root directory")
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("Unable to remove the state store (%s): %v", path, err)
+	}
+	return nil
+ }
+
+ // getEventHub initialize the event hub on the peers with an event endpoint, from the one selected by EventPeerIndex
+ func (setup *FabricSetup) getEventHub(client api.FabricClient) (api.EventHub, error) {
 	eventHub, err := events.NewEventHub(client)
 	if err != nil {
 		return nil, fmt.Errorf("Error creating new event hub: %v", err)
 	}
-	foundEventHub := false
 	peerConfig, err := client.GetConfig().GetPeersConfig()
 	if err != nil {
 		return nil, fmt.Errorf("Error reading peer config: %v", err)
 	}
-	for _, p := range peerConfig {
+	addresses, err := eventPeerAddresses(peerConfig, setup.EventPeerIndex, client.GetConfig().IsTLSEnabled())
+	if err != nil {
+		return nil, err
+	}
+	setup.eventPeersMutex.Lock()
+	setup.eventPeers = addresses
+	setup.eventPeer = 0
+	setup.eventPeersMutex.Unlock()
+
+	return eventHub, nil
+ }
+
+ // eventPeerAddresses returns the event endpoints of the peers, starting from the one selected by index and
+ // moving to the next ones when it is unreachable, see connectEventHub
+ func eventPeerAddresses(peers []api.PeerConfig, index int, tls bool) ([]eventPeerAddress, error) {
+	// Only the peers with an event endpoint can be used
+	var eventPeers []api.PeerConfig
+	var tried []string
+	for _, p := range peers {
+		tried = append(tried, fmt.Sprintf("%s:%d", p.Host, p.Port))
 		if p.EventHost != "" && p.EventPort != 0 {
-			fmt.Printf("EventHub connect to peer (%s:%d)\n", p.EventHost, p.EventPort)
-			eventHub.SetPeerAddr(fmt.Sprintf("%s:%d", p.EventHost, p.EventPort), p.TLS.Certificate, p.TLS.ServerHostOverride)
-			foundEventHub = true 
-			break
+			eventPeers = append(eventPeers, p)
 		}
 	}
-
-	if !foundEventHub {
-		return nil, fmt.Errorf("No EventHub configuration found")
+	if len(eventPeers) == 0 {
+		return nil, fmt.Errorf("No EventHub configuration found in the peers: %s", strings.Join(tried, ", "))
+	}
+	if index < 0 || index >= len(eventPeers) {
+		return nil, fmt.Errorf("Invalid EventPeerIndex %d: only %d peer(s) with an EventHub configuration", index, len(eventPeers))
 	}
 
-	return eventHub, nil
+	addresses := make([]eventPeerAddress, len(eventPeers))
+	for i := range eventPeers {
+		p := eventPeers[(index+i)%len(eventPeers)]
+		addresses[i] = eventPeerAddress{url: fmt.Sprintf("%s:%d", p.EventHost, p.EventPort)}
+		if tls {
+			addresses[i].certificate = p.TLS.Certificate
+			addresses[i].serverHostOverride = p.TLS.ServerHostOverride
+		}
+	}
+	return addresses, nil
  }
 
  // Install and instantiate the chaincode
- func (setup *FabricSetup) InstallAndInstantiateCC() error {
+ // The arguments are given to the Init function of the chaincode, ChaincodeInitArgs when nil
+ func (setup *FabricSetup) InstallAndInstantiateCC(args []string) error {
 
 	// Check if chaincode ID is provided
 	// otherwise, generate a random one
 	if setup.ChaincodeId == "" {
 		setup.ChaincodeId = fcutil.GenerateRandomID()
 	}
+	// The development server already runs the chaincode
+	if setup.DevMode {
+		return nil
+	}
 
-	fmt.Printf(
-		"Chaincode %s (version %s) will be installed (Go Path: %s / Chaincode Path: %s)\n",
-		setup.ChaincodeId,
-		setup.ChaincodeVersion,
-		setup.ChaincodeGoPath,
-		setup.ChaincodePath,
-	)
+	return setup.installAndInstantiateOn(setup.primaryTarget(), args)
+ }
+
+ // InstallCC installs the chaincode on the peers of the organisation, unless it is already installed
+ func (setup *FabricSetup) InstallCC() error {
+	if err := setup.validateChaincodeLang(); err != nil {
+		return err
+	}
+	return setup.installOnce(setup.primaryTarget())
+ }
+
+ // InstantiateCC instantiates the installed chaincode on the channel, unless it is already instantiated.
+ // The arguments are given to the Init function of the chaincode, ChaincodeInitArgs when nil.
+ func (setup *FabricSetup) InstantiateCC(args []string) error {
+	if err := setup.validateChaincodeLang(); err != nil {
+		return err
+	}
+	policy, err := setup.endorsementPolicy()
+	if err != nil {
+		return err
+	}
+	args, err = setup.initArgs(args)
+	if err != nil {
+		return err
+	}
+	return setup.instantiateOnce(setup.primaryTarget(), args, policy)
+ }
 
-	// Install Chaincode
-	// Package the go code and make a proposal to the network with this new chaincode
-	err := fcutil.SendInstallCC(
-		setup.Client,	// The SDK client
-		setup.Channel,	// The channel concerned
-		setup.ChaincodeId,
-		setup.ChaincodePath,
-		setup.ChaincodeVersion,
-		nil,
-		setup.Channel.GetPeers(),	// Peers concerned by this change in the channel
+ // installAndInstantiateOn installs and instantiates the chaincode of the target channel
+ func (setup *FabricSetup) installAndInstantiateOn(target channelTarget, args []string) error {
+
+	// Check the parameters before any network call
+	if err := setup.validateChaincodeLang(); err != nil {
+		return err
+	}
+	policy, err := setup.endorsementPolicy()
+	if err != nil {
+		return err
+	}
+	args, err = setup.initArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if err := setup.installOnce(target); err != nil {
+		return err
+	}
+	return setup.instantiateOnce(target, args, policy)
+ }
+
+ // installOnce installs the chaincode of the target channel, skipped when done, e.g. by a previous run
+ func (setup *FabricSetup) installOnce(target channelTarget) error {
+	installed, err := setup.isInstalledOn(target)
+	if err != nil {
+		return err
+	}
+	if installed {
+		setup.targetLogger(target).Printf("Chaincode %s already installed (version %s)", target.chaincodeID, target.chaincodeVersion)
+		return nil
+	}
+	if err := setup.installOn(target); err != nil {
+		return setupError(PhaseInstall, err)
+	}
+	return nil
+ }
+
+ // instantiateOnce instantiates the chaincode of the target channel, skipped when done, e.g. by a previous run.
+ // It calls the Init function of the chaincode in order to initialize in every peer the new chaincode.
+ func (setup *FabricSetup) instantiateOnce(target channelTarget, args []string, policy []byte) error {
+	instantiated, err := setup.isInstantiatedOn(target)
+	if err != nil {
+		return err
+	}
+	if instantiated {
+		setup.targetLogger(target).Printf("Chaincode %s already instantiated on %s (version %s)", target.chaincodeID, target.channelID, target.chaincodeVersion)
+		return nil
+	}
+	span := setup.startSpan("Instantiate")
+	err = setup.deployOn(target, deployInstantiate, args, policy)
+	endSpan(span, err)
+	if err != nil {
+		return setupError(PhaseInstantiate, err)
+	}
+	setup.targetLogger(target).Printf("Chaincode %s instantiated on %s (version %s)", target.chaincodeID, target.channelID, target.chaincodeVersion)
+	return nil
+ }
+
+ // UpgradeCC installs the new version of the chaincode on the peers, then upgrades the instantiated chaincode to it.
+ // The arguments (the function name first) are given as is to the Init function of the new version,
+ // ChaincodeInitArgs when nil.
+ func (setup *FabricSetup) UpgradeCC(newVersion string, args [][]byte) error {
+	if newVersion == setup.ChaincodeVersion {
+		return fmt.Errorf("The chaincode %s is already deployed in version %s", setup.ChaincodeId, newVersion)
+	}
+	if err := setup.validateChaincodeLang(); err != nil {
+		return err
+	}
+	policy, err := setup.endorsementPolicy()
+	if err != nil {
+		return err
+	}
+	// The SDK takes the arguments as strings, which can hold any byte
+	var stringArgs []string
+	if args != nil {
+		stringArgs = make([]string, len(args))
+		for i, arg := range args {
+			stringArgs[i] = string(arg)
+		}
+	}
+	stringArgs, err = setup.initArgs(stringArgs)
+	if err != nil {
+		return err
+	}
+
+	// Skip the steps already done, e.g. by a previous run interrupted before updating ChaincodeVersion
+	target := setup.primaryTarget()
+	target.chaincodeVersion = newVersion
+	installed, err := setup.isInstalledOn(target)
+	if err != nil {
+		return err
+	}
+	upgraded, err := setup.isInstantiatedOn(target)
+	if err != nil {
+		return err
+	}
+	if upgraded {
+		setup.targetLogger(target).Printf("Chaincode %s already upgraded (version %s)", setup.ChaincodeId, newVersion)
+		setup.ChaincodeVersion = newVersion
+		return nil
+	}
+
+	if installed {
+		setup.targetLogger(target).Printf("Chaincode %s already installed (version %s)", target.chaincodeID, newVersion)
+	} else if err := setup.installOn(target); err != nil {
+		return setupError(PhaseInstall, err)
+	}
+
+	span := setup.startSpan("Upgrade")
+	err = setup.deployOn(target, deployUpgrade, stringArgs, policy)
+	endSpan(span, err)
+	if err != nil {
+		return setupError(PhaseUpgrade, err)
+	}
+
+	setup.targetLogger(target).Printf("Chaincode %s upgraded (version %s to %s)", setup.ChaincodeId, setup.ChaincodeVersion, newVersion)
+	setup.ChaincodeVersion = newVersion
+	return nil
+ }
+
+ // installOn packages the go code and makes a proposal to the peers of the organisation in the target channel with this new chaincode version
+ func (setup *FabricSetup) installOn(target channelTarget) error {
+	if setup.ChaincodeLifecycle == LifecycleV2 {
+		return setup.installPackageOn(target)
+	}
+	setup.targetLogger(target).Printf(
+		"Chaincode %s (version %s) will be installed (Go Path: %s / Chaincode Path: %s)",
+		target.chaincodeID,
+		target.chaincodeVersion,
 		setup.ChaincodeGoPath,
+		target.chaincodePath,
 	)
+
+	span := setup.startSpan("Install")
+	chaincodePackage, err := packageChaincode(setup.targetLogger(target), setup.ChaincodeLang, setup.ChaincodeGoPath, target.chaincodePath, setup.ExcludePatterns)
+	if err == nil {
+		err = setup.retry(target.callContext(), "Install", func() error {
+			if setup.ChaincodeLang != "" && setup.ChaincodeLang != LangGolang {
+				return setup.installPackage(target, chaincodePackage)
+			}
+			return fcutil.SendInstallCC(
+				setup.Client,	// The SDK client
+				target.channel,	// The channel concerned
+				target.chaincodeID,
+				target.chaincodePath,
+				target.chaincodeVersion,
+				chaincodePackage,
+				setup.ownPeers(target.channel),	// Peers of the organisation concerned by this change in the channel
+				setup.ChaincodeGoPath,
+			)
+		})
+	}
+	endSpan(span, err)
 	if err != nil {
 		return fmt.Errorf("Send install proposal return error: %v", err)
-	} else {
-		fmt.Printf("Chaincode %s installed (version %s)\n", setup.ChaincodeId, setup.ChaincodeVersion)
-	}
-
-	// Instantiate Chaincode
-	// Call the Init function of the chaincode in order to initialize in every peer the new chaincode
-	err = fcutil.SendInstantiateCC(
-		setup.Channel,
-		setup.ChaincodeId,
-		setup.ChannelId,
-		[]string{"init"},	// Arguments for the invoke request
-		setup.ChaincodePath,
-		setup.ChaincodeVersion,
-		[]api.Peer{setup.Channel.GetPrimaryPeer()},	// Which peer to contact
-		setup.EventHub,
-	)
-	if err != nil {
-		return err
-	} else {
-		fmt.Printf("Chaincode %s instantiated (version %s)\n", setup.ChaincodeId, setup.ChaincodeVersion)
 	}
 
+	setup.targetLogger(target).Printf("Chaincode %s installed (version %s)", target.chaincodeID, target.chaincodeVersion)
 	return nil
- }
\ No newline at end of file
+ }
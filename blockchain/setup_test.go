@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fsgConfig "github.com/hyperledger/fabric-sdk-go/pkg/config"
+)
+
+// testConfig is the configuration of config.yaml, loaded by TestMain: loading it sets the backend of the global
+// logger, which must happen before the tests leave gRPC goroutines logging through it
+var testConfig api.Config
+
+func TestMain(m *testing.M) {
+	config, err := fsgConfig.InitConfig("../config.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load the configuration: %v\n", err)
+		os.Exit(1)
+	}
+	testConfig = config
+	os.Exit(m.Run())
+}
+
+func TestRemoveStateStore(t *testing.T) {
+	for _, path := range []string{"", ".", "/", "//", "./"} {
+		if err := RemoveStateStore(path); err == nil {
+			t.Errorf("The state store %q was removed", path)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "heroes-state-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "admin.json"), []byte("{}"), 0600)
+	if err := RemoveStateStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("The state store is still there")
+	}
+}
+
+func eventPeer(host string, eventPort int) api.PeerConfig {
+	p := api.PeerConfig{Host: host, Port: 7051, EventHost: host, EventPort: eventPort}
+	p.TLS.Certificate = host + ".pem"
+	p.TLS.ServerHostOverride = host
+	return p
+}
+
+func TestEventPeerAddresses(t *testing.T) {
+	peers := []api.PeerConfig{
+		eventPeer("peer0", 7053),
+		{Host: "peer1", Port: 7051},
+		eventPeer("peer2", 8053),
+		eventPeer("peer3", 9053),
+	}
+	tests := []struct {
+		index	int
+		urls	[]string
+	}{
+		{0, []string{"peer0:7053", "peer2:8053", "peer3:9053"}},
+		{1, []string{"peer2:8053", "peer3:9053", "peer0:7053"}},
+		{2, []string{"peer3:9053", "peer0:7053", "peer2:8053"}},
+	}
+	for _, test := range tests {
+		addresses, err := eventPeerAddresses(peers, test.index, true)
+		if err != nil {
+			t.Fatalf("Index %d: %v", test.index, err)
+		}
+		if len(addresses) != len(test.urls) {
+			t.Fatalf("Index %d: %d addresses, want %d", test.index, len(addresses), len(test.urls))
+		}
+		for i, address := range addresses {
+			host := strings.Split(test.urls[i], ":")[0]
+			if address.url != test.urls[i] || address.certificate != host+".pem" || address.serverHostOverride != host {
+				t.Errorf("Index %d: address %d is %+v, want %s", test.index, i, address, test.urls[i])
+			}
+		}
+	}
+
+	addresses, _ := eventPeerAddresses(peers, 0, false)
+	if addresses[0].certificate != "" || addresses[0].serverHostOverride != "" {
+		t.Error("The TLS settings are kept without TLS")
+	}
+	for _, index := range []int{-1, 3} {
+		if _, err := eventPeerAddresses(peers, index, false); err == nil {
+			t.Errorf("The index %d was accepted", index)
+		}
+	}
+	if _, err := eventPeerAddresses(peers[1:2], 0, false); err == nil {
+		t.Error("Peers without event endpoint were accepted")
+	}
+}
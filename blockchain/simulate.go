@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"github.com/hyperledger/fabric/protos/ledger/rwset"
+	"github.com/hyperledger/fabric/protos/ledger/rwset/kvrwset"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// SimulationResult is the outcome of a simulated invoke: what the chaincode returned,
+// and what it read and would write if the transaction was committed
+type SimulationResult struct {
+	TxID	string
+	Payload	[]byte
+	Reads	[]KeyRead
+	Writes	[]KeyWrite
+}
+
+// KeyRead is a key read by the chaincode, with the version it had when it was read
+type KeyRead struct {
+	Namespace	string	`json:"namespace"`
+	Key			string	`json:"key"`
+	BlockNum	uint64	`json:"blockNum"`	// Block of the last transaction that wrote the key, 0 if the key doesn't exist
+	TxNum		uint64	`json:"txNum"`		// Position of that transaction in the block
+}
+
+// KeyWrite is a key the chaincode would write
+type KeyWrite struct {
+	Namespace	string	`json:"namespace"`
+	Key			string	`json:"key"`
+	Value		[]byte	`json:"value"`
+	IsDelete	bool	`json:"isDelete"`
+}
+
+// Simulate sends the invoke proposal to the primary peer for endorsement, without sending
+// the transaction to the orderer. Nothing is written in the ledger: the result tells what
+// the transaction would write, so it can be reviewed before being submitted.
+func (setup *FabricSetup) Simulate(function string, args []string) (*SimulationResult, error) {
+	proposal, err := setup.createProposal(append([]string{function}, args...), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Create transaction proposal in the simulation return error: %v", err)
+	}
+	responses, err := setup.sendProposal(proposal, []api.Peer{setup.Channel.GetPrimaryPeer()}, noopSpan{})
+	if err != nil {
+		return nil, fmt.Errorf("Send transaction proposal in the simulation return error: %w", ledgerError(proposal.TransactionID, err))
+	}
+
+	result := &SimulationResult{
+		TxID:		proposal.TransactionID,
+		Payload:	responses[0].ProposalResponse.GetResponse().Payload,
+	}
+	if err := parseReadWriteSet(responses[0], result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// parseReadWriteSet extracts the read/write set from the endorsement of a proposal.
+// The proposal response payload embeds (as protobuf bytes, each level wrapping the next one):
+//  - a ProposalResponsePayload, whose extension is
+//  - a ChaincodeAction, whose results are
+//  - a TxReadWriteSet, with one read/write set per namespace (chaincode) encoded as
+//  - a KVRWSet, holding the keys read (with their version) and written (with their new value)
+func parseReadWriteSet(response *api.TransactionProposalResponse, result *SimulationResult) error {
+	responsePayload, err := protosUtils.GetProposalResponsePayload(response.ProposalResponse.Payload)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal the proposal response payload: %v", err)
+	}
+	action, err := protosUtils.GetChaincodeAction(responsePayload.Extension)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal the chaincode action: %v", err)
+	}
+	result.Reads, result.Writes, err = parseResults(action.Results)
+	return err
+}
+
+// parseResults decodes the results of a chaincode action, its read/write set
+func parseResults(results []byte) (reads []KeyRead, writes []KeyWrite, err error) {
+	txRwSet := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(results, txRwSet); err != nil {
+		return nil, nil, fmt.Errorf("Unable to unmarshal the read/write set: %v", err)
+	}
+
+	for _, nsRwSet := range txRwSet.NsRwset {
+		kvRwSet := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(nsRwSet.Rwset, kvRwSet); err != nil {
+			return nil, nil, fmt.Errorf("Unable to unmarshal the read/write set of %s: %v", nsRwSet.Namespace, err)
+		}
+		for _, read := range kvRwSet.Reads {
+			keyRead := KeyRead{Namespace: nsRwSet.Namespace, Key: read.Key}
+			if read.Version != nil {
+				keyRead.BlockNum = read.Version.BlockNum
+				keyRead.TxNum = read.Version.TxNum
+			}
+			reads = append(reads, keyRead)
+		}
+		for _, write := range kvRwSet.Writes {
+			writes = append(writes, KeyWrite{
+				Namespace:	nsRwSet.Namespace,
+				Key:		write.Key,
+				Value:		write.Value,
+				IsDelete:	write.IsDelete,
+			})
+		}
+	}
+
+	return reads, writes, nil
+}
@@ -0,0 +1,202 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSubmitParallelism	= 8
+	defaultSubmitQueueSize		= 100
+)
+
+// submitQueue runs the invokes on a pool of SubmitParallelism workers, so many callers can invoke at the same
+// time without opening as many concurrent transactions on the peers and the orderer
+type submitQueue struct {
+	mutex	sync.RWMutex	// Held while a job is queued, so Close doesn't miss it
+	closed	bool
+	jobs	chan func()
+	stop	chan struct{}
+	workers	sync.WaitGroup
+	limiter	*rateLimiter	// Of SubmitRate, nil without limit
+}
+
+// rateLimiter is a token bucket: a token is added every 1/rate seconds, up to burst tokens
+type rateLimiter struct {
+	mutex	sync.Mutex
+	rate	float64
+	burst	float64
+	tokens	float64
+	last	time.Time
+}
+
+// newRateLimiter returns a full limiter
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait takes a token, waiting for one if the bucket is empty
+func (limiter *rateLimiter) wait() {
+	limiter.mutex.Lock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.burst {
+		limiter.tokens = limiter.burst
+	}
+	limiter.last = now
+	// The token is taken now, the next callers wait behind
+	limiter.tokens--
+	delay := time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+	limiter.mutex.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// InvokeResult is the outcome of an invoke submitted by InvokeAsync
+type InvokeResult struct {
+	TxID	string
+	Err		error
+}
+
+// InvokeAsync is like InvokeWith, but returns at once: the result is sent on the channel once the transaction
+// is committed, or has failed
+func (setup *FabricSetup) InvokeAsync(function string, args []string) <-chan InvokeResult {
+	result := make(chan InvokeResult, 1)
+	go func() {
+		txID, err := setup.InvokeWith(context.Background(), function, args)
+		result <- InvokeResult{TxID: txID, Err: err}
+	}()
+	return result
+}
+
+// submit runs the job on a worker of the queue and waits for its end. The workers are started by the first job.
+// While SubmitQueueSize jobs are waiting, it waits up to SubmitQueueTimeout for room, then fails with ErrOverloaded.
+// It fails once the setup is closed.
+func (setup *FabricSetup) submit(job func()) error {
+	queue := &setup.submissions
+	queue.mutex.RLock()
+	if queue.closed {
+		queue.mutex.RUnlock()
+		return fmt.Errorf("Unable to submit the invoke: the setup is closed")
+	}
+	if queue.jobs == nil {
+		queue.mutex.RUnlock()
+		setup.startSubmitWorkers()
+		return setup.submit(job)
+	}
+	done := make(chan struct{})
+	queued := func() {
+		defer close(done)
+		job()
+	}
+	select {
+	case queue.jobs <- queued:
+	default:
+		if err := setup.waitQueue(queued); err != nil {
+			queue.mutex.RUnlock()
+			return err
+		}
+	}
+	queue.mutex.RUnlock()
+	<-done
+	return nil
+}
+
+// waitQueue queues the job once there is room in the queue, up to SubmitQueueTimeout
+func (setup *FabricSetup) waitQueue(job func()) error {
+	queue := &setup.submissions
+	switch timeout := setup.SubmitQueueTimeout; {
+	case timeout < 0:
+		return ErrOverloaded
+	case timeout == 0:
+		queue.jobs <- job
+		return nil
+	default:
+		select {
+		case queue.jobs <- job:
+			return nil
+		case <-time.After(timeout):
+			return ErrOverloaded
+		}
+	}
+}
+
+// startSubmitWorkers starts the workers of the queue, once
+func (setup *FabricSetup) startSubmitWorkers() {
+	queue := &setup.submissions
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	if queue.jobs != nil || queue.closed {
+		return
+	}
+	parallelism := setup.SubmitParallelism
+	if parallelism <= 0 {
+		parallelism = defaultSubmitParallelism
+	}
+	queueSize := setup.SubmitQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultSubmitQueueSize
+	}
+	queue.jobs = make(chan func(), queueSize)
+	queue.stop = make(chan struct{})
+	if setup.SubmitRate > 0 {
+		queue.limiter = newRateLimiter(setup.SubmitRate, setup.SubmitBurst)
+	}
+	limiter := queue.limiter
+	for i := 0; i < parallelism; i++ {
+		queue.workers.Add(1)
+		go func() {
+			defer queue.workers.Done()
+			for {
+				select {
+				case job := <-queue.jobs:
+					if limiter != nil {
+						limiter.wait()
+					}
+					job()
+				case <-queue.stop:
+					// The queued jobs still run, their callers are waiting
+					for {
+						select {
+						case job := <-queue.jobs:
+							job()
+						default:
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+}
+
+// close stops the workers once the queued jobs are done, the next jobs fail
+func (queue *submitQueue) close() {
+	queue.mutex.Lock()
+	if queue.closed {
+		queue.mutex.Unlock()
+		return
+	}
+	queue.closed = true
+	if queue.stop != nil {
+		close(queue.stop)
+	}
+	queue.mutex.Unlock()
+	queue.workers.Wait()
+}
+
+// reopen lets a closed setup submit again, once initialized again
+func (queue *submitQueue) reopen() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.closed = false
+	queue.jobs = nil
+	queue.stop = nil
+	queue.limiter = nil
+}
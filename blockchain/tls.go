@@ -0,0 +1,251 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const defaultTLSReloadInterval = time.Minute
+
+// CertificateSource gives the client TLS certificate and its private key, in PEM.
+// It is read again at each reload, see ReloadTLSCertificates, so it can return the rotated ones.
+type CertificateSource interface {
+	Certificate() (certPEM []byte, keyPEM []byte, err error)
+}
+
+// FileCertificateSource reads the client TLS certificate and its key from files,
+// e.g. written by a secret store agent
+type FileCertificateSource struct {
+	CertPath	string
+	KeyPath		string
+}
+
+// Certificate reads the files
+func (source FileCertificateSource) Certificate() ([]byte, []byte, error) {
+	certPEM, err := ioutil.ReadFile(source.CertPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read the client TLS certificate: %v", err)
+	}
+	keyPEM, err := ioutil.ReadFile(source.KeyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read the client TLS key: %v", err)
+	}
+	return certPEM, keyPEM, nil
+}
+
+// clientCertificate is the certificate presented to the peers and the orderers, swapped when rotated.
+// The TLS handshakes ask for it, so the connections opened after a rotation use the new one.
+type clientCertificate struct {
+	mutex		sync.RWMutex
+	certificate	*tls.Certificate
+	certPEM		[]byte
+	keyPEM		[]byte
+	rootCerts	[]byte	// Content of TLSRootCertPath when the certificate was loaded, to detect its rotation too
+}
+
+// get returns the certificate for a TLS handshake, an empty one when there is none
+func (c *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.certificate == nil {
+		return &tls.Certificate{}, nil
+	}
+	return c.certificate, nil
+}
+
+// configured tells if a certificate is presented
+func (c *clientCertificate) configured() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.certificate != nil
+}
+
+// set replaces the certificate, and tells if it or the root certificates changed
+func (c *clientCertificate) set(certPEM []byte, keyPEM []byte, rootCerts []byte) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	changed := !bytes.Equal(c.rootCerts, rootCerts)
+	c.rootCerts = rootCerts
+	if certPEM == nil {
+		changed = changed || c.certificate != nil
+		c.certificate, c.certPEM, c.keyPEM = nil, nil, nil
+		return changed, nil
+	}
+	if c.certificate != nil && bytes.Equal(c.certPEM, certPEM) && bytes.Equal(c.keyPEM, keyPEM) {
+		return changed, nil
+	}
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("Invalid client TLS certificate: %v", err)
+	}
+	c.certificate, c.certPEM, c.keyPEM = &certificate, certPEM, keyPEM
+	return true, nil
+}
+
+// applyTLSConfig overrides the TLS settings of config.yaml with TLSEnabled and TLSRootCertPath
+// (or the root certificates of the SecretProvider).
+// The SDK builds the peer, orderer and event hub connections from its configuration, so the overrides
+// are written in it before any connection is made. When TLS is disabled, no certificate is loaded.
+// The connection to the Fabric CA keeps its own settings (client.fabricCA).
+func (setup *FabricSetup) applyTLSConfig(config api.Config) error {
+	configViper := config.GetFabricClientViper()
+	configViper.Set("client.tls.enabled", setup.TLSEnabled)
+	if !setup.TLSEnabled || setup.rootCertPath() == "" {
+		return nil
+	}
+
+	// The CA bundle is used to verify every peer and the orderer
+	configViper.Set("client.orderer.tls.certificate", setup.rootCertPath())
+	peersConfig, err := config.GetPeersConfig()
+	if err != nil {
+		return fmt.Errorf("Error reading peer config: %v", err)
+	}
+	peers := make([]map[string]interface{}, len(peersConfig))
+	for i, p := range peersConfig {
+		peers[i] = map[string]interface{}{
+			"host":			p.Host,
+			"port":			p.Port,
+			"eventHost":	p.EventHost,
+			"eventPort":	p.EventPort,
+			"primary":		p.Primary,
+			"tls":			map[string]interface{}{
+				"certificate":			setup.rootCertPath(),
+				"serverHostOverride":	p.TLS.ServerHostOverride,
+			},
+		}
+	}
+	configViper.Set("client.peers", peers)
+	return nil
+}
+
+// certificateSource returns the source of the client TLS certificate, nil when none is presented
+func (setup *FabricSetup) certificateSource() CertificateSource {
+	if setup.TLSClientCertSource != nil {
+		return setup.TLSClientCertSource
+	}
+	if setup.secretClientCert {
+		return secretCertificateSource{setup: setup}
+	}
+	if setup.TLSClientCertPath != "" {
+		return FileCertificateSource{CertPath: setup.TLSClientCertPath, KeyPath: setup.TLSClientKeyPath}
+	}
+	return nil
+}
+
+// loadTLSCertificates reads the client certificate and TLSRootCertPath, and tells if one of them changed
+func (setup *FabricSetup) loadTLSCertificates() (bool, error) {
+	var certPEM, keyPEM, rootCerts []byte
+	if setup.TLSEnabled {
+		if source := setup.certificateSource(); source != nil {
+			var err error
+			if certPEM, keyPEM, err = source.Certificate(); err != nil {
+				return false, err
+			}
+		}
+		var err error
+		if rootCerts, err = setup.writeSecretRootCerts(); err != nil {
+			return false, err
+		}
+		if rootCerts == nil && setup.TLSRootCertPath != "" {
+			if rootCerts, err = ioutil.ReadFile(setup.TLSRootCertPath); err != nil {
+				return false, fmt.Errorf("Unable to read the TLS root certificates: %v", err)
+			}
+		}
+	}
+	return setup.clientCertificate.set(certPEM, keyPEM, rootCerts)
+}
+
+// tlsDialOption returns the TLS credentials of a connection verified by the certificate pool,
+// presenting the client certificate when there is one
+func (setup *FabricSetup) tlsDialOption(certPool *x509.CertPool, serverHostOverride string) grpc.DialOption {
+	if !setup.clientCertificate.configured() {
+		return grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(certPool, serverHostOverride))
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		RootCAs:				certPool,
+		ServerName:				serverHostOverride,
+		GetClientCertificate:	setup.clientCertificate.get,
+	}))
+}
+
+// ReloadTLSCertificates reads the client certificate and the TLS root certificates again, then closes the connections
+// to the peers and reconnects the event hub, so the new ones are used without restarting.
+// The orderers open a connection per call, the next one uses them.
+// It is called every TLSReloadInterval, the connections being reset only when a certificate changed.
+func (setup *FabricSetup) ReloadTLSCertificates() error {
+	if !setup.Initialized {
+		return fmt.Errorf("Unable to reload the TLS certificates: the setup is not initialized")
+	}
+	if _, err := setup.loadTLSCertificates(); err != nil {
+		return err
+	}
+	return setup.resetConnections()
+}
+
+// resetConnections closes the connections to the peers and reconnects the event hub.
+// When supervised, the event hub is reconnected by the supervisor, which replays the blocks missed in the meantime.
+func (setup *FabricSetup) resetConnections() error {
+	setup.resetEndorsers()
+	if setup.EventHub == nil {
+		return nil
+	}
+	setup.EventHub.Disconnect()
+	if setup.supervisor != nil {
+		return nil
+	}
+	if err := setup.connectEventHub(setup.EventHub); err != nil {
+		return fmt.Errorf("Failed eventHub.Connect() [%s]", err)
+	}
+	return nil
+}
+
+// startTLSReload checks the TLS certificates every TLSReloadInterval, when there is a client certificate
+// or TLSRootCertPath, and resets the connections when one of them is rotated
+func (setup *FabricSetup) startTLSReload() {
+	interval := setup.TLSReloadInterval
+	if interval < 0 || !setup.TLSEnabled || (setup.certificateSource() == nil && setup.rootCertPath() == "") {
+		return
+	}
+	if interval == 0 {
+		interval = defaultTLSReloadInterval
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	setup.stopTLSReload = func() {
+		close(stop)
+		<-done
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				changed, err := setup.loadTLSCertificates()
+				if err != nil {
+					setup.logger().Errorf("Unable to reload the TLS certificates: %v", err)
+					continue
+				}
+				if !changed {
+					continue
+				}
+				setup.logger().Printf("TLS certificates rotated, reconnecting")
+				if err := setup.resetConnections(); err != nil {
+					setup.logger().Errorf("Unable to reconnect with the rotated TLS certificates: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+// countingSource counts the reads of the client certificate
+type countingSource struct {
+	reads	int
+}
+
+func (source *countingSource) Certificate() ([]byte, []byte, error) {
+	source.reads++
+	return nil, nil, nil
+}
+
+func TestTLSDisabledLoadsNoCertificate(t *testing.T) {
+	config := testConfig
+	source := &countingSource{}
+	setup := &FabricSetup{
+		TLSEnabled:				false,
+		TLSRootCertPath:		"/missing/ca.pem",
+		TLSClientCertSource:	source,
+	}
+	if err := setup.applyTLSConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if config.IsTLSEnabled() {
+		t.Error("TLS is still enabled in the configuration")
+	}
+	if config.GetFabricClientViper().GetString("client.orderer.tls.certificate") == setup.TLSRootCertPath {
+		t.Error("The root certificates were given to the orderer")
+	}
+	peers, err := config.GetPeersConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range peers {
+		if p.TLS.Certificate == setup.TLSRootCertPath {
+			t.Errorf("The root certificates were given to the peer %s", p.Host)
+		}
+	}
+
+	if _, err := setup.loadTLSCertificates(); err != nil {
+		t.Errorf("A certificate was loaded: %v", err)
+	}
+	if source.reads != 0 || setup.clientCertificate.configured() {
+		t.Error("The client certificate was read")
+	}
+
+	// The same files are read once TLS is enabled
+	setup.TLSEnabled = true
+	if _, err := setup.loadTLSCertificates(); err == nil || source.reads != 1 {
+		t.Errorf("Got %v after %d reads, want the missing root certificates after 1", err, source.reads)
+	}
+}
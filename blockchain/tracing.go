@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+)
+
+// Tracer starts a span around each network operation (Initialize, Query, Invoke, Install
+// and Instantiate). It is kept minimal so an OpenTelemetry tracer can be plugged with a
+// small adapter, without making the package depend on it.
+type Tracer interface {
+	StartSpan(operation string) Span
+}
+
+// Span is an operation being traced
+type Span interface {
+	SetAttribute(key string, value string)
+	RecordError(err error)
+	End()
+}
+
+// ContextTracer is a Tracer starting the spans of the operations called with a context (QueryWith,
+// InvokeWith...) under the span of the context, e.g. the one of an incoming HTTP request extracted by the
+// middleware of the tracing library
+type ContextTracer interface {
+	Tracer
+	StartSpanFromContext(ctx context.Context, operation string) Span
+}
+
+// ParentSpan is a Span starting child spans, for the phases of an operation: the endorsement by each peer,
+// the ordering and the wait of the commit of an invoke. The phases of a span without children are not traced.
+type ParentSpan interface {
+	Span
+	StartChild(operation string) Span
+}
+
+// Attributes recorded on the spans
+const (
+	AttributeChannel	= "fabric.channel"
+	AttributeChaincode	= "fabric.chaincode"
+	AttributeTxID		= "fabric.tx_id"
+	AttributePeer		= "fabric.peer"
+	AttributeBlock		= "fabric.block"
+)
+
+// noopSpan is used when no tracer is set
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value string)	{}
+func (noopSpan) RecordError(err error)					{}
+func (noopSpan) End()									{}
+
+// startSpan starts a span for the operation, with the channel and chaincode attributes
+func (setup *FabricSetup) startSpan(operation string) Span {
+	if setup.Tracer == nil {
+		return noopSpan{}
+	}
+	span := setup.Tracer.StartSpan(operation)
+	span.SetAttribute(AttributeChannel, setup.ChannelId)
+	span.SetAttribute(AttributeChaincode, setup.ChaincodeId)
+	return span
+}
+
+// startTargetSpan starts a span for the operation on the target, under the span of its context, if any
+func (setup *FabricSetup) startTargetSpan(target channelTarget, operation string) Span {
+	if setup.Tracer == nil {
+		return noopSpan{}
+	}
+	var span Span
+	if tracer, ok := setup.Tracer.(ContextTracer); ok && target.ctx != nil {
+		span = tracer.StartSpanFromContext(target.ctx, operation)
+	} else {
+		span = setup.Tracer.StartSpan(operation)
+	}
+	span.SetAttribute(AttributeChannel, target.channelID)
+	span.SetAttribute(AttributeChaincode, target.chaincodeID)
+	return span
+}
+
+// startChildSpan starts a span for a phase of the operation of the parent span, if it starts children
+func startChildSpan(parent Span, operation string) Span {
+	if parent, ok := parent.(ParentSpan); ok {
+		return parent.StartChild(operation)
+	}
+	return noopSpan{}
+}
+
+// endEndorsementSpan ends the span of the endorsement of a peer, with the error of its response or its rejection
+func endEndorsementSpan(span Span, response *api.TransactionProposalResponse) {
+	err := response.Err
+	if err == nil {
+		if status := response.ProposalResponse.GetResponse().GetStatus(); status != 200 {
+			err = fmt.Errorf("Endorser %s return status %d: %s", response.Endorser, status, response.ProposalResponse.GetResponse().GetMessage())
+		}
+	}
+	endSpan(span, err)
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"fmt"
+	"strings"
+	api "github.com/hyperledger/fabric-sdk-go/api"
+	fabricCAClient "github.com/hyperledger/fabric-sdk-go/pkg/fabric-ca-client"
+	sdkUser "github.com/hyperledger/fabric-sdk-go/pkg/fabric-client/user"
+)
+
+// RegisterUser registers a new identity with the Fabric CA, using the admin as registrar, and returns
+// the enrollment secret generated by the CA. The user is then enrolled with EnrollUser.
+func (setup *FabricSetup) RegisterUser(name string, affiliation string) (string, error) {
+	caClient, registrar, err := setup.registrar()
+	if err != nil {
+		return "", err
+	}
+	secret, err := caClient.Register(registrar, &api.RegistrationRequest{
+		Name:			name,
+		Type:			"user",
+		Affiliation:	affiliation,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to register the user %s: %v", name, err)
+	}
+	return secret, nil
+}
+
+// EnrollUser enrolls a registered identity with the Fabric CA and saves its credentials in the state store.
+// The user can then be given to SetUserContext, or to QueryWith and InvokeWith with WithUser.
+func (setup *FabricSetup) EnrollUser(name string, secret string) (api.User, error) {
+	caClient, err := fabricCAClient.NewFabricCAClient(setup.Client.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("NewFabricCAClient return error: %v", err)
+	}
+	key, cert, err := caClient.Enroll(name, secret)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to enroll the user %s: %v", name, err)
+	}
+	enrolledUser := sdkUser.NewUser(name)
+	enrolledUser.SetPrivateKey(key)
+	enrolledUser.SetEnrollmentCertificate(cert)
+	if err := setup.Client.SaveUserToStateStore(enrolledUser, false); err != nil {
+		return nil, fmt.Errorf("Unable to save the user %s in the state store: %v", name, err)
+	}
+
+	return NewMSPUser(enrolledUser, setup.Client.GetConfig().GetFabricCAID()), nil
+}
+
+// SetUserContext makes the user enrolled before (read from the state store) sign the next proposals
+// and transactions, instead of the organisation admin. It waits for the QueryWith and InvokeWith in progress.
+func (setup *FabricSetup) SetUserContext(name string) error {
+	user, err := setup.loadEnrolledUser(name)
+	if err != nil {
+		return fmt.Errorf("Unable to load the user %s from the state store: %v", name, err)
+	}
+	if user == nil {
+		return fmt.Errorf("The user %s is not enrolled", name)
+	}
+
+	setup.userMutex.Lock()
+	defer setup.userMutex.Unlock()
+	setup.Client.SetUserContext(user)
+	return nil
+}
+
+// RegisterAndEnrollUser registers a new identity with the Fabric CA, using the admin as registrar, and enrolls it.
+// The credentials are saved in the state store, and the user can be given to the client with SetUserContext.
+// The secret is the enrollment secret of the identity, generated by the CA when empty. When the identity is
+// already registered, it is enrolled with the given secret.
+func (setup *FabricSetup) RegisterAndEnrollUser(name string, affiliation string, secret string) (api.User, error) {
+
+	// An identity enrolled before is read from the state store
+	user, err := setup.loadEnrolledUser(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load the user %s from the state store: %v", name, err)
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	caClient, registrar, err := setup.registrar()
+	if err != nil {
+		return nil, err
+	}
+	registeredSecret, err := caClient.Register(registrar, &api.RegistrationRequest{
+		Name:			name,
+		Type:			"user",
+		Affiliation:	affiliation,
+		Secret:			secret,
+	})
+	if err != nil {
+		if !strings.Contains(err.Error(), "is already registered") {
+			return nil, fmt.Errorf("Unable to register the user %s: %v", name, err)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("The user %s is already registered, its secret is needed to enroll it", name)
+		}
+		registeredSecret = secret
+	}
+
+	return setup.EnrollUser(name, registeredSecret)
+}
+
+// registrar returns a Fabric CA client and the admin enrolled during the initialization, which registers the users
+func (setup *FabricSetup) registrar() (api.Services, api.User, error) {
+	registrar, err := setup.loadEnrolledUser(setup.AdminUser)
+	if err != nil || registrar == nil {
+		return nil, nil, fmt.Errorf("Unable to load the registrar %s from the state store: %v", setup.AdminUser, err)
+	}
+	caClient, err := fabricCAClient.NewFabricCAClient(setup.Client.GetConfig())
+	if err != nil {
+		return nil, nil, fmt.Errorf("NewFabricCAClient return error: %v", err)
+	}
+	return caClient, registrar, nil
+}
+
+// asUser runs the operation with the given user as the user context of the client, so the proposals
+// and transactions are signed by it, then restores the previous user.
+// The user context is shared by the whole setup: the operations run as another user are serialized,
+// and wait for the QueryWith and InvokeWith in progress, which can run concurrently with each other.
+// The other operations (like QueryHello or Simulate) don't wait and must not run at the same time.
+func (setup *FabricSetup) asUser(user api.User, operation func() error) error {
+	if user == nil {
+		return fmt.Errorf("No user to run the operation as")
+	}
+	setup.userMutex.Lock()
+	defer setup.userMutex.Unlock()
+
+	previous := setup.Client.GetUserContext()
+	setup.Client.SetUserContext(user)
+	defer setup.Client.SetUserContext(previous)
+
+	return operation()
+}
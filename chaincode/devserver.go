@@ -0,0 +1,97 @@
+// +build devmode
+
+// The development server of the chaincode, run with "go run -tags devmode ./chaincode" where the shim is, for
+// the development mode of the service (HEROES_DEV_MODE). It executes the proposals of the service on the mock stub
+// of the shim, in memory: no peer, orderer nor Docker. The writes are applied at once and lost when the server stops.
+// The mock stub implements neither the history nor the rich queries.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Address the development server listens to, localhost:9999 by default (HEROES_DEV_MODE_ADDRESS of the service)
+const devAddressEnv = "CHAINCODE_DEV_ADDRESS"
+
+func init() {
+	serveExternal = func(chaincode shim.Chaincode) error {
+		address := os.Getenv(devAddressEnv)
+		if address == "" {
+			address = "localhost:9999"
+		}
+		return serveDev(address, chaincode)
+	}
+}
+
+// devInvocation is a proposal of the service, see blockchain/devmode.go
+type devInvocation struct {
+	TxID			string		`json:"txId"`
+	Args			[][]byte	`json:"args"`
+	SignedProposal	[]byte		`json:"signedProposal"`
+}
+
+// devResult is the response of the chaincode, with the last event it set like a peer keeps it
+type devResult struct {
+	Status			int32	`json:"status"`
+	Message			string	`json:"message"`
+	Payload			[]byte	`json:"payload"`
+	EventName		string	`json:"eventName"`
+	EventPayload	[]byte	`json:"eventPayload"`
+}
+
+// devServer executes the invocations one at a time on the mock stub
+type devServer struct {
+	mutex	sync.Mutex
+	stub	*shim.MockStub
+}
+
+// serveDev initializes the chaincode on a mock stub and serves its invocations on the address
+func serveDev(address string, chaincode shim.Chaincode) error {
+	stub := shim.NewMockStub("heroes-service", chaincode)
+	if response := stub.MockInit("init", [][]byte{[]byte("init")}); response.Status != shim.OK {
+		return fmt.Errorf("Init of the chaincode failed: %s", response.Message)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/invoke", &devServer{stub: stub})
+	fmt.Printf("Heroes Service chaincode in development mode listening on %s\n", address)
+	return http.ListenAndServe(address, mux)
+}
+
+func (server *devServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var invocation devInvocation
+	if err := json.NewDecoder(r.Body).Decode(&invocation); err != nil {
+		http.Error(w, "Invalid invocation: " + err.Error(), http.StatusBadRequest)
+		return
+	}
+	signedProposal := &pb.SignedProposal{}
+	if err := proto.Unmarshal(invocation.SignedProposal, signedProposal); err != nil {
+		http.Error(w, "Invalid signed proposal: " + err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.mutex.Lock()
+	response := server.stub.MockInvokeWithSignedProposal(invocation.TxID, invocation.Args, signedProposal)
+	result := devResult{Status: response.Status, Message: response.Message, Payload: response.Payload}
+	for drained := false; !drained; {
+		select {
+		case event := <-server.stub.ChaincodeEventsChannel:
+			result.EventName, result.EventPayload = event.EventName, event.Payload
+		default:
+			drained = true
+		}
+	}
+	server.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&result); err != nil {
+		fmt.Printf("Error sending the response of %s: %s\n", invocation.TxID, err)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
@@ -91,10 +94,134 @@ func (t *HeroesServiceChaincode) query(stub shim.ChaincodeStubInterface, args []
 		return shim.Success(state)
 	}
 
+	// The hero matching the id given as third argument, stored in JSON
+	if args[1] == "hero" && len(args) == 3 {
+
+		state, err := stub.GetState("hero_" + args[2])
+		if err != nil {
+			return shim.Error("Failed to get state of the hero")
+		}
+
+		// Return this value in response, empty if the hero doesn't exist
+		return shim.Success(state)
+	}
+
+	// The modifications of the key given as third argument, oldest first
+	if args[1] == "history" && len(args) == 3 {
+		return t.queryHistory(stub, args[2])
+	}
+
+	// The records matching the CouchDB selector given as third argument, by pages of the size given as
+	// fourth argument, from the bookmark given as fifth argument (empty for the first page)
+	if args[1] == "rich" && len(args) == 5 {
+		return t.queryRich(stub, args[2], args[3], args[4])
+	}
+
 	// If the arguments given don't match any function, we return an error
 	return shim.Error("Unknown query action, check the second argument.")
 }
 
+// richQueryPage is the response of a rich query, the bookmark gives the next page (empty on the last one)
+type richQueryPage struct {
+	Records		[]richQueryRecord	`json:"records"`
+	Bookmark	string				`json:"bookmark"`
+}
+
+type richQueryRecord struct {
+	Key		string			`json:"key"`
+	Value	json.RawMessage	`json:"value"`
+}
+
+// queryRich runs a CouchDB rich query and returns a page of its records.
+// The state database gives no bookmark in this Fabric version, the bookmark is the number of records already returned.
+func (t *HeroesServiceChaincode) queryRich(stub shim.ChaincodeStubInterface, selector string, pageSizeArg string, bookmark string) pb.Response {
+	var selectorObject map[string]interface{}
+	if err := json.Unmarshal([]byte(selector), &selectorObject); err != nil {
+		return shim.Error("The selector must be a JSON object.")
+	}
+	pageSize, err := strconv.Atoi(pageSizeArg)
+	if err != nil || pageSize <= 0 {
+		return shim.Error("The page size must be a positive number.")
+	}
+	offset := 0
+	if bookmark != "" {
+		offset, err = strconv.Atoi(bookmark)
+		if err != nil || offset < 0 {
+			return shim.Error("Invalid bookmark.")
+		}
+	}
+
+	iterator, err := stub.GetQueryResult(`{"selector":` + selector + `}`)
+	if err != nil {
+		return shim.Error("Failed to run the rich query: " + err.Error())
+	}
+	defer iterator.Close()
+
+	page := richQueryPage{Records: []richQueryRecord{}}
+	for index := 0; iterator.HasNext(); index++ {
+		result, err := iterator.Next()
+		if err != nil {
+			return shim.Error("Failed to read the result of the rich query")
+		}
+		if index < offset {
+			continue
+		}
+		// One more record than the page, so there is a next page
+		if len(page.Records) == pageSize {
+			page.Bookmark = strconv.Itoa(offset + pageSize)
+			break
+		}
+		page.Records = append(page.Records, richQueryRecord{Key: result.Key, Value: json.RawMessage(result.Value)})
+	}
+
+	payload, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error("Failed to marshal the page of the rich query")
+	}
+	return shim.Success(payload)
+}
+
+// keyModification is a modification of a key in the response of a history query
+type keyModification struct {
+	TxID		string	`json:"txId"`
+	Timestamp	string	`json:"timestamp,omitempty"`	// RFC 3339
+	Value		[]byte	`json:"value"`
+	IsDelete	bool	`json:"isDelete"`
+}
+
+// queryHistory returns the modifications of the key in JSON, the peers must keep the history (the default)
+func (t *HeroesServiceChaincode) queryHistory(stub shim.ChaincodeStubInterface, key string) pb.Response {
+	iterator, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return shim.Error("Failed to get the history of the key: " + err.Error())
+	}
+	defer iterator.Close()
+
+	modifications := []keyModification{}
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		if err != nil {
+			return shim.Error("Failed to read the history of the key")
+		}
+		var timestamp string
+		if modification.Timestamp != nil {
+			timestamp = time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC().Format(time.RFC3339Nano)
+		}
+		modifications = append(modifications, keyModification{
+			TxID:		modification.TxId,
+			Timestamp:	timestamp,
+			Value:		modification.Value,
+			IsDelete:	modification.IsDelete,
+		})
+	}
+
+	payload, err := json.Marshal(modifications)
+	if err != nil {
+		return shim.Error("Failed to marshal the history of the key")
+	}
+	return shim.Success(payload)
+}
+
 // invoke
 // Every functions that read and write in the ledger will be here
 func (t *HeroesServiceChaincode) invoke(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -114,11 +241,48 @@ func (t *HeroesServiceChaincode) invoke(stub shim.ChaincodeStubInterface, args [
 		return shim.Success(nil)
 	}
 
+	// Create or replace the hero matching the id given as third argument, with the JSON given as fourth argument
+	if args[1] == "hero" && len(args) == 4 {
+
+		current, err := stub.GetState("hero_" + args[2])
+		if err != nil {
+			return shim.Error("Failed to get state of the hero")
+		}
+		err = stub.PutState("hero_" + args[2], []byte(args[3]))
+		if err != nil {
+			return shim.Error("Failed to update state of the hero")
+		}
+
+		// Tell the listeners, with the hero as payload
+		eventName := "heroUpdated"
+		if current == nil {
+			eventName = "heroCreated"
+		}
+		if err := stub.SetEvent(eventName, []byte(args[3])); err != nil {
+			return shim.Error("Failed to set the event of the hero")
+		}
+
+		// Return this value in response
+		return shim.Success(nil)
+	}
+
 	// If the arguments given don't match any function, we return an error
 	return shim.Error("Unknown invoke action, check the second argument.")
 }
 
+// serveExternal runs the chaincode as an external service, only set when built with the ccaas tag (see server.go),
+// or as the development server with the devmode tag (see devserver.go)
+var serveExternal func(chaincode shim.Chaincode) error
+
 func main() {
+	// Run as an external service or the development server when built for it, see server.go and devserver.go
+	if serveExternal != nil {
+		if err := serveExternal(new(HeroesServiceChaincode)); err != nil {
+			fmt.Printf("Error serving Heroes Service chaincode: %s\n", err)
+		}
+		return
+	}
+
 	// Start the chaincode and make it ready for futures requests
 	err := shim.Start(new(HeroesServiceChaincode))
 	if err != nil {
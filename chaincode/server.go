@@ -0,0 +1,108 @@
+// +build ccaas
+
+// The runner of the chaincode as an external service (chaincode-as-a-service of Fabric 2.x), built with
+// "go build -tags ccaas" where the shim is, e.g. in the chaincode builder image. It is left out of the build
+// of the peer, which doesn't have gRPC at hand.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"google.golang.org/grpc"
+)
+
+// Address the chaincode server listens to, e.g. 0.0.0.0:9999, the peer dials it
+const serverAddressEnv = "CHAINCODE_SERVER_ADDRESS"
+
+// The package ID of the chaincode, given by the install, the chaincode registers with it
+const packageIDEnv = "CHAINCODE_ID"
+
+// chaincodeServiceDesc is the Chaincode service of Fabric 2.x (peer/chaincode_shim.proto), which the peer
+// calls to connect to an external chaincode. The protos and the shim of Fabric 1.x only have the service of the peer,
+// so the stream is handed to the in-process shim, which speaks the same messages.
+var chaincodeServiceDesc = grpc.ServiceDesc{
+	ServiceName:	"protos.Chaincode",
+	HandlerType:	(*interface{})(nil),
+	Streams:		[]grpc.StreamDesc{{
+		StreamName:		"Connect",
+		Handler:		connectHandler,
+		ServerStreams:	true,
+		ClientStreams:	true,
+	}},
+}
+
+func init() {
+	serveExternal = func(chaincode shim.Chaincode) error {
+		address := os.Getenv(serverAddressEnv)
+		if address == "" {
+			return fmt.Errorf("The address of the chaincode server (%s) is not set", serverAddressEnv)
+		}
+		return serve(address, os.Getenv(packageIDEnv), chaincode)
+	}
+}
+
+// chaincodeServer runs the chaincode for each peer connecting to it
+type chaincodeServer struct {
+	packageID	string
+	chaincode	shim.Chaincode
+}
+
+// serve runs the chaincode as an external service listening to the address, until the listener fails.
+// The connection is in plaintext, the peer must not require TLS (tls_required false in connection.json).
+func serve(address string, packageID string, chaincode shim.Chaincode) error {
+	if packageID == "" {
+		return fmt.Errorf("The package ID of the chaincode (%s) is not set", packageIDEnv)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&chaincodeServiceDesc, &chaincodeServer{packageID: packageID, chaincode: chaincode})
+	fmt.Printf("Heroes Service chaincode %s listening on %s\n", packageID, address)
+	return server.Serve(listener)
+}
+
+// connectHandler runs the chaincode on the stream of a peer, until the peer disconnects
+func connectHandler(srv interface{}, stream grpc.ServerStream) error {
+	server := srv.(*chaincodeServer)
+	recv := make(chan *pb.ChaincodeMessage)
+	send := make(chan *pb.ChaincodeMessage)
+	done := make(chan struct{})
+	defer close(done)
+
+	// Forward the messages of the peer to the shim, the closed channel ends the shim
+	go func() {
+		defer close(recv)
+		for {
+			message := &pb.ChaincodeMessage{}
+			if err := stream.RecvMsg(message); err != nil {
+				return
+			}
+			select {
+			case recv <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+	// Forward the messages of the shim to the peer
+	go func() {
+		for {
+			select {
+			case message := <-send:
+				if err := stream.SendMsg(message); err != nil {
+					fmt.Printf("Error sending to the peer: %s\n", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return shim.StartInProc([]string{"CORE_CHAINCODE_ID_NAME=" + server.packageID}, nil, server.chaincode, recv, send)
+}
@@ -0,0 +1,352 @@
+// heroesctl administrates the heroes-service network from the command line, one operation per run,
+// so the operational tasks can be scripted instead of being done by the web application at startup.
+// The network is the one of blockchain.DefaultConfig, read from the HEROES_* environment variables.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/chainhero/heroes-service/blockchain"
+	"github.com/chainhero/heroes-service/devnet"
+	"github.com/chainhero/heroes-service/integration"
+)
+
+// command is a subcommand of heroesctl
+type command struct {
+	name	string	// E.g. "channel create"
+	usage	string	// The arguments, after the flags
+	help	string
+	flags	func(flags *flag.FlagSet)	// Registers the flags of the command, if any
+	run		func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error
+	offline	func(flags *flag.FlagSet) error	// Runs instead of run, without initializing the setup
+}
+
+var commands = []*command{
+	{
+		name:	"channel create",
+		help:	"Create the channel from its configuration transaction, unless it exists",
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			return setup.CreateChannel()
+		},
+	},
+	{
+		name:	"channel join",
+		help:	"Make the peers of the organisation join the channel",
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			return setup.JoinPeers()
+		},
+	},
+	{
+		name:	"channel update",
+		usage:	"update.tx",
+		help:	"Apply a configuration update transaction to the channel, signed by the organisation admin",
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			if flags.NArg() != 1 {
+				return fmt.Errorf("The configuration update transaction is missing")
+			}
+			return setup.UpdateChannelConfig(flags.Arg(0))
+		},
+	},
+	{
+		name:	"channel anchors",
+		usage:	"host:port...",
+		help:	"Set the anchor peers of the organisation in the channel configuration",
+		flags:	func(flags *flag.FlagSet) {
+			flags.String("msp", "Org1MSP", "MSP ID of the organisation")
+		},
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			if flags.NArg() < 1 {
+				return fmt.Errorf("The anchor peers are missing")
+			}
+			return setup.SetAnchorPeers(flags.Lookup("msp").Value.String(), flags.Args())
+		},
+	},
+	{
+		name:	"chaincode install",
+		help:	"Install the chaincode on the peers of the organisation",
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			return setup.InstallCC()
+		},
+	},
+	{
+		name:	"chaincode instantiate",
+		usage:	"[function [args...]]",
+		help:	"Instantiate the installed chaincode, calling its Init function with the arguments",
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			return setup.InstantiateCC(argsOrNil(flags.Args()))
+		},
+	},
+	{
+		name:	"chaincode upgrade",
+		usage:	"version [function [args...]]",
+		help:	"Install the new version of the chaincode and upgrade the instantiated chaincode to it",
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			if flags.NArg() < 1 {
+				return fmt.Errorf("The new version is missing")
+			}
+			var args [][]byte
+			for _, arg := range flags.Args()[1:] {
+				args = append(args, []byte(arg))
+			}
+			return setup.UpgradeCC(flags.Arg(0), args)
+		},
+	},
+	{
+		name:	"invoke",
+		usage:	"function [args...]",
+		help:	"Invoke the chaincode and wait for the transaction to be committed, prints the transaction ID",
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			if flags.NArg() < 1 {
+				return fmt.Errorf("The function is missing")
+			}
+			txID, err := setup.InvokeWith(context.Background(), flags.Arg(0), flags.Args()[1:])
+			if err != nil {
+				return err
+			}
+			fmt.Println(txID)
+			return nil
+		},
+	},
+	{
+		name:	"query",
+		usage:	"function [args...]",
+		help:	"Query the chaincode, prints the payload",
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			if flags.NArg() < 1 {
+				return fmt.Errorf("The function is missing")
+			}
+			payload, err := setup.QueryWith(context.Background(), flags.Arg(0), flags.Args()[1:])
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(payload))
+			return nil
+		},
+	},
+	{
+		name:	"ledger export",
+		help:	"Write the blocks of the ledger as JSON, one per line, to the output or the standard output",
+		flags:	func(flags *flag.FlagSet) {
+			flags.Uint64("from", 0, "First block exported")
+			flags.Int64("to", -1, "Last block exported, the last block of the ledger when negative")
+			flags.String("o", "", "Output file, the standard output when not set")
+		},
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			from, _ := strconv.ParseUint(flags.Lookup("from").Value.String(), 10, 64)
+			to, _ := strconv.ParseInt(flags.Lookup("to").Value.String(), 10, 64)
+			if to < 0 {
+				info, err := setup.QueryChainInfo()
+				if err != nil {
+					return err
+				}
+				if info.Height == 0 {
+					return fmt.Errorf("The ledger is empty")
+				}
+				to = int64(info.Height) - 1
+			}
+			path := flags.Lookup("o").Value.String()
+			if path == "" {
+				return setup.ExportLedger(os.Stdout, from, uint64(to))
+			}
+			file, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			err = setup.ExportLedger(file, from, uint64(to))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		},
+	},
+	{
+		name:	"user enroll",
+		usage:	"name [secret]",
+		help:	"Enroll the user with the Fabric CA, registering it first with -register (the secret is then printed)",
+		flags:	func(flags *flag.FlagSet) {
+			flags.Bool("register", false, "Register the user with the admin as registrar before enrolling it")
+			flags.String("affiliation", "org1.department1", "Affiliation of the user registered")
+		},
+		run:	func(setup *blockchain.FabricSetup, flags *flag.FlagSet) error {
+			if flags.NArg() < 1 {
+				return fmt.Errorf("The user name is missing")
+			}
+			name, secret := flags.Arg(0), flags.Arg(1)
+			if flags.Lookup("register").Value.String() == "true" {
+				var err error
+				secret, err = setup.RegisterUser(name, flags.Lookup("affiliation").Value.String())
+				if err != nil {
+					return err
+				}
+				fmt.Println(secret)
+			}
+			if secret == "" {
+				return fmt.Errorf("The secret of the user %s is missing", name)
+			}
+			_, err := setup.EnrollUser(name, secret)
+			return err
+		},
+	},
+	{
+		name:	"devnet up",
+		help:	"Start the fixtures network and wait until it is ready, initializing the setup on it with -init",
+		flags:	devnetFlags,
+		offline:	func(flags *flag.FlagSet) error {
+			network := newNetwork(flags)
+			if err := network.Up(context.Background()); err != nil {
+				return err
+			}
+			if flags.Lookup("init").Value.String() != "true" {
+				return nil
+			}
+			setup, err := network.Initialize(context.Background())
+			if err != nil {
+				return err
+			}
+			setup.Close()
+			return nil
+		},
+	},
+	{
+		name:	"devnet down",
+		help:	"Stop and remove the fixtures network",
+		flags:	devnetFlags,
+		offline:	func(flags *flag.FlagSet) error {
+			return newNetwork(flags).Down(context.Background())
+		},
+	},
+	{
+		name:	"devnet reset",
+		help:	"Remove the fixtures network, its chaincode containers and the state store, then start it again",
+		flags:	devnetFlags,
+		offline:	func(flags *flag.FlagSet) error {
+			return newNetwork(flags).Reset(context.Background())
+		},
+	},
+	{
+		name:	"integration",
+		help:	"Run the integration tests on a channel and a chaincode created for the run, prints the report",
+		flags:	devnetFlags,
+		offline:	func(flags *flag.FlagSet) error {
+			network := newNetwork(flags)
+			suite := &integration.Suite{Network: network, Logger: network.Logger}
+			report, err := suite.Run(context.Background())
+			if err != nil {
+				return err
+			}
+			fmt.Println(report)
+			return report.Err()
+		},
+	},
+}
+
+// devnetFlags registers the flags of the devnet commands
+func devnetFlags(flags *flag.FlagSet) {
+	flags.String("compose", "fixtures/docker-compose.yaml", "Compose file of the network")
+	flags.Duration("timeout", 2*time.Minute, "Wait for the services of the network")
+	flags.Bool("init", false, "Initialize the setup on the network once ready (devnet up)")
+}
+
+// newNetwork returns the network of the devnet flags
+func newNetwork(flags *flag.FlagSet) *devnet.Network {
+	timeout, _ := time.ParseDuration(flags.Lookup("timeout").Value.String())
+	return &devnet.Network{
+		ComposeFile:	flags.Lookup("compose").Value.String(),
+		ReadyTimeout:	timeout,
+		Logger:			blockchain.StdLogger{Debug: flags.Lookup("debug").Value.String() == "true"},
+	}
+}
+
+func main() {
+	name, args := findCommand(os.Args[1:])
+	cmd := lookup(name)
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("heroesctl "+cmd.name, flag.ExitOnError)
+	user := flags.String("user", "", "Enrolled user running the invoke or query, the organisation admin when not set")
+	debug := flags.Bool("debug", false, "Log the debug messages of the setup")
+	if cmd.flags != nil {
+		cmd.flags(flags)
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: heroesctl %s [flags] %s\n%s\n\nFlags:\n", cmd.name, cmd.usage, cmd.help)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if cmd.offline != nil {
+		if err := cmd.offline(flags); err != nil {
+			fmt.Fprintf(os.Stderr, "heroesctl %s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := run(cmd, flags, *user, *debug); err != nil {
+		fmt.Fprintf(os.Stderr, "heroesctl %s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+// run initializes the setup without touching the channel, runs the command and closes the setup
+func run(cmd *command, flags *flag.FlagSet, user string, debug bool) error {
+	setup := blockchain.NewFabricSetup()
+	setup.Logger = blockchain.StdLogger{Debug: debug}
+	setup.JoinChannel = false
+	setup.SkipChannelMembershipCheck = strings.HasPrefix(cmd.name, "channel ")
+	setup.EventSupervisorInterval = -1	// A single operation doesn't outlive a disconnection
+	if err := setup.Initialize(); err != nil {
+		return err
+	}
+	defer setup.Close()
+
+	if user != "" {
+		if err := setup.SetUserContext(user); err != nil {
+			return err
+		}
+	}
+	return cmd.run(setup, flags)
+}
+
+// findCommand splits the arguments between the name of the command (one or two words) and its own arguments
+func findCommand(args []string) (string, []string) {
+	if len(args) >= 2 && lookup(args[0]+" "+args[1]) != nil {
+		return args[0] + " " + args[1], args[2:]
+	}
+	if len(args) >= 1 {
+		return args[0], args[1:]
+	}
+	return "", nil
+}
+
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: heroesctl <command> [flags] [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-22s %s\n", cmd.name, cmd.help)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun heroesctl <command> -h for the flags of a command.\n")
+}
+
+// argsOrNil returns nil without arguments, so the default arguments apply
+func argsOrNil(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
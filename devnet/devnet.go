@@ -0,0 +1,527 @@
+// Package devnet starts, stops and resets the local network of the fixtures (fixtures/docker-compose.yaml),
+// waits for its CA, peers and orderer, and initializes a setup on it, so the end-to-end tests and heroesctl
+// don't rely on a "sleep 15"
+package devnet
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"github.com/chainhero/heroes-service/blockchain"
+	docker "github.com/fsouza/go-dockerclient"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultComposeFile	= "fixtures/docker-compose.yaml"
+	defaultReadyTimeout	= 2 * time.Minute
+	readyPollInterval	= time.Second
+	dialTimeout			= time.Second
+	projectLabel		= "com.docker.compose.project"
+	serviceLabel		= "com.docker.compose.service"
+)
+
+// Network is the docker-compose network of the fixtures. Its containers are created, started and removed with the
+// Docker API, like docker-compose does (project named after the directory of the compose file, network
+// <project>_default, containers labelled with the project), so make env-up and env-down still work with them.
+// Only the keys of the compose file used by the fixtures are read.
+type Network struct {
+	ComposeFile		string				// "fixtures/docker-compose.yaml" when not set
+	Config			blockchain.Config	// Network the setup is initialized on, and whose chaincode containers Reset removes, DefaultConfig when not set
+	ReadyTimeout	time.Duration		// Wait for the services by Up, 2 minutes when not set
+	Docker			*docker.Client		// Client of the Docker API, from the DOCKER_* environment variables when not set
+	Logger			blockchain.Logger	// A StdLogger when not set
+}
+
+// service is a service of the compose file
+type service struct {
+	name		string
+	container	string		// None for a service only pulling its image, e.g. the builder of the fixtures
+	ports		[]string	// Published, "host:container", "ip:host:container" or with "/udp"
+	image		string
+	environment	[]string
+	command		string
+	workingDir	string
+	volumes		[]string	// "host:container[:mode]", the relative host paths from the directory of the compose file
+	dependsOn	[]string
+}
+
+// Up creates the containers of the network again, like make env-up, and waits until every service is ready
+func (network *Network) Up(ctx context.Context) error {
+	network.logger().Printf("Starting the network of %s", network.composeFile())
+	services, err := network.readComposeFile()
+	if err != nil {
+		return err
+	}
+	services, err = startOrder(services)
+	if err != nil {
+		return err
+	}
+	client, err := network.docker()
+	if err != nil {
+		return err
+	}
+	if err := network.createNetwork(client); err != nil {
+		return err
+	}
+	for _, service := range services {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := network.startService(client, service); err != nil {
+			return err
+		}
+	}
+	return network.WaitReady(ctx)
+}
+
+// Down stops and removes the containers and the network of the project, like make env-down
+func (network *Network) Down(ctx context.Context) error {
+	network.logger().Printf("Stopping the network of %s", network.composeFile())
+	client, err := network.docker()
+	if err != nil {
+		return err
+	}
+	containers, err := client.ListContainers(docker.ListContainersOptions{
+		All:		true,
+		Filters:	map[string][]string{"label": {projectLabel + "=" + network.project()}},
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to list the containers: %v", err)
+	}
+	for _, container := range containers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := client.RemoveContainer(docker.RemoveContainerOptions{ID: container.ID, Force: true, RemoveVolumes: true}); err != nil {
+			return fmt.Errorf("Unable to remove the container %s: %v", strings.Join(container.Names, ", "), err)
+		}
+	}
+	if err := client.RemoveNetwork(network.networkName()); err != nil {
+		if _, ok := err.(*docker.NoSuchNetwork); !ok {
+			return fmt.Errorf("Unable to remove the network %s: %v", network.networkName(), err)
+		}
+	}
+	return nil
+}
+
+// createNetwork creates the network of the project, unless it exists
+func (network *Network) createNetwork(client *docker.Client) error {
+	if _, err := client.NetworkInfo(network.networkName()); err == nil {
+		return nil
+	}
+	_, err := client.CreateNetwork(docker.CreateNetworkOptions{Name: network.networkName(), Driver: "bridge", CheckDuplicate: true})
+	if err != nil && err != docker.ErrNetworkAlreadyExists {
+		return fmt.Errorf("Unable to create the network %s: %v", network.networkName(), err)
+	}
+	return nil
+}
+
+// startService pulls the image of the service if missing, then replaces its container by a new one and starts it,
+// like docker-compose up --force-recreate
+func (network *Network) startService(client *docker.Client, service service) error {
+	if _, err := client.InspectImage(service.image); err == docker.ErrNoSuchImage {
+		network.logger().Printf("Pulling %s", service.image)
+		repository, tag := splitImage(service.image)
+		if err := client.PullImage(docker.PullImageOptions{Repository: repository, Tag: tag}, docker.AuthConfiguration{}); err != nil {
+			return fmt.Errorf("Unable to pull the image %s: %v", service.image, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("Unable to inspect the image %s: %v", service.image, err)
+	}
+	if service.container == "" {
+		return nil
+	}
+
+	err := client.RemoveContainer(docker.RemoveContainerOptions{ID: service.container, Force: true, RemoveVolumes: true})
+	if _, ok := err.(*docker.NoSuchContainer); err != nil && !ok {
+		return fmt.Errorf("Unable to remove the container %s: %v", service.container, err)
+	}
+
+	command, err := splitCommand(service.command)
+	if err != nil {
+		return fmt.Errorf("Invalid command of the service %s: %v", service.name, err)
+	}
+	config := &docker.Config{
+		Image:			service.image,
+		Env:			service.environment,
+		Cmd:			command,
+		WorkingDir:		service.workingDir,
+		ExposedPorts:	map[docker.Port]struct{}{},
+		Labels:			map[string]string{projectLabel: network.project(), serviceLabel: service.name},
+	}
+	hostConfig := &docker.HostConfig{
+		NetworkMode:	network.networkName(),
+		PortBindings:	map[docker.Port][]docker.PortBinding{},
+	}
+	for _, port := range service.ports {
+		hostIP, hostPort, containerPort := splitPort(port)
+		config.ExposedPorts[containerPort] = struct{}{}
+		hostConfig.PortBindings[containerPort] = append(hostConfig.PortBindings[containerPort], docker.PortBinding{HostIP: hostIP, HostPort: hostPort})
+	}
+	for _, volume := range service.volumes {
+		parts := strings.SplitN(volume, ":", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], ".") {
+			hostPath, err := filepath.Abs(filepath.Join(filepath.Dir(network.composeFile()), parts[0]))
+			if err != nil {
+				return err
+			}
+			volume = hostPath + ":" + parts[1]
+		}
+		hostConfig.Binds = append(hostConfig.Binds, volume)
+	}
+
+	container, err := client.CreateContainer(docker.CreateContainerOptions{
+		Name:		service.container,
+		Config:		config,
+		HostConfig:	hostConfig,
+		NetworkingConfig: &docker.NetworkingConfig{EndpointsConfig: map[string]*docker.EndpointConfig{
+			network.networkName(): {Aliases: []string{service.name}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to create the container %s: %v", service.container, err)
+	}
+	if err := client.StartContainer(container.ID, nil); err != nil {
+		return fmt.Errorf("Unable to start the container %s: %v", service.container, err)
+	}
+	return nil
+}
+
+// Reset removes the network, the containers and images of its chaincode and the state store of the enrolled users,
+// like make clean, then starts the network again
+func (network *Network) Reset(ctx context.Context) error {
+	if err := network.Down(ctx); err != nil {
+		return err
+	}
+	if err := network.RemoveChaincode(); err != nil {
+		return err
+	}
+	if err := blockchain.RemoveStateStore(network.config().StateStore); err != nil {
+		return err
+	}
+	return network.Up(ctx)
+}
+
+// Initialize waits until the network is ready, then initializes a setup of Config on it
+func (network *Network) Initialize(ctx context.Context) (*blockchain.FabricSetup, error) {
+	if err := network.WaitReady(ctx); err != nil {
+		return nil, err
+	}
+	setup := blockchain.NewFabricSetupFromConfig(network.config())
+	setup.Logger = network.Logger
+	if err := setup.InitializeWithContext(ctx); err != nil {
+		return nil, err
+	}
+	return setup, nil
+}
+
+// WaitReady waits up to ReadyTimeout until the container of each service publishing ports runs and accepts
+// connections on them. The error lists the services not ready.
+func (network *Network) WaitReady(ctx context.Context) error {
+	all, err := network.readComposeFile()
+	if err != nil {
+		return err
+	}
+	var services []service
+	for _, service := range all {
+		if len(service.ports) > 0 {
+			services = append(services, service)
+		}
+	}
+	client, err := network.docker()
+	if err != nil {
+		return err
+	}
+	timeout := network.ReadyTimeout
+	if timeout == 0 {
+		timeout = defaultReadyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		var waiting []string
+		for _, service := range services {
+			if err := serviceReady(client, service); err != nil {
+				waiting = append(waiting, fmt.Sprintf("%s (%v)", service.name, err))
+			}
+		}
+		if len(waiting) == 0 {
+			network.logger().Printf("Network ready")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Network not ready: %s", strings.Join(waiting, ", "))
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// serviceReady tells why the service isn't ready, nil once it is
+func serviceReady(client *docker.Client, service service) error {
+	container, err := client.InspectContainer(service.container)
+	if err != nil {
+		return err
+	}
+	if !container.State.Running {
+		return fmt.Errorf("container %s", container.State.Status)
+	}
+	for _, port := range service.ports {
+		_, hostPort, containerPort := splitPort(port)
+		if containerPort.Proto() != "tcp" || hostPort == "" {
+			continue
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", hostPort), dialTimeout)
+		if err != nil {
+			return fmt.Errorf("port %s closed", hostPort)
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+// readComposeFile reads the services of the compose file, ordered by name
+func (network *Network) readComposeFile() ([]service, error) {
+	data, err := ioutil.ReadFile(network.composeFile())
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the compose file: %v", err)
+	}
+	var composeFile struct {
+		Services map[string]struct {
+			ContainerName	string		`yaml:"container_name"`
+			Image			string		`yaml:"image"`
+			Environment		[]string	`yaml:"environment"`
+			Command			string		`yaml:"command"`
+			WorkingDir		string		`yaml:"working_dir"`
+			Ports			[]string	`yaml:"ports"`
+			Volumes			[]string	`yaml:"volumes"`
+			DependsOn		[]string	`yaml:"depends_on"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &composeFile); err != nil {
+		return nil, fmt.Errorf("Invalid compose file %s: %v", network.composeFile(), err)
+	}
+
+	var services []service
+	for name, definition := range composeFile.Services {
+		if definition.Image == "" {
+			return nil, fmt.Errorf("The service %s of the compose file has no image", name)
+		}
+		if definition.ContainerName == "" && len(definition.Ports) > 0 {
+			return nil, fmt.Errorf("The service %s of the compose file has no container_name", name)
+		}
+		services = append(services, service{
+			name:			name,
+			container:		definition.ContainerName,
+			ports:			definition.Ports,
+			image:			definition.Image,
+			environment:	definition.Environment,
+			command:		definition.Command,
+			workingDir:		definition.WorkingDir,
+			volumes:		definition.Volumes,
+			dependsOn:		definition.DependsOn,
+		})
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].name < services[j].name })
+	return services, nil
+}
+
+// startOrder orders the services so each one comes after the ones it depends on
+func startOrder(services []service) ([]service, error) {
+	started := make(map[string]bool)
+	var ordered []service
+	for len(ordered) < len(services) {
+		progress := false
+		for _, service := range services {
+			if started[service.name] {
+				continue
+			}
+			ready := true
+			for _, dependency := range service.dependsOn {
+				ready = ready && started[dependency]
+			}
+			if ready {
+				started[service.name] = true
+				ordered = append(ordered, service)
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, fmt.Errorf("The depends_on of the compose file are circular or name unknown services")
+		}
+	}
+	return ordered, nil
+}
+
+// splitPort returns the host IP (none for every interface), the host port and the container port of a published port
+func splitPort(port string) (string, string, docker.Port) {
+	protocol := "tcp"
+	if i := strings.Index(port, "/"); i >= 0 {
+		port, protocol = port[:i], port[i+1:]
+	}
+	parts := strings.Split(port, ":")
+	containerPort := docker.Port(parts[len(parts)-1] + "/" + protocol)
+	switch len(parts) {
+	case 1:
+		// Published on a random port of the host
+		return "", "", containerPort
+	case 2:
+		return "", parts[0], containerPort
+	}
+	return parts[0], parts[1], containerPort
+}
+
+// splitImage returns the repository and the tag of an image, "latest" when it has none
+func splitImage(image string) (string, string) {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// splitCommand splits the command of a service in arguments like a shell, with the single and double quotes
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unterminated quote in %s", command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// RemoveChaincode removes the containers and the images the peers built for the chaincode of Config, named
+// dev-<peer>-<chaincode>-<version>
+func (network *Network) RemoveChaincode() error {
+	client, err := network.docker()
+	if err != nil {
+		return err
+	}
+	chaincodeID := network.config().ChaincodeId
+	isChaincode := func(name string) bool {
+		name = strings.TrimPrefix(name, "/")
+		return strings.HasPrefix(name, "dev-") && strings.Contains(name, "-"+chaincodeID+"-")
+	}
+
+	containers, err := client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		return fmt.Errorf("Unable to list the containers: %v", err)
+	}
+	for _, container := range containers {
+		for _, name := range container.Names {
+			if !isChaincode(name) {
+				continue
+			}
+			if err := client.RemoveContainer(docker.RemoveContainerOptions{ID: container.ID, Force: true, RemoveVolumes: true}); err != nil {
+				return fmt.Errorf("Unable to remove the chaincode container %s: %v", name, err)
+			}
+			break
+		}
+	}
+
+	images, err := client.ListImages(docker.ListImagesOptions{})
+	if err != nil {
+		return fmt.Errorf("Unable to list the images: %v", err)
+	}
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if !isChaincode(tag) {
+				continue
+			}
+			if err := client.RemoveImage(image.ID); err != nil {
+				return fmt.Errorf("Unable to remove the chaincode image %s: %v", tag, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// project returns the name of the compose project, the directory of the compose file like docker-compose
+func (network *Network) project() string {
+	directory, err := filepath.Abs(filepath.Dir(network.composeFile()))
+	if err != nil {
+		directory = filepath.Dir(network.composeFile())
+	}
+	var project strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(directory)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			project.WriteRune(r)
+		}
+	}
+	return project.String()
+}
+
+// networkName returns the network of the project, the peers start the chaincode containers on it
+// (CORE_VM_DOCKER_HOSTCONFIG_NETWORKMODE)
+func (network *Network) networkName() string {
+	return network.project() + "_default"
+}
+
+// composeFile returns the compose file of the network
+func (network *Network) composeFile() string {
+	if network.ComposeFile == "" {
+		return defaultComposeFile
+	}
+	return network.ComposeFile
+}
+
+// config returns the config of the network
+func (network *Network) config() blockchain.Config {
+	if network.Config.ChannelId == "" {
+		return blockchain.DefaultConfig()
+	}
+	return network.Config
+}
+
+// docker returns the client of the Docker API, created from the environment on first use
+func (network *Network) docker() (*docker.Client, error) {
+	if network.Docker != nil {
+		return network.Docker, nil
+	}
+	client, err := docker.NewClientFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to Docker: %v", err)
+	}
+	network.Docker = client
+	return client, nil
+}
+
+// logger returns the logger of the network, a StdLogger when not set
+func (network *Network) logger() blockchain.Logger {
+	if network.Logger == nil {
+		return blockchain.StdLogger{}
+	}
+	return network.Logger
+}
@@ -0,0 +1,94 @@
+package devnet
+
+import (
+	"reflect"
+	"testing"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command	string
+		args	[]string
+	}{
+		{"peer node start", []string{"peer", "node", "start"}},
+		{"sh -c 'fabric-ca-server start -b admin:adminpw -d'", []string{"sh", "-c", "fabric-ca-server start -b admin:adminpw -d"}},
+		{`echo "a 'b'"  c`, []string{"echo", "a 'b'", "c"}},
+		{"echo ''", []string{"echo", ""}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		args, err := splitCommand(test.command)
+		if err != nil || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("splitCommand(%q) = %q, %v, want %q", test.command, args, err, test.args)
+		}
+	}
+	if _, err := splitCommand("sh -c 'unterminated"); err == nil {
+		t.Error("An unterminated quote was accepted")
+	}
+}
+
+func TestSplitPort(t *testing.T) {
+	tests := []struct {
+		port			string
+		hostIP			string
+		hostPort		string
+		containerPort	docker.Port
+	}{
+		{"7054:7054", "", "7054", "7054/tcp"},
+		{"8051:7051", "", "8051", "7051/tcp"},
+		{"127.0.0.1:5984:5984", "127.0.0.1", "5984", "5984/tcp"},
+		{"7053/udp", "", "", "7053/udp"},
+	}
+	for _, test := range tests {
+		hostIP, hostPort, containerPort := splitPort(test.port)
+		if hostIP != test.hostIP || hostPort != test.hostPort || containerPort != test.containerPort {
+			t.Errorf("splitPort(%q) = %q, %q, %q", test.port, hostIP, hostPort, containerPort)
+		}
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	for image, want := range map[string][2]string{
+		"hyperledger/fabric-peer:x86_64-1.0.0-rc1":	{"hyperledger/fabric-peer", "x86_64-1.0.0-rc1"},
+		"couchdb":									{"couchdb", "latest"},
+		"localhost:5000/peer":						{"localhost:5000/peer", "latest"},
+	} {
+		if repository, tag := splitImage(image); repository != want[0] || tag != want[1] {
+			t.Errorf("splitImage(%q) = %q, %q", image, repository, tag)
+		}
+	}
+}
+
+func TestFixturesComposeFile(t *testing.T) {
+	network := &Network{ComposeFile: "../fixtures/docker-compose.yaml"}
+	if project := network.project(); project != "fixtures" {
+		t.Errorf("Project %q, the peers expect the network fixtures_default", project)
+	}
+	services, err := network.readComposeFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ordered, err := startOrder(services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	position := make(map[string]int)
+	for i, service := range ordered {
+		position[service.name] = i
+	}
+	for _, service := range ordered {
+		for _, dependency := range service.dependsOn {
+			if position[dependency] > position[service.name] {
+				t.Errorf("%s starts before %s, which it depends on", service.name, dependency)
+			}
+		}
+	}
+}
+
+func TestStartOrderCircular(t *testing.T) {
+	_, err := startOrder([]service{{name: "a", dependsOn: []string{"b"}}, {name: "b", dependsOn: []string{"a"}}})
+	if err == nil {
+		t.Error("Circular dependencies were accepted")
+	}
+}
@@ -0,0 +1,190 @@
+// Package heroes is a typed client of the heroes stored by the chaincode, built on the QueryWith and InvokeWith
+// of a blockchain.ChainService
+package heroes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"github.com/chainhero/heroes-service/blockchain"
+)
+
+// Heroes read by page by ListHeroes
+const listPageSize = 100
+
+// The selector of the rich query matching every hero
+const everyHeroSelector = `{"id":{"$gt":null}}`
+
+var (
+	// ErrNotFound is returned when the hero doesn't exist
+	ErrNotFound = errors.New("Hero not found")
+	// ErrAlreadyExists is returned by CreateHero when the hero exists
+	ErrAlreadyExists = errors.New("Hero already exists")
+	// ErrUnsupported is returned when the chaincode deployed doesn't know the function, e.g. an older version
+	ErrUnsupported = errors.New("Not supported by the chaincode")
+)
+
+// InvalidHeroError is returned for a hero the chaincode can't store, before anything is sent
+type InvalidHeroError struct {
+	Reason string
+}
+
+func (e *InvalidHeroError) Error() string {
+	return "Invalid hero: " + e.Reason
+}
+
+// Hero is a hero stored in JSON by the chaincode. The fields other than id and name are kept in Attributes,
+// so a hero read then updated keeps them.
+type Hero struct {
+	ID			string
+	Name		string
+	Attributes	map[string]interface{}
+}
+
+// MarshalJSON writes the attributes with the id and the name
+func (hero Hero) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(hero.Attributes)+2)
+	for name, value := range hero.Attributes {
+		fields[name] = value
+	}
+	fields["id"] = hero.ID
+	if hero.Name != "" {
+		fields["name"] = hero.Name
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON reads the id and the name, the other fields go to the attributes
+func (hero *Hero) UnmarshalJSON(data []byte) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	id, ok := fields["id"].(string)
+	if !ok {
+		return fmt.Errorf("The hero has no string id")
+	}
+	name, _ := fields["name"].(string)
+	delete(fields, "id")
+	delete(fields, "name")
+	if len(fields) == 0 {
+		fields = nil
+	}
+	*hero = Hero{ID: id, Name: name, Attributes: fields}
+	return nil
+}
+
+// Client reads and writes the heroes through the chaincode
+type Client struct {
+	fabric blockchain.ChainService
+}
+
+// NewClient returns a client of the heroes of the service
+func NewClient(fabric blockchain.ChainService) *Client {
+	return &Client{fabric: fabric}
+}
+
+// CreateHero stores a new hero and returns the transaction ID. ErrAlreadyExists is returned when it exists.
+// The existence is checked by a query first, so two concurrent creations of the same hero may both succeed.
+func (client *Client) CreateHero(hero Hero) (string, error) {
+	if err := checkID(hero.ID); err != nil {
+		return "", err
+	}
+	if _, err := client.GetHero(hero.ID); err == nil {
+		return "", ErrAlreadyExists
+	} else if err != ErrNotFound {
+		return "", err
+	}
+	return client.putHero(hero)
+}
+
+// GetHero returns the hero, ErrNotFound when it doesn't exist
+func (client *Client) GetHero(id string) (*Hero, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+	payload, err := client.fabric.QueryWith(context.Background(), "invoke", []string{"query", "hero", id})
+	if err != nil {
+		return nil, chaincodeError("Unable to get the hero "+id, err)
+	}
+	// The chaincode answers an empty payload for a missing hero
+	if len(payload) == 0 {
+		return nil, ErrNotFound
+	}
+	hero := &Hero{}
+	if err := json.Unmarshal(payload, hero); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the hero %s: %v", id, err)
+	}
+	return hero, nil
+}
+
+// ListHeroes returns every hero, read by pages of a rich query. The peers must use CouchDB as state database.
+func (client *Client) ListHeroes() ([]Hero, error) {
+	var heroes []Hero
+	bookmark := ""
+	for {
+		page, err := client.fabric.QueryRich(everyHeroSelector, listPageSize, bookmark)
+		if err != nil {
+			return nil, chaincodeError("Unable to list the heroes", err)
+		}
+		for _, record := range page.Records {
+			var hero Hero
+			if err := json.Unmarshal(record.Value, &hero); err != nil {
+				return nil, fmt.Errorf("Unable to unmarshal the hero %s: %v", record.Key, err)
+			}
+			heroes = append(heroes, hero)
+		}
+		if page.Bookmark == "" || page.Bookmark == bookmark || len(page.Records) == 0 {
+			return heroes, nil
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+// UpdateHero replaces an existing hero and returns the transaction ID. ErrNotFound is returned when it doesn't exist.
+// Like CreateHero, the existence is checked by a query first.
+func (client *Client) UpdateHero(hero Hero) (string, error) {
+	if err := checkID(hero.ID); err != nil {
+		return "", err
+	}
+	if _, err := client.GetHero(hero.ID); err != nil {
+		return "", err
+	}
+	return client.putHero(hero)
+}
+
+// putHero stores the hero, created or replaced
+func (client *Client) putHero(hero Hero) (string, error) {
+	heroJSON, err := json.Marshal(hero)
+	if err != nil {
+		return "", fmt.Errorf("Unable to marshal the hero %s: %v", hero.ID, err)
+	}
+	txID, err := client.fabric.InvokeWith(context.Background(), "invoke", []string{"invoke", "hero", hero.ID, string(heroJSON)})
+	if err != nil {
+		return "", chaincodeError("Unable to store the hero "+hero.ID, err)
+	}
+	return txID, nil
+}
+
+// checkID checks the id can be stored by the chaincode and used in the URLs of the API
+func checkID(id string) error {
+	if id == "" {
+		return &InvalidHeroError{Reason: "the id is empty"}
+	}
+	if strings.Contains(id, "/") {
+		return &InvalidHeroError{Reason: fmt.Sprintf("the id %s contains a /", id)}
+	}
+	return nil
+}
+
+// chaincodeError maps the rejection of the chaincode to the errors of the package, the other errors
+// (e.g. the blockchain.TimeoutError) are wrapped
+func chaincodeError(message string, err error) error {
+	var rejected *blockchain.ChaincodeError
+	if errors.As(err, &rejected) && strings.HasPrefix(rejected.Message, "Unknown") {
+		return fmt.Errorf("%s: %w", message, ErrUnsupported)
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
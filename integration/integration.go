@@ -0,0 +1,313 @@
+// Package integration runs the blockchain package end to end on a running network: each run creates
+// its own channel and chaincode, named after the time of the run, goes through the install, instantiate,
+// invoke, query and events of the setup, then removes what it can. The channels of Fabric can't be removed,
+// the peers keep the channels of the previous runs until the network is reset (see devnet).
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"github.com/chainhero/heroes-service/blockchain"
+	"github.com/chainhero/heroes-service/devnet"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+	protosUtils "github.com/hyperledger/fabric/protos/utils"
+)
+
+const (
+	defaultPrefix		= "heroes-it"
+	defaultEventTimeout	= 30 * time.Second
+)
+
+// Suite is the integration tests of the blockchain package
+type Suite struct {
+	Config			blockchain.Config	// Network of the tests, DefaultConfig when not set. Its ChannelConfig is the template of the channels created.
+	Network			*devnet.Network		// Waited for before the tests, and removing the chaincode containers after them, if set
+	Prefix			string				// Of the channel and chaincode IDs, "heroes-it" when not set
+	EventTimeout	time.Duration		// Wait for a chaincode event, 30 seconds when not set
+	Logger			blockchain.Logger	// A StdLogger when not set
+}
+
+// Result is the outcome of a step of a run
+type Result struct {
+	Step		string
+	Duration	time.Duration
+	Err			error
+}
+
+// Report is the outcome of a run
+type Report struct {
+	ChannelID	string
+	ChaincodeID	string
+	Results		[]Result
+}
+
+// Err returns the error of the first step failed, nil when every step passed
+func (report *Report) Err() error {
+	for _, result := range report.Results {
+		if result.Err != nil {
+			return fmt.Errorf("%s failed: %w", result.Step, result.Err)
+		}
+	}
+	return nil
+}
+
+// String lists the steps with their outcome, one per line
+func (report *Report) String() string {
+	lines := []string{fmt.Sprintf("Channel %s, chaincode %s", report.ChannelID, report.ChaincodeID)}
+	for _, result := range report.Results {
+		outcome := "ok"
+		if result.Err != nil {
+			outcome = "FAIL: " + result.Err.Error()
+		}
+		lines = append(lines, fmt.Sprintf("%-24s %-8s %s", result.Step, result.Duration.Round(time.Millisecond), outcome))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// run is the state shared by the steps of a run
+type run struct {
+	suite	*Suite
+	config	blockchain.Config
+	setup	*blockchain.FabricSetup
+}
+
+// step is a step of a run, the next ones are skipped when it fails
+type step struct {
+	name	string
+	run		func(r *run, ctx context.Context) error
+}
+
+var steps = []step{
+	{"channel create and join", (*run).initialize},
+	{"chaincode deploy", (*run).deploy},
+	{"query", (*run).query},
+	{"invoke", (*run).invoke},
+	{"chaincode event", (*run).event},
+}
+
+// Run creates a channel and a chaincode for the run, runs the steps until one fails and tears down the run.
+// The error is the one of the run itself, e.g. the channel template unreadable, the failures of the steps are
+// in the report (see Report.Err).
+func (suite *Suite) Run(ctx context.Context) (*Report, error) {
+	config := suite.Config
+	if config.ChannelId == "" {
+		config = blockchain.DefaultConfig()
+	}
+	prefix := suite.Prefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	name := fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+
+	dir, err := ioutil.TempDir("", name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create the directory of the run: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	channelConfig := filepath.Join(dir, name+".tx")
+	if err := renameChannelConfig(config.ChannelConfig, channelConfig, name); err != nil {
+		return nil, err
+	}
+	config.ChannelId = name
+	config.ChannelConfig = channelConfig
+	config.ChaincodeId = name
+
+	if suite.Network != nil {
+		if err := suite.Network.WaitReady(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &run{suite: suite, config: config}
+	defer r.tearDown()
+	report := &Report{ChannelID: name, ChaincodeID: name}
+	for _, step := range steps {
+		start := time.Now()
+		err := step.run(r, ctx)
+		report.Results = append(report.Results, Result{Step: step.name, Duration: time.Since(start), Err: err})
+		if err != nil {
+			suite.logger().Errorf("Integration step %s failed: %v", step.name, err)
+			break
+		}
+		suite.logger().Printf("Integration step %s passed", step.name)
+	}
+	return report, nil
+}
+
+// initialize initializes the setup of the run, which creates its channel and makes the peers join it
+func (r *run) initialize(ctx context.Context) error {
+	r.setup = blockchain.NewFabricSetupFromConfig(r.config)
+	r.setup.Logger = r.suite.logger()
+	return r.setup.InitializeWithContext(ctx)
+}
+
+// deploy installs and instantiates the chaincode of the run, then checks the peers report it
+func (r *run) deploy(ctx context.Context) error {
+	if err := r.setup.InstallAndInstantiateCCWithContext(ctx, nil); err != nil {
+		return err
+	}
+	if installed, err := r.setup.IsChaincodeInstalled(); err != nil || !installed {
+		return fmt.Errorf("The chaincode isn't reported installed: %v", err)
+	}
+	if instantiated, err := r.setup.IsChaincodeInstantiated(); err != nil || !instantiated {
+		return fmt.Errorf("The chaincode isn't reported instantiated: %v", err)
+	}
+	return nil
+}
+
+// query checks the value written by the Init function of the chaincode
+func (r *run) query(ctx context.Context) error {
+	value, err := r.setup.QueryHello()
+	if err != nil {
+		return err
+	}
+	if value != "word" {
+		return fmt.Errorf("Query hello returned %q, expected \"word\"", value)
+	}
+	return nil
+}
+
+// invoke writes a new value and checks a query reads it once the transaction is committed
+func (r *run) invoke(ctx context.Context) error {
+	expected := r.config.ChannelId
+	if _, err := r.setup.InvokeHello(expected); err != nil {
+		return err
+	}
+	value, err := r.setup.QueryHello()
+	if err != nil {
+		return err
+	}
+	if value != expected {
+		return fmt.Errorf("Query hello returned %q after the invoke, expected %q", value, expected)
+	}
+	return nil
+}
+
+// event creates a hero and waits for the heroCreated event of its transaction
+func (r *run) event(ctx context.Context) error {
+	type event struct {
+		txID	string
+		payload	[]byte
+	}
+	events := make(chan event, 16)
+	registration, err := r.setup.RegisterChaincodeEvent("heroCreated", func(ccID string, txID string, payload []byte) {
+		select {
+		case events <- event{txID: txID, payload: payload}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer registration.Unregister()
+
+	hero := `{"id":"integration","name":"Integration"}`
+	txID, err := r.setup.InvokeWith(context.Background(), "invoke", []string{"invoke", "hero", "integration", hero})
+	if err != nil {
+		return err
+	}
+	timeout := r.suite.EventTimeout
+	if timeout == 0 {
+		timeout = defaultEventTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		select {
+		case received := <-events:
+			if received.txID != txID {
+				continue
+			}
+			if string(received.payload) != hero {
+				return fmt.Errorf("The event of the transaction %s has the payload %q, expected %q", txID, received.payload, hero)
+			}
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("No heroCreated event received for the transaction %s", txID)
+		}
+	}
+}
+
+// tearDown closes the setup of the run and removes the containers and images of its chaincode
+func (r *run) tearDown() {
+	if r.setup != nil {
+		if err := r.setup.Close(); err != nil {
+			r.suite.logger().Errorf("Unable to close the setup of the run: %v", err)
+		}
+	}
+	if r.suite.Network != nil {
+		network := *r.suite.Network
+		network.Config = r.config
+		if err := network.RemoveChaincode(); err != nil {
+			r.suite.logger().Errorf("Unable to remove the chaincode of the run: %v", err)
+		}
+	}
+}
+
+// renameChannelConfig writes the channel configuration transaction of the template to path, for the channel
+// named channelID. The creation of a channel only differs by its name, the transaction is signed again by
+// the setup creating the channel.
+func renameChannelConfig(template string, path string, channelID string) error {
+	data, err := ioutil.ReadFile(template)
+	if err != nil {
+		return fmt.Errorf("Unable to read the channel configuration template: %v", err)
+	}
+	envelope := &common.Envelope{}
+	if err := proto.Unmarshal(data, envelope); err != nil {
+		return fmt.Errorf("Unable to unmarshal the channel configuration template: %v", err)
+	}
+	payload, err := protosUtils.UnmarshalPayload(envelope.Payload)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal the payload of the channel configuration template: %v", err)
+	}
+	if payload.Header == nil {
+		return fmt.Errorf("The channel configuration template has no header")
+	}
+	channelHeader, err := protosUtils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal the channel header of the template: %v", err)
+	}
+	configUpdateEnvelope := &common.ConfigUpdateEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configUpdateEnvelope); err != nil {
+		return fmt.Errorf("Unable to unmarshal the config update envelope of the template: %v", err)
+	}
+	configUpdate := &common.ConfigUpdate{}
+	if err := proto.Unmarshal(configUpdateEnvelope.ConfigUpdate, configUpdate); err != nil {
+		return fmt.Errorf("Unable to unmarshal the config update of the template: %v", err)
+	}
+
+	channelHeader.ChannelId = channelID
+	configUpdate.ChannelId = channelID
+	if configUpdateEnvelope.ConfigUpdate, err = proto.Marshal(configUpdate); err != nil {
+		return err
+	}
+	configUpdateEnvelope.Signatures = nil
+	if payload.Data, err = proto.Marshal(configUpdateEnvelope); err != nil {
+		return err
+	}
+	if payload.Header.ChannelHeader, err = proto.Marshal(channelHeader); err != nil {
+		return err
+	}
+	if envelope.Payload, err = proto.Marshal(payload); err != nil {
+		return err
+	}
+	envelope.Signature = nil
+	if data, err = proto.Marshal(envelope); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// logger returns the logger of the suite, a StdLogger when not set
+func (suite *Suite) logger() blockchain.Logger {
+	if suite.Logger == nil {
+		return blockchain.StdLogger{}
+	}
+	return suite.Logger
+}
@@ -0,0 +1,49 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+	"github.com/chainhero/heroes-service/blockchain"
+	"github.com/chainhero/heroes-service/devnet"
+)
+
+// TestIntegration runs the suite on the fixtures network, e.g. started by "make integration":
+//
+//	go test -tags integration ./integration/
+func TestIntegration(t *testing.T) {
+	// The paths of the configuration and of the fixtures are relative to the root of the repository
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	suite := &Suite{Network: &devnet.Network{Logger: blockchain.StdLogger{}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	report, err := suite.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("\n%s", report)
+
+	// A subtest per step, the steps after a failure don't run
+	for _, step := range steps {
+		var result *Result
+		for i := range report.Results {
+			if report.Results[i].Step == step.name {
+				result = &report.Results[i]
+			}
+		}
+		t.Run(step.name, func(t *testing.T) {
+			switch {
+			case result == nil:
+				t.Skip("Not run, a previous step failed")
+			case result.Err != nil:
+				t.Fatal(result.Err)
+			}
+		})
+	}
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"database/sql"
+	"github.com/chainhero/heroes-service/admin"
 	"github.com/chainhero/heroes-service/blockchain"
-	"fmt"
+	"github.com/chainhero/heroes-service/metrics"
+	"github.com/chainhero/heroes-service/projection"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"net"
 	"os"
 	"runtime"
 	"path/filepath"
@@ -36,16 +44,29 @@ func main() {
 		os.Setenv("GOPATH", defaultGOPATH())
 	}
 
-	// Initialize the Fabric SDK
-	fabricSdk, err := blockchain.Initialize()
+	logger := blockchain.StdLogger{}
+	collector := metrics.NewCollector()
+	appConfig := loadAppConfig()
+
+	// Initialize the Fabric SDK, on the network of HEROES_PROFILE if set
+	config, err := blockchain.ProfileConfig("", "")
+	if err != nil {
+		logger.Errorf("Unable to load the profile: %v", err)
+		os.Exit(1)
+	}
+	fabricSdk := blockchain.NewFabricSetupFromConfig(config)
+	fabricSdk.Metrics = collector
+	fabricSdk.DevMode = appConfig.DevMode
+	fabricSdk.DevModeAddress = appConfig.DevModeAddress
+	err = fabricSdk.Initialize()
 	if err != nil {
-		fmt.Printf("Unable to initialize the Fabric SDK: %v\n", err)
+		logger.Errorf("Unable to initialize the Fabric SDK: %v", err)
 	}
 
 	// Install and instantiate the chaincode
-	err = fabricSdk.InstallAndInstantiateCC()
+	err = fabricSdk.InstallAndInstantiateCC(nil)
 	if err != nil {
-		fmt.Printf("Unable to install and instantiate the chaincode: %v\n", err)
+		logger.Errorf("Unable to install and instantiate the chaincode: %v", err)
 	}
 
 	// Query the chaincode
@@ -75,6 +96,75 @@ func main() {
 	// Make the web application listening
 	app := &controllers.Application {
 		Fabric: fabricSdk,
+		Logger: logger,
+		Metrics: collector.Handler(),
+	}
+
+	// Project the heroes in a database, which lists them instead of the peers
+	if config.ProjectionDriver != "" {
+		store, err := startProjection(fabricSdk, config, logger)
+		if err != nil {
+			logger.Errorf("Unable to project the heroes: %v", err)
+		} else {
+			app.Projection = store
+		}
+	}
+
+	// Serve the administrative gRPC API
+	if appConfig.AdminGRPCAddress != "" {
+		if err := startAdminServer(fabricSdk, appConfig, logger); err != nil {
+			logger.Errorf("Unable to serve the administrative API: %v", err)
+		}
 	}
 	web.Serve(app)
+}
+
+// startAdminServer serves the administrative gRPC API in the background
+func startAdminServer(fabricSdk *blockchain.FabricSetup, config appConfig, logger blockchain.Logger) error {
+	if err := config.checkAdminGRPC(); err != nil {
+		return err
+	}
+	var options []grpc.ServerOption
+	if config.AdminGRPCTLSCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(config.AdminGRPCTLSCert, config.AdminGRPCTLSKey)
+		if err != nil {
+			return err
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+	server := &admin.Server{Setup: fabricSdk, Token: config.AdminGRPCToken, Logger: logger}
+	grpcServer, err := server.NewGRPCServer(options...)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", config.AdminGRPCAddress)
+	if err != nil {
+		return err
+	}
+	logger.Printf("Administrative API listening on %s", config.AdminGRPCAddress)
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			logger.Errorf("The administrative API stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// startProjection opens the database of the projection and starts projecting the blocks to it
+func startProjection(fabricSdk *blockchain.FabricSetup, config blockchain.Config, logger blockchain.Logger) (*projection.SQLStore, error) {
+	db, err := sql.Open(config.ProjectionDriver, config.ProjectionDSN)
+	if err != nil {
+		return nil, err
+	}
+	store := &projection.SQLStore{DB: db, NumberedParameters: config.ProjectionDriver == "postgres"}
+	if err := store.CreateTables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	projector := &projection.Projector{Setup: fabricSdk, Store: store, Logger: logger}
+	if err := projector.Start(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
 }
\ No newline at end of file
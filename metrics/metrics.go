@@ -0,0 +1,221 @@
+// Package metrics collects the measures of the blockchain operations and exposes them to Prometheus.
+// The Prometheus client isn't vendored, the text exposition format is written directly.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBuckets are the upper bounds, in seconds, of the histograms (the Prometheus defaults)
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector implements blockchain.Metrics, set it as the Metrics of the setup and serve its Handler
+type Collector struct {
+	mutex				sync.Mutex
+	operations			*counter	// By operation and result
+	operationDuration	*histogram	// By operation
+	proposalDuration	*histogram
+	proposalFailures	*counter
+	commitDuration		*histogram
+	transactions		*counter	// By validation code
+	eventHubConnected	float64
+}
+
+// NewCollector returns a collector with no measure
+func NewCollector() *Collector {
+	return &Collector{
+		operations:			newCounter("heroes_fabric_operations_total", "Number of operations, by operation and result.", "operation", "result"),
+		operationDuration:	newHistogram("heroes_fabric_operation_duration_seconds", "Duration of the operations.", "operation"),
+		proposalDuration:	newHistogram("heroes_fabric_proposal_duration_seconds", "Duration of the endorsement of the transaction proposals."),
+		proposalFailures:	newCounter("heroes_fabric_proposal_failures_total", "Number of transaction proposals not endorsed."),
+		commitDuration:		newHistogram("heroes_fabric_commit_duration_seconds", "Duration from the sending of a transaction to its commit."),
+		transactions:		newCounter("heroes_fabric_transactions_total", "Number of transactions committed, by validation code.", "code"),
+	}
+}
+
+// ObserveOperation counts the operation and measures its duration
+func (c *Collector) ObserveOperation(operation string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.operations.inc(operation, result)
+	c.operationDuration.observe(duration.Seconds(), operation)
+}
+
+// ObserveProposal measures the endorsement of a proposal, and counts it when it failed
+func (c *Collector) ObserveProposal(duration time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.proposalDuration.observe(duration.Seconds())
+	if err != nil {
+		c.proposalFailures.inc()
+	}
+}
+
+// ObserveCommit measures the commit of a transaction, and counts it by validation code
+func (c *Collector) ObserveCommit(duration time.Duration, validationCode string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.commitDuration.observe(duration.Seconds())
+	c.transactions.inc(validationCode)
+}
+
+// SetEventHubConnected records the connection state of the event hub
+func (c *Collector) SetEventHubConnected(connected bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.eventHubConnected = 0
+	if connected {
+		c.eventHubConnected = 1
+	}
+}
+
+// Handler returns the handler serving the metrics, to be mounted at /metrics
+func (c *Collector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.write(w)
+	})
+}
+
+// write writes all the metrics in the Prometheus text format
+func (c *Collector) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.operations.write(w)
+	c.operationDuration.write(w)
+	c.proposalDuration.write(w)
+	c.proposalFailures.write(w)
+	c.commitDuration.write(w)
+	c.transactions.write(w)
+	fmt.Fprintf(w, "# HELP heroes_fabric_event_hub_connected Whether the event hub is connected.\n")
+	fmt.Fprintf(w, "# TYPE heroes_fabric_event_hub_connected gauge\n")
+	fmt.Fprintf(w, "heroes_fabric_event_hub_connected %g\n", c.eventHubConnected)
+}
+
+// counter is a counter with labels, its values are keyed by the joined label values
+type counter struct {
+	name	string
+	help	string
+	labels	[]string
+	values	map[string]float64
+}
+
+func newCounter(name, help string, labels ...string) *counter {
+	return &counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counter) inc(labelValues ...string) {
+	c.values[joinLabels(labelValues)]++
+}
+
+func (c *counter) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %g\n", c.name, formatLabels(c.labels, splitLabels(key), ""), c.values[key])
+	}
+}
+
+// histogram is a histogram with labels over defaultBuckets
+type histogram struct {
+	name	string
+	help	string
+	labels	[]string
+	series	map[string]*series
+}
+
+type series struct {
+	counts	[]uint64	// Observations per bucket, not cumulated
+	count	uint64
+	sum		float64
+}
+
+func newHistogram(name, help string, labels ...string) *histogram {
+	return &histogram{name: name, help: help, labels: labels, series: make(map[string]*series)}
+}
+
+func (h *histogram) observe(value float64, labelValues ...string) {
+	key := joinLabels(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &series{counts: make([]uint64, len(defaultBuckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(defaultBuckets, value); i < len(defaultBuckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *histogram) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		values := splitLabels(key)
+		var cumulated uint64
+		for i, bound := range defaultBuckets {
+			cumulated += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, fmt.Sprintf("%g", bound)), cumulated)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, formatLabels(h.labels, values, ""), s.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values, ""), s.count)
+	}
+}
+
+// labelSeparator joins the label values in the keys, it can't appear in a label value of the collector
+const labelSeparator = "\x00"
+
+func joinLabels(values []string) string {
+	return strings.Join(values, labelSeparator)
+}
+
+func splitLabels(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, labelSeparator)
+}
+
+// formatLabels formats the labels of a sample, with the le label of a bucket when le is set
+func formatLabels(names, values []string, le string) string {
+	var pairs []string
+	for i, name := range names {
+		if i < len(values) {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", name, values[i]))
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,171 @@
+// Package projection keeps a copy of the heroes of the ledger in a relational database, so the listing and
+// searching of the heroes don't load the peers. The Projector reads the blocks committed from the last one applied,
+// the checkpoint of the Store, and applies the writes of the valid transactions to the heroes.
+package projection
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"github.com/chainhero/heroes-service/blockchain"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	defaultKeyPrefix	= "hero_"
+	defaultSyncInterval	= 30 * time.Second
+)
+
+// Change is a write of a hero by a valid transaction
+type Change struct {
+	ID			string	// Key of the hero without its prefix
+	Value		[]byte	// The hero in JSON, none for a deletion
+	IsDelete	bool
+	TxID		string
+}
+
+// Store keeps the heroes projected and the checkpoint, e.g. SQLStore
+type Store interface {
+	// Checkpoint returns the number of the last block applied, false when none was
+	Checkpoint() (uint64, bool, error)
+	// Apply applies the changes of the block, in their order, and moves the checkpoint to the block atomically
+	Apply(block uint64, changes []Change) error
+}
+
+// Projector applies the blocks of the primary channel of the setup to the store
+type Projector struct {
+	Setup			*blockchain.FabricSetup
+	Store			Store
+	KeyPrefix		string				// Of the keys of the heroes, "hero_" when not set
+	SyncInterval	time.Duration		// Blocks are read at least this often, in case of events missed, 30 seconds when not set
+	Logger			blockchain.Logger	// A StdLogger when not set
+
+	syncMutex		sync.Mutex			// Held by Sync
+	stop			chan struct{}
+	done			chan struct{}
+}
+
+// Start applies the blocks committed since the checkpoint, then applies the next ones in the background,
+// on each block event and every SyncInterval, until Stop
+func (projector *Projector) Start() error {
+	if err := projector.Sync(); err != nil {
+		return err
+	}
+	wake := make(chan struct{}, 1)
+	registration, err := projector.Setup.RegisterBlockListener(func(summary blockchain.BlockSummary) {
+		if summary.ChannelID != projector.Setup.ChannelId {
+			return
+		}
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	interval := projector.SyncInterval
+	if interval == 0 {
+		interval = defaultSyncInterval
+	}
+	projector.stop = make(chan struct{})
+	projector.done = make(chan struct{})
+	go func() {
+		defer close(projector.done)
+		defer registration.Unregister()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-projector.stop:
+				return
+			case <-wake:
+			case <-ticker.C:
+			}
+			if err := projector.Sync(); err != nil {
+				projector.logger().Errorf("Unable to project the heroes: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the projection started by Start and waits for the block being applied, if any
+func (projector *Projector) Stop() {
+	if projector.stop == nil {
+		return
+	}
+	close(projector.stop)
+	<-projector.done
+	projector.stop = nil
+}
+
+// Sync applies the blocks committed since the checkpoint, up to the height of the ledger of the primary peer
+func (projector *Projector) Sync() error {
+	projector.syncMutex.Lock()
+	defer projector.syncMutex.Unlock()
+
+	checkpoint, ok, err := projector.Store.Checkpoint()
+	if err != nil {
+		return fmt.Errorf("Unable to read the checkpoint of the projection: %v", err)
+	}
+	next := uint64(0)
+	if ok {
+		next = checkpoint + 1
+	}
+	info, err := projector.Setup.QueryChainInfo()
+	if err != nil {
+		return err
+	}
+	for number := next; number < info.Height; number++ {
+		block, err := projector.Setup.QueryBlockByNumber(number)
+		if err != nil {
+			return err
+		}
+		changes := projector.changes(block)
+		if err := projector.Store.Apply(number, changes); err != nil {
+			return fmt.Errorf("Unable to apply the block %d to the projection: %v", number, err)
+		}
+		if len(changes) > 0 {
+			projector.logger().Debugf("Block %d projected, %d heroes changed", number, len(changes))
+		}
+	}
+	return nil
+}
+
+// changes returns the writes of heroes by the valid transactions of the chaincode of the setup in the block
+func (projector *Projector) changes(block *blockchain.Block) []Change {
+	chaincodeID := projector.Setup.ChaincodeId
+	prefix := projector.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	var changes []Change
+	for _, transaction := range block.Transactions {
+		if transaction.ValidationCode != pb.TxValidationCode_VALID.String() || transaction.ChaincodeID != chaincodeID {
+			continue
+		}
+		for _, write := range transaction.Writes {
+			if write.Namespace != chaincodeID || !strings.HasPrefix(write.Key, prefix) {
+				continue
+			}
+			changes = append(changes, Change{
+				ID:			strings.TrimPrefix(write.Key, prefix),
+				Value:		write.Value,
+				IsDelete:	write.IsDelete,
+				TxID:		transaction.TxID,
+			})
+		}
+	}
+	return changes
+}
+
+// logger returns the logger of the projector, a StdLogger when not set
+func (projector *Projector) logger() blockchain.Logger {
+	if projector.Logger == nil {
+		return blockchain.StdLogger{}
+	}
+	return projector.Logger
+}
@@ -0,0 +1,145 @@
+package projection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultTable			= "heroes"
+	defaultCheckpointTable	= "heroes_checkpoint"
+)
+
+// SQLStore keeps the heroes in a table of a database, PostgreSQL or SQLite, with the columns id, name (for the
+// search), value (the hero in JSON), tx_id and block_number, and the checkpoint in a second table.
+// The driver of the database is chosen by the caller.
+type SQLStore struct {
+	DB					*sql.DB
+	Table				string	// "heroes" when not set
+	CheckpointTable		string	// "heroes_checkpoint" when not set
+	NumberedParameters	bool	// $1, $2... parameters (PostgreSQL), ? when false
+}
+
+// CreateTables creates the tables of the store, unless they exist
+func (store *SQLStore) CreateTables() error {
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id VARCHAR(255) PRIMARY KEY, name TEXT NOT NULL, value TEXT NOT NULL, tx_id VARCHAR(255) NOT NULL, block_number BIGINT NOT NULL)", store.table()),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INTEGER PRIMARY KEY, block_number BIGINT NOT NULL)", store.checkpointTable()),
+	}
+	for _, statement := range statements {
+		if _, err := store.DB.Exec(statement); err != nil {
+			return fmt.Errorf("Unable to create the tables of the projection: %v", err)
+		}
+	}
+	return nil
+}
+
+// Checkpoint returns the number of the last block applied
+func (store *SQLStore) Checkpoint() (uint64, bool, error) {
+	var block uint64
+	err := store.DB.QueryRow(fmt.Sprintf("SELECT block_number FROM %s WHERE id = 1", store.checkpointTable())).Scan(&block)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return block, true, nil
+}
+
+// Apply replaces the heroes changed by the block and moves the checkpoint in a transaction. A hero is deleted then
+// inserted again, the upserts of PostgreSQL and of the SQLite vendored differ.
+func (store *SQLStore) Apply(block uint64, changes []Change) error {
+	tx, err := store.DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if _, err := tx.Exec(store.statement("DELETE FROM %s WHERE id = %s", store.table(), 1), change.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if change.IsDelete {
+			continue
+		}
+		var hero struct {
+			Name string `json:"name"`
+		}
+		// A value which isn't a hero is kept, without name
+		json.Unmarshal(change.Value, &hero)
+		insert := store.statement("INSERT INTO %s (id, name, value, tx_id, block_number) VALUES (%s)", store.table(), 5)
+		if _, err := tx.Exec(insert, change.ID, hero.Name, string(change.Value), change.TxID, block); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = 1", store.checkpointTable())); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(store.statement("INSERT INTO %s (id, block_number) VALUES (1, %s)", store.checkpointTable(), 1), block); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListHeroes returns the heroes whose name contains search (case insensitive, every hero when empty), in JSON,
+// ordered by id, from offset up to limit heroes
+func (store *SQLStore) ListHeroes(search string, offset int, limit int) ([]json.RawMessage, error) {
+	query := fmt.Sprintf("SELECT value FROM %s", store.table())
+	var args []interface{}
+	if search != "" {
+		query += " WHERE LOWER(name) LIKE " + store.parameter(1)
+		args = append(args, "%"+strings.ToLower(search)+"%")
+	}
+	query += fmt.Sprintf(" ORDER BY id LIMIT %d OFFSET %d", limit, offset)
+
+	rows, err := store.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the heroes of the projection: %v", err)
+	}
+	defer rows.Close()
+	heroes := []json.RawMessage{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		heroes = append(heroes, json.RawMessage(value))
+	}
+	return heroes, rows.Err()
+}
+
+// statement formats the statement on the table with its count parameters, comma separated
+func (store *SQLStore) statement(format string, table string, count int) string {
+	parameters := make([]string, count)
+	for i := range parameters {
+		parameters[i] = store.parameter(i + 1)
+	}
+	return fmt.Sprintf(format, table, strings.Join(parameters, ", "))
+}
+
+// parameter returns the placeholder of the parameter at the position, from 1
+func (store *SQLStore) parameter(position int) string {
+	if store.NumberedParameters {
+		return fmt.Sprintf("$%d", position)
+	}
+	return "?"
+}
+
+func (store *SQLStore) table() string {
+	if store.Table == "" {
+		return defaultTable
+	}
+	return store.Table
+}
+
+func (store *SQLStore) checkpointTable() string {
+	if store.CheckpointTable == "" {
+		return defaultCheckpointTable
+	}
+	return store.CheckpointTable
+}
@@ -2,7 +2,6 @@ package web
 
 import (
 	"net/http"
-	"fmt"
 	"github.com/chainhero/heroes-service/web/controllers"
 )
 
@@ -13,10 +12,30 @@ func Serve(app *controllers.Application) {
 	http.HandleFunc("/home.html", app.HomeHandler)
 	http.HandleFunc("/request.html", app.RequestHandler)
 
+	// JSON API
+	http.HandleFunc("/api/hero/", app.HeroHandler)
+	http.HandleFunc("/api/hero", app.HeroesHandler)
+	http.HandleFunc("/api/invoke", app.InvokeHandler)
+	http.HandleFunc("/api/query", app.QueryHandler)
+	http.HandleFunc("/api/health", app.HealthHandler)
+	http.HandleFunc("/api/live", app.LivenessHandler)
+
+	// Chaincode events pushed to the browsers
+	http.HandleFunc("/ws/events", app.EventsHandler)
+
+	// Prometheus metrics
+	if app.Metrics != nil {
+		http.Handle("/metrics", app.Metrics)
+	}
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/home.html", http.StatusTemporaryRedirect)
 	})
 
-	fmt.Println("Listening (http://localhost:3000/) ...")
-	http.ListenAndServe(":3000", nil)
+	app.Log().Printf("Listening (http://localhost:3000/) ...")
+	handler := http.Handler(http.DefaultServeMux)
+	if app.Middleware != nil {
+		handler = app.Middleware(handler)
+	}
+	http.ListenAndServe(":3000", handler)
 }
\ No newline at end of file
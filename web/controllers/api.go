@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/chainhero/heroes-service/blockchain"
+)
+
+// apiError is the JSON body of a failed API request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// HeroHandler answers GET /api/hero/{id} with the hero stored in the ledger,
+// and GET /api/hero/{id}/history with its modifications (see heroHistory)
+func (app *Application) HeroHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("Only GET is allowed"))
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/hero/")
+	if strings.HasSuffix(id, "/history") {
+		app.heroHistory(w, strings.TrimSuffix(id, "/history"))
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("Invalid hero id"))
+		return
+	}
+
+	if !app.checkInitialized(w) {
+		return
+	}
+	payload, err := app.Fabric.QueryWith(r.Context(), "invoke", []string{"query", "hero", id})
+	if err != nil {
+		writeAPIError(w, blockchain.HTTPStatus(err), err)
+		return
+	}
+	if len(payload) == 0 {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("No hero %s", id))
+		return
+	}
+
+	// The hero is stored in JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+// heroVersion is a modification of a hero in the JSON body of GET /api/hero/{id}/history
+type heroVersion struct {
+	TxID		string			`json:"txId"`
+	Timestamp	time.Time		`json:"timestamp"`
+	Hero		json.RawMessage	`json:"hero,omitempty"`	// The hero stored by the transaction, none for a deletion
+	IsDelete	bool			`json:"isDelete"`
+}
+
+// heroHistory answers the modifications of the hero, oldest first
+func (app *Application) heroHistory(w http.ResponseWriter, id string) {
+	if id == "" || strings.Contains(id, "/") {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("Invalid hero id"))
+		return
+	}
+	if !app.checkInitialized(w) {
+		return
+	}
+	modifications, err := app.Fabric.GetHistory("hero_" + id)
+	if err != nil {
+		writeAPIError(w, blockchain.HTTPStatus(err), err)
+		return
+	}
+	if len(modifications) == 0 {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("No hero %s", id))
+		return
+	}
+	versions := make([]heroVersion, len(modifications))
+	for i, modification := range modifications {
+		versions[i] = heroVersion{TxID: modification.TxID, Timestamp: modification.Timestamp, IsDelete: modification.IsDelete}
+		if !modification.IsDelete && len(modification.Value) > 0 {
+			versions[i].Hero = json.RawMessage(modification.Value)
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, versions)
+}
+
+// Heroes listed by page by GET /api/hero when no page size is given
+const defaultHeroesPageSize = 20
+
+// Largest hero accepted by POST /api/hero, in bytes
+const maxHeroSize = 1 << 20
+
+// Selector of the hero documents, whose keys start with "hero_" (see the chaincode)
+const heroDocumentsSelector = `{"_id":{"$regex":"^hero_"}}`
+
+// heroesPage is the JSON body of GET /api/hero
+type heroesPage struct {
+	Heroes		[]json.RawMessage	`json:"heroes"`
+	Bookmark	string				`json:"bookmark,omitempty"`
+}
+
+// HeroesHandler creates or replaces the hero given in JSON to POST /api/hero, and answers the transaction ID.
+// GET /api/hero lists the heroes, see listHeroes.
+func (app *Application) HeroesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		app.listHeroes(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("Only GET and POST are allowed"))
+		return
+	}
+
+	// The hero is stored as given, it only needs an id
+	var hero map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHeroSize)).Decode(&hero); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("The hero is larger than %d bytes", maxHeroSize))
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("Invalid JSON body: %v", err))
+		return
+	}
+	id, ok := hero["id"].(string)
+	if !ok || id == "" || strings.Contains(id, "/") {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("The hero needs a string id"))
+		return
+	}
+	heroJSON, err := json.Marshal(hero)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !app.checkInitialized(w) {
+		return
+	}
+	txID, err := app.Fabric.InvokeWith(r.Context(), "invoke", []string{"invoke", "hero", id, string(heroJSON)})
+	if err != nil {
+		writeAPIError(w, blockchain.HTTPStatus(err), err)
+		return
+	}
+	writeAPIJSON(w, http.StatusCreated, map[string]string{"txId": txID})
+}
+
+// listHeroes answers a page of the heroes matching the CouchDB selector of the selector parameter (every hero
+// when not set), of pageSize heroes, from the bookmark parameter given by the previous page.
+// The selector only matches the hero documents, not the other states of the chaincode.
+// Without selector, the heroes are listed by the Projection when set, see listProjectedHeroes.
+func (app *Application) listHeroes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageSize := defaultHeroesPageSize
+	if value := query.Get("pageSize"); value != "" {
+		var err error
+		if pageSize, err = strconv.Atoi(value); err != nil || pageSize <= 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("Invalid page size %s", value))
+			return
+		}
+	}
+	selector := query.Get("selector")
+	if selector == "" && app.Projection != nil {
+		app.listProjectedHeroes(w, r, pageSize)
+		return
+	}
+	if selector == "" {
+		selector = `{"id":{"$gt":null}}`
+	}
+	var selectorObject map[string]interface{}
+	if err := json.Unmarshal([]byte(selector), &selectorObject); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("The selector must be a JSON object: %v", err))
+		return
+	}
+
+	if !app.checkInitialized(w) {
+		return
+	}
+	page, err := app.Fabric.QueryRich(`{"$and":[` + heroDocumentsSelector + `,` + selector + `]}`, pageSize, query.Get("bookmark"))
+	if err != nil {
+		writeAPIError(w, blockchain.HTTPStatus(err), err)
+		return
+	}
+	heroes := heroesPage{Heroes: []json.RawMessage{}, Bookmark: page.Bookmark}
+	for _, record := range page.Records {
+		heroes.Heroes = append(heroes.Heroes, record.Value)
+	}
+	writeAPIJSON(w, http.StatusOK, heroes)
+}
+
+// listProjectedHeroes answers a page of the heroes of the Projection whose name contains the search parameter,
+// every hero when not set. The bookmark is the offset of the next page, none after the last one.
+func (app *Application) listProjectedHeroes(w http.ResponseWriter, r *http.Request, pageSize int) {
+	query := r.URL.Query()
+	offset := 0
+	if value := query.Get("bookmark"); value != "" {
+		var err error
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("Invalid bookmark %s", value))
+			return
+		}
+	}
+	list, err := app.Projection.ListHeroes(query.Get("search"), offset, pageSize)
+	if err != nil {
+		app.Log().Errorf("Unable to list the heroes of the projection: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("Unable to list the heroes"))
+		return
+	}
+	heroes := heroesPage{Heroes: list}
+	if len(list) == pageSize {
+		heroes.Bookmark = strconv.Itoa(offset + pageSize)
+	}
+	writeAPIJSON(w, http.StatusOK, heroes)
+}
+
+// Largest body accepted by POST /api/invoke and /api/query, in bytes
+const maxChaincodeRequestSize = 1 << 20
+
+// chaincodeRequest is the JSON body of POST /api/invoke and /api/query
+type chaincodeRequest struct {
+	Function	string		`json:"function"`
+	Args		[]string	`json:"args"`
+}
+
+// InvokeHandler invokes the function of the chaincode given to POST /api/invoke, like {"function": "...", "args": [...]},
+// and answers the transaction ID once it is committed
+func (app *Application) InvokeHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := app.readChaincodeRequest(w, r)
+	if !ok {
+		return
+	}
+	txID, err := app.Fabric.InvokeWith(r.Context(), request.Function, request.Args)
+	if err != nil {
+		writeAPIError(w, blockchain.HTTPStatus(err), err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]string{"txId": txID})
+}
+
+// QueryHandler queries the function of the chaincode given to POST /api/query, with the same body as /api/invoke,
+// and answers the payload as a string
+func (app *Application) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := app.readChaincodeRequest(w, r)
+	if !ok {
+		return
+	}
+	payload, err := app.Fabric.QueryWith(r.Context(), request.Function, request.Args)
+	if err != nil {
+		writeAPIError(w, blockchain.HTTPStatus(err), err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]string{"result": string(payload)})
+}
+
+// readChaincodeRequest decodes and checks the body of a POST to /api/invoke or /api/query, answering the error if any
+func (app *Application) readChaincodeRequest(w http.ResponseWriter, r *http.Request) (*chaincodeRequest, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("Only POST is allowed"))
+		return nil, false
+	}
+	request := &chaincodeRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxChaincodeRequestSize)).Decode(request); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("The request is larger than %d bytes", maxChaincodeRequestSize))
+			return nil, false
+		}
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("Invalid JSON body: %v", err))
+		return nil, false
+	}
+	if request.Function == "" {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("The function is missing"))
+		return nil, false
+	}
+	if !app.checkInitialized(w) {
+		return nil, false
+	}
+	return request, true
+}
+
+// HealthHandler answers GET /api/health with the health report of the setup, with the status 503 when unhealthy.
+// It is the readiness probe of the service.
+func (app *Application) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.checkInitialized(w) {
+		return
+	}
+	report := app.Fabric.Health(r.Context())
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+	writeAPIJSON(w, status, report)
+}
+
+// LivenessHandler answers GET /api/live with 200 while the service answers requests, whatever the state of the
+// network: it is the liveness probe of the service, restarting it doesn't fix an unreachable peer
+func (app *Application) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIJSON(w, http.StatusOK, map[string]bool{"alive": true})
+}
+
+// checkInitialized answers 503 when the setup is not initialized
+func (app *Application) checkInitialized(w http.ResponseWriter) bool {
+	if app.Fabric == nil || !app.Fabric.IsInitialized() {
+		writeAPIError(w, http.StatusServiceUnavailable, fmt.Errorf("The setup is not initialized"))
+		return false
+	}
+	return true
+}
+
+// writeAPIError writes the error in JSON with its status
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, &apiError{Error: err.Error()})
+}
+
+// writeAPIJSON writes the value in JSON with its status
+func writeAPIJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"github.com/chainhero/heroes-service/blockchain"
+	"github.com/chainhero/heroes-service/blockchain/mocks"
+)
+
+// serve runs the request through the handler and returns the recorded response
+func serve(handler http.HandlerFunc, method string, target string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+func newTestApplication() (*Application, *mocks.Ledger) {
+	ledger := mocks.NewLedger()
+	return &Application{Fabric: ledger, Logger: blockchain.NoopLogger{}}, ledger
+}
+
+func TestHeroHandlers(t *testing.T) {
+	app, _ := newTestApplication()
+
+	response := serve(app.HeroesHandler, http.MethodPost, "/api/hero", `{"id":"batman","name":"Batman"}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("POST answered %d: %s", response.Code, response.Body)
+	}
+	var created map[string]string
+	if err := json.NewDecoder(response.Body).Decode(&created); err != nil || created["txId"] == "" {
+		t.Errorf("No transaction ID answered: %v", err)
+	}
+
+	response = serve(app.HeroHandler, http.MethodGet, "/api/hero/batman", "")
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"Batman"`) {
+		t.Errorf("GET answered %d: %s", response.Code, response.Body)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("GET answered %s", contentType)
+	}
+
+	serve(app.HeroesHandler, http.MethodPost, "/api/hero", `{"id":"batman","name":"Bruce Wayne"}`)
+	response = serve(app.HeroHandler, http.MethodGet, "/api/hero/batman/history", "")
+	var versions []heroVersion
+	if err := json.NewDecoder(response.Body).Decode(&versions); err != nil || len(versions) != 2 {
+		t.Fatalf("The history answered %d versions: %v", len(versions), err)
+	}
+	if !strings.Contains(string(versions[1].Hero), "Bruce Wayne") || versions[0].TxID == versions[1].TxID {
+		t.Errorf("Unexpected history: %+v", versions)
+	}
+}
+
+func TestHeroHandlersStatus(t *testing.T) {
+	app, _ := newTestApplication()
+	serve(app.HeroesHandler, http.MethodPost, "/api/hero", `{"id":"batman"}`)
+	tests := []struct {
+		name	string
+		handler	http.HandlerFunc
+		method	string
+		target	string
+		body	string
+		status	int
+	}{
+		{"unknown hero", app.HeroHandler, http.MethodGet, "/api/hero/superman", "", http.StatusNotFound},
+		{"unknown history", app.HeroHandler, http.MethodGet, "/api/hero/superman/history", "", http.StatusNotFound},
+		{"empty id", app.HeroHandler, http.MethodGet, "/api/hero/", "", http.StatusBadRequest},
+		{"id with a slash", app.HeroHandler, http.MethodGet, "/api/hero/a/b", "", http.StatusBadRequest},
+		{"delete a hero", app.HeroHandler, http.MethodDelete, "/api/hero/batman", "", http.StatusMethodNotAllowed},
+		{"invalid JSON", app.HeroesHandler, http.MethodPost, "/api/hero", `{"id":`, http.StatusBadRequest},
+		{"hero too large", app.HeroesHandler, http.MethodPost, "/api/hero", `{"id":"batman","name":"` + strings.Repeat("a", maxHeroSize) + `"}`, http.StatusRequestEntityTooLarge},
+		{"hero without id", app.HeroesHandler, http.MethodPost, "/api/hero", `{"name":"Batman"}`, http.StatusBadRequest},
+		{"hero with a number id", app.HeroesHandler, http.MethodPost, "/api/hero", `{"id":1}`, http.StatusBadRequest},
+		{"put the heroes", app.HeroesHandler, http.MethodPut, "/api/hero", "", http.StatusMethodNotAllowed},
+		{"invalid page size", app.HeroesHandler, http.MethodGet, "/api/hero?pageSize=0", "", http.StatusBadRequest},
+		{"invalid selector", app.HeroesHandler, http.MethodGet, "/api/hero?selector=[]", "", http.StatusBadRequest},
+		{"liveness", app.LivenessHandler, http.MethodGet, "/api/live", "", http.StatusOK},
+		{"health", app.HealthHandler, http.MethodGet, "/api/health", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		response := serve(test.handler, test.method, test.target, test.body)
+		if response.Code != test.status {
+			t.Errorf("%s: answered %d, want %d: %s", test.name, response.Code, test.status, response.Body)
+		}
+		var body apiError
+		if test.status >= 400 && (json.NewDecoder(response.Body).Decode(&body) != nil || body.Error == "") {
+			t.Errorf("%s: the error isn't answered in JSON", test.name)
+		}
+	}
+}
+
+func TestListHeroes(t *testing.T) {
+	app, ledger := newTestApplication()
+	for i := 0; i < 5; i++ {
+		serve(app.HeroesHandler, http.MethodPost, "/api/hero", fmt.Sprintf(`{"id":"hero%d","level":%d}`, i, i))
+	}
+	// A state of the chaincode that isn't a hero
+	if _, err := ledger.InvokeHello(`{"id":"hello","level":9}`); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	bookmark := ""
+	for pages := 0; pages < 5; pages++ {
+		response := serve(app.HeroesHandler, http.MethodGet, "/api/hero?pageSize=2&bookmark="+bookmark, "")
+		var page heroesPage
+		if err := json.NewDecoder(response.Body).Decode(&page); err != nil || response.Code != http.StatusOK {
+			t.Fatalf("The list answered %d: %v", response.Code, err)
+		}
+		for _, hero := range page.Heroes {
+			var decoded struct{ ID string }
+			json.Unmarshal(hero, &decoded)
+			ids = append(ids, decoded.ID)
+		}
+		if bookmark = page.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	if strings.Join(ids, ",") != "hero0,hero1,hero2,hero3,hero4" {
+		t.Errorf("Listed %v", ids)
+	}
+
+	selector := url.QueryEscape(`{"level":{"$gte":3}}`)
+	response := serve(app.HeroesHandler, http.MethodGet, "/api/hero?selector="+selector, "")
+	var page heroesPage
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil || len(page.Heroes) != 2 {
+		t.Errorf("The selector listed %d heroes: %v", len(page.Heroes), err)
+	}
+}
+
+func TestChaincodeHandlers(t *testing.T) {
+	app, _ := newTestApplication()
+
+	response := serve(app.InvokeHandler, http.MethodPost, "/api/invoke", `{"function":"invoke","args":["invoke","hello","world"]}`)
+	var invoked map[string]string
+	if err := json.NewDecoder(response.Body).Decode(&invoked); err != nil || response.Code != http.StatusOK || invoked["txId"] == "" {
+		t.Fatalf("The invoke answered %d without transaction ID: %v", response.Code, err)
+	}
+	response = serve(app.QueryHandler, http.MethodPost, "/api/query", `{"function":"invoke","args":["query","hello"]}`)
+	var queried map[string]string
+	if err := json.NewDecoder(response.Body).Decode(&queried); err != nil || queried["result"] != "world" {
+		t.Errorf("The query answered %d %v, want the invoked value: %v", response.Code, queried, err)
+	}
+
+	tests := []struct {
+		method	string
+		body	string
+		status	int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, `{"function":`, http.StatusBadRequest},
+		{http.MethodPost, `{"args":["query","hello"]}`, http.StatusBadRequest},
+		{http.MethodPost, `{"function":"invoke","args":["` + strings.Repeat("a", maxChaincodeRequestSize) + `"]}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		if response := serve(app.QueryHandler, test.method, "/api/query", test.body); response.Code != test.status {
+			t.Errorf("%s %.40s answered %d, want %d", test.method, test.body, response.Code, test.status)
+		}
+	}
+}
+
+func TestHandlersLedgerErrors(t *testing.T) {
+	tests := []struct {
+		err		error
+		status	int
+	}{
+		{&blockchain.MVCCReadConflictError{TxID: "tx1"}, http.StatusConflict},
+		{&blockchain.PhantomReadConflictError{TxID: "tx1"}, http.StatusConflict},
+		{&blockchain.TimeoutError{Operation: "Commit"}, http.StatusGatewayTimeout},
+		{blockchain.ErrOverloaded, http.StatusServiceUnavailable},
+		{blockchain.ErrEventHubNotConnected, http.StatusServiceUnavailable},
+		{&blockchain.ChaincodeError{Peer: "peer0", Status: 500, Message: "Incorrect arguments"}, http.StatusBadRequest},
+		{fmt.Errorf("Unable to reach the orderer"), http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		app, ledger := newTestApplication()
+		ledger.Err = test.err
+		for _, response := range []*httptest.ResponseRecorder{
+			serve(app.HeroHandler, http.MethodGet, "/api/hero/batman", ""),
+			serve(app.HeroHandler, http.MethodGet, "/api/hero/batman/history", ""),
+			serve(app.HeroesHandler, http.MethodPost, "/api/hero", `{"id":"batman"}`),
+			serve(app.HeroesHandler, http.MethodGet, "/api/hero", ""),
+			serve(app.InvokeHandler, http.MethodPost, "/api/invoke", `{"function":"invoke","args":["invoke","hello","world"]}`),
+			serve(app.QueryHandler, http.MethodPost, "/api/query", `{"function":"invoke","args":["query","hello"]}`),
+		} {
+			if response.Code != test.status {
+				t.Errorf("%v: answered %d, want %d", test.err, response.Code, test.status)
+			}
+		}
+	}
+}
+
+func TestHandlersNotInitialized(t *testing.T) {
+	app, ledger := newTestApplication()
+	ledger.Close()
+	for _, response := range []*httptest.ResponseRecorder{
+		serve(app.HeroHandler, http.MethodGet, "/api/hero/batman", ""),
+		serve(app.HeroesHandler, http.MethodPost, "/api/hero", `{"id":"batman"}`),
+		serve(app.HeroesHandler, http.MethodGet, "/api/hero", ""),
+		serve(app.HealthHandler, http.MethodGet, "/api/health", ""),
+		serve(app.InvokeHandler, http.MethodPost, "/api/invoke", `{"function":"invoke","args":["invoke","hello","world"]}`),
+	} {
+		if response.Code != http.StatusServiceUnavailable {
+			t.Errorf("Answered %d, want 503", response.Code)
+		}
+	}
+	if response := serve(app.LivenessHandler, http.MethodGet, "/api/live", ""); response.Code != http.StatusOK {
+		t.Errorf("The liveness answered %d", response.Code)
+	}
+}
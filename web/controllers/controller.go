@@ -1,19 +1,40 @@
 package controllers
 
 import (
+	"encoding/json"
 	"path/filepath"
 	"os"
-	"fmt"
 	"net/http"
 	"html/template"
+	"sync"
 	"github.com/chainhero/heroes-service/blockchain"
 )
 
+// HeroLister lists the heroes off the chain, e.g. a *projection.SQLStore
+type HeroLister interface {
+	ListHeroes(search string, offset int, limit int) ([]json.RawMessage, error)
+}
+
 type Application struct {
-	Fabric *blockchain.FabricSetup
+	Fabric blockchain.ChainService	// A *blockchain.FabricSetup, or a mocks.Ledger in the tests
+	Logger blockchain.Logger	// A StdLogger when not set
+	Metrics http.Handler		// Served at /metrics when set
+	Middleware func(http.Handler) http.Handler	// Wraps the handlers when set, e.g. to extract the trace context of the requests
+	Projection HeroLister	// Lists the heroes instead of the peers when set
+
+	eventsOnce sync.Once
+	events *eventBroadcaster	// Fans out the chaincode events to the WebSocket clients of /ws/events
+}
+
+// Log returns the logger of the application, a StdLogger when not set
+func (app *Application) Log() blockchain.Logger {
+	if app.Logger == nil {
+		return blockchain.StdLogger{}
+	}
+	return app.Logger
 }
 
-func renderTemplate(w http.ResponseWriter, r *http.Request, templateName string, data interface{}) {
+func (app *Application) renderTemplate(w http.ResponseWriter, r *http.Request, templateName string, data interface{}) {
 	lp := filepath.Join("web", "templates", "layout.html")
 	tp := filepath.Join("web", "templates", templateName)
 
@@ -35,13 +56,13 @@ func renderTemplate(w http.ResponseWriter, r *http.Request, templateName string,
 	resultTemplate, err := template.ParseFiles(tp, lp)
 	if err != nil {
 		// Log the detailed error
-		fmt.Println(err.Error())
+		app.Log().Errorf("Unable to parse the template %s: %v", templateName, err)
 		// Return a generic "Internal Server Error" message
 		http.Error(w, http.StatusText(500), 500)
 		return
 	}
 	if err := resultTemplate.ExecuteTemplate(w, "layout", data); err != nil {
-		fmt.Println(err.Error())
+		app.Log().Errorf("Unable to render the template %s: %v", templateName, err)
 		http.Error(w, http.StatusText(500), 500)
 	}
 }
\ No newline at end of file
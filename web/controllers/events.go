@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"github.com/chainhero/heroes-service/blockchain"
+)
+
+// Messages kept for a slow client, it is disconnected beyond
+const eventClientBuffer = 64
+
+// The chaincode events pushed by /ws/events, emitted by the hero action of the chaincode with the hero as payload
+var heroEvents = []string{"heroCreated", "heroUpdated"}
+
+// eventMessage is a chaincode event pushed to the WebSocket clients
+type eventMessage struct {
+	Event	string			`json:"event"`
+	TxID	string			`json:"txId"`
+	Hero	json.RawMessage	`json:"hero,omitempty"`
+}
+
+// eventClient is a WebSocket client and the events it subscribed to
+type eventClient struct {
+	events	map[string]bool
+	send	chan []byte
+	closed	chan struct{}	// Closed when the client is removed, e.g. too slow
+}
+
+// eventBroadcaster fans out the chaincode events to the WebSocket clients.
+// An event is registered once on the ChainService, while a client subscribes to it.
+type eventBroadcaster struct {
+	fabric			blockchain.ChainService
+	logger			blockchain.Logger
+	mutex			sync.Mutex
+	clients			map[*eventClient]bool
+	registrations	map[string]blockchain.Registration	// By event name
+}
+
+// broadcaster returns the broadcaster of the application, created on first use
+func (app *Application) broadcaster() *eventBroadcaster {
+	app.eventsOnce.Do(func() {
+		app.events = &eventBroadcaster{
+			fabric:			app.Fabric,
+			logger:			app.Log(),
+			clients:		make(map[*eventClient]bool),
+			registrations:	make(map[string]blockchain.Registration),
+		}
+	})
+	return app.events
+}
+
+// EventsHandler upgrades GET /ws/events to a WebSocket pushing the hero events of the chaincode as JSON messages,
+// {"event": "heroCreated", "txId": "...", "hero": {...}}. The events parameter, a comma separated list of
+// heroCreated and heroUpdated, filters them, every event when not set.
+func (app *Application) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	events := heroEvents
+	if value := r.URL.Query().Get("events"); value != "" {
+		events = strings.Split(value, ",")
+		for _, event := range events {
+			if !isHeroEvent(event) {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("Unknown event %s, expected one of %s", event, strings.Join(heroEvents, ", ")))
+				return
+			}
+		}
+	}
+	if !app.checkInitialized(w) {
+		return
+	}
+
+	conn, err := upgradeWebsocket(w, r)
+	if err != nil {
+		app.Log().Debugf("WebSocket upgrade refused: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	broadcaster := app.broadcaster()
+	client, err := broadcaster.subscribe(events)
+	if err != nil {
+		app.Log().Errorf("Unable to subscribe to the chaincode events: %v", err)
+		conn.writeFrame(opcodeClose, closePayload(1011, "Unable to subscribe to the events"))
+		return
+	}
+	defer broadcaster.unsubscribe(client)
+
+	// The reads detect the client leaving, the writes push the events
+	done := make(chan error, 1)
+	go func() { done <- conn.readLoop() }()
+	for {
+		select {
+		case message := <-client.send:
+			if err := conn.writeText(message); err != nil {
+				return
+			}
+		case <-client.closed:
+			conn.writeFrame(opcodeClose, closePayload(1008, "Too slow to receive the events"))
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// isHeroEvent tells if the event is one of heroEvents
+func isHeroEvent(event string) bool {
+	for _, heroEvent := range heroEvents {
+		if event == heroEvent {
+			return true
+		}
+	}
+	return false
+}
+
+// closePayload returns the payload of a close frame
+func closePayload(code int, reason string) []byte {
+	return append([]byte{byte(code >> 8), byte(code)}, reason...)
+}
+
+// subscribe adds a client of the events, registering the events no other client listens to yet
+func (b *eventBroadcaster) subscribe(events []string) (*eventClient, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	client := &eventClient{events: make(map[string]bool), send: make(chan []byte, eventClientBuffer), closed: make(chan struct{})}
+	for _, event := range events {
+		client.events[event] = true
+		if _, ok := b.registrations[event]; ok {
+			continue
+		}
+		event := event
+		registration, err := b.fabric.RegisterChaincodeEvent(regexp.QuoteMeta(event), func(ccID string, txID string, payload []byte) {
+			b.publish(event, txID, payload)
+		})
+		if err != nil {
+			b.release()
+			return nil, err
+		}
+		b.registrations[event] = registration
+	}
+	b.clients[client] = true
+	return client, nil
+}
+
+// unsubscribe removes the client, if not removed yet, and unregisters the events without client
+func (b *eventBroadcaster) unsubscribe(client *eventClient) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.remove(client)
+	b.release()
+}
+
+// remove forgets the client, the mutex being held
+func (b *eventBroadcaster) remove(client *eventClient) {
+	if !b.clients[client] {
+		return
+	}
+	delete(b.clients, client)
+	close(client.closed)
+}
+
+// release unregisters the events no client listens to, the mutex being held
+func (b *eventBroadcaster) release() {
+	for event, registration := range b.registrations {
+		listened := false
+		for client := range b.clients {
+			listened = listened || client.events[event]
+		}
+		if listened {
+			continue
+		}
+		if err := registration.Unregister(); err != nil {
+			b.logger.Errorf("Unable to unregister the event %s: %v", event, err)
+		}
+		delete(b.registrations, event)
+	}
+}
+
+// publish sends the event to its clients. It runs on the goroutine of the event hub, so it never blocks:
+// a client whose buffer is full is disconnected, its events are unregistered by its handler.
+func (b *eventBroadcaster) publish(event string, txID string, payload []byte) {
+	message := eventMessage{Event: event, TxID: txID}
+	if json.Valid(payload) {
+		message.Hero = payload
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		b.logger.Errorf("Unable to encode the event %s: %v", event, err)
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for client := range b.clients {
+		if !client.events[event] {
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			b.logger.Errorf("WebSocket client too slow, disconnected")
+			b.remove(client)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The server side of the WebSocket protocol (RFC 6455) needed to push messages: text frames are sent,
+// the frames received are only read to answer the pings and the close
+const (
+	websocketGUID			= "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	websocketWriteTimeout	= 10 * time.Second
+	websocketMaxFrameSize	= 64 << 10	// The clients only send control frames, limited to 125 bytes
+
+	opcodeText		= 0x1
+	opcodeClose		= 0x8
+	opcodePing		= 0x9
+	opcodePong		= 0xA
+)
+
+// websocketConn is an upgraded connection
+type websocketConn struct {
+	conn		net.Conn
+	reader		*bufio.Reader
+	writeMutex	sync.Mutex
+}
+
+// upgradeWebsocket answers the WebSocket handshake of the request and takes over its connection.
+// On failure, the error has already been answered.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("Only GET is allowed"))
+		return nil, fmt.Errorf("Method %s", r.Method)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("A WebSocket handshake is expected"))
+		return nil, fmt.Errorf("Not a WebSocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeAPIError(w, http.StatusUpgradeRequired, fmt.Errorf("Only the version 13 of WebSocket is supported"))
+		return nil, fmt.Errorf("Unsupported WebSocket version")
+	}
+	// A page of another site must not read the events with the cookies of the user
+	if origin := r.Header.Get("Origin"); origin != "" {
+		originURL, err := url.Parse(origin)
+		if err != nil || originURL.Host != r.Host {
+			writeAPIError(w, http.StatusForbidden, fmt.Errorf("Cross-origin WebSocket connections are not allowed"))
+			return nil, fmt.Errorf("Cross-origin request from %s", origin)
+		}
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("The connection can't be upgraded"))
+		return nil, fmt.Errorf("The response writer can't be hijacked")
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocketConn{conn: conn, reader: buffer.Reader}, nil
+}
+
+// headerContains tells if one of the comma separated values of the header is the token, ignoring the case
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header[name] {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeText sends the message in a text frame
+func (c *websocketConn) writeText(message []byte) error {
+	return c.writeFrame(opcodeText, message)
+}
+
+// writeFrame sends a final frame, unmasked as the server frames are
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readLoop reads the frames of the client until it closes the connection: the pings are answered,
+// the other frames are ignored
+func (c *websocketConn) readLoop() error {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case opcodeClose:
+			c.writeFrame(opcodeClose, payload)
+			return io.EOF
+		case opcodePing:
+			if err := c.writeFrame(opcodePong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readFrame reads a frame of the client, which must be masked
+func (c *websocketConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("Unmasked frame from the client")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > websocketMaxFrameSize {
+		return 0, nil, fmt.Errorf("Frame of %d bytes too large", length)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// Close closes the connection
+func (c *websocketConn) Close() error {
+	return c.conn.Close()
+}